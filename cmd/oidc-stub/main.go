@@ -0,0 +1,34 @@
+// Command oidc-stub runs a fake OpenID Connect provider that logs everyone in as the configured user. Point
+// OIDC_ISSUER_URL at it to try the OpenID Connect login offline.
+package main
+
+import (
+	"flag"
+	"github.com/rs/zerolog/log"
+	"pinman/internal/clients/oidc/testidp"
+)
+
+func main() {
+	addr := flag.String("addr", ":8082", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:8082", "URL the provider is reachable at")
+	clientID := flag.String("client-id", "pinman", "client id pinman is configured with")
+	clientSecret := flag.String("client-secret", "secret", "client secret pinman is configured with")
+	email := flag.String("email", "player@example.com", "email address of the user everyone is logged in as")
+	name := flag.String("name", "Test Player", "name of the user everyone is logged in as")
+	flag.Parse()
+
+	provider, err := testidp.NewProvider(*issuer, *clientID, *clientSecret, testidp.User{
+		Subject:       *email,
+		Email:         *email,
+		EmailVerified: true,
+		Name:          *name,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not create provider")
+	}
+
+	log.Info().Str("addr", *addr).Str("issuer", provider.Issuer).Msg("starting OpenID Connect stub")
+	if err := provider.NewRouter().Run(*addr); err != nil {
+		log.Fatal().Err(err).Msg("OpenID Connect stub could not be started")
+	}
+}
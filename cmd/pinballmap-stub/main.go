@@ -0,0 +1,24 @@
+// Command pinballmap-stub runs a fake Pinball Map API. Point PINBALLMAP_URL at it to run pinman offline.
+package main
+
+import (
+	"flag"
+	"github.com/rs/zerolog/log"
+	"pinman/internal/clients/pinballmap/stub"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	fixturesPath := flag.String("fixtures", "", "path to a fixtures file, the bundled fixtures are used when empty")
+	flag.Parse()
+
+	fixtures, err := stub.LoadFixtures(*fixturesPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not load fixtures")
+	}
+
+	log.Info().Str("addr", *addr).Int("locations", len(fixtures.Locations)).Msg("starting pinball map stub")
+	if err := stub.NewRouter(fixtures).Run(*addr); err != nil {
+		log.Fatal().Err(err).Msg("pinball map stub could not be started")
+	}
+}
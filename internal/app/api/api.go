@@ -2,19 +2,33 @@ package api
 
 import (
 	"fmt"
-	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pinman/internal/app/api/auth"
 	"pinman/internal/app/api/league"
 	"pinman/internal/app/api/location"
+	"pinman/internal/app/api/slug"
 	"pinman/internal/app/api/tournament"
 	"pinman/internal/app/api/user"
+	"pinman/internal/app/generated"
+	"pinman/internal/clients/oidc"
+	"pinman/internal/clients/pinballmap"
+	"pinman/internal/mailer"
+	"pinman/internal/models"
 	"pinman/internal/utils"
 )
 
 type AuthHandlers struct {
-	Login   gin.HandlerFunc
-	Refresh gin.HandlerFunc
+	Login         gin.HandlerFunc
+	Refresh       gin.HandlerFunc
+	Logout        gin.HandlerFunc
+	OIDCAuthorize gin.HandlerFunc
+	OIDCCallback  gin.HandlerFunc
+	// TwoFactorEnroll and TwoFactorVerify finish logins that were answered with a two-factor challenge
+	TwoFactorEnroll gin.HandlerFunc
+	TwoFactorVerify gin.HandlerFunc
+	// Authenticate authenticates requests to public endpoints that require scopes for some parameters
+	Authenticate func(c *gin.Context, scopes ...string) bool
 }
 
 // Server
@@ -24,18 +38,33 @@ type Server struct {
 	League     *league.Controller
 	Location   *location.Controller
 	Tournament *tournament.Controller
+	Slug       *slug.Controller
 	AuthHandlers
 }
 
-func NewServer(db *gorm.DB, authMiddleware *jwt.GinJWTMiddleware) *Server {
+func NewServer(
+	config *utils.Config,
+	db *gorm.DB,
+	authMiddleware *auth.JWTMiddleware,
+	pmClient pinballmap.ClientInterface,
+	mailer mailer.Mailer,
+	oidcClient oidc.ClientInterface,
+) *Server {
 	server := &Server{
-		User:       user.NewController(db),
+		User:       user.NewController(db, config, mailer),
 		League:     league.NewController(db),
-		Location:   location.NewController(db),
+		Location:   location.NewControllerWithClient(db, pmClient),
 		Tournament: tournament.NewController(db),
+		Slug:       slug.NewController(db),
 		AuthHandlers: AuthHandlers{
-			Login:   authMiddleware.LoginHandler,
-			Refresh: authMiddleware.RefreshHandler,
+			Login:           authMiddleware.LoginHandler,
+			Refresh:         auth.GetRefreshHandlerFunc(authMiddleware, db, config),
+			Logout:          auth.GetLogoutHandlerFunc(authMiddleware, db),
+			OIDCAuthorize:   auth.GetOIDCAuthorizeHandlerFunc(oidcClient, config),
+			OIDCCallback:    auth.GetOIDCCallbackHandlerFunc(authMiddleware, db, oidcClient, config),
+			TwoFactorEnroll: auth.GetTwoFactorEnrollHandlerFunc(db, config),
+			TwoFactorVerify: auth.GetTwoFactorVerifyHandlerFunc(authMiddleware, db, config),
+			Authenticate:    auth.GetAuthenticateFunc(authMiddleware, db),
 		},
 	}
 	if err := utils.CheckFieldsForNil(server); err != nil {
@@ -49,10 +78,66 @@ func (s *Server) PostAuthLogin(c *gin.Context) {
 	s.AuthHandlers.Login(c)
 }
 
-func (s *Server) GetAuthRefresh(c *gin.Context) {
+func (s *Server) PostAuthRefresh(c *gin.Context) {
 	s.AuthHandlers.Refresh(c)
 }
 
+func (s *Server) PostAuthLogout(c *gin.Context) {
+	s.AuthHandlers.Logout(c)
+}
+
+func (s *Server) GetAuthOidcAuthorize(c *gin.Context) {
+	s.AuthHandlers.OIDCAuthorize(c)
+}
+
+func (s *Server) PostAuthOidcCallback(c *gin.Context) {
+	s.AuthHandlers.OIDCCallback(c)
+}
+
+func (s *Server) PostAuth2faEnroll(c *gin.Context) {
+	s.AuthHandlers.TwoFactorEnroll(c)
+}
+
+func (s *Server) PostAuth2faVerify(c *gin.Context) {
+	s.AuthHandlers.TwoFactorVerify(c)
+}
+
+func (s *Server) PostAuthPasswordForgot(c *gin.Context) {
+	s.User.ForgotPassword(c)
+}
+
+func (s *Server) PostAuthPasswordReset(c *gin.Context) {
+	s.User.ResetPassword(c)
+}
+
+func (s *Server) PostUsersMePassword(c *gin.Context) {
+	s.User.ChangePassword(c)
+}
+
+func (s *Server) GetUsersMeSessions(c *gin.Context) {
+	s.User.ListSessions(c)
+}
+
+func (s *Server) DeleteUsersMeSessions(c *gin.Context) {
+	s.User.RevokeOtherSessions(c)
+}
+
+func (s *Server) DeleteUsersMeSessionsId(c *gin.Context, id string) {
+	s.User.RevokeSession(c, id)
+}
+
+func (s *Server) GetUsersMeTokens(c *gin.Context) {
+	s.User.ListAPITokens(c)
+}
+
+func (s *Server) PostUsersMeTokens(c *gin.Context) {
+	s.User.CreateAPIToken(c)
+}
+
+func (s *Server) DeleteUsersMeTokensId(c *gin.Context, id string) {
+	s.User.RevokeAPIToken(c, id)
+}
+
 func (s *Server) PostUsersRegister(c *gin.Context) {
 	s.User.SignUpUser(c)
 }
@@ -61,20 +146,106 @@ func (s *Server) GetUsersMe(c *gin.Context) {
 	s.User.GetMe(c)
 }
 
-func (s *Server) PostLeagues(c *gin.Context) {
-	s.League.CreateLeague(c)
+func (s *Server) PatchUsersMe(c *gin.Context) {
+	s.User.UpdateMe(c)
+}
+
+func (s *Server) DeleteUsersMe(c *gin.Context) {
+	s.User.DeleteMe(c)
+}
+
+func (s *Server) GetUsersMeExport(c *gin.Context) {
+	s.User.ExportMe(c)
+}
+
+func (s *Server) PostUsersVerify(c *gin.Context) {
+	s.User.VerifyUser(c)
+}
+
+func (s *Server) PostUsersVerifyResend(c *gin.Context) {
+	s.User.ResendVerification(c)
+}
+
+func (s *Server) GetUsers(c *gin.Context, params generated.GetUsersParams) {
+	s.User.ListUsers(c, params)
+}
+
+func (s *Server) PutUsersIdRole(c *gin.Context, id string) {
+	s.User.ChangeRole(c, id)
+}
+
+func (s *Server) PostUsersIdDisable(c *gin.Context, id string) {
+	s.User.Disable(c, id)
+}
+
+func (s *Server) PostUsersIdEnable(c *gin.Context, id string) {
+	s.User.Enable(c, id)
 }
 
-func (s *Server) GetLeagues(c *gin.Context) {
-	s.League.ListLeagues(c)
+func (s *Server) GetUsersIdLogins(c *gin.Context, id string) {
+	s.User.ListLogins(c, id)
 }
 
-func (s *Server) GetLeaguesSlug(c *gin.Context, slug string) {
-	s.League.GetLeagueWithSlug(c, slug)
+func (s *Server) PostUsersIdUnlock(c *gin.Context, id string) {
+	s.User.Unlock(c, id)
 }
 
-func (s *Server) GetLocations(c *gin.Context) {
-	s.Location.ListLocations(c)
+func (s *Server) GetUsersMe2fa(c *gin.Context) {
+	s.User.GetTwoFactorStatus(c)
+}
+
+func (s *Server) PostUsersMe2fa(c *gin.Context) {
+	s.User.StartTwoFactor(c)
+}
+
+func (s *Server) PostUsersMe2faConfirm(c *gin.Context) {
+	s.User.ConfirmTwoFactor(c)
+}
+
+func (s *Server) PostUsersMe2faDisable(c *gin.Context) {
+	s.User.DisableTwoFactor(c)
+}
+
+func (s *Server) PostUsersMe2faRecoveryCodes(c *gin.Context) {
+	s.User.RegenerateRecoveryCodes(c)
+}
+
+func (s *Server) GetRolesRole(c *gin.Context, role string) {
+	s.User.GetRole(c, role)
+}
+
+func (s *Server) PutRolesRole(c *gin.Context, role string) {
+	s.User.UpdateRole(c, role)
+}
+
+func (s *Server) PostLeagues(c *gin.Context, params generated.PostLeaguesParams) {
+	s.League.CreateLeague(c, params)
+}
+
+func (s *Server) GetLeagues(c *gin.Context, params generated.GetLeaguesParams) {
+	if includesDeleted(params.IncludeDeleted) && !s.Authenticate(c, models.RoleAdmin) {
+		return
+	}
+	s.League.ListLeagues(c, params)
+}
+
+func (s *Server) GetLeaguesSlug(c *gin.Context, slug string, params generated.GetLeaguesSlugParams) {
+	s.League.GetLeagueWithSlug(c, slug, params)
+}
+
+func (s *Server) DeleteLeaguesSlug(c *gin.Context, slug string) {
+	s.League.DeleteLeague(c, slug)
+}
+
+func (s *Server) PostLeaguesSlugRestore(c *gin.Context, slug string) {
+	s.League.RestoreLeague(c, slug)
+}
+
+func (s *Server) GetLocations(c *gin.Context, params generated.GetLocationsParams) {
+	if includesDeleted(params.IncludeDeleted) && !s.Authenticate(c, models.RoleAdmin) {
+		return
+	}
+	s.Location.ListLocations(c, params)
 }
 
 func (s *Server) PostLocations(c *gin.Context) {
@@ -85,10 +256,46 @@ func (s *Server) GetLocationsSlug(c *gin.Context, slug string) {
 	s.Location.GetLocationWithSlug(c, slug)
 }
 
-func (s *Server) PostTournaments(c *gin.Context) {
-	s.Tournament.CreateTournament(c)
+func (s *Server) DeleteLocationsSlug(c *gin.Context, slug string) {
+	s.Location.DeleteLocation(c, slug)
+}
+
+func (s *Server) PostLocationsSlugRestore(c *gin.Context, slug string) {
+	s.Location.RestoreLocation(c, slug)
+}
+
+func (s *Server) PostLocationsSlugLink(c *gin.Context, slug string) {
+	s.Location.LinkLocation(c, slug)
+}
+
+func (s *Server) PostTournaments(c *gin.Context, params generated.PostTournamentsParams) {
+	s.Tournament.CreateTournament(c, params)
+}
+
+func (s *Server) GetTournaments(c *gin.Context, params generated.GetTournamentsParams) {
+	if includesDeleted(params.IncludeDeleted) && !s.Authenticate(c, models.RoleAdmin) {
+		return
+	}
+	s.Tournament.ListTournaments(c, params)
+}
+
+func (s *Server) GetTournamentsSlug(c *gin.Context, slug string, params generated.GetTournamentsSlugParams) {
+	s.Tournament.GetTournamentWithSlug(c, slug, params)
+}
+
+func (s *Server) DeleteTournamentsSlug(c *gin.Context, slug string) {
+	s.Tournament.DeleteTournament(c, slug)
+}
+
+func (s *Server) PostTournamentsSlugRestore(c *gin.Context, slug string) {
+	s.Tournament.RestoreTournament(c, slug)
+}
+
+func (s *Server) GetSlugsCheck(c *gin.Context, params generated.GetSlugsCheckParams) {
+	s.Slug.CheckSlug(c, params)
 }
 
-func (s *Server) GetTournaments(c *gin.Context) {
-	s.Tournament.ListTournaments(c)
+// includesDeleted returns whether a list request asks for deleted records as well, which only admins may see.
+func includesDeleted(includeDeleted *bool) bool {
+	return includeDeleted != nil && *includeDeleted
 }
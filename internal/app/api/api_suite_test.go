@@ -4,6 +4,10 @@ import (
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"gorm.io/gorm"
 	"pinman/internal/app/api"
+	"pinman/internal/app/api/auth"
+	"pinman/internal/clients/pinballmap"
+	"pinman/internal/mailer"
+	"pinman/internal/utils"
 	"testing"
 
 	"github.com/onsi/ginkgo/v2"
@@ -18,8 +22,12 @@ func TestApi(t *testing.T) {
 var _ = ginkgo.Describe("NewServer", func() {
 	ginkgo.It("should not return nil", func() {
 		server := api.NewServer(
+			&utils.Config{},
 			&gorm.DB{},
-			&jwt.GinJWTMiddleware{},
+			&auth.JWTMiddleware{GinJWTMiddleware: &jwt.GinJWTMiddleware{}},
+			pinballmap.NewClient(),
+			mailer.NewLogMailer(),
+			nil,
 		)
 		gomega.Expect(server).NotTo(gomega.BeNil())
 	})
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"net/http"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"strings"
+	"time"
+)
+
+const (
+	// APITokenPrefix starts every personal API token, which tells them apart from JWTs in the Authorization header.
+	APITokenPrefix = "pm_"
+	// ScopeLeague is an auth scope marking endpoints that call AuthorizeLeague, only those accept API tokens that
+	// are restricted to a league.
+	ScopeLeague = "league"
+	// APITokenKey is the context key of the API token a request was authenticated with.
+	APITokenKey = "apiToken"
+
+	// last_used_at is only written once per interval, so busy scripts don't cause a write on every request
+	apiTokenLastUsedInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIToken    = fmt.Errorf("invalid, expired or revoked API token")
+	ErrAPITokenReadOnly   = fmt.Errorf("API token is read-only")
+	ErrAPITokenLeague     = fmt.Errorf("API token is restricted to another league")
+	ErrAPITokenNotAllowed = fmt.Errorf("endpoint can't be used with an API token")
+)
+
+// GenerateAPIToken returns a new random personal API token.
+func GenerateAPIToken() (string, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	return APITokenPrefix + token, nil
+}
+
+// GetAPIToken returns the API token the request was authenticated with, or nil for requests using a JWT.
+func GetAPIToken(ctx *gin.Context) *models.APIToken {
+	if token, ok := ctx.Get(APITokenKey); ok {
+		return token.(*models.APIToken)
+	}
+
+	return nil
+}
+
+// RevokeAPITokens revokes every API token of the user.
+func RevokeAPITokens(db *gorm.DB, userID uuid.UUID) error {
+	return db.Model(&models.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeLeagueAPITokens revokes every API token that is restricted to the league.
+func RevokeLeagueAPITokens(db *gorm.DB, leagueID uuid.UUID) error {
+	return db.Model(&models.APIToken{}).
+		Where("league_id = ? AND revoked_at IS NULL", leagueID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// AuthorizeLeague fails if the request was made with an API token that is restricted to a different league.
+func AuthorizeLeague(ctx *gin.Context, leagueID uuid.UUID) error {
+	token := GetAPIToken(ctx)
+	if token != nil && token.LeagueID != nil && *token.LeagueID != leagueID {
+		return ErrAPITokenLeague
+	}
+
+	return nil
+}
+
+func getAPITokenFromHeader(c *gin.Context) (string, bool) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return token, strings.HasPrefix(token, APITokenPrefix)
+}
+
+// authenticateAPIToken does for API tokens what the JWT middleware does for JWTs: it sets the user of the token in
+// the context and checks the scopes of the endpoint, plus the restrictions of the token.
+func authenticateAPIToken(db *gorm.DB, c *gin.Context, plainToken string) {
+	token := &models.APIToken{}
+	err := db.Preload("User").First(token, "token_hash = ?", utils.HashOpaqueToken(plainToken)).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Err(err).Msg("failed to look up API token")
+		}
+		unauthorizedFunc(c, http.StatusUnauthorized, ErrInvalidAPIToken.Error())
+		return
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && now.After(*token.ExpiresAt)) {
+		unauthorizedFunc(c, http.StatusUnauthorized, ErrInvalidAPIToken.Error())
+		return
+	}
+
+	if token.ReadOnly && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		unauthorizedFunc(c, http.StatusForbidden, ErrAPITokenReadOnly.Error())
+		return
+	}
+
+	if token.LeagueID != nil && !hasScope(c, ScopeLeague) {
+		unauthorizedFunc(c, http.StatusForbidden, ErrAPITokenLeague.Error())
+		return
+	}
+
+	c.Set(IdentityKey, &token.User)
+	c.Set(APITokenKey, token)
+	if !authorizationFunc(&token.User, c) {
+		unauthorizedFunc(c, http.StatusForbidden, httpStatusMessageFunc(jwt.ErrForbidden, c))
+		return
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenLastUsedInterval {
+		err := db.Model(&models.APIToken{}).Where("id = ?", token.ID).Update("last_used_at", now).Error
+		if err != nil {
+			log.Err(err).Str("apiTokenId", token.ID.String()).Msg("failed to update last use of API token")
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"pinman/internal/models"
+)
+
+// WriteAuditLog records the event along with the IP address of the request. Failing to record it is only logged,
+// it shouldn't fail the request.
+func WriteAuditLog(db *gorm.DB, ctx *gin.Context, entry *models.AuditLog) {
+	entry.IPAddress = ctx.ClientIP()
+	log.Warn().Str("action", entry.Action).Str("ip", entry.IPAddress).Msg(entry.Detail)
+
+	if err := db.Create(entry).Error; err != nil {
+		log.Err(err).Str("action", entry.Action).Msg("failed to write audit log")
+	}
+}
+
+// writeFailedLogin adds a failed login to the login history of the user.
+func writeFailedLogin(db *gorm.DB, ctx *gin.Context, user *models.User, reason string) {
+	WriteAuditLog(db, ctx, &models.AuditLog{
+		Action: models.AuditActionLoginFailed,
+		UserID: &user.ID,
+		Detail: fmt.Sprintf("failed login for %s: %s", user.Email, reason),
+	})
+}
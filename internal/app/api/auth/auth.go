@@ -1,10 +1,10 @@
 package auth
 
 import (
-	"encoding/base64"
 	"fmt"
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 	"net/http"
@@ -18,37 +18,53 @@ import (
 
 const (
 	IdentityKey = "user"
+	// ScopeVerified is an auth scope that, unlike the role scopes, requires the user to have verified their email.
+	ScopeVerified = "verified"
+
+	authErrorKey = "authError"
+)
+
+var (
+	ErrEmailNotVerified = fmt.Errorf("email address has not been verified")
+	ErrTokenRevoked     = fmt.Errorf("token has been revoked, please log in again")
+	ErrAccountDisabled  = fmt.Errorf("account has been disabled")
 )
 
-func CreateJWTMiddleware(config *utils.Config, db *gorm.DB) (*jwt.GinJWTMiddleware, error) {
-	tokenPublicKey, err := base64.StdEncoding.DecodeString(config.TokenPublicKey)
+// JWTMiddleware is the gin-jwt middleware with access tokens signed by a KeySet. gin-jwt neither sets kid headers nor
+// verifies tokens with more than one key, so tokens are issued by TokenGenerator and LoginHandler here instead.
+type JWTMiddleware struct {
+	*jwt.GinJWTMiddleware
+	Keys    *KeySet
+	cookies *tokenCookies
+}
+
+func CreateJWTMiddleware(config *utils.Config, db *gorm.DB) (*JWTMiddleware, error) {
+	keys, err := NewKeySet(config)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode public key: %v", err)
+		return nil, err
 	}
 
-	tokenPrivateKey, err := base64.StdEncoding.DecodeString(config.TokenPrivateKey)
+	cookies, err := newTokenCookies(config)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode private key: %v", err)
+		return nil, err
 	}
 
 	// the jwt middleware
 	authMiddleware, err := jwt.New(&jwt.GinJWTMiddleware{
-		Realm:           "pinman",
-		Key:             []byte(config.TokenSecretKey),
-		Timeout:         config.TokenExpiresAfter,
-		MaxRefresh:      config.TokenExpiresAfter,
-		PubKeyBytes:     tokenPublicKey,
-		PrivKeyBytes:    tokenPrivateKey,
-		IdentityKey:     IdentityKey,
-		PayloadFunc:     payloadFunc,
-		IdentityHandler: getIdentityHandlerFunc(db),
-		Authenticator:   getAuthenticatorFunc(db),
-		Unauthorized:    unauthorizedFunc,
-		Authorizator:    authorizationFunc,
-		LoginResponse:   loginResponseFunc,
-		RefreshResponse: refreshResponseFunc,
-		TokenLookup:     "header:Authorization",
-		TokenHeadName:   "Bearer",
+		Realm:                 "pinman",
+		SigningAlgorithm:      gojwt.SigningMethodRS256.Alg(),
+		KeyFunc:               keys.keyFunc,
+		Timeout:               config.TokenExpiresAfter,
+		IdentityKey:           IdentityKey,
+		PayloadFunc:           payloadFunc,
+		IdentityHandler:       getIdentityHandlerFunc(db),
+		Authenticator:         getAuthenticatorFunc(db, config, newLoginLimiter(db, config)),
+		Unauthorized:          unauthorizedFunc,
+		Authorizator:          authorizationFunc,
+		LoginResponse:         getLoginResponseFunc(cookies),
+		HTTPStatusMessageFunc: httpStatusMessageFunc,
+		TokenLookup:           cookies.tokenLookup(),
+		TokenHeadName:         "Bearer",
 
 		// TimeFunc provides the current time. You can override it to use another time value. This is useful for testing or if your server uses a different time zone than your tokens.
 		TimeFunc: time.Now,
@@ -58,7 +74,58 @@ func CreateJWTMiddleware(config *utils.Config, db *gorm.DB) (*jwt.GinJWTMiddlewa
 		return nil, fmt.Errorf("failed to create middleware: %v", err)
 	}
 
-	return authMiddleware, nil
+	return &JWTMiddleware{GinJWTMiddleware: authMiddleware, Keys: keys, cookies: cookies}, nil
+}
+
+// TokenGenerator returns an access token for data signed with the active key.
+func (mw *JWTMiddleware) TokenGenerator(data interface{}) (string, time.Time, error) {
+	claims := gojwt.MapClaims{}
+	for key, value := range mw.PayloadFunc(data) {
+		claims[key] = value
+	}
+
+	expire := mw.TimeFunc().Add(mw.Timeout)
+	claims["exp"] = expire.Unix()
+	claims["orig_iat"] = mw.TimeFunc().Unix()
+	token, err := mw.Keys.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expire, nil
+}
+
+// LoginHandler authenticates the user and responds with an access token, like the gin-jwt handler does.
+func (mw *JWTMiddleware) LoginHandler(c *gin.Context) {
+	data, err := mw.Authenticator(c)
+	if err != nil {
+		mw.unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(err, c))
+		return
+	}
+
+	token, expire, err := mw.TokenGenerator(data)
+	if err != nil {
+		log.Err(err).Msg("failed to sign access token")
+		mw.unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return
+	}
+
+	mw.LoginResponse(c, http.StatusOK, token, expire)
+}
+
+func (mw *JWTMiddleware) unauthorized(c *gin.Context, code int, message string) {
+	c.Header("WWW-Authenticate", "JWT realm="+mw.Realm)
+	c.Abort()
+	mw.Unauthorized(c, code, message)
+}
+
+// GetJWKSHandlerFunc publishes the public keys access tokens are verified with, so other services can verify them.
+func GetJWKSHandlerFunc(mw *JWTMiddleware) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// verifiers are expected to fetch the keys again when they see an unknown kid after a rotation
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, mw.Keys.jwks())
+	}
 }
 
 func GetUser(ctx *gin.Context) (*models.User, error) {
@@ -70,19 +137,43 @@ func GetUser(ctx *gin.Context) (*models.User, error) {
 	return user.(*models.User), nil
 }
 
-func GetAuthMiddlewareFunc(mw *jwt.GinJWTMiddleware) func(c *gin.Context) {
+func GetAuthMiddlewareFunc(mw *JWTMiddleware, db *gorm.DB) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		// Only run the JWT middleware if auth scopes are required for the endpoint
 		if _, ok := c.Get(generated.PinmanAuthScopes); ok {
-			mw.MiddlewareFunc()(c)
+			if token, ok := getAPITokenFromHeader(c); ok {
+				authenticateAPIToken(db, c, token)
+			} else if mw.cookies.authenticatesWithCookie(c) && !verifyCSRFToken(c) {
+				errors.AbortWithError(http.StatusForbidden, ErrInvalidCSRFToken.Error(), c)
+			} else {
+				mw.MiddlewareFunc()(c)
+			}
 		}
 		c.Next()
 		return
 	}
 }
 
+// GetAuthenticateFunc returns a function that authenticates requests to public endpoints which only require the scopes
+// for some parameters, like admins listing deleted records. It aborts the request and returns false if the request
+// lacks the scopes.
+func GetAuthenticateFunc(mw *JWTMiddleware, db *gorm.DB) func(c *gin.Context, scopes ...string) bool {
+	authenticate := GetAuthMiddlewareFunc(mw, db)
+	return func(c *gin.Context, scopes ...string) bool {
+		c.Set(generated.PinmanAuthScopes, scopes)
+		authenticate(c)
+		return !c.IsAborted()
+	}
+}
+
 func payloadFunc(data interface{}) jwt.MapClaims {
-	if v, ok := data.(*models.User); ok {
+	switch v := data.(type) {
+	case *models.Session:
+		return jwt.MapClaims{
+			IdentityKey:  v.UserID.String(),
+			SessionIDKey: v.ID.String(),
+		}
+	case *models.User:
 		return jwt.MapClaims{
 			IdentityKey: v.ID.String(),
 		}
@@ -91,15 +182,65 @@ func payloadFunc(data interface{}) jwt.MapClaims {
 }
 
 func unauthorizedFunc(c *gin.Context, code int, message string) {
+	// the login handler responds to every failed login with 401, throttled ones are told when to try again instead
+	if retryAfter, ok := c.Get(retryAfterKey); ok {
+		abortTooManyAttempts(c, retryAfter.(time.Duration))
+		return
+	}
+	// and a correct password of a user with two-factor authentication is answered with the challenge
+	if challenge, ok := c.Get(twoFactorChallengeKey); ok {
+		c.Writer.Header().Del("WWW-Authenticate")
+		c.AbortWithStatusJSON(http.StatusAccepted, challenge)
+		return
+	}
+
 	errors.AbortWithError(code, message, c)
 	return
 }
 
+// httpStatusMessageFunc explains why a request was forbidden when authorizationFunc gave a reason.
+func httpStatusMessageFunc(e error, c *gin.Context) string {
+	if e == jwt.ErrForbidden {
+		if reason, ok := c.Get(authErrorKey); ok {
+			return reason.(error).Error()
+		}
+	}
+	return e.Error()
+}
+
 func authorizationFunc(data interface{}, c *gin.Context) bool {
 	if scopes, ok := c.Get(generated.PinmanAuthScopes); ok {
 		if user, ok := data.(*models.User); ok {
-			for _, scope := range scopes.([]string) {
-				if user.Role == scope {
+			if user.DisabledAt != nil {
+				c.Set(authErrorKey, ErrAccountDisabled)
+				c.Abort()
+				return false
+			}
+
+			scopes := scopes.([]string)
+			var roles []string
+			for _, scope := range scopes {
+				if scope == ScopeVerified {
+					if !user.Verified {
+						c.Set(authErrorKey, ErrEmailNotVerified)
+						c.Abort()
+						return false
+					}
+					continue
+				}
+				if scope == ScopeLeague {
+					continue
+				}
+				roles = append(roles, scope)
+			}
+
+			// endpoints that only require a verified email address are open to every role
+			if len(roles) == 0 && len(scopes) > 0 {
+				return true
+			}
+			// every role includes the ones below it, so admins can use the endpoints of organizers and users
+			for _, role := range roles {
+				if models.RoleIncludes(user.Role, role) {
 					return true
 				}
 			}
@@ -114,18 +255,45 @@ func authorizationFunc(data interface{}, c *gin.Context) bool {
 	return true
 }
 
-func loginResponseFunc(c *gin.Context, _ int, token string, expire time.Time) {
-	c.JSON(http.StatusOK, generated.TokenResponse{
-		AccessToken: token,
-		Expire:      expire.Format(time.RFC3339),
-	})
+func hasScope(c *gin.Context, scope string) bool {
+	if scopes, ok := c.Get(generated.PinmanAuthScopes); ok {
+		for _, s := range scopes.([]string) {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func refreshResponseFunc(c *gin.Context, _ int, token string, expire time.Time) {
-	c.JSON(http.StatusOK, generated.TokenResponse{
-		AccessToken: token,
-		Expire:      expire.Format(time.RFC3339),
-	})
+// getLoginResponseFunc returns the function responding with the tokens of logins and refreshes, the refresh token is
+// taken from the context.
+func getLoginResponseFunc(cookies *tokenCookies) func(c *gin.Context, _ int, token string, expire time.Time) {
+	return func(c *gin.Context, _ int, token string, expire time.Time) {
+		response := generated.TokenResponse{
+			Expire: expire.Format(time.RFC3339),
+		}
+		refreshToken := c.GetString(refreshTokenKey)
+		if cookies.enabled() {
+			csrfToken, err := cookies.set(c, token, expire, refreshToken)
+			if err != nil {
+				errors.AbortWithError(http.StatusInternalServerError, jwt.ErrFailedTokenCreation.Error(), c)
+				return
+			}
+			response.CsrfToken = &csrfToken
+		}
+		if cookies.tokensInBody() {
+			response.AccessToken = &token
+			if refreshToken != "" {
+				response.RefreshToken = &refreshToken
+			}
+		}
+		if codes, ok := c.Get(recoveryCodesKey); ok && codes != nil {
+			recoveryCodes := codes.([]string)
+			response.RecoveryCodes = &recoveryCodes
+		}
+		c.JSON(http.StatusOK, response)
+	}
 }
 
 func getIdentityHandlerFunc(db *gorm.DB) func(c *gin.Context) interface{} {
@@ -138,11 +306,30 @@ func getIdentityHandlerFunc(db *gorm.DB) func(c *gin.Context) interface{} {
 			return nil
 		}
 
+		// logging out or revoking the session invalidates the access tokens issued for it
+		if sid, ok := claims[SessionIDKey]; ok {
+			session := &models.Session{}
+			result := db.First(session, "id = ? AND user_id = ?", sid, user.ID)
+			if result.Error != nil || session.RevokedAt != nil {
+				c.Set(authErrorKey, ErrTokenRevoked)
+				return nil
+			}
+		}
+
+		// changing the password signs the user out everywhere
+		if user.PasswordChangedAt != nil {
+			issuedAt, ok := claims["orig_iat"].(float64)
+			if !ok || int64(issuedAt) < user.PasswordChangedAt.Unix() {
+				c.Set(authErrorKey, ErrTokenRevoked)
+				return nil
+			}
+		}
+
 		return user
 	}
 }
 
-func getAuthenticatorFunc(db *gorm.DB) func(ctx *gin.Context) (interface{}, error) {
+func getAuthenticatorFunc(db *gorm.DB, config *utils.Config, limiter *loginLimiter) func(ctx *gin.Context) (interface{}, error) {
 	return func(ctx *gin.Context) (interface{}, error) {
 		payload := &generated.UserLogin{}
 
@@ -157,18 +344,84 @@ func getAuthenticatorFunc(db *gorm.DB) func(ctx *gin.Context) (interface{}, erro
 			return nil, fmt.Errorf("unsuported content-type")
 		}
 
+		if retryAfter := limiter.retryAfter(ctx, payload.Username); retryAfter > 0 {
+			ctx.Set(retryAfterKey, retryAfter)
+			return nil, ErrTooManyLoginAttempts
+		}
+
 		user := &models.User{}
 		result := db.First(user, "email = ?", strings.ToLower(payload.Username))
 		if result.Error != nil {
+			utils.VerifyDummyPassword(payload.Password)
 			log.Err(result.Error).Msg("failed to authenticate user - database query failed")
+			limiter.fail(ctx, payload.Username, nil)
 			return nil, jwt.ErrFailedAuthentication
 		}
 
-		if err := utils.VerifyPassword(user.Password, payload.Password); err != nil {
+		if err := verifyPassword(user, payload.Password); err != nil {
 			log.Err(jwt.ErrFailedAuthentication).Str("userId", user.ID.String()).Msg("invalid password")
+			writeFailedLogin(db, ctx, user, "invalid password")
+			limiter.fail(ctx, payload.Username, user)
 			return nil, jwt.ErrFailedAuthentication
 		}
 
-		return user, nil
+		if user.DisabledAt != nil {
+			writeFailedLogin(db, ctx, user, ErrAccountDisabled.Error())
+			return nil, ErrAccountDisabled
+		}
+		rehashPassword(db, user, payload.Password)
+
+		// the failed logins are only forgotten once the second factor is verified too, or knowing the password
+		// would allow guessing codes endlessly
+		challenge, err := newTwoFactorChallenge(db, config, user)
+		if err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to look up two-factor authentication")
+			return nil, jwt.ErrFailedTokenCreation
+		}
+		if challenge != nil {
+			ctx.Set(twoFactorChallengeKey, challenge)
+			return nil, errTwoFactorChallenge
+		}
+		limiter.succeed(payload.Username)
+
+		session, refreshToken, err := startSession(db, ctx, user, config.RefreshTokenExpiresAfter)
+		if err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to start session")
+			return nil, jwt.ErrFailedTokenCreation
+		}
+		ctx.Set(refreshTokenKey, refreshToken)
+
+		return session, nil
+	}
+}
+
+// verifyPassword checks the password of a user who is logging in. Users who only log in with an identity provider
+// have no password, which must take as long to find out as a wrong password.
+func verifyPassword(user *models.User, password string) error {
+	if user.Password == "" {
+		utils.VerifyDummyPassword(password)
+		return utils.ErrPasswordMismatch
+	}
+
+	return utils.VerifyPassword(user.Password, password)
+}
+
+// rehashPassword hashes the password of a user that just logged in again if it was hashed with an outdated algorithm
+// or cost. The login goes on if it fails, it is tried again on the next one.
+func rehashPassword(db *gorm.DB, user *models.User, password string) {
+	if !utils.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to rehash password")
+		return
+	}
+	// unlike a new password, this must not revoke the sessions of the user
+	if err := db.Model(user).UpdateColumn("password", hashedPassword).Error; err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to rehash password")
+		return
 	}
+	log.Info().Str("userId", user.ID.String()).Str("algorithm", utils.PasswordHashing.Algorithm()).Msg("rehashed password")
 }
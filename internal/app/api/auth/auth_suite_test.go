@@ -2,18 +2,25 @@ package auth_test
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
-	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"pinman/internal/app/api/auth"
 	"pinman/internal/app/generated"
+	"pinman/internal/clients/oidc"
 	"pinman/internal/models"
 	"pinman/internal/utils"
 	"regexp"
@@ -23,6 +30,7 @@ import (
 
 	g "github.com/onsi/ginkgo/v2"
 	m "github.com/onsi/gomega"
+	testify "github.com/stretchr/testify/mock"
 )
 
 func TestAuth(t *testing.T) {
@@ -60,7 +68,7 @@ var _ = g.Describe("JWTMiddleware", func() {
 		var mock sqlmock.Sqlmock
 		var rr *httptest.ResponseRecorder
 		var router *gin.Engine
-		var mw *jwt.GinJWTMiddleware
+		var mw *auth.JWTMiddleware
 
 		var payload = &generated.UserLogin{
 			Username: "email@example.com",
@@ -108,6 +116,8 @@ var _ = g.Describe("JWTMiddleware", func() {
 				),
 			).WithArgs(strings.ToLower(payload.Username)).
 				WillReturnRows(rows)
+			expectNoTwoFactor(mock, user.ID)
+			expectStartSession(mock, user.ID)
 
 			body, err := json.Marshal(payload)
 			m.Expect(err).To(m.BeNil())
@@ -123,8 +133,10 @@ var _ = g.Describe("JWTMiddleware", func() {
 
 			response := generated.TokenResponse{}
 			m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
-			m.Expect(response.AccessToken).ToNot(m.BeEmpty())
+			m.Expect(response.AccessToken).To(m.HaveValue(m.Not(m.BeEmpty())))
 			m.Expect(response.Expire).ToNot(m.BeEmpty())
+			m.Expect(response.RefreshToken).ToNot(m.BeNil())
+			m.Expect(*response.RefreshToken).ToNot(m.BeEmpty())
 		})
 
 		g.It("should be successful for urlencoded request with valid credentials", func() {
@@ -134,6 +146,8 @@ var _ = g.Describe("JWTMiddleware", func() {
 				),
 			).WithArgs(strings.ToLower(payload.Username)).
 				WillReturnRows(rows)
+			expectNoTwoFactor(mock, user.ID)
+			expectStartSession(mock, user.ID)
 
 			body := url.Values{}
 			body.Set("username", payload.Username)
@@ -151,10 +165,71 @@ var _ = g.Describe("JWTMiddleware", func() {
 
 			response := generated.TokenResponse{}
 			m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
-			m.Expect(response.AccessToken).ToNot(m.BeEmpty())
+			m.Expect(response.AccessToken).To(m.HaveValue(m.Not(m.BeEmpty())))
 			m.Expect(response.Expire).ToNot(m.BeEmpty())
 		})
 
+		g.It("should rehash a password hashed with an outdated algorithm", func() {
+			legacyHash, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.MinCost)
+			m.Expect(err).To(m.BeNil())
+			mock.ExpectQuery(
+				regexp.QuoteMeta(
+					`SELECT * FROM "users" WHERE email = $1 ORDER BY "users"."id" LIMIT 1`,
+				),
+			).WithArgs(strings.ToLower(payload.Username)).
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(
+					user.ID, user.Name, user.Email, user.CreatedAt, user.UpdatedAt, string(legacyHash), user.Role,
+					user.Verified,
+				))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "password"=$1 WHERE "id" = $2`)).
+				WithArgs(utils.AnyString{}, user.ID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			expectNoTwoFactor(mock, user.ID)
+			expectStartSession(mock, user.ID)
+
+			body, err := json.Marshal(payload)
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+
+			req.Header.Set("Content-Type", "application/json")
+			router.POST("/", mw.LoginHandler)
+			router.ServeHTTP(rr, req)
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("should return as unauthorized for a disabled account", func() {
+			mock.ExpectQuery(
+				regexp.QuoteMeta(
+					`SELECT * FROM "users" WHERE email = $1 ORDER BY "users"."id" LIMIT 1`,
+				),
+			).WithArgs(strings.ToLower(payload.Username)).
+				WillReturnRows(sqlmock.NewRows(append(columns, "disabled_at")).AddRow(
+					user.ID, user.Name, user.Email, user.CreatedAt, user.UpdatedAt, user.Password, user.Role,
+					user.Verified, time.Now(),
+				))
+			expectAuditLog(mock, models.AuditActionLoginFailed, user.ID)
+
+			body, err := json.Marshal(payload)
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+
+			req.Header.Set("Content-Type", "application/json")
+			router.POST("/", mw.LoginHandler)
+			router.ServeHTTP(rr, req)
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			response := &generated.ErrorResponse{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+			m.Expect(response.Detail).To(m.Equal(auth.ErrAccountDisabled.Error()))
+		})
+
 		g.It("should return as unauthorized for invalid password", func() {
 			payload.Password = "wrong password"
 			mock.ExpectQuery(
@@ -163,6 +238,7 @@ var _ = g.Describe("JWTMiddleware", func() {
 				),
 			).WithArgs(strings.ToLower(payload.Username)).
 				WillReturnRows(rows)
+			expectAuditLog(mock, models.AuditActionLoginFailed, user.ID)
 
 			body, err := json.Marshal(payload)
 			m.Expect(err).To(m.BeNil())
@@ -246,56 +322,541 @@ var _ = g.Describe("JWTMiddleware", func() {
 		})
 	})
 
-	g.When("RefreshHandler receives a request", func() {
+	g.When("LoginHandler receives requests after failed logins", func() {
 		var db *gorm.DB
+		var mock sqlmock.Sqlmock
 		var rr *httptest.ResponseRecorder
 		var router *gin.Engine
-		var mw *jwt.GinJWTMiddleware
+		var mw *auth.JWTMiddleware
 		var user *models.User
-		var token string
+
+		const sqlSelectFailures = `SELECT * FROM "failed_logins" WHERE key IN ($1,$2)`
+		const sqlSelectUser = `SELECT * FROM "users" WHERE email = $1 ORDER BY "users"."id" LIMIT 1`
+		const sqlCountFailure = `INSERT INTO "failed_logins" ("key","count","last_failed_at") VALUES ($1,$2,$3) ON CONFLICT ("key") DO UPDATE SET "count"=CASE WHEN failed_logins.last_failed_at < $4 THEN 1 ELSE failed_logins.count + 1 END,"last_failed_at"=$5 RETURNING *`
+		const sqlInsertAuditLog = `INSERT INTO "audit_logs" ("action","user_id","actor_id","ip_address","detail","created_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+
+		limitedConfig := &utils.Config{
+			TokenSecretKey:        "asecretkey",
+			LoginMaxFailures:      5,
+			LoginMaxFailuresPerIP: 50,
+			LoginLockoutDuration:  15 * time.Minute,
+		}
+
+		var doLogin = func(password string) {
+			body, err := json.Marshal(generated.UserLogin{Username: user.Email, Password: password})
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = "192.0.2.1:1234"
+
+			router.POST("/", mw.LoginHandler)
+			router.ServeHTTP(rr, req)
+		}
+
+		var expectFailures = func(rows *sqlmock.Rows) {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectFailures)).
+				WithArgs("account:email@example.com", "ip:192.0.2.1").
+				WillReturnRows(rows)
+		}
+
+		var expectCountFailure = func(key string, count int) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlCountFailure)).
+				WithArgs(key, 1, utils.AnyTime{}, utils.AnyTime{}, utils.AnyTime{}).
+				WillReturnRows(sqlmock.NewRows([]string{"key", "count", "last_failed_at"}).AddRow(key, count, time.Now()))
+			mock.ExpectCommit()
+		}
 
 		g.BeforeEach(func() {
-			db, _ = utils.NewGormMock()
+			db, mock = utils.NewGormMock()
 			_, rr, router = utils.NewGinTestCtx()
 			var err error
-			mw, err = auth.CreateJWTMiddleware(config, db)
+			mw, err = auth.CreateJWTMiddleware(limitedConfig, db)
 			m.Expect(err).To(m.BeNil())
 
-			uid, err := uuid.NewUUID()
+			hashedPass, err := utils.HashPassword("password")
+			m.Expect(err).To(m.BeNil())
+			user = &models.User{
+				ID:       uuid.New(),
+				Email:    "email@example.com",
+				Password: hashedPass,
+				Role:     "user",
+			}
+		})
+
+		g.It("forgets the failed logins of the account after a successful login", func() {
+			expectFailures(sqlmock.NewRows([]string{"key", "count", "last_failed_at"}).
+				AddRow("account:email@example.com", 2, time.Now().Add(-time.Minute)))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUser)).
+				WithArgs(user.Email).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "role"}).
+					AddRow(user.ID, user.Email, user.Password, user.Role))
+			expectNoTwoFactor(mock, user.ID)
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "failed_logins" WHERE key = $1`)).
+				WithArgs("account:email@example.com").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			expectStartSession(mock, user.ID)
+
+			doLogin("password")
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("counts failed logins for the account and the IP address", func() {
+			expectFailures(sqlmock.NewRows([]string{"key", "count", "last_failed_at"}))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUser)).
+				WithArgs(user.Email).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "role"}).
+					AddRow(user.ID, user.Email, user.Password, user.Role))
+			expectAuditLog(mock, models.AuditActionLoginFailed, user.ID)
+			expectCountFailure("account:email@example.com", 1)
+			expectCountFailure("ip:192.0.2.1", 1)
+
+			doLogin("wrong password")
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("locks the account and writes an audit log when it reaches the limit", func() {
+			expectFailures(sqlmock.NewRows([]string{"key", "count", "last_failed_at"}).
+				AddRow("account:email@example.com", 4, time.Now().Add(-time.Minute)))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUser)).
+				WithArgs(user.Email).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "role"}).
+					AddRow(user.ID, user.Email, user.Password, user.Role))
+			expectAuditLog(mock, models.AuditActionLoginFailed, user.ID)
+			expectCountFailure("account:email@example.com", 5)
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlInsertAuditLog)).
+				WithArgs(models.AuditActionAccountLocked, user.ID, nil, "192.0.2.1", utils.AnyString{}, utils.AnyTime{}).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			expectCountFailure("ip:192.0.2.1", 5)
+
+			doLogin("wrong password")
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("rejects logins for a locked account with too many requests", func() {
+			expectFailures(sqlmock.NewRows([]string{"key", "count", "last_failed_at"}).
+				AddRow("account:email@example.com", 5, time.Now().Add(-time.Minute)))
+
+			doLogin("password")
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusTooManyRequests))
+			m.Expect(rr.Header().Get("Retry-After")).To(m.Equal("840"))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+
+			response := generated.ErrorResponse{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
+			m.Expect(response.Detail).To(m.Equal(auth.ErrTooManyLoginAttempts.Error()))
+			m.Expect(*response.Meta).To(m.HaveKeyWithValue("retry_after", m.BeNumerically("==", 840)))
+		})
+
+		g.It("delays the next login after a failed one", func() {
+			expectFailures(sqlmock.NewRows([]string{"key", "count", "last_failed_at"}).
+				AddRow("account:email@example.com", 3, time.Now()))
+
+			doLogin("password")
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusTooManyRequests))
+			m.Expect(rr.Header().Get("Retry-After")).To(m.Equal("4"))
+		})
+
+		g.It("rejects logins from a locked IP address for any account", func() {
+			expectFailures(sqlmock.NewRows([]string{"key", "count", "last_failed_at"}).
+				AddRow("ip:192.0.2.1", 50, time.Now()))
+
+			doLogin("password")
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusTooManyRequests))
+		})
+	})
+
+	g.When("a user with two-factor authentication logs in", func() {
+		var db *gorm.DB
+		var mock sqlmock.Sqlmock
+		var rr *httptest.ResponseRecorder
+		var router *gin.Engine
+		var mw *auth.JWTMiddleware
+		var user *models.User
+		var secret string
+
+		const sqlSelectUserByEmail = `SELECT * FROM "users" WHERE email = $1 ORDER BY "users"."id" LIMIT 1`
+		const sqlSelectUserByID = `SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`
+		const sqlSelectTwoFactor = `SELECT * FROM "two_factors" WHERE user_id = $1 LIMIT 1`
+		const sqlSelectRoleSetting = `SELECT * FROM "role_settings" WHERE role = $1 LIMIT 1`
+		const sqlUseStep = `UPDATE "two_factors" SET "last_used_step"=$1,"updated_at"=$2 WHERE user_id = $3 AND last_used_step < $4`
+		const sqlUseRecoveryCode = `UPDATE "recovery_codes" SET "used_at"=$1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+
+		twoFactorConfig := &utils.Config{
+			TokenSecretKey: "asecretkey",
+			LinkSigningKey: "alinksigningkey",
+		}
+
+		var userRows = func() *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"id", "email", "password", "role", "verified"}).
+				AddRow(user.ID, user.Email, user.Password, user.Role, true)
+		}
+
+		var twoFactorRows = func(enabledAt interface{}) *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"user_id", "secret", "last_used_step", "enabled_at"}).
+				AddRow(user.ID, secret, 0, enabledAt)
+		}
+
+		var post = func(path string, payload interface{}) {
+			body, err := json.Marshal(payload)
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", path, bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+			req.Header.Set("Content-Type", "application/json")
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+		}
+
+		var totpCode = func(step int64) string {
+			code, err := utils.TOTPCode(secret, step)
+			m.Expect(err).To(m.BeNil())
+			return code
+		}
+
+		// login answers the password and returns the challenge
+		var login = func() generated.TwoFactorChallenge {
+			post("/login", generated.UserLogin{Username: user.Email, Password: "password"})
+			m.Expect(rr.Code).To(m.Equal(http.StatusAccepted))
+
+			challenge := generated.TwoFactorChallenge{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), &challenge)).To(m.BeNil())
+			m.Expect(challenge.ChallengeToken).ToNot(m.BeEmpty())
+			return challenge
+		}
+
+		g.BeforeEach(func() {
+			db, mock = utils.NewGormMock()
+			_, rr, router = utils.NewGinTestCtx()
+			var err error
+			mw, err = auth.CreateJWTMiddleware(twoFactorConfig, db)
 			m.Expect(err).To(m.BeNil())
+			router.POST("/login", mw.LoginHandler)
+			router.POST("/2fa/enroll", auth.GetTwoFactorEnrollHandlerFunc(db, twoFactorConfig))
+			router.POST("/2fa/verify", auth.GetTwoFactorVerifyHandlerFunc(mw, db, twoFactorConfig))
+
 			hashedPass, err := utils.HashPassword("password")
 			m.Expect(err).To(m.BeNil())
 			user = &models.User{
-				ID:        uid,
-				Name:      "John Doe",
-				Email:     "email@example.com",
-				Password:  hashedPass,
-				Role:      "user",
-				Verified:  true,
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
+				ID:       uuid.New(),
+				Email:    "email@example.com",
+				Password: hashedPass,
+				Role:     models.RoleOrganizer,
 			}
+			secret, err = utils.GenerateTOTPSecret()
+			m.Expect(err).To(m.BeNil())
 		})
 
-		g.Context("with valid token", func() {
-			g.It("should be successful", func() {
-				var err error
-				token, _, err = mw.TokenGenerator(user)
-				m.Expect(err).To(m.BeNil())
+		g.It("finishes the login with a code from the authenticator app", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByEmail)).WithArgs(user.Email).WillReturnRows(userRows())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectTwoFactor)).WithArgs(user.ID).WillReturnRows(twoFactorRows(time.Now()))
+
+			challenge := login()
+			m.Expect(challenge.EnrollmentRequired).To(m.BeFalse())
+
+			step := utils.TOTPStep(time.Now())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByID)).WithArgs(user.ID.String()).WillReturnRows(userRows())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectTwoFactor)).WithArgs(user.ID).WillReturnRows(twoFactorRows(time.Now()))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(sqlUseStep)).
+				WithArgs(step, utils.AnyTime{}, user.ID, step).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			expectStartSession(mock, user.ID)
+
+			post("/2fa/verify", generated.TwoFactorVerify{
+				ChallengeToken: challenge.ChallengeToken,
+				Code:           totpCode(step),
+			})
 
-				req, err := http.NewRequest("GET", "/", nil)
-				m.Expect(err).To(m.BeNil())
-				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			response := generated.TokenResponse{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
+			m.Expect(response.AccessToken).To(m.HaveValue(m.Not(m.BeEmpty())))
+			m.Expect(response.RecoveryCodes).To(m.BeNil())
+		})
 
-				router.GET("/", mw.RefreshHandler)
-				router.ServeHTTP(rr, req)
+		g.It("rejects a code that was already used", func() {
+			step := utils.TOTPStep(time.Now())
+			challenge := generated.TwoFactorChallenge{ChallengeToken: utils.SignToken(
+				[]byte(twoFactorConfig.LinkSigningKey), "2fa-login", user.ID.String(), time.Now().Add(time.Minute),
+			)}
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByID)).WithArgs(user.ID.String()).WillReturnRows(userRows())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectTwoFactor)).WithArgs(user.ID).WillReturnRows(twoFactorRows(time.Now()))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(sqlUseStep)).
+				WithArgs(step, utils.AnyTime{}, user.ID, step).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+			expectAuditLog(mock, models.AuditActionLoginFailed, user.ID)
+
+			post("/2fa/verify", generated.TwoFactorVerify{
+				ChallengeToken: challenge.ChallengeToken,
+				Code:           totpCode(step),
+			})
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("accepts an unused recovery code", func() {
+			challenge := generated.TwoFactorChallenge{ChallengeToken: utils.SignToken(
+				[]byte(twoFactorConfig.LinkSigningKey), "2fa-login", user.ID.String(), time.Now().Add(time.Minute),
+			)}
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByID)).WithArgs(user.ID.String()).WillReturnRows(userRows())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectTwoFactor)).WithArgs(user.ID).WillReturnRows(twoFactorRows(time.Now()))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(sqlUseRecoveryCode)).
+				WithArgs(utils.AnyTime{}, user.ID, utils.HashOpaqueToken("abcdefghij")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			expectStartSession(mock, user.ID)
+
+			post("/2fa/verify", generated.TwoFactorVerify{ChallengeToken: challenge.ChallengeToken, Code: "ABCDE-FGHIJ"})
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("rejects an invalid challenge token", func() {
+			post("/2fa/verify", generated.TwoFactorVerify{ChallengeToken: "invalid", Code: "123456"})
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("has users of a role that requires it set up two-factor authentication", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByEmail)).WithArgs(user.Email).WillReturnRows(userRows())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectTwoFactor)).WithArgs(user.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectRoleSetting)).WithArgs(models.RoleOrganizer).
+				WillReturnRows(sqlmock.NewRows([]string{"role", "two_factor_required"}).AddRow(models.RoleOrganizer, true))
+
+			challenge := login()
+			m.Expect(challenge.EnrollmentRequired).To(m.BeTrue())
+
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByID)).WithArgs(user.ID.String()).WillReturnRows(userRows())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectTwoFactor)).WithArgs(user.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "two_factors"`)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			post("/2fa/enroll", generated.TwoFactorEnroll{ChallengeToken: challenge.ChallengeToken})
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+			enrollment := generated.TotpEnrollment{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), &enrollment)).To(m.BeNil())
+			m.Expect(enrollment.Secret).ToNot(m.BeEmpty())
+			m.Expect(enrollment.ProvisioningUri).To(m.HavePrefix("otpauth://totp/Pinman:email@example.com?"))
+			secret = enrollment.Secret
+
+			step := utils.TOTPStep(time.Now())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByID)).WithArgs(user.ID.String()).WillReturnRows(userRows())
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectTwoFactor)).WithArgs(user.ID).WillReturnRows(twoFactorRows(nil))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(
+				`UPDATE "two_factors" SET "enabled_at"=$1,"last_used_step"=$2,"updated_at"=$3 WHERE user_id = $4 AND enabled_at IS NULL`,
+			)).WithArgs(utils.AnyTime{}, step, utils.AnyTime{}, user.ID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "recovery_codes" WHERE user_id = $1`)).
+				WithArgs(user.ID).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "recovery_codes"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectCommit()
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			expectStartSession(mock, user.ID)
+
+			post("/2fa/verify", generated.TwoFactorVerify{
+				ChallengeToken: challenge.ChallengeToken,
+				Code:           totpCode(step),
+			})
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			response := generated.TokenResponse{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
+			m.Expect(response.AccessToken).To(m.HaveValue(m.Not(m.BeEmpty())))
+			m.Expect(response.RecoveryCodes).ToNot(m.BeNil())
+			m.Expect(*response.RecoveryCodes).To(m.HaveLen(auth.RecoveryCodeCount))
+		})
+	})
+
+	g.When("RefreshHandler receives a request", func() {
+		var db *gorm.DB
+		var mock sqlmock.Sqlmock
+		var rr *httptest.ResponseRecorder
+		var router *gin.Engine
+		var mw *auth.JWTMiddleware
+		var userID, sessionID, tokenID uuid.UUID
+
+		const refreshToken = "a-refresh-token"
+		const sqlSelectToken = `SELECT * FROM "refresh_tokens" WHERE token_hash = $1 ORDER BY "refresh_tokens"."id" LIMIT 1`
+		const sqlSelectSession = `SELECT * FROM "sessions" WHERE "sessions"."id" = $1`
+		const sqlSelectUser = `SELECT * FROM "users" WHERE "users"."id" = $1`
+		const sqlRevokeSession = `UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE id = $3 AND revoked_at IS NULL`
+
+		var expectLookup = func(usedAt interface{}, revokedAt interface{}) {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectToken)).
+				WithArgs(utils.HashOpaqueToken(refreshToken)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "session_id", "token_hash", "used_at"}).
+					AddRow(tokenID, sessionID, utils.HashOpaqueToken(refreshToken), usedAt))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectSession)).
+				WithArgs(sessionID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "revoked_at"}).
+					AddRow(sessionID, userID, time.Now().Add(time.Hour), revokedAt))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUser)).
+				WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "role", "verified"}).AddRow(userID, "user", true))
+		}
+
+		var doRequest = func(handler gin.HandlerFunc, payload interface{}) {
+			body, err := json.Marshal(payload)
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+			req.Header.Set("Content-Type", "application/json")
+
+			router.POST("/", handler)
+			router.ServeHTTP(rr, req)
+		}
+
+		g.BeforeEach(func() {
+			db, mock = utils.NewGormMock()
+			_, rr, router = utils.NewGinTestCtx()
+			var err error
+			mw, err = auth.CreateJWTMiddleware(config, db)
+			m.Expect(err).To(m.BeNil())
+
+			userID, sessionID, tokenID = uuid.New(), uuid.New(), uuid.New()
+		})
+
+		g.Context("with a valid refresh token", func() {
+			g.It("rotates the refresh token and returns a new access token", func() {
+				expectLookup(nil, nil)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "used_at"=$1 WHERE id = $2 AND used_at IS NULL`)).
+					WithArgs(utils.AnyTime{}, tokenID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "sessions" SET "expires_at"=$1,"last_used_at"=$2,"updated_at"=$3 WHERE id = $4`)).
+					WithArgs(utils.AnyTime{}, utils.AnyTime{}, utils.AnyTime{}, sessionID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "refresh_tokens" ("session_id","token_hash","used_at","created_at") VALUES ($1,$2,$3,$4) RETURNING "id"`)).
+					WithArgs(sessionID, utils.AnyString{}, nil, utils.AnyTime{}).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectCommit()
+
+				doRequest(auth.GetRefreshHandlerFunc(mw, db, config), generated.TokenRefresh{RefreshToken: utils.PtrString(refreshToken)})
 
 				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
 
 				response := generated.TokenResponse{}
 				m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
-				m.Expect(response.AccessToken).ToNot(m.BeEmpty())
+				m.Expect(response.AccessToken).To(m.HaveValue(m.Not(m.BeEmpty())))
 				m.Expect(response.Expire).ToNot(m.BeEmpty())
+				m.Expect(response.RefreshToken).ToNot(m.BeNil())
+				m.Expect(*response.RefreshToken).ToNot(m.Equal(refreshToken))
+			})
+		})
+
+		g.Context("with an unknown refresh token", func() {
+			g.It("returns unauthorized", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelectToken)).
+					WithArgs(utils.HashOpaqueToken(refreshToken)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				doRequest(auth.GetRefreshHandlerFunc(mw, db, config), generated.TokenRefresh{RefreshToken: utils.PtrString(refreshToken)})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.Context("with a refresh token of a revoked session", func() {
+			g.It("returns unauthorized", func() {
+				expectLookup(nil, time.Now())
+
+				doRequest(auth.GetRefreshHandlerFunc(mw, db, config), generated.TokenRefresh{RefreshToken: utils.PtrString(refreshToken)})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.Context("with a refresh token that was already used", func() {
+			g.It("revokes the session and returns unauthorized", func() {
+				expectLookup(time.Now(), nil)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlRevokeSession)).
+					WithArgs(utils.AnyTime{}, utils.AnyTime{}, sessionID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				doRequest(auth.GetRefreshHandlerFunc(mw, db, config), generated.TokenRefresh{RefreshToken: utils.PtrString(refreshToken)})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+
+				response := generated.ErrorResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
+				m.Expect(response.Detail).To(m.Equal(auth.ErrRefreshTokenReused.Error()))
+			})
+		})
+
+		g.Context("without a refresh token", func() {
+			g.It("returns bad request", func() {
+				doRequest(auth.GetRefreshHandlerFunc(mw, db, config), map[string]string{})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+			})
+		})
+
+		g.Context("when logging out", func() {
+			g.It("revokes the session of the refresh token", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelectToken)).
+					WithArgs(utils.HashOpaqueToken(refreshToken)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "session_id"}).AddRow(tokenID, sessionID))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlRevokeSession)).
+					WithArgs(utils.AnyTime{}, utils.AnyTime{}, sessionID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				doRequest(auth.GetLogoutHandlerFunc(mw, db), generated.TokenRefresh{RefreshToken: utils.PtrString(refreshToken)})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+
+			g.It("succeeds for an unknown refresh token", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelectToken)).
+					WithArgs(utils.HashOpaqueToken(refreshToken)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				doRequest(auth.GetLogoutHandlerFunc(mw, db), generated.TokenRefresh{RefreshToken: utils.PtrString(refreshToken)})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
 			})
 		})
 	})
@@ -306,7 +867,7 @@ var _ = g.Describe("JWTMiddleware", func() {
 		//var ctx *gin.Context
 		var rr *httptest.ResponseRecorder
 		var router *gin.Engine
-		var mw *jwt.GinJWTMiddleware
+		var mw *auth.JWTMiddleware
 		var user *models.User
 
 		var columns = []string{
@@ -349,7 +910,7 @@ var _ = g.Describe("JWTMiddleware", func() {
 				m.Expect(err).To(m.BeNil())
 
 				router.GET("/", func(context *gin.Context) {
-					auth.GetAuthMiddlewareFunc(mw)(context)
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
 					m.Expect(context.IsAborted()).To(m.BeFalse())
 				})
 				router.ServeHTTP(rr, req)
@@ -373,7 +934,7 @@ var _ = g.Describe("JWTMiddleware", func() {
 
 				router.GET("/", func(context *gin.Context) {
 					context.Set(generated.PinmanAuthScopes, []string{"user"})
-					auth.GetAuthMiddlewareFunc(mw)(context)
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
 					m.Expect(context.IsAborted()).To(m.BeFalse())
 				})
 				router.ServeHTTP(rr, req)
@@ -394,11 +955,916 @@ var _ = g.Describe("JWTMiddleware", func() {
 
 				router.GET("/", func(context *gin.Context) {
 					context.Set(generated.PinmanAuthScopes, []string{"admin"})
-					auth.GetAuthMiddlewareFunc(mw)(context)
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
 					m.Expect(context.IsAborted()).To(m.BeTrue())
 				})
 				router.ServeHTTP(rr, req)
 			})
-		})
-	})
-})
+			g.It("succeeds if the role of the user includes the required one", func() {
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`,
+					),
+				).WithArgs(strings.ToLower(user.ID.String())).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(
+						user.ID, user.Name, user.Email, user.CreatedAt, user.UpdatedAt, user.Password, models.RoleAdmin,
+						user.Verified,
+					))
+
+				token, _, err := mw.TokenGenerator(user)
+
+				req, err := http.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				router.GET("/", func(context *gin.Context) {
+					context.Set(generated.PinmanAuthScopes, []string{models.RoleOrganizer})
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
+					m.Expect(context.IsAborted()).To(m.BeFalse())
+				})
+				router.ServeHTTP(rr, req)
+			})
+			g.It("fails if the role of the user is ranked below the required one", func() {
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`,
+					),
+				).WithArgs(strings.ToLower(user.ID.String())).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(
+						user.ID, user.Name, user.Email, user.CreatedAt, user.UpdatedAt, user.Password, models.RoleOrganizer,
+						user.Verified,
+					))
+
+				token, _, err := mw.TokenGenerator(user)
+
+				req, err := http.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				router.GET("/", func(context *gin.Context) {
+					context.Set(generated.PinmanAuthScopes, []string{models.RoleAdmin})
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
+					m.Expect(context.IsAborted()).To(m.BeTrue())
+				})
+				router.ServeHTTP(rr, req)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+			})
+			g.It("authenticates public endpoints that require scopes for some parameters", func() {
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`,
+					),
+				).WithArgs(strings.ToLower(user.ID.String())).
+					WillReturnRows(rows)
+
+				token, _, err := mw.TokenGenerator(user)
+
+				req, err := http.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				router.GET("/", func(context *gin.Context) {
+					m.Expect(auth.GetAuthenticateFunc(mw, db)(context, models.RoleAdmin)).To(m.BeFalse())
+					m.Expect(context.IsAborted()).To(m.BeTrue())
+				})
+				router.ServeHTTP(rr, req)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+			})
+			g.It("fails if the account was disabled", func() {
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`,
+					),
+				).WithArgs(strings.ToLower(user.ID.String())).
+					WillReturnRows(sqlmock.NewRows(append(columns, "disabled_at")).AddRow(
+						user.ID, user.Name, user.Email, user.CreatedAt, user.UpdatedAt, user.Password, user.Role,
+						user.Verified, time.Now(),
+					))
+
+				token, _, err := mw.TokenGenerator(user)
+
+				req, err := http.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				router.GET("/", func(context *gin.Context) {
+					context.Set(generated.PinmanAuthScopes, []string{"user"})
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
+					m.Expect(context.IsAborted()).To(m.BeTrue())
+				})
+				router.ServeHTTP(rr, req)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+				response := &generated.ErrorResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Detail).To(m.Equal(auth.ErrAccountDisabled.Error()))
+			})
+			g.It("succeeds if the endpoint requires a verified user and the user is verified", func() {
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`,
+					),
+				).WithArgs(strings.ToLower(user.ID.String())).
+					WillReturnRows(rows)
+
+				token, _, err := mw.TokenGenerator(user)
+
+				req, err := http.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				router.GET("/", func(context *gin.Context) {
+					context.Set(generated.PinmanAuthScopes, []string{"user", auth.ScopeVerified})
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
+					m.Expect(context.IsAborted()).To(m.BeFalse())
+				})
+				router.ServeHTTP(rr, req)
+			})
+			g.It("fails if the password was changed after the token was issued", func() {
+				token, _, err := mw.TokenGenerator(user)
+
+				passwordChangedAt := time.Now().Add(time.Minute)
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`,
+					),
+				).WithArgs(strings.ToLower(user.ID.String())).
+					WillReturnRows(sqlmock.NewRows(append(columns, "password_changed_at")).AddRow(
+						user.ID, user.Name, user.Email, user.CreatedAt, user.UpdatedAt, user.Password, user.Role,
+						user.Verified, passwordChangedAt,
+					))
+
+				req, err := http.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				router.GET("/", func(context *gin.Context) {
+					context.Set(generated.PinmanAuthScopes, []string{"user"})
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
+					m.Expect(context.IsAborted()).To(m.BeTrue())
+				})
+				router.ServeHTTP(rr, req)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+				response := &generated.ErrorResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Detail).To(m.Equal(auth.ErrTokenRevoked.Error()))
+			})
+			g.It("fails if the session of the token was revoked", func() {
+				session := &models.Session{ID: uuid.New(), UserID: user.ID}
+				token, _, err := mw.TokenGenerator(session)
+				m.Expect(err).To(m.BeNil())
+
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`,
+					),
+				).WithArgs(strings.ToLower(user.ID.String())).
+					WillReturnRows(rows)
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "sessions" WHERE id = $1 AND user_id = $2 ORDER BY "sessions"."id" LIMIT 1`,
+					),
+				).WithArgs(session.ID.String(), user.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "revoked_at"}).
+						AddRow(session.ID, user.ID, time.Now()))
+
+				req, err := http.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				router.GET("/", func(context *gin.Context) {
+					context.Set(generated.PinmanAuthScopes, []string{"user"})
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
+					m.Expect(context.IsAborted()).To(m.BeTrue())
+				})
+				router.ServeHTTP(rr, req)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+				response := &generated.ErrorResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Detail).To(m.Equal(auth.ErrTokenRevoked.Error()))
+			})
+			g.Context("with a personal API token", func() {
+				const sqlSelectToken = `SELECT * FROM "api_tokens" WHERE token_hash = $1 ORDER BY "api_tokens"."id" LIMIT 1`
+				const sqlSelectUser = `SELECT * FROM "users" WHERE "users"."id" = $1`
+				var plainToken string
+				var tokenID uuid.UUID
+
+				var expectToken = func(readOnly bool, leagueID interface{}, revokedAt interface{}) {
+					mock.ExpectQuery(regexp.QuoteMeta(sqlSelectToken)).
+						WithArgs(utils.HashOpaqueToken(plainToken)).
+						WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "read_only", "league_id", "revoked_at"}).
+							AddRow(tokenID, user.ID, readOnly, leagueID, revokedAt))
+					if revokedAt == nil {
+						mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUser)).
+							WithArgs(user.ID).
+							WillReturnRows(rows)
+					}
+				}
+
+				var doRequest = func(method string, scopes []string) {
+					req, err := http.NewRequest(method, "/", bytes.NewReader([]byte{}))
+					m.Expect(err).To(m.BeNil())
+					req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", plainToken))
+
+					router.Handle(method, "/", func(context *gin.Context) {
+						context.Set(generated.PinmanAuthScopes, scopes)
+						auth.GetAuthMiddlewareFunc(mw, db)(context)
+					})
+					router.ServeHTTP(rr, req)
+				}
+
+				g.BeforeEach(func() {
+					var err error
+					plainToken, err = auth.GenerateAPIToken()
+					m.Expect(err).To(m.BeNil())
+					tokenID = uuid.New()
+				})
+
+				g.It("authenticates the user of the token", func() {
+					expectToken(false, nil, nil)
+					mock.ExpectBegin()
+					mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_tokens" SET "last_used_at"=$1 WHERE id = $2`)).
+						WithArgs(utils.AnyTime{}, tokenID).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+
+					doRequest("POST", []string{"user"})
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+					m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				})
+
+				g.It("fails for a revoked token", func() {
+					expectToken(false, nil, time.Now())
+
+					doRequest("GET", []string{"user"})
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+					m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				})
+
+				g.It("fails for a write request with a read-only token", func() {
+					expectToken(true, nil, nil)
+
+					doRequest("POST", []string{"user"})
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+					response := &generated.ErrorResponse{}
+					m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+					m.Expect(response.Detail).To(m.Equal(auth.ErrAPITokenReadOnly.Error()))
+				})
+
+				g.It("fails for a league token on an endpoint that is not league specific", func() {
+					expectToken(false, uuid.New(), nil)
+
+					doRequest("POST", []string{"user"})
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+					response := &generated.ErrorResponse{}
+					m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+					m.Expect(response.Detail).To(m.Equal(auth.ErrAPITokenLeague.Error()))
+				})
+			})
+			g.It("fails if the endpoint requires a verified user and the user is not verified", func() {
+				mock.ExpectQuery(
+					regexp.QuoteMeta(
+						`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`,
+					),
+				).WithArgs(strings.ToLower(user.ID.String())).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(
+						user.ID, user.Name, user.Email, user.CreatedAt, user.UpdatedAt, user.Password, user.Role, false,
+					))
+
+				token, _, err := mw.TokenGenerator(user)
+
+				req, err := http.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				router.GET("/", func(context *gin.Context) {
+					context.Set(generated.PinmanAuthScopes, []string{"user", auth.ScopeVerified})
+					auth.GetAuthMiddlewareFunc(mw, db)(context)
+					m.Expect(context.IsAborted()).To(m.BeTrue())
+				})
+				router.ServeHTTP(rr, req)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+				response := &generated.ErrorResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Detail).To(m.Equal(auth.ErrEmailNotVerified.Error()))
+			})
+		})
+	})
+})
+
+var _ = g.Describe("OIDC", func() {
+	const issuer = "https://idp.example.com"
+	const sqlSelectIdentity = `SELECT * FROM "external_identities" WHERE issuer = $1 AND subject = $2 ORDER BY "external_identities"."id" LIMIT 1`
+	const sqlSelectUserByEmail = `SELECT * FROM "users" WHERE email = $1 ORDER BY "users"."id" LIMIT 1`
+	const sqlInsertIdentity = `INSERT INTO "external_identities" ("user_id","issuer","subject","email","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+
+	config := &utils.Config{
+		TokenSecretKey: "asecretkey",
+		LinkSigningKey: "alinksigningkey",
+	}
+
+	var db *gorm.DB
+	var mock sqlmock.Sqlmock
+	var rr *httptest.ResponseRecorder
+	var router *gin.Engine
+	var mw *auth.JWTMiddleware
+	var client *oidc.MockClientInterface
+	var claims *oidc.Claims
+
+	var doRequest = func(method string, handler gin.HandlerFunc, payload interface{}) {
+		body, err := json.Marshal(payload)
+		m.Expect(err).To(m.BeNil())
+		req, err := http.NewRequest(method, "/", bytes.NewReader(body))
+		m.Expect(err).To(m.BeNil())
+		req.Header.Set("Content-Type", "application/json")
+
+		router.Handle(method, "/", handler)
+		router.ServeHTTP(rr, req)
+	}
+
+	// startLogin returns the state of a login started at the authorize endpoint and expects the callback with it to
+	// authenticate the code with the nonce of the state
+	var startLogin = func() string {
+		state := utils.SignToken([]byte(config.LinkSigningKey), "oidc-login", "a-nonce", time.Now().Add(time.Minute))
+		client.On("Authenticate", testify.Anything, "a-code", "a-nonce").Return(claims, nil)
+		client.On("Issuer").Return(issuer)
+		return state
+	}
+
+	var expectTokenResponse = func() {
+		m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+		m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+
+		response := generated.TokenResponse{}
+		m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
+		m.Expect(response.AccessToken).To(m.HaveValue(m.Not(m.BeEmpty())))
+		m.Expect(response.RefreshToken).ToNot(m.BeNil())
+	}
+
+	g.BeforeEach(func() {
+		db, mock = utils.NewGormMock()
+		_, rr, router = utils.NewGinTestCtx()
+		var err error
+		mw, err = auth.CreateJWTMiddleware(config, db)
+		m.Expect(err).To(m.BeNil())
+
+		client = oidc.NewMockClientInterface(g.GinkgoT())
+		claims = &oidc.Claims{
+			Subject:       "1234",
+			Email:         "Player@Example.com",
+			EmailVerified: true,
+			Name:          "Test Player",
+		}
+	})
+
+	g.When("the authorize endpoint receives a request", func() {
+		g.It("returns the URL of the provider's login page with a signed state", func() {
+			var nonce string
+			client.On("AuthCodeURL", testify.Anything, testify.AnythingOfType("string"), testify.AnythingOfType("string")).
+				Run(func(args testify.Arguments) { nonce = args.String(2) }).
+				Return("https://idp.example.com/authorize?state=a-state", nil)
+
+			doRequest("GET", auth.GetOIDCAuthorizeHandlerFunc(client, config), nil)
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+			response := generated.OidcAuthorization{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
+			m.Expect(response.AuthorizationUrl).To(m.Equal("https://idp.example.com/authorize?state=a-state"))
+
+			subject, err := utils.VerifySignedToken([]byte(config.LinkSigningKey), "oidc-login", response.State)
+			m.Expect(err).To(m.BeNil())
+			m.Expect(subject).To(m.Equal(nonce))
+		})
+
+		g.It("returns not found if no provider is configured", func() {
+			doRequest("GET", auth.GetOIDCAuthorizeHandlerFunc(nil, config), nil)
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusNotFound))
+		})
+	})
+
+	g.When("the callback endpoint receives a request", func() {
+		g.It("logs in the user linked to the identity", func() {
+			userID := uuid.New()
+			state := startLogin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectIdentity)).
+				WithArgs(issuer, "1234").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(uuid.New(), userID))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+				WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "role", "verified"}).AddRow(userID, "user", true))
+			expectNoTwoFactor(mock, userID)
+			expectStartSession(mock, userID)
+
+			doRequest("POST", auth.GetOIDCCallbackHandlerFunc(mw, db, client, config), generated.OidcCallback{
+				Code:  "a-code",
+				State: state,
+			})
+
+			expectTokenResponse()
+		})
+
+		g.It("links the identity to the verified user with the same email address", func() {
+			userID := uuid.New()
+			state := startLogin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectIdentity)).
+				WithArgs(issuer, "1234").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByEmail)).
+				WithArgs("player@example.com").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "role", "verified"}).
+					AddRow(userID, "player@example.com", "a-hash", "user", true))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlInsertIdentity)).
+				WithArgs(userID, issuer, "1234", "player@example.com", utils.AnyTime{}, utils.AnyTime{}).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			expectNoTwoFactor(mock, userID)
+			expectStartSession(mock, userID)
+
+			doRequest("POST", auth.GetOIDCCallbackHandlerFunc(mw, db, client, config), generated.OidcCallback{
+				Code:  "a-code",
+				State: state,
+			})
+
+			expectTokenResponse()
+		})
+
+		g.It("takes over the unverified user with the same email address, dropping its password and access", func() {
+			userID := uuid.New()
+			state := startLogin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectIdentity)).
+				WithArgs(issuer, "1234").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByEmail)).
+				WithArgs("player@example.com").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "role", "verified"}).
+					AddRow(userID, "player@example.com", "a-hash", "user", false))
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "password"=$1,"verified"=$2,"updated_at"=$3 WHERE "id" = $4`)).
+				WithArgs("", true, utils.AnyTime{}, userID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE user_id = $3 AND revoked_at IS NULL`)).
+				WithArgs(utils.AnyTime{}, utils.AnyTime{}, userID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_tokens" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+				WithArgs(utils.AnyTime{}, userID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlInsertIdentity)).
+				WithArgs(userID, issuer, "1234", "player@example.com", utils.AnyTime{}, utils.AnyTime{}).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			expectNoTwoFactor(mock, userID)
+			expectStartSession(mock, userID)
+
+			doRequest("POST", auth.GetOIDCCallbackHandlerFunc(mw, db, client, config), generated.OidcCallback{
+				Code:  "a-code",
+				State: state,
+			})
+
+			expectTokenResponse()
+		})
+
+		g.It("registers a verified user without a password for a new email address", func() {
+			userID := uuid.New()
+			state := startLogin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectIdentity)).
+				WithArgs(issuer, "1234").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUserByEmail)).
+				WithArgs("player@example.com").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("name","email","password","role","verified","created_at","updated_at","password_changed_at","disabled_at","anonymized_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`)).
+				WithArgs("Test Player", "player@example.com", "", "user", true, utils.AnyTime{}, utils.AnyTime{}, nil, nil, nil).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlInsertIdentity)).
+				WithArgs(userID, issuer, "1234", "player@example.com", utils.AnyTime{}, utils.AnyTime{}).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			expectNoTwoFactor(mock, userID)
+			expectStartSession(mock, userID)
+
+			doRequest("POST", auth.GetOIDCCallbackHandlerFunc(mw, db, client, config), generated.OidcCallback{
+				Code:  "a-code",
+				State: state,
+			})
+
+			expectTokenResponse()
+		})
+
+		g.It("returns unauthorized if the provider has not verified the email address", func() {
+			claims.EmailVerified = false
+			state := utils.SignToken([]byte(config.LinkSigningKey), "oidc-login", "a-nonce", time.Now().Add(time.Minute))
+			client.On("Authenticate", testify.Anything, "a-code", "a-nonce").Return(claims, nil)
+
+			doRequest("POST", auth.GetOIDCCallbackHandlerFunc(mw, db, client, config), generated.OidcCallback{
+				Code:  "a-code",
+				State: state,
+			})
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+			response := generated.ErrorResponse{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
+			m.Expect(response.Detail).To(m.Equal(auth.ErrOIDCEmailNotVerified.Error()))
+		})
+
+		g.It("returns unauthorized if the provider rejects the code", func() {
+			state := utils.SignToken([]byte(config.LinkSigningKey), "oidc-login", "a-nonce", time.Now().Add(time.Minute))
+			client.On("Authenticate", testify.Anything, "a-code", "a-nonce").Return(nil, oidc.ErrInvalidIDToken)
+
+			doRequest("POST", auth.GetOIDCCallbackHandlerFunc(mw, db, client, config), generated.OidcCallback{
+				Code:  "a-code",
+				State: state,
+			})
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+		})
+
+		g.It("returns bad request for an expired state", func() {
+			state := utils.SignToken([]byte(config.LinkSigningKey), "oidc-login", "a-nonce", time.Now().Add(-time.Minute))
+
+			doRequest("POST", auth.GetOIDCCallbackHandlerFunc(mw, db, client, config), generated.OidcCallback{
+				Code:  "a-code",
+				State: state,
+			})
+
+			m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+			response := generated.ErrorResponse{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.BeNil())
+			m.Expect(response.Detail).To(m.Equal(auth.ErrOIDCInvalidState.Error()))
+		})
+	})
+})
+
+var _ = g.Describe("signing keys", func() {
+	var db *gorm.DB
+	var mock sqlmock.Sqlmock
+	var ctx *gin.Context
+	var rr *httptest.ResponseRecorder
+	var router *gin.Engine
+	var user *models.User
+	var oldKey, newKey *rsa.PrivateKey
+
+	var newConfig = func(active *rsa.PrivateKey, retired ...*rsa.PrivateKey) *utils.Config {
+		config := &utils.Config{
+			TokenPrivateKey: encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(active)),
+			TokenSecretKey:  "asecretkey",
+		}
+		for _, key := range retired {
+			config.TokenRetiredPublicKeys = append(config.TokenRetiredPublicKeys, encodePublicKey(key))
+		}
+		return config
+	}
+
+	var authenticate = func(mw *auth.JWTMiddleware, token string) bool {
+		authenticated := false
+		router.GET("/", func(context *gin.Context) {
+			context.Set(generated.PinmanAuthScopes, []string{"user"})
+			auth.GetAuthMiddlewareFunc(mw, db)(context)
+			authenticated = !context.IsAborted()
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		router.ServeHTTP(rr, req)
+		return authenticated
+	}
+
+	var expectUser = func() {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`)).
+			WithArgs(user.ID.String()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "role", "verified"}).AddRow(user.ID, user.Role, true))
+	}
+
+	g.BeforeEach(func() {
+		db, mock = utils.NewGormMock()
+		ctx, rr, router = utils.NewGinTestCtx()
+		user = &models.User{ID: uuid.New(), Role: models.RoleUser, Verified: true}
+
+		if oldKey == nil {
+			var err error
+			oldKey, err = rsa.GenerateKey(rand.Reader, 2048)
+			m.Expect(err).To(m.BeNil())
+			newKey, err = rsa.GenerateKey(rand.Reader, 2048)
+			m.Expect(err).To(m.BeNil())
+		}
+	})
+
+	g.It("signs tokens with the active key and names it in the kid header", func() {
+		mw, err := auth.CreateJWTMiddleware(newConfig(newKey, oldKey), db)
+		m.Expect(err).To(m.BeNil())
+
+		token, _, err := mw.TokenGenerator(user)
+		m.Expect(err).To(m.BeNil())
+
+		parsed, _, err := gojwt.NewParser().ParseUnverified(token, gojwt.MapClaims{})
+		m.Expect(err).To(m.BeNil())
+		m.Expect(parsed.Method).To(m.Equal(gojwt.SigningMethodRS256))
+
+		auth.GetJWKSHandlerFunc(mw)(ctx)
+		m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+		keySet := oidc.JSONWebKeySet{}
+		m.Expect(json.Unmarshal(rr.Body.Bytes(), &keySet)).To(m.Succeed())
+		m.Expect(keySet.Keys).To(m.HaveLen(2))
+		m.Expect(keySet.Keys[0].Kid).To(m.Equal(parsed.Header["kid"]))
+		publicKey, err := keySet.Keys[0].PublicKey()
+		m.Expect(err).To(m.BeNil())
+		m.Expect(publicKey).To(m.Equal(&newKey.PublicKey))
+		publicKey, err = keySet.Keys[1].PublicKey()
+		m.Expect(err).To(m.BeNil())
+		m.Expect(publicKey).To(m.Equal(&oldKey.PublicKey))
+	})
+
+	g.It("accepts tokens signed with a retired key", func() {
+		oldMiddleware, err := auth.CreateJWTMiddleware(newConfig(oldKey), db)
+		m.Expect(err).To(m.BeNil())
+		token, _, err := oldMiddleware.TokenGenerator(user)
+		m.Expect(err).To(m.BeNil())
+
+		mw, err := auth.CreateJWTMiddleware(newConfig(newKey, oldKey), db)
+		m.Expect(err).To(m.BeNil())
+		expectUser()
+
+		m.Expect(authenticate(mw, token)).To(m.BeTrue())
+		m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+	})
+
+	g.It("rejects tokens signed with a key that is no longer configured", func() {
+		oldMiddleware, err := auth.CreateJWTMiddleware(newConfig(oldKey), db)
+		m.Expect(err).To(m.BeNil())
+		token, _, err := oldMiddleware.TokenGenerator(user)
+		m.Expect(err).To(m.BeNil())
+
+		mw, err := auth.CreateJWTMiddleware(newConfig(newKey), db)
+		m.Expect(err).To(m.BeNil())
+
+		m.Expect(authenticate(mw, token)).To(m.BeFalse())
+		m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+	})
+
+	g.It("accepts tokens signed with the secret key before keys were introduced", func() {
+		token, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, gojwt.MapClaims{
+			auth.IdentityKey: user.ID.String(),
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"orig_iat":       time.Now().Unix(),
+		}).SignedString([]byte("asecretkey"))
+		m.Expect(err).To(m.BeNil())
+
+		mw, err := auth.CreateJWTMiddleware(newConfig(newKey), db)
+		m.Expect(err).To(m.BeNil())
+		expectUser()
+
+		m.Expect(authenticate(mw, token)).To(m.BeTrue())
+		m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+	})
+
+	g.It("fails if the public key does not belong to the private key", func() {
+		config := newConfig(newKey)
+		config.TokenPublicKey = encodePublicKey(oldKey)
+
+		_, err := auth.CreateJWTMiddleware(config, db)
+		m.Expect(err).ToNot(m.BeNil())
+	})
+})
+
+var _ = g.Describe("cookie sessions", func() {
+	var db *gorm.DB
+	var mock sqlmock.Sqlmock
+	var rr *httptest.ResponseRecorder
+	var router *gin.Engine
+	var mw *auth.JWTMiddleware
+	var user *models.User
+
+	const refreshToken = "a-refresh-token"
+	const csrfToken = "a-csrf-token"
+	config := &utils.Config{
+		TokenSecretKey:           "asecretkey",
+		TokenExpiresAfter:        time.Hour,
+		RefreshTokenExpiresAfter: 24 * time.Hour,
+		TokenTransport:           auth.TokenTransportCookie,
+	}
+
+	var cookies = func() map[string]*http.Cookie {
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range rr.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+		return cookies
+	}
+
+	var newRequest = func(method string, body interface{}, cookies map[string]string) *http.Request {
+		payload, err := json.Marshal(body)
+		m.Expect(err).To(m.BeNil())
+		req := httptest.NewRequest(method, "/", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		return req
+	}
+
+	g.BeforeEach(func() {
+		db, mock = utils.NewGormMock()
+		_, rr, router = utils.NewGinTestCtx()
+		var err error
+		mw, err = auth.CreateJWTMiddleware(config, db)
+		m.Expect(err).To(m.BeNil())
+		user = &models.User{ID: uuid.New(), Email: "email@example.com", Role: models.RoleUser, Verified: true}
+	})
+
+	g.It("sets the tokens in HttpOnly cookies instead of returning them when logging in", func() {
+		hashedPass, err := utils.HashPassword("password")
+		m.Expect(err).To(m.BeNil())
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 ORDER BY "users"."id" LIMIT 1`)).
+			WithArgs(user.Email).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "role", "verified"}).
+				AddRow(user.ID, user.Email, hashedPass, user.Role, true))
+		expectNoTwoFactor(mock, user.ID)
+		expectStartSession(mock, user.ID)
+
+		router.POST("/", mw.LoginHandler)
+		router.ServeHTTP(rr, newRequest("POST", generated.UserLogin{Username: user.Email, Password: "password"}, nil))
+
+		m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+		response := generated.TokenResponse{}
+		m.Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(m.Succeed())
+		m.Expect(response.AccessToken).To(m.BeNil())
+		m.Expect(response.RefreshToken).To(m.BeNil())
+		m.Expect(response.CsrfToken).To(m.HaveValue(m.Not(m.BeEmpty())))
+
+		cookies := cookies()
+		for _, name := range []string{auth.AccessTokenCookie, auth.RefreshTokenCookie, auth.CSRFTokenCookie} {
+			m.Expect(cookies).To(m.HaveKey(name))
+			m.Expect(cookies[name].HttpOnly).To(m.BeTrue())
+			m.Expect(cookies[name].Secure).To(m.BeTrue())
+			m.Expect(cookies[name].SameSite).To(m.Equal(http.SameSiteStrictMode))
+		}
+		m.Expect(cookies[auth.CSRFTokenCookie].Value).To(m.Equal(*response.CsrfToken))
+	})
+
+	g.Context("authenticating with the access token cookie", func() {
+		var authenticate = func(req *http.Request) bool {
+			authenticated := false
+			router.Any("/", func(context *gin.Context) {
+				context.Set(generated.PinmanAuthScopes, []string{"user"})
+				auth.GetAuthMiddlewareFunc(mw, db)(context)
+				authenticated = !context.IsAborted()
+			})
+			router.ServeHTTP(rr, req)
+			return authenticated
+		}
+
+		var expectUser = func() {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`)).
+				WithArgs(user.ID.String()).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "role", "verified"}).AddRow(user.ID, user.Role, true))
+		}
+
+		var token string
+
+		g.BeforeEach(func() {
+			var err error
+			token, _, err = mw.TokenGenerator(user)
+			m.Expect(err).To(m.BeNil())
+		})
+
+		g.It("succeeds for reading requests without a CSRF token", func() {
+			expectUser()
+
+			req := newRequest("GET", nil, map[string]string{auth.AccessTokenCookie: token})
+
+			m.Expect(authenticate(req)).To(m.BeTrue())
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("succeeds for changing requests with the CSRF token", func() {
+			expectUser()
+
+			req := newRequest("POST", nil, map[string]string{
+				auth.AccessTokenCookie: token,
+				auth.CSRFTokenCookie:   csrfToken,
+			})
+			req.Header.Set(auth.CSRFTokenHeader, csrfToken)
+
+			m.Expect(authenticate(req)).To(m.BeTrue())
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("fails with forbidden for changing requests with a wrong CSRF token", func() {
+			req := newRequest("POST", nil, map[string]string{
+				auth.AccessTokenCookie: token,
+				auth.CSRFTokenCookie:   csrfToken,
+			})
+			req.Header.Set(auth.CSRFTokenHeader, "another-csrf-token")
+
+			m.Expect(authenticate(req)).To(m.BeFalse())
+			m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+		})
+
+		g.It("ignores access tokens in the Authorization header", func() {
+			req := newRequest("GET", nil, nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			m.Expect(authenticate(req)).To(m.BeFalse())
+			m.Expect(rr.Code).To(m.Equal(http.StatusUnauthorized))
+		})
+	})
+
+	g.It("fails with forbidden when refreshing with the cookie without the CSRF token", func() {
+		router.POST("/", auth.GetRefreshHandlerFunc(mw, db, config))
+		router.ServeHTTP(rr, newRequest("POST", generated.TokenRefresh{}, map[string]string{
+			auth.RefreshTokenCookie: refreshToken,
+			auth.CSRFTokenCookie:    csrfToken,
+		}))
+
+		m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+		m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+	})
+
+	g.It("revokes the session of the refresh token cookie and removes the cookies when logging out", func() {
+		sessionID := uuid.New()
+		mock.ExpectQuery(regexp.QuoteMeta(
+			`SELECT * FROM "refresh_tokens" WHERE token_hash = $1 ORDER BY "refresh_tokens"."id" LIMIT 1`,
+		)).WithArgs(utils.HashOpaqueToken(refreshToken)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "session_id"}).AddRow(uuid.New(), sessionID))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(
+			`UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE id = $3 AND revoked_at IS NULL`,
+		)).WithArgs(utils.AnyTime{}, utils.AnyTime{}, sessionID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		req := newRequest("POST", generated.TokenRefresh{}, map[string]string{
+			auth.RefreshTokenCookie: refreshToken,
+			auth.CSRFTokenCookie:    csrfToken,
+		})
+		req.Header.Set(auth.CSRFTokenHeader, csrfToken)
+		router.POST("/", auth.GetLogoutHandlerFunc(mw, db))
+		router.ServeHTTP(rr, req)
+
+		m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+		m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		cookies := cookies()
+		for _, name := range []string{auth.AccessTokenCookie, auth.RefreshTokenCookie, auth.CSRFTokenCookie} {
+			m.Expect(cookies).To(m.HaveKey(name))
+			m.Expect(cookies[name].MaxAge).To(m.BeNumerically("<", 0))
+		}
+	})
+
+	g.It("fails to create the middleware for an unknown token transport", func() {
+		_, err := auth.CreateJWTMiddleware(&utils.Config{TokenTransport: "carrier-pigeon"}, db)
+		m.Expect(err).ToNot(m.BeNil())
+	})
+})
+
+func encodePEM(blockType string, der []byte) string {
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+func encodePublicKey(key *rsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	m.Expect(err).To(m.BeNil())
+	return encodePEM("PUBLIC KEY", der)
+}
+
+// expectNoTwoFactor expects a login to look up the two-factor authentication of a user who doesn't need it.
+func expectNoTwoFactor(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "two_factors" WHERE user_id = $1 LIMIT 1`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_settings" WHERE role = $1 LIMIT 1`)).
+		WithArgs(utils.AnyString{}).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}))
+}
+
+func expectStartSession(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`INSERT INTO "sessions" ("user_id","user_agent","ip_address","last_used_at","expires_at","revoked_at","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING "id"`,
+	)).WithArgs(userID, utils.AnyString{}, utils.AnyString{}, utils.AnyTime{}, utils.AnyTime{}, nil, utils.AnyTime{}, utils.AnyTime{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`INSERT INTO "refresh_tokens" ("session_id","token_hash","used_at","created_at") VALUES ($1,$2,$3,$4) RETURNING "id"`,
+	)).WithArgs(utils.AnyString{}, utils.AnyString{}, nil, utils.AnyTime{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+	expectAuditLog(mock, models.AuditActionLogin, userID)
+}
+
+func expectAuditLog(mock sqlmock.Sqlmock, action string, userID uuid.UUID) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`INSERT INTO "audit_logs" ("action","user_id","actor_id","ip_address","detail","created_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`,
+	)).WithArgs(action, userID, nil, utils.AnyString{}, utils.AnyString{}, utils.AnyTime{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"pinman/internal/utils"
+	"strings"
+	"time"
+)
+
+const (
+	// TokenTransportHeader returns the tokens in the response bodies, clients send access tokens in the
+	// Authorization header. It is the default.
+	TokenTransportHeader = "header"
+	// TokenTransportCookie only sends the tokens in HttpOnly cookies.
+	TokenTransportCookie = "cookie"
+	// TokenTransportBoth sets the cookies and returns the tokens, so both kinds of clients can log in.
+	TokenTransportBoth = "both"
+
+	AccessTokenCookie  = "pinman_access_token"
+	RefreshTokenCookie = "pinman_refresh_token"
+	CSRFTokenCookie    = "pinman_csrf_token"
+	CSRFTokenHeader    = "X-CSRF-Token"
+
+	// tokenCookiePath limits the token cookies to the API
+	tokenCookiePath = "/api"
+)
+
+var ErrInvalidCSRFToken = fmt.Errorf("missing or invalid CSRF token")
+
+// tokenCookies sends the tokens of logins in HttpOnly cookies, which unlike tokens kept by the app can't be read by
+// injected scripts. The cookies are sent along with requests started by other sites too, so requests authenticated
+// with them have to send the CSRF token, which is set in a cookie and returned with the tokens, in the X-CSRF-Token
+// header. Other sites can't read it to do the same.
+type tokenCookies struct {
+	transport     string
+	domain        string
+	sameSite      http.SameSite
+	refreshMaxAge time.Duration
+}
+
+func newTokenCookies(config *utils.Config) (*tokenCookies, error) {
+	cookies := &tokenCookies{
+		transport:     config.TokenTransport,
+		domain:        config.CookieDomain,
+		refreshMaxAge: config.RefreshTokenExpiresAfter,
+	}
+	switch cookies.transport {
+	case "":
+		cookies.transport = TokenTransportHeader
+	case TokenTransportHeader, TokenTransportCookie, TokenTransportBoth:
+	default:
+		return nil, fmt.Errorf("unknown token transport %q", config.TokenTransport)
+	}
+
+	switch strings.ToLower(config.CookieSameSite) {
+	case "", "strict":
+		cookies.sameSite = http.SameSiteStrictMode
+	case "lax":
+		cookies.sameSite = http.SameSiteLaxMode
+	case "none":
+		cookies.sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unknown cookie SameSite mode %q", config.CookieSameSite)
+	}
+
+	return cookies, nil
+}
+
+func (t *tokenCookies) enabled() bool {
+	return t.transport != TokenTransportHeader
+}
+
+// tokensInBody returns whether the tokens are returned in the response bodies.
+func (t *tokenCookies) tokensInBody() bool {
+	return t.transport != TokenTransportCookie
+}
+
+// tokenLookup returns where the JWT middleware looks for access tokens.
+func (t *tokenCookies) tokenLookup() string {
+	switch t.transport {
+	case TokenTransportCookie:
+		return "cookie:" + AccessTokenCookie
+	case TokenTransportBoth:
+		return "header:Authorization, cookie:" + AccessTokenCookie
+	}
+	return "header:Authorization"
+}
+
+// set sets the cookies for the tokens of a login and returns the new CSRF token. The refresh token is optional.
+func (t *tokenCookies) set(c *gin.Context, accessToken string, expire time.Time, refreshToken string) (string, error) {
+	csrfToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	t.setCookie(c, AccessTokenCookie, accessToken, time.Until(expire))
+	if refreshToken != "" {
+		t.setCookie(c, RefreshTokenCookie, refreshToken, t.refreshMaxAge)
+	}
+	// the CSRF token is returned along with the cookies, so the app doesn't need to read its cookie either
+	t.setCookie(c, CSRFTokenCookie, csrfToken, t.refreshMaxAge)
+
+	return csrfToken, nil
+}
+
+// clear removes the cookies, logging the browser out.
+func (t *tokenCookies) clear(c *gin.Context) {
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie, CSRFTokenCookie} {
+		t.setCookie(c, name, "", -1)
+	}
+}
+
+func (t *tokenCookies) setCookie(c *gin.Context, name string, value string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     tokenCookiePath,
+		Domain:   t.domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: t.sameSite,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// authenticatesWithCookie returns whether the access token of the request is taken from the cookie.
+func (t *tokenCookies) authenticatesWithCookie(c *gin.Context) bool {
+	if !t.enabled() {
+		return false
+	}
+	if _, err := c.Cookie(AccessTokenCookie); err != nil {
+		return false
+	}
+	// the Authorization header takes precedence unless only cookies are accepted
+	bearer := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer"))
+	return t.transport == TokenTransportCookie || bearer == ""
+}
+
+// verifyCSRFToken returns whether the CSRF token header matches the cookie. Requests that can't change anything don't
+// need one.
+func verifyCSRFToken(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := c.Cookie(CSRFTokenCookie)
+	if err != nil || cookie == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(c.GetHeader(CSRFTokenHeader))) == 1
+}
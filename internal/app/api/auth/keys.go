@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	"math/big"
+	"pinman/internal/utils"
+	"sync"
+)
+
+var (
+	ErrUnknownSigningKey       = fmt.Errorf("token was signed with an unknown key")
+	ErrInvalidSigningAlgorithm = fmt.Errorf("token was signed with an unsupported algorithm")
+)
+
+var (
+	generatedKey     *rsa.PrivateKey
+	generatedKeyErr  error
+	generatedKeyOnce sync.Once
+)
+
+// KeySet holds the RSA keys access tokens are signed and verified with. Tokens are signed with the active key and
+// name it in their kid header, retired keys only verify the tokens issued before the last rotation. Keys are
+// identified by their RFC 7638 thumbprint, so a key keeps its ID when it is retired.
+type KeySet struct {
+	activeID string
+	active   *rsa.PrivateKey
+	// keys holds the active and retired public keys, the active one first
+	keys []verificationKey
+	// legacySecret verifies the HS256 tokens issued before tokens were signed with RSA keys
+	legacySecret []byte
+}
+
+type verificationKey struct {
+	id  string
+	key *rsa.PublicKey
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// NewKeySet loads the signing key from TOKEN_PRIVATE_KEY and the retired keys from TOKEN_RETIRED_PUBLIC_KEYS, all of
+// them base64 encoded PEM. A random signing key is generated when none is configured.
+func NewKeySet(config *utils.Config) (*KeySet, error) {
+	active, err := loadSigningKey(config)
+	if err != nil {
+		return nil, err
+	}
+
+	activeID, err := keyID(&active.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	keySet := &KeySet{
+		activeID: activeID,
+		active:   active,
+		keys:     []verificationKey{{id: activeID, key: &active.PublicKey}},
+	}
+	if config.TokenSecretKey != "" {
+		keySet.legacySecret = []byte(config.TokenSecretKey)
+	}
+
+	for i, encoded := range config.TokenRetiredPublicKeys {
+		key, err := decodePublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode retired public key %d: %v", i+1, err)
+		}
+		id, err := keyID(key)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := keySet.find(id); ok {
+			continue
+		}
+		keySet.keys = append(keySet.keys, verificationKey{id: id, key: key})
+	}
+
+	return keySet, nil
+}
+
+func loadSigningKey(config *utils.Config) (*rsa.PrivateKey, error) {
+	if config.TokenPrivateKey == "" {
+		generatedKeyOnce.Do(func() {
+			log.Warn().Msg("TOKEN_PRIVATE_KEY is not set, users will be logged out when the server restarts")
+			generatedKey, generatedKeyErr = rsa.GenerateKey(rand.Reader, 2048)
+		})
+		if generatedKeyErr != nil {
+			return nil, fmt.Errorf("could not generate private key: %v", generatedKeyErr)
+		}
+		return generatedKey, nil
+	}
+
+	pem, err := base64.StdEncoding.DecodeString(config.TokenPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode private key: %v", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %v", err)
+	}
+
+	// the public key is optional, but it must belong to the private key if it is set
+	if config.TokenPublicKey != "" {
+		publicKey, err := decodePublicKey(config.TokenPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode public key: %v", err)
+		}
+		if !publicKey.Equal(&key.PublicKey) {
+			return nil, fmt.Errorf("public key does not belong to the private key")
+		}
+	}
+
+	return key, nil
+}
+
+func decodePublicKey(encoded string) (*rsa.PublicKey, error) {
+	pem, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(pem)
+}
+
+// keyID returns the RFC 7638 thumbprint of the key.
+func keyID(key *rsa.PublicKey) (string, error) {
+	jwk := newJSONWebKey("", key)
+	// the members have to be in lexicographic order, which json.Marshal keeps for maps
+	thumbprintInput, err := json.Marshal(map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(thumbprintInput)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func newJSONWebKey(id string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: id,
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func (k *KeySet) find(id string) (*rsa.PublicKey, bool) {
+	for _, key := range k.keys {
+		if key.id == id {
+			return key.key, true
+		}
+	}
+	return nil, false
+}
+
+// sign signs the claims with the active key.
+func (k *KeySet) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.activeID
+	return token.SignedString(k.active)
+}
+
+// keyFunc returns the key the token was signed with.
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		if k.legacySecret != nil && token.Method == jwt.SigningMethodHS256 {
+			return k.legacySecret, nil
+		}
+		return nil, ErrUnknownSigningKey
+	}
+
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, ErrInvalidSigningAlgorithm
+	}
+	key, ok := k.find(kid)
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+	return key, nil
+}
+
+// jwks returns the public keys tokens are verified with.
+func (k *KeySet) jwks() jsonWebKeySet {
+	keySet := jsonWebKeySet{Keys: make([]jsonWebKey, 0, len(k.keys))}
+	for _, key := range k.keys {
+		keySet.Keys = append(keySet.Keys, newJSONWebKey(key.id, key.key))
+	}
+	return keySet
+}
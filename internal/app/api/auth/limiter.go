@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"net/http"
+	"pinman/internal/app/api/errors"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const retryAfterKey = "retryAfter"
+
+var ErrTooManyLoginAttempts = fmt.Errorf("too many failed login attempts, please try again later")
+
+// loginLimiter slows down guessing passwords. Every failed login for an account doubles the time before the next
+// attempt for it is accepted, and accounts and IP addresses are locked for a while after too many failed logins.
+// IP addresses are only locked, their limit is meant to be high enough for users sharing an address.
+type loginLimiter struct {
+	db               *gorm.DB
+	maxFailures      int
+	maxFailuresPerIP int
+	lockoutDuration  time.Duration
+}
+
+func newLoginLimiter(db *gorm.DB, config *utils.Config) *loginLimiter {
+	return &loginLimiter{
+		db:               db,
+		maxFailures:      config.LoginMaxFailures,
+		maxFailuresPerIP: config.LoginMaxFailuresPerIP,
+		lockoutDuration:  config.LoginLockoutDuration,
+	}
+}
+
+func accountLoginKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+// retryAfter returns how long to wait before the next login attempt for the email address is accepted from the
+// client, 0 if it is accepted right away.
+func (l *loginLimiter) retryAfter(ctx *gin.Context, email string) time.Duration {
+	var keys []string
+	if l.maxFailures > 0 {
+		keys = append(keys, accountLoginKey(email))
+	}
+	if l.maxFailuresPerIP > 0 {
+		keys = append(keys, ipLoginKey(ctx.ClientIP()))
+	}
+	if len(keys) == 0 {
+		return 0
+	}
+
+	var failures []models.FailedLogin
+	if err := l.db.Where("key IN ?", keys).Find(&failures).Error; err != nil {
+		// failing open keeps users able to log in while the database has trouble
+		log.Err(err).Msg("failed to look up failed logins")
+		return 0
+	}
+
+	var wait time.Duration
+	for _, failure := range failures {
+		notBefore := failure.LastFailedAt.Add(l.delay(failure))
+		if until := time.Until(notBefore); until > wait {
+			wait = until
+		}
+	}
+	return wait
+}
+
+// delay returns how long after the last failed login the next attempt is accepted.
+func (l *loginLimiter) delay(failure models.FailedLogin) time.Duration {
+	if strings.HasPrefix(failure.Key, "ip:") {
+		if failure.Count >= l.maxFailuresPerIP {
+			return l.lockoutDuration
+		}
+		return 0
+	}
+
+	if failure.Count >= l.maxFailures {
+		return l.lockoutDuration
+	}
+	// 1s, 2s, 4s, ... but never longer than the lockout
+	delay := time.Second * time.Duration(math.Pow(2, float64(failure.Count-1)))
+	if delay > l.lockoutDuration {
+		return l.lockoutDuration
+	}
+	return delay
+}
+
+// fail counts a failed login for the email address and the client, and locks them once they reach their limit.
+// user is nil for unknown email addresses.
+func (l *loginLimiter) fail(ctx *gin.Context, email string, user *models.User) {
+	if l.maxFailures > 0 {
+		if count, ok := l.count(accountLoginKey(email)); ok && count == l.maxFailures {
+			var userID *uuid.UUID
+			if user != nil {
+				userID = &user.ID
+			}
+			WriteAuditLog(l.db, ctx, &models.AuditLog{
+				Action: models.AuditActionAccountLocked,
+				UserID: userID,
+				Detail: fmt.Sprintf("%d failed logins for %s", count, email),
+			})
+		}
+	}
+	if l.maxFailuresPerIP > 0 {
+		if count, ok := l.count(ipLoginKey(ctx.ClientIP())); ok && count == l.maxFailuresPerIP {
+			WriteAuditLog(l.db, ctx, &models.AuditLog{
+				Action: models.AuditActionIPLocked,
+				Detail: fmt.Sprintf("%d failed logins from %s", count, ctx.ClientIP()),
+			})
+		}
+	}
+}
+
+// count increments the failed logins for the key and returns the new count. It starts over if no login failed for
+// the lockout duration.
+func (l *loginLimiter) count(key string) (int, bool) {
+	now := time.Now()
+	failure := &models.FailedLogin{Key: key, Count: 1, LastFailedAt: now}
+	err := l.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"count": gorm.Expr(
+					"CASE WHEN failed_logins.last_failed_at < ? THEN 1 ELSE failed_logins.count + 1 END",
+					now.Add(-l.lockoutDuration),
+				),
+				"last_failed_at": now,
+			}),
+		},
+		clause.Returning{},
+	).Create(failure).Error
+	if err != nil {
+		log.Err(err).Str("key", key).Msg("failed to count failed login")
+		return 0, false
+	}
+	return failure.Count, true
+}
+
+// succeed forgets the failed logins for the email address. Those of the client are kept, or logging in to an own
+// account would allow guessing the passwords of others.
+func (l *loginLimiter) succeed(email string) {
+	if l.maxFailures <= 0 {
+		return
+	}
+	if err := UnlockLogin(l.db, email); err != nil {
+		log.Err(err).Msg("failed to reset failed logins")
+	}
+}
+
+// UnlockLogin forgets the failed logins for the email address, so its account can be logged in to right away.
+func UnlockLogin(db *gorm.DB, email string) error {
+	return db.Delete(&models.FailedLogin{}, "key = ?", accountLoginKey(email)).Error
+}
+
+// abortTooManyAttempts responds with 429 and tells the client when to try again.
+func abortTooManyAttempts(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	errors.AbortWithError(http.StatusTooManyRequests, ErrTooManyLoginAttempts.Error(), c, map[string]interface{}{
+		"retry_after": seconds,
+	})
+}
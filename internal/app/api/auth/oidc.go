@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"net/http"
+	apierrors "pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/clients/oidc"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"strings"
+	"time"
+)
+
+const (
+	oidcStatePurpose      = "oidc-login"
+	oidcStateExpiresAfter = 10 * time.Minute
+)
+
+var (
+	ErrOIDCNotConfigured    = fmt.Errorf("OpenID Connect login is not configured")
+	ErrOIDCInvalidState     = fmt.Errorf("invalid or expired login state, please try again")
+	ErrOIDCFailed           = fmt.Errorf("OpenID Connect login failed")
+	ErrOIDCEmailNotVerified = fmt.Errorf("the identity provider has not verified the email address")
+)
+
+// GetOIDCAuthorizeHandlerFunc returns the URL of the provider's login page. The state is signed and carries the
+// nonce the ID token must contain, the SPA keeps it to check that the callback belongs to a login it started.
+func GetOIDCAuthorizeHandlerFunc(client oidc.ClientInterface, config *utils.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if client == nil {
+			apierrors.AbortWithError(http.StatusNotFound, ErrOIDCNotConfigured.Error(), c)
+			return
+		}
+
+		nonce, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), c)
+			return
+		}
+
+		state := utils.SignToken(
+			[]byte(config.LinkSigningKey),
+			oidcStatePurpose,
+			nonce,
+			time.Now().Add(oidcStateExpiresAfter),
+		)
+
+		authorizationURL, err := client.AuthCodeURL(c.Request.Context(), state, nonce)
+		if err != nil {
+			log.Err(err).Msg("failed to build OpenID Connect authorization URL")
+			apierrors.AbortWithError(http.StatusBadGateway, ErrOIDCFailed.Error(), c)
+			return
+		}
+
+		c.JSON(http.StatusOK, generated.OidcAuthorization{
+			AuthorizationUrl: authorizationURL,
+			State:            state,
+		})
+	}
+}
+
+// GetOIDCCallbackHandlerFunc completes the login with the code the provider sent the user back with, and responds
+// with the same tokens as a password login.
+func GetOIDCCallbackHandlerFunc(mw *JWTMiddleware, db *gorm.DB, client oidc.ClientInterface, config *utils.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if client == nil {
+			apierrors.AbortWithError(http.StatusNotFound, ErrOIDCNotConfigured.Error(), c)
+			return
+		}
+
+		payload := &generated.OidcCallback{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, err.Error(), c)
+			return
+		}
+
+		nonce, err := utils.VerifySignedToken([]byte(config.LinkSigningKey), oidcStatePurpose, payload.State)
+		if err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, ErrOIDCInvalidState.Error(), c)
+			return
+		}
+
+		claims, err := client.Authenticate(c.Request.Context(), payload.Code, nonce)
+		if err != nil {
+			log.Err(err).Msg("OpenID Connect login failed")
+			apierrors.AbortWithError(http.StatusUnauthorized, ErrOIDCFailed.Error(), c)
+			return
+		}
+
+		if claims.Email == "" || !claims.EmailVerified {
+			apierrors.AbortWithError(http.StatusUnauthorized, ErrOIDCEmailNotVerified.Error(), c)
+			return
+		}
+
+		user, err := findOrCreateOIDCUser(db, client.Issuer(), claims)
+		if err != nil {
+			log.Err(err).Str("subject", claims.Subject).Msg("failed to link OpenID Connect identity")
+			apierrors.AbortWithError(http.StatusInternalServerError, ErrOIDCFailed.Error(), c)
+			return
+		}
+		if user.DisabledAt != nil {
+			writeFailedLogin(db, c, user, ErrAccountDisabled.Error())
+			apierrors.AbortWithError(http.StatusUnauthorized, ErrAccountDisabled.Error(), c)
+			return
+		}
+
+		// the provider proving who the user is doesn't replace their second factor
+		challenge, err := newTwoFactorChallenge(db, config, user)
+		if err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to look up two-factor authentication")
+			apierrors.AbortWithError(http.StatusInternalServerError, ErrOIDCFailed.Error(), c)
+			return
+		}
+		if challenge != nil {
+			c.JSON(http.StatusAccepted, challenge)
+			return
+		}
+
+		respondWithTokens(mw, db, config, c, user)
+	}
+}
+
+// findOrCreateOIDCUser returns the user linked to the identity. Identities logging in for the first time are
+// linked to the user with the same email address, which the provider has verified, or to a new user without a
+// password. Linking to an unverified user drops its password and logs it out everywhere, as whoever registered the
+// address may not own it.
+func findOrCreateOIDCUser(db *gorm.DB, issuer string, claims *oidc.Claims) (*models.User, error) {
+	identity := &models.ExternalIdentity{}
+	err := db.Preload("User").First(identity, "issuer = ? AND subject = ?", issuer, claims.Subject).Error
+	if err == nil {
+		return &identity.User, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	user := &models.User{}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		email := strings.ToLower(claims.Email)
+		err := tx.First(user, "email = ?", email).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			name := claims.Name
+			if name == "" {
+				name = strings.Split(email, "@")[0]
+			}
+
+			*user = models.User{
+				Name:     name,
+				Email:    email,
+				Role:     models.RoleUser,
+				Verified: true,
+			}
+			err = tx.Create(user).Error
+		} else if err == nil && !user.Verified {
+			err = claimUnverifiedUser(tx, user)
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.ExternalIdentity{
+			UserID:  user.ID,
+			Issuer:  issuer,
+			Subject: claims.Subject,
+			Email:   email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// claimUnverifiedUser hands an unverified user over to the owner of its email address, which the provider verified.
+// Anyone could have registered with the address before, so their password, sessions and API tokens stop working.
+func claimUnverifiedUser(tx *gorm.DB, user *models.User) error {
+	err := tx.Model(user).Updates(map[string]interface{}{"password": "", "verified": true}).Error
+	if err != nil {
+		return err
+	}
+	user.Password = ""
+	user.Verified = true
+
+	if err := RevokeSessions(tx, user.ID); err != nil {
+		return err
+	}
+
+	return RevokeAPITokens(tx, user.ID)
+}
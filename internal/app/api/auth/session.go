@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"net/http"
+	apierrors "pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"time"
+)
+
+const (
+	SessionIDKey = "sid"
+
+	refreshTokenKey   = "refreshToken"
+	maxUserAgentChars = 512
+)
+
+var (
+	ErrInvalidRefreshToken  = fmt.Errorf("invalid or expired refresh token")
+	ErrRefreshTokenReused   = fmt.Errorf("refresh token was already used, the session has been revoked")
+	ErrRefreshTokenRequired = fmt.Errorf("refresh_token is required")
+)
+
+// GetSessionID returns the session the access token of the request was issued for.
+func GetSessionID(ctx *gin.Context) (uuid.UUID, error) {
+	sid, ok := jwt.ExtractClaims(ctx)[SessionIDKey].(string)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("token has no session")
+	}
+
+	return uuid.Parse(sid)
+}
+
+// RevokeSessions logs the user out of all their sessions, except the ones in keep.
+func RevokeSessions(db *gorm.DB, userID uuid.UUID, keep ...uuid.UUID) error {
+	query := db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if len(keep) > 0 {
+		query = query.Where("id NOT IN ?", keep)
+	}
+
+	return query.Update("revoked_at", time.Now()).Error
+}
+
+func revokeSession(db *gorm.DB, sessionID uuid.UUID) error {
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// startSession creates a session for the device the user logged in from together with its first refresh token.
+func startSession(db *gorm.DB, ctx *gin.Context, user *models.User, expiresAfter time.Duration) (*models.Session, string, error) {
+	userAgent := ctx.Request.UserAgent()
+	if len(userAgent) > maxUserAgentChars {
+		userAgent = userAgent[:maxUserAgentChars]
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IPAddress:  ctx.ClientIP(),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(expiresAfter),
+	}
+
+	var refreshToken string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		refreshToken, err = issueRefreshToken(tx, session.ID)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	WriteAuditLog(db, ctx, &models.AuditLog{
+		Action: models.AuditActionLogin,
+		UserID: &user.ID,
+		Detail: fmt.Sprintf("%s logged in", user.Email),
+	})
+
+	session.User = *user
+	return session, refreshToken, nil
+}
+
+func issueRefreshToken(db *gorm.DB, sessionID uuid.UUID) (string, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Create(&models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: utils.HashOpaqueToken(token),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetRefreshHandlerFunc exchanges a refresh token for a new access token and a new refresh token.
+func GetRefreshHandlerFunc(mw *JWTMiddleware, db *gorm.DB, config *utils.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := bindRefreshToken(mw, c)
+		if err != nil {
+			apierrors.AbortWithError(refreshTokenErrorStatus(err), err.Error(), c)
+			return
+		}
+
+		refreshToken := &models.RefreshToken{}
+		err = db.Preload("Session.User").
+			First(refreshToken, "token_hash = ?", utils.HashOpaqueToken(token)).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				apierrors.AbortWithError(http.StatusUnauthorized, ErrInvalidRefreshToken.Error(), c)
+				return
+			}
+			apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), c)
+			return
+		}
+
+		session := &refreshToken.Session
+		now := time.Now()
+		if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+			apierrors.AbortWithError(http.StatusUnauthorized, ErrInvalidRefreshToken.Error(), c)
+			return
+		}
+		if session.User.DisabledAt != nil {
+			apierrors.AbortWithError(http.StatusUnauthorized, ErrAccountDisabled.Error(), c)
+			return
+		}
+
+		if refreshToken.UsedAt != nil {
+			handleRefreshTokenReuse(db, session, c)
+			return
+		}
+
+		var newRefreshToken string
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// the used_at condition makes sure two concurrent requests can't both rotate the same token
+			result := tx.Model(&models.RefreshToken{}).
+				Where("id = ? AND used_at IS NULL", refreshToken.ID).
+				Update("used_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrRefreshTokenReused
+			}
+
+			session.LastUsedAt = now
+			session.ExpiresAt = now.Add(config.RefreshTokenExpiresAfter)
+			err := tx.Model(&models.Session{}).Where("id = ?", session.ID).Updates(map[string]interface{}{
+				"last_used_at": session.LastUsedAt,
+				"expires_at":   session.ExpiresAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			newRefreshToken, err = issueRefreshToken(tx, session.ID)
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, ErrRefreshTokenReused) {
+				handleRefreshTokenReuse(db, session, c)
+				return
+			}
+			apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), c)
+			return
+		}
+
+		accessToken, expire, err := mw.TokenGenerator(session)
+		if err != nil {
+			apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), c)
+			return
+		}
+
+		c.Set(refreshTokenKey, newRefreshToken)
+		mw.LoginResponse(c, http.StatusOK, accessToken, expire)
+	}
+}
+
+// handleRefreshTokenReuse revokes a session whose refresh token was presented twice, as either the user or an
+// attacker holds a stolen copy and there is no telling which one is making the request.
+func handleRefreshTokenReuse(db *gorm.DB, session *models.Session, c *gin.Context) {
+	log.Warn().Str("sessionId", session.ID.String()).Str("userId", session.UserID.String()).
+		Msg("refresh token reused, revoking session")
+	if err := revokeSession(db, session.ID); err != nil {
+		apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), c)
+		return
+	}
+
+	apierrors.AbortWithError(http.StatusUnauthorized, ErrRefreshTokenReused.Error(), c)
+}
+
+// GetLogoutHandlerFunc revokes the session of the given refresh token. Unknown tokens are ignored, so logging out
+// always succeeds.
+func GetLogoutHandlerFunc(mw *JWTMiddleware, db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := bindRefreshToken(mw, c)
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			// the browser has no session, but it may still have some of the cookies
+			mw.cookies.clear(c)
+			c.Status(http.StatusNoContent)
+			return
+		}
+		if err != nil {
+			apierrors.AbortWithError(refreshTokenErrorStatus(err), err.Error(), c)
+			return
+		}
+		if mw.cookies.enabled() {
+			mw.cookies.clear(c)
+		}
+
+		refreshToken := &models.RefreshToken{}
+		err = db.First(refreshToken, "token_hash = ?", utils.HashOpaqueToken(token)).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.Status(http.StatusNoContent)
+				return
+			}
+			apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), c)
+			return
+		}
+
+		if err := revokeSession(db, refreshToken.SessionID); err != nil {
+			apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), c)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// bindRefreshToken returns the refresh token of the request body, or the one of the cookie if the body has none.
+func bindRefreshToken(mw *JWTMiddleware, c *gin.Context) (string, error) {
+	payload := &generated.TokenRefresh{}
+	if err := c.ShouldBindJSON(payload); err != nil {
+		return "", err
+	}
+	if payload.RefreshToken != nil && *payload.RefreshToken != "" {
+		return *payload.RefreshToken, nil
+	}
+
+	if !mw.cookies.enabled() {
+		return "", ErrRefreshTokenRequired
+	}
+	token, err := c.Cookie(RefreshTokenCookie)
+	if err != nil || token == "" {
+		return "", ErrInvalidRefreshToken
+	}
+	if !verifyCSRFToken(c) {
+		return "", ErrInvalidCSRFToken
+	}
+	return token, nil
+}
+
+func refreshTokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidRefreshToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInvalidCSRFToken):
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,407 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	apierrors "pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorChallengePurpose      = "2fa-login"
+	twoFactorChallengeExpiresAfter = 5 * time.Minute
+	twoFactorChallengeKey          = "twoFactorChallenge"
+	recoveryCodesKey               = "recoveryCodes"
+
+	// RecoveryCodeCount is how many recovery codes a user gets, generating new ones replaces all of them
+	RecoveryCodeCount = 10
+	// TOTPIssuer is the name authenticator apps show for the account
+	TOTPIssuer = "Pinman"
+)
+
+var (
+	ErrInvalidTwoFactorChallenge = fmt.Errorf("invalid or expired login, please log in again")
+	ErrInvalidTwoFactorCode      = fmt.Errorf("invalid two-factor authentication code")
+	ErrTwoFactorAlreadyEnabled   = fmt.Errorf("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled      = fmt.Errorf("two-factor authentication has not been set up")
+	ErrTwoFactorRequired         = fmt.Errorf("two-factor authentication is required for your role")
+
+	// errTwoFactorChallenge makes the login handler respond with the challenge instead of a token
+	errTwoFactorChallenge = fmt.Errorf("two-factor authentication required")
+)
+
+// GetTwoFactor returns the authenticator app of the user, nil if they never set one up.
+func GetTwoFactor(db *gorm.DB, userID uuid.UUID) (*models.TwoFactor, error) {
+	twoFactor := &models.TwoFactor{}
+	result := db.Limit(1).Find(twoFactor, "user_id = ?", userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	return twoFactor, nil
+}
+
+// TwoFactorRequired returns whether admins require users with the role to use two-factor authentication.
+func TwoFactorRequired(db *gorm.DB, role string) (bool, error) {
+	setting := &models.RoleSetting{}
+	if err := db.Limit(1).Find(setting, "role = ?", role).Error; err != nil {
+		return false, err
+	}
+
+	return setting.TwoFactorRequired, nil
+}
+
+// newTwoFactorChallenge returns the challenge the user has to answer to finish logging in, nil if their password is
+// enough. Users whose role requires two-factor authentication but who haven't set it up have to enroll first.
+func newTwoFactorChallenge(db *gorm.DB, config *utils.Config, user *models.User) (*generated.TwoFactorChallenge, error) {
+	twoFactor, err := GetTwoFactor(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := twoFactor != nil && twoFactor.EnabledAt != nil
+	if !enabled {
+		required, err := TwoFactorRequired(db, user.Role)
+		if err != nil || !required {
+			return nil, err
+		}
+	}
+
+	return &generated.TwoFactorChallenge{
+		ChallengeToken: utils.SignToken(
+			[]byte(config.LinkSigningKey),
+			twoFactorChallengePurpose,
+			user.ID.String(),
+			time.Now().Add(twoFactorChallengeExpiresAfter),
+		),
+		EnrollmentRequired: !enabled,
+	}, nil
+}
+
+// getChallengeUser returns the user who was given the challenge token after entering their password.
+func getChallengeUser(db *gorm.DB, config *utils.Config, token string) (*models.User, error) {
+	userID, err := utils.VerifySignedToken([]byte(config.LinkSigningKey), twoFactorChallengePurpose, token)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+
+	user := &models.User{}
+	if err := db.First(user, "id = ?", userID).Error; err != nil {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+	// the account may have been disabled since the password was entered
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	return user, nil
+}
+
+// StartTwoFactorEnrollment generates a new secret for the user's authenticator app. It replaces a secret that was
+// never confirmed, callers have to check two-factor authentication is not enabled yet.
+func StartTwoFactorEnrollment(db *gorm.DB, user *models.User) (*generated.TotpEnrollment, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "updated_at"}),
+	}).Create(&models.TwoFactor{UserID: user.ID, Secret: secret}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &generated.TotpEnrollment{
+		Secret:          secret,
+		ProvisioningUri: utils.TOTPProvisioningURI(TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor enables the authenticator app once the user confirmed it with a code, and returns their recovery
+// codes.
+func EnableTwoFactor(db *gorm.DB, ctx *gin.Context, user *models.User, twoFactor *models.TwoFactor, code string) ([]string, error) {
+	step, ok := utils.ValidateTOTP(twoFactor.Secret, normalizeTwoFactorCode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.TwoFactor{}).
+			Where("user_id = ? AND enabled_at IS NULL", user.ID).
+			Updates(map[string]interface{}{"enabled_at": time.Now(), "last_used_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		var err error
+		codes, err = ReplaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	WriteAuditLog(db, ctx, &models.AuditLog{
+		Action: models.AuditActionTwoFactorOn,
+		UserID: &user.ID,
+		Detail: fmt.Sprintf("two-factor authentication enabled for %s", user.Email),
+	})
+	return codes, nil
+}
+
+// DisableTwoFactor removes the authenticator app and the recovery codes of the user.
+func DisableTwoFactor(db *gorm.DB, ctx *gin.Context, user *models.User) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.RecoveryCode{}, "user_id = ?", user.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.TwoFactor{}, "user_id = ?", user.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	WriteAuditLog(db, ctx, &models.AuditLog{
+		Action: models.AuditActionTwoFactorOff,
+		UserID: &user.ID,
+		Detail: fmt.Sprintf("two-factor authentication disabled for %s", user.Email),
+	})
+	return nil
+}
+
+// ReplaceRecoveryCodes generates new recovery codes for the user, the old ones stop working.
+func ReplaceRecoveryCodes(db *gorm.DB, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashOpaqueToken(normalizeTwoFactorCode(code)),
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.RecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyTwoFactorCode checks a code from the user's authenticator app or one of their recovery codes. Either can
+// only be used once.
+func VerifyTwoFactorCode(db *gorm.DB, twoFactor *models.TwoFactor, code string) error {
+	code = normalizeTwoFactorCode(code)
+
+	if step, ok := utils.ValidateTOTP(twoFactor.Secret, code, time.Now()); ok {
+		result := db.Model(&models.TwoFactor{}).
+			Where("user_id = ? AND last_used_step < ?", twoFactor.UserID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", twoFactor.UserID, utils.HashOpaqueToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// RevokeAccessWithoutTwoFactor logs out the users with the role who haven't enabled two-factor authentication and
+// revokes their API tokens, so they have to set it up when they log in again. Passing users only revokes theirs.
+func RevokeAccessWithoutTwoFactor(db *gorm.DB, role string, userIDs ...uuid.UUID) error {
+	users := db.Model(&models.User{}).
+		Select("id").
+		Where("role = ? AND id NOT IN (?)", role, db.Model(&models.TwoFactor{}).
+			Select("user_id").
+			Where("enabled_at IS NOT NULL"))
+	if len(userIDs) > 0 {
+		users = users.Where("id IN ?", userIDs)
+	}
+
+	now := time.Now()
+	err := db.Model(&models.Session{}).
+		Where("revoked_at IS NULL AND user_id IN (?)", users).
+		Update("revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&models.APIToken{}).
+		Where("revoked_at IS NULL AND user_id IN (?)", users).
+		Update("revoked_at", now).Error
+}
+
+// generateRecoveryCode returns a code like "k3m9x-q2w7p" that is easy to write down.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating recovery code: %w", err)
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeTwoFactorCode ignores the formatting users add when typing codes.
+func normalizeTwoFactorCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// GetTwoFactorEnrollHandlerFunc returns the secret for the authenticator app of a user who has to set up
+// two-factor authentication before logging in.
+func GetTwoFactorEnrollHandlerFunc(db *gorm.DB, config *utils.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payload := &generated.TwoFactorEnroll{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, err.Error(), c)
+			return
+		}
+
+		user, err := getChallengeUser(db, config, payload.ChallengeToken)
+		if err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, err.Error(), c)
+			return
+		}
+
+		twoFactor, err := GetTwoFactor(db, user.ID)
+		if err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to look up two-factor authentication")
+			apierrors.AbortWithError(http.StatusInternalServerError, "failed to set up two-factor authentication", c)
+			return
+		}
+		// the challenge only proves the password, it must not replace an authenticator app that is in use
+		if twoFactor != nil && twoFactor.EnabledAt != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, ErrTwoFactorAlreadyEnabled.Error(), c)
+			return
+		}
+
+		enrollment, err := StartTwoFactorEnrollment(db, user)
+		if err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to start two-factor enrollment")
+			apierrors.AbortWithError(http.StatusInternalServerError, "failed to set up two-factor authentication", c)
+			return
+		}
+
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+// GetTwoFactorVerifyHandlerFunc finishes a login that was answered with a challenge. Users who had to enroll get
+// their recovery codes along with the tokens. Wrong codes count as failed logins.
+func GetTwoFactorVerifyHandlerFunc(mw *JWTMiddleware, db *gorm.DB, config *utils.Config) gin.HandlerFunc {
+	limiter := newLoginLimiter(db, config)
+
+	return func(c *gin.Context) {
+		payload := &generated.TwoFactorVerify{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, err.Error(), c)
+			return
+		}
+
+		user, err := getChallengeUser(db, config, payload.ChallengeToken)
+		if err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, err.Error(), c)
+			return
+		}
+
+		if retryAfter := limiter.retryAfter(c, user.Email); retryAfter > 0 {
+			abortTooManyAttempts(c, retryAfter)
+			return
+		}
+
+		twoFactor, err := GetTwoFactor(db, user.ID)
+		if err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to look up two-factor authentication")
+			apierrors.AbortWithError(http.StatusInternalServerError, jwt.ErrFailedTokenCreation.Error(), c)
+			return
+		}
+		if twoFactor == nil {
+			apierrors.AbortWithError(http.StatusBadRequest, ErrTwoFactorNotEnrolled.Error(), c)
+			return
+		}
+
+		if twoFactor.EnabledAt == nil {
+			var codes []string
+			codes, err = EnableTwoFactor(db, c, user, twoFactor, payload.Code)
+			c.Set(recoveryCodesKey, codes)
+		} else {
+			err = VerifyTwoFactorCode(db, twoFactor, payload.Code)
+		}
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			writeFailedLogin(db, c, user, err.Error())
+			limiter.fail(c, user.Email, user)
+			apierrors.AbortWithError(http.StatusUnauthorized, err.Error(), c)
+			return
+		} else if err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to verify two-factor authentication code")
+			apierrors.AbortWithError(http.StatusInternalServerError, jwt.ErrFailedTokenCreation.Error(), c)
+			return
+		}
+		limiter.succeed(user.Email)
+
+		respondWithTokens(mw, db, config, c, user)
+	}
+}
+
+// respondWithTokens logs the user in on a new session and responds like the login handler does.
+func respondWithTokens(mw *JWTMiddleware, db *gorm.DB, config *utils.Config, c *gin.Context, user *models.User) {
+	session, refreshToken, err := startSession(db, c, user, config.RefreshTokenExpiresAfter)
+	if err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to start session")
+		apierrors.AbortWithError(http.StatusInternalServerError, jwt.ErrFailedTokenCreation.Error(), c)
+		return
+	}
+
+	token, expire, err := mw.TokenGenerator(session)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusInternalServerError, jwt.ErrFailedTokenCreation.Error(), c)
+		return
+	}
+
+	c.Set(refreshTokenKey, refreshToken)
+	mw.LoginResponse(c, http.StatusOK, token, expire)
+}
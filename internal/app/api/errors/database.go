@@ -0,0 +1,141 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgForeignKeyViolation  = "23503"
+	pgUniqueViolation      = "23505"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+var (
+	ErrNotFound             = stderrors.New("record not found")
+	ErrUniqueViolation      = stderrors.New("unique constraint violated")
+	ErrForeignKeyViolation  = stderrors.New("foreign key constraint violated")
+	ErrSerializationFailure = stderrors.New("transaction conflicted with a concurrent one")
+)
+
+// keyDetail matches the detail of constraint violations, like `Key (slug)=(pinballz) already exists.`
+var keyDetail = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// DatabaseError is a database error translated to one of the typed errors, ErrNotFound, ErrUniqueViolation,
+// ErrForeignKeyViolation or ErrSerializationFailure, which errors.Is matches it against.
+type DatabaseError struct {
+	Kind error
+	// Table and Constraint name what was violated, and Fields the columns of the constraint, if the database says so
+	Table      string
+	Constraint string
+	Fields     []string
+	Err        error
+}
+
+func (e *DatabaseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func (e *DatabaseError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *DatabaseError) Unwrap() error {
+	return e.Err
+}
+
+// TranslateDBError translates errors returned by gorm to a DatabaseError, and returns other errors unchanged.
+func TranslateDBError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var translated *DatabaseError
+	if stderrors.As(err, &translated) {
+		return translated
+	}
+
+	switch {
+	case stderrors.Is(err, gorm.ErrRecordNotFound):
+		return &DatabaseError{Kind: ErrNotFound, Err: err}
+	case stderrors.Is(err, gorm.ErrDuplicatedKey):
+		return &DatabaseError{Kind: ErrUniqueViolation, Err: err}
+	case stderrors.Is(err, gorm.ErrForeignKeyViolated):
+		return &DatabaseError{Kind: ErrForeignKeyViolation, Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if !stderrors.As(err, &pgErr) {
+		return err
+	}
+	translated = &DatabaseError{Table: pgErr.TableName, Constraint: pgErr.ConstraintName, Err: err}
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		translated.Kind = ErrUniqueViolation
+	case pgForeignKeyViolation:
+		translated.Kind = ErrForeignKeyViolation
+	case pgSerializationFailure, pgDeadlockDetected:
+		translated.Kind = ErrSerializationFailure
+	default:
+		return err
+	}
+	if match := keyDetail.FindStringSubmatch(pgErr.Detail); match != nil {
+		for _, field := range strings.Split(match[1], ",") {
+			translated.Fields = append(translated.Fields, strings.Trim(strings.TrimSpace(field), `"`))
+		}
+	}
+	return translated
+}
+
+// DBErrorDetails are the details to respond with for the kinds of database errors a request expects, like
+// ErrUniqueViolation: "league with slug already exists".
+type DBErrorDetails map[error]string
+
+// AbortWithDBError aborts with the status that fits the database error: 404 for missing records, 409 for unique
+// violations and serialization failures and 400 for foreign key violations, with the detail for the error from
+// details. Errors the request doesn't expect are logged and abort with 500 and failure as detail. The fields that
+// caused a violation are listed in the meta of the response.
+func AbortWithDBError(ctx *gin.Context, err error, failure string, details DBErrorDetails) {
+	translated := TranslateDBError(err)
+
+	var dbErr *DatabaseError
+	if !stderrors.As(translated, &dbErr) {
+		log.Err(err).Msg(failure)
+		AbortWithError(http.StatusInternalServerError, failure, ctx)
+		return
+	}
+
+	detail, expected := details[dbErr.Kind]
+	if !expected && dbErr.Kind == ErrSerializationFailure {
+		// any request can run into a concurrent one, and can simply be retried
+		detail, expected = "the request conflicted with a concurrent one, please try again", true
+	}
+	if !expected {
+		// a violation nobody expected is a bug rather than a bad request
+		log.Err(err).Msg(failure)
+		AbortWithError(http.StatusInternalServerError, failure, ctx)
+		return
+	}
+
+	code := http.StatusConflict
+	switch dbErr.Kind {
+	case ErrNotFound:
+		code = http.StatusNotFound
+	case ErrForeignKeyViolation:
+		code = http.StatusBadRequest
+	}
+
+	if len(dbErr.Fields) > 0 {
+		AbortWithError(code, detail, ctx, map[string]interface{}{"fields": dbErr.Fields})
+		return
+	}
+	AbortWithError(code, detail, ctx)
+}
@@ -2,7 +2,11 @@ package errors_test
 
 import (
 	"encoding/json"
+	stderrors "errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
 	"pinman/internal/app/api/errors"
@@ -70,3 +74,85 @@ var _ = g.Describe("AbortWithError", func() {
 		})
 	})
 })
+
+var _ = g.Describe("TranslateDBError", func() {
+	g.It("translates missing records", func() {
+		err := errors.TranslateDBError(fmt.Errorf("finding league: %w", gorm.ErrRecordNotFound))
+		m.Expect(err).To(m.MatchError(errors.ErrNotFound))
+	})
+
+	g.It("translates Postgres constraint violations and names their fields", func() {
+		err := errors.TranslateDBError(&pgconn.PgError{
+			Code:           "23503",
+			TableName:      "leagues",
+			ConstraintName: "fk_leagues_location",
+			Detail:         `Key (location_id)=(0d0c2dcb-30a4-4d8f-a1c4-1c5c1e0d6b5e) is not present in table "locations".`,
+		})
+		m.Expect(err).To(m.MatchError(errors.ErrForeignKeyViolation))
+
+		var dbErr *errors.DatabaseError
+		m.Expect(stderrors.As(err, &dbErr)).To(m.BeTrue())
+		m.Expect(dbErr.Table).To(m.Equal("leagues"))
+		m.Expect(dbErr.Fields).To(m.Equal([]string{"location_id"}))
+	})
+
+	g.It("translates serialization failures and deadlocks", func() {
+		m.Expect(errors.TranslateDBError(&pgconn.PgError{Code: "40001"})).To(m.MatchError(errors.ErrSerializationFailure))
+		m.Expect(errors.TranslateDBError(&pgconn.PgError{Code: "40P01"})).To(m.MatchError(errors.ErrSerializationFailure))
+	})
+
+	g.It("returns other errors unchanged", func() {
+		err := fmt.Errorf("connection refused")
+		m.Expect(errors.TranslateDBError(err)).To(m.Equal(err))
+		pgErr := &pgconn.PgError{Code: "42P01"}
+		m.Expect(errors.TranslateDBError(pgErr)).To(m.Equal(pgErr))
+	})
+})
+
+var _ = g.Describe("AbortWithDBError", func() {
+	var ctx *gin.Context
+	var rr *httptest.ResponseRecorder
+
+	g.BeforeEach(func() {
+		ctx, rr, _ = utils.NewGinTestCtx()
+	})
+
+	g.It("responds with the status and detail of expected errors", func() {
+		errors.AbortWithDBError(ctx, &pgconn.PgError{
+			Code: "23505", Detail: "Key (slug)=(pinballz) already exists.",
+		}, "failed to create league", errors.DBErrorDetails{
+			errors.ErrUniqueViolation: "league with slug already exists",
+		})
+
+		m.Expect(rr.Code).To(m.Equal(http.StatusConflict))
+		response := &generated.ErrorResponse{}
+		m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+		m.Expect(response.Detail).To(m.Equal("league with slug already exists"))
+		m.Expect(*response.Meta).To(m.Equal(map[string]interface{}{"fields": []interface{}{"slug"}}))
+	})
+
+	g.It("responds with not found for missing records", func() {
+		errors.AbortWithDBError(ctx, gorm.ErrRecordNotFound, "failed to get league", errors.DBErrorDetails{
+			errors.ErrNotFound: "league not found",
+		})
+
+		m.Expect(rr.Code).To(m.Equal(http.StatusNotFound))
+	})
+
+	g.It("asks to retry after serialization failures", func() {
+		errors.AbortWithDBError(ctx, &pgconn.PgError{Code: "40001"}, "failed to create league", nil)
+
+		m.Expect(rr.Code).To(m.Equal(http.StatusConflict))
+	})
+
+	g.It("fails for unexpected errors", func() {
+		errors.AbortWithDBError(ctx, gorm.ErrRecordNotFound, "failed to create league", errors.DBErrorDetails{
+			errors.ErrUniqueViolation: "league with slug already exists",
+		})
+
+		m.Expect(rr.Code).To(m.Equal(http.StatusInternalServerError))
+		response := &generated.ErrorResponse{}
+		m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+		m.Expect(response.Detail).To(m.Equal("failed to create league"))
+	})
+})
@@ -0,0 +1,87 @@
+// Package include parses the include query parameter, which names the related resources a response embeds. Only the
+// included relations are preloaded, so callers that don't need them don't pay for the queries.
+package include
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+)
+
+const (
+	Location = "location"
+	League   = "league"
+	Owner    = "owner"
+)
+
+// associations are the names of the relations on the models.
+var associations = map[string]string{
+	Location: "Location",
+	League:   "League",
+	Owner:    "Owner",
+}
+
+// Relations are the relations a response embeds.
+type Relations []string
+
+// Parse parses a comma separated include parameter. Without the parameter the defaults are included, an empty
+// parameter includes nothing. The relations are kept in the order they are allowed in, so the preload queries run in
+// the same order whichever order the caller named them in.
+func Parse(value *string, allowed []string, defaults ...string) (Relations, error) {
+	if value == nil {
+		return defaults, nil
+	}
+
+	requested := map[string]bool{}
+	for _, name := range strings.Split(*value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !contains(allowed, name) {
+			return nil, fmt.Errorf("can't include %q, include any of %s", name, strings.Join(allowed, ", "))
+		}
+		requested[name] = true
+	}
+
+	relations := Relations{}
+	for _, name := range allowed {
+		if requested[name] {
+			relations = append(relations, name)
+		}
+	}
+	return relations, nil
+}
+
+// Has returns whether the relation is included.
+func (r Relations) Has(relation string) bool {
+	return contains(r, relation)
+}
+
+// Scope preloads the included relations.
+func (r Relations) Scope(db *gorm.DB) *gorm.DB {
+	for _, relation := range r {
+		db = db.Preload(associations[relation])
+	}
+	return db
+}
+
+// UnscopedScope preloads the included relations even if they are deleted, for listing deleted records whose relations
+// were deleted along with them.
+func (r Relations) UnscopedScope(db *gorm.DB) *gorm.DB {
+	for _, relation := range r {
+		db = db.Preload(associations[relation], func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		})
+	}
+	return db
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package include_test
+
+import (
+	"pinman/internal/app/api/include"
+	"pinman/internal/utils"
+	"testing"
+
+	g "github.com/onsi/ginkgo/v2"
+	m "github.com/onsi/gomega"
+)
+
+func TestInclude(t *testing.T) {
+	m.RegisterFailHandler(g.Fail)
+	g.RunSpecs(t, "Include Suite")
+}
+
+var _ = g.Describe("Parse", func() {
+	allowed := []string{include.Location, include.Owner}
+
+	g.It("includes the defaults without a parameter", func() {
+		relations, err := include.Parse(nil, allowed, include.Location)
+		m.Expect(err).To(m.BeNil())
+		m.Expect(relations.Has(include.Location)).To(m.BeTrue())
+		m.Expect(relations.Has(include.Owner)).To(m.BeFalse())
+	})
+
+	g.It("includes nothing with an empty parameter", func() {
+		relations, err := include.Parse(utils.PtrString(""), allowed, include.Location)
+		m.Expect(err).To(m.BeNil())
+		m.Expect(relations).To(m.BeEmpty())
+	})
+
+	g.It("orders the relations like the allowed ones", func() {
+		relations, err := include.Parse(utils.PtrString("owner, location,owner"), allowed)
+		m.Expect(err).To(m.BeNil())
+		m.Expect(relations).To(m.Equal(include.Relations{include.Location, include.Owner}))
+	})
+
+	g.It("rejects relations that aren't allowed", func() {
+		_, err := include.Parse(utils.PtrString("location,league"), allowed)
+		m.Expect(err).To(m.MatchError(`can't include "league", include any of location, owner`))
+	})
+})
@@ -1,13 +1,19 @@
 package league
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 	"net/http"
 	"pinman/internal/app/api/auth"
 	apierrors "pinman/internal/app/api/errors"
+	"pinman/internal/app/api/include"
+	"pinman/internal/app/api/location"
+	"pinman/internal/app/api/pagination"
+	"pinman/internal/app/api/slug"
 	"pinman/internal/app/generated"
 	"pinman/internal/models"
 	"pinman/internal/utils"
@@ -16,16 +22,25 @@ import (
 )
 
 type Controller struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	Slugs *slug.Service
 }
 
 func NewController(db *gorm.DB) *Controller {
 	return &Controller{
-		DB: db,
+		DB:    db,
+		Slugs: slug.NewService(db),
 	}
 }
 
-func (c *Controller) CreateLeague(ctx *gin.Context) {
+// includeRelations are the relations leagues can embed, and defaultRelations the ones they embed without an include
+// parameter.
+var (
+	includeRelations = []string{include.Location, include.Owner}
+	defaultRelations = []string{include.Location}
+)
+
+func (c *Controller) CreateLeague(ctx *gin.Context, params generated.PostLeaguesParams) {
 	payload := &generated.LeagueCreate{}
 
 	currentUser, err := auth.GetUser(ctx)
@@ -34,133 +49,303 @@ func (c *Controller) CreateLeague(ctx *gin.Context) {
 		return
 	}
 
+	relations, err := include.Parse(params.Include, includeRelations, defaultRelations...)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
 	if err := ctx.ShouldBindJSON(payload); err != nil {
 		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
 		return
 	}
 
 	location := models.Location{}
-	locationQueryResult := c.DB.Where("id = ?", payload.LocationId).First(&location)
-	if locationQueryResult.Error != nil {
-		if strings.Contains(locationQueryResult.Error.Error(), "not found") {
-			apierrors.AbortWithError(http.StatusBadRequest, fmt.Sprintf("location with id %s does not exist", payload.LocationId), ctx)
-			return
-		} else {
-			log.Err(locationQueryResult.Error).Msg("failed to get location")
-			apierrors.AbortWithError(http.StatusInternalServerError, "failed to get location", ctx)
+	if err := c.DB.Where("id = ?", payload.LocationId).First(&location).Error; err != nil {
+		if errors.Is(apierrors.TranslateDBError(err), apierrors.ErrNotFound) {
+			apierrors.AbortWithError(
+				http.StatusBadRequest, fmt.Sprintf("location with id %s does not exist", payload.LocationId), ctx,
+				map[string]interface{}{"fields": []string{"location_id"}},
+			)
 			return
 		}
+		log.Err(err).Msg("failed to get location")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to get location", ctx)
+		return
 	}
 
 	now := time.Now()
 	league := models.League{
 		Name:       payload.Name,
 		OwnerID:    currentUser.ID,
-		Slug:       payload.Slug,
 		LocationID: location.ID,
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
 
-	createResult := c.DB.Create(&league)
-	if createResult.Error != nil {
-		if strings.Contains(createResult.Error.Error(), "duplicate key") {
-			apierrors.AbortWithError(http.StatusConflict, "league with slug already exists", ctx)
-			return
-		} else {
-			log.Err(createResult.Error).Msg("failed to create league")
-			apierrors.AbortWithError(http.StatusInternalServerError, "failed to create league", ctx)
-			return
-		}
+	err = c.Slugs.Create(slug.League, payload.Name, payload.Slug, func(leagueSlug string) error {
+		league.Slug = leagueSlug
+		return c.DB.Create(&league).Error
+	})
+	if errors.Is(err, slug.ErrInvalidSlug) {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx, map[string]interface{}{"fields": []string{"slug"}})
+		return
 	}
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to create league", apierrors.DBErrorDetails{
+			apierrors.ErrUniqueViolation:     "league with slug already exists",
+			apierrors.ErrForeignKeyViolation: "location or owner of the league does not exist",
+		})
+		return
+	}
+
+	// the relations were loaded to create the league, so they don't have to be preloaded
+	league.Location = location
+	league.Owner = *currentUser
 
+	response := NewLeague(&league, relations)
 	ctx.JSON(http.StatusCreated, generated.LeagueResponse{
-		League: &generated.League{
-			Id:      league.ID.String(),
-			Name:    league.Name,
-			Slug:    league.Slug,
-			OwnerId: league.OwnerID.String(),
-			Location: &generated.Location{
-				Address:      location.Address,
-				Id:           location.ID.String(),
-				Name:         location.Name,
-				PinballMapId: location.PinballMapID,
-				Slug:         location.Slug,
-				CreatedAt:    utils.FormatTime(league.CreatedAt),
-				UpdatedAt:    utils.FormatTime(league.UpdatedAt),
-			},
-			CreatedAt: utils.FormatTime(league.CreatedAt),
-			UpdatedAt: utils.FormatTime(league.UpdatedAt),
-		},
+		League: &response,
 	})
 }
 
-func (c *Controller) ListLeagues(ctx *gin.Context) {
+// leagueSortFields are the fields leagues can be sorted by.
+var leagueSortFields = []pagination.Field[models.League]{
+	{Column: "created_at", Value: func(league *models.League) interface{} { return league.CreatedAt }},
+	{Column: "name", Value: func(league *models.League) interface{} { return league.Name }},
+}
+
+// ListLeagues lists one page of the leagues matching the filters, most recently created first unless sorted otherwise.
+// Deleted leagues are only listed if the parameters include them.
+func (c *Controller) ListLeagues(ctx *gin.Context, params generated.GetLeaguesParams) {
+	page, err := pagination.New(pagination.Params{
+		Limit:  params.Limit,
+		Cursor: params.Cursor,
+		Sort:   params.Sort,
+	}, leagueSortFields)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+	relations, err := include.Parse(params.Include, includeRelations, defaultRelations...)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	var ownerID, locationID *uuid.UUID
+	if params.OwnerId != nil && *params.OwnerId != "" {
+		id, err := uuid.Parse(*params.OwnerId)
+		if err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, "owner_id must be a UUID", ctx)
+			return
+		}
+		ownerID = &id
+	}
+	if params.LocationId != nil && *params.LocationId != "" {
+		id, err := uuid.Parse(*params.LocationId)
+		if err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, "location_id must be a UUID", ctx)
+			return
+		}
+		locationID = &id
+	}
+
+	includeDeleted := params.IncludeDeleted != nil && *params.IncludeDeleted
+	filter := func(db *gorm.DB) *gorm.DB {
+		if params.Search != nil && *params.Search != "" {
+			db = db.Where("LOWER(name) LIKE ?", "%"+utils.EscapeLike(strings.ToLower(*params.Search))+"%")
+		}
+		if ownerID != nil {
+			db = db.Where("owner_id = ?", *ownerID)
+		}
+		if locationID != nil {
+			db = db.Where("location_id = ?", *locationID)
+		}
+		if includeDeleted {
+			db = db.Unscoped()
+		}
+		return db
+	}
+	relationsScope := relations.Scope
+	if includeDeleted {
+		relationsScope = relations.UnscopedScope
+	}
+
+	var total int64
+	if err := c.DB.Model(&models.League{}).Scopes(filter).Count(&total).Error; err != nil {
+		log.Err(err).Msg("failed to count leagues")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list leagues", ctx)
+		return
+	}
+
 	var dbResults []models.League
-	result := c.DB.Preload("Location").Find(&dbResults)
+	result := c.DB.Scopes(relationsScope, filter, page.Scope).Find(&dbResults)
 	if result.Error != nil {
 		log.Err(result.Error).Msg("failed to list leagues")
 		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list leagues", ctx)
 		return
 	}
+	dbResults, nextCursor, err := page.Trim(dbResults, func(league *models.League) uuid.UUID { return league.ID })
+	if err != nil {
+		log.Err(err).Msg("failed to create cursor")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list leagues", ctx)
+		return
+	}
 
-	var leagues []generated.League
-	for _, league := range dbResults {
-		leagues = append(leagues, generated.League{
-			Id:   league.ID.String(),
-			Name: league.Name,
-			Slug: league.Slug,
-			Location: &generated.Location{
-				Address:      league.Location.Address,
-				Id:           league.Location.ID.String(),
-				Name:         league.Location.Name,
-				PinballMapId: league.Location.PinballMapID,
-				Slug:         league.Location.Slug,
-				CreatedAt:    utils.FormatTime(league.CreatedAt),
-				UpdatedAt:    utils.FormatTime(league.UpdatedAt),
-			},
-			OwnerId:   league.OwnerID.String(),
-			CreatedAt: utils.FormatTime(league.CreatedAt),
-			UpdatedAt: utils.FormatTime(league.UpdatedAt),
-		})
+	leagues := make([]generated.League, 0, len(dbResults))
+	for i := range dbResults {
+		leagues = append(leagues, NewLeague(&dbResults[i], relations))
 	}
 
 	ctx.JSON(http.StatusOK, generated.LeagueListResponse{
-		Leagues: leagues,
+		Leagues:    leagues,
+		NextCursor: nextCursor,
+		Total:      int(total),
 	})
 }
 
-func (c *Controller) GetLeagueWithSlug(ctx *gin.Context, slug string) {
+// GetLeagueWithSlug returns the league with the slug, or the league that was renamed from it with a canonical link to
+// its current slug.
+func (c *Controller) GetLeagueWithSlug(ctx *gin.Context, leagueSlug string, params generated.GetLeaguesSlugParams) {
+	relations, err := include.Parse(params.Include, includeRelations, defaultRelations...)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
 	var dbResult models.League
-	result := c.DB.Preload("Location").Where("slug = ?", slug).First(&dbResult)
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "not found") {
-			apierrors.AbortWithError(http.StatusNotFound, "league not found", ctx)
-			return
-		} else {
-			log.Err(result.Error).Msg("failed to get league")
-			apierrors.AbortWithError(http.StatusInternalServerError, "failed to get league", ctx)
+	renamed, err := c.Slugs.Find(slug.League, leagueSlug, &dbResult, relations.Scope)
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get league", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "league not found",
+		})
+		return
+	}
+	if renamed {
+		slug.SetCanonicalLink(ctx, slug.League, dbResult.Slug)
+	}
+
+	response := NewLeague(&dbResult, relations)
+	ctx.JSON(http.StatusOK, generated.LeagueResponse{
+		League: &response,
+	})
+}
+
+// DeleteLeague deletes the league with the slug along with its tournaments. Only the owner of the league and admins can
+// delete it, and admins can restore it until deleted leagues are purged.
+func (c *Controller) DeleteLeague(ctx *gin.Context, leagueSlug string) {
+	currentUser, err := auth.GetUser(ctx)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
+		return
+	}
+
+	var league models.League
+	if err := c.DB.Where("slug = ?", leagueSlug).First(&league).Error; err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get league", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "league not found",
+		})
+		return
+	}
+
+	if league.OwnerID != currentUser.ID && !models.RoleIncludes(currentUser.Role, models.RoleAdmin) {
+		apierrors.AbortWithError(http.StatusForbidden, "only the owner of the league can delete it", ctx)
+		return
+	}
+	if err := auth.AuthorizeLeague(ctx, league.ID); err != nil {
+		apierrors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
+		return
+	}
+
+	now := time.Now()
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		// the tournaments are deleted at the same time as the league, so restoring the league restores exactly the
+		// tournaments that were deleted with it
+		err := tx.Model(&models.Tournament{}).Where("league_id = ?", league.ID).UpdateColumn("deleted_at", now).Error
+		if err != nil {
+			return err
+		}
+		// the API tokens restricted to the league stay revoked when it is restored, their users can create new ones
+		if err := auth.RevokeLeagueAPITokens(tx, league.ID); err != nil {
+			return err
+		}
+		return tx.Model(&league).UpdateColumn("deleted_at", now).Error
+	})
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to delete league", nil)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RestoreLeague restores the deleted league with the slug along with the tournaments that were deleted with it. The
+// location of the league has to be restored first.
+func (c *Controller) RestoreLeague(ctx *gin.Context, leagueSlug string) {
+	var league models.League
+	err := c.DB.Unscoped().Where("slug = ? AND deleted_at IS NOT NULL", leagueSlug).First(&league).Error
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get league", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "deleted league not found",
+		})
+		return
+	}
+
+	// the location is loaded into its own variable, so restoring the league doesn't save it
+	var leagueLocation models.Location
+	if err := c.DB.Where("id = ?", league.LocationID).First(&leagueLocation).Error; err != nil {
+		if errors.Is(apierrors.TranslateDBError(err), apierrors.ErrNotFound) {
+			apierrors.AbortWithError(http.StatusConflict, "location of the league is deleted, restore it first", ctx)
 			return
 		}
+		log.Err(err).Msg("failed to get location")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to restore league", ctx)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.Tournament{}).
+			Where("league_id = ? AND deleted_at = ?", league.ID, league.DeletedAt).
+			UpdateColumn("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&league).UpdateColumn("deleted_at", nil).Error
+	})
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to restore league", nil)
+		return
 	}
+	league.DeletedAt = gorm.DeletedAt{}
+	league.Location = leagueLocation
 
+	response := NewLeague(&league, include.Relations{include.Location})
 	ctx.JSON(http.StatusOK, generated.LeagueResponse{
-		League: &generated.League{
-			Id:   dbResult.ID.String(),
-			Name: dbResult.Name,
-			Slug: dbResult.Slug,
-			Location: &generated.Location{
-				Address:      dbResult.Location.Address,
-				Id:           dbResult.Location.ID.String(),
-				Name:         dbResult.Location.Name,
-				PinballMapId: dbResult.Location.PinballMapID,
-				Slug:         dbResult.Location.Slug,
-				CreatedAt:    utils.FormatTime(dbResult.CreatedAt),
-				UpdatedAt:    utils.FormatTime(dbResult.UpdatedAt),
-			},
-			OwnerId:   dbResult.OwnerID.String(),
-			CreatedAt: utils.FormatTime(dbResult.CreatedAt),
-			UpdatedAt: utils.FormatTime(dbResult.UpdatedAt),
-		},
+		League: &response,
 	})
 }
+
+// NewLeague returns the API representation of a league, embedding the included relations, which have to be loaded.
+func NewLeague(league *models.League, relations include.Relations) generated.League {
+	response := generated.League{
+		Id:        league.ID.String(),
+		Name:      league.Name,
+		Slug:      league.Slug,
+		OwnerId:   league.OwnerID.String(),
+		CreatedAt: utils.FormatTime(league.CreatedAt),
+		UpdatedAt: utils.FormatTime(league.UpdatedAt),
+		DeletedAt: utils.FormatDeletedAt(league.DeletedAt),
+	}
+	if relations.Has(include.Location) {
+		leagueLocation := location.NewLocation(&league.Location)
+		response.Location = &leagueLocation
+	}
+	if relations.Has(include.Owner) {
+		response.Owner = &generated.UserSummary{
+			Id:   league.Owner.ID.String(),
+			Name: league.Owner.Name,
+		}
+	}
+	return response
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
 	"gorm.io/gorm"
@@ -57,7 +58,7 @@ var _ = ginkgo.Describe("Controller", func() {
 			Name:         "Test Location",
 			Slug:         "test-location",
 			Address:      "123 Test St",
-			PinballMapID: 123,
+			PinballMapID: utils.PtrInt(123),
 			CreatedAt:    time.Now().Add(-1 * time.Hour),
 			UpdatedAt:    time.Now(),
 		}
@@ -70,7 +71,7 @@ var _ = ginkgo.Describe("Controller", func() {
 		ginkgo.BeforeEach(func() {
 			payload = &generated.LeagueCreate{
 				Name:       "Test League",
-				Slug:       "test-league",
+				Slug:       utils.PtrString("test-league"),
 				LocationId: locationObj.ID.String(),
 			}
 		})
@@ -81,18 +82,18 @@ var _ = ginkgo.Describe("Controller", func() {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
 
-				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
-							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
+							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, *locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
 					)
 
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "leagues" ("name","slug","owner_id","location_id","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "leagues" ("name","slug","owner_id","location_id","created_at","updated_at","deleted_at") VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "id"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Slug, userObj.ID.String(), payload.LocationId, utils.AnyTime{}, utils.AnyTime{}).
+					WithArgs(payload.Name, *payload.Slug, userObj.ID.String(), payload.LocationId, utils.AnyTime{}, utils.AnyTime{}, nil).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id"}).
 							AddRow(uuid.New()),
@@ -103,7 +104,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
 
-				router.POST("/", controller.CreateLeague)
+				router.POST("/", func(c *gin.Context) { controller.CreateLeague(c, generated.PostLeaguesParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
@@ -113,19 +114,91 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
 
 				gomega.Expect(response.League.Name).To(gomega.Equal(payload.Name))
-				gomega.Expect(response.League.Slug).To(gomega.Equal(payload.Slug))
+				gomega.Expect(response.League.Slug).To(gomega.Equal(*payload.Slug))
 				gomega.Expect(response.League.Location.Id).To(gomega.Equal(payload.LocationId))
 				gomega.Expect(response.League.Location.Name).To(gomega.Equal(locationObj.Name))
 			})
 		})
 
+		ginkgo.Context("without a slug", func() {
+			ginkgo.It("derives a free slug from the name", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+				payload.Slug = nil
+
+				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
+				mock.ExpectQuery(regexp.QuoteMeta(sqlQuery)).
+					WithArgs(payload.LocationId).
+					WillReturnRows(
+						sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
+							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, *locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
+					)
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "leagues" WHERE slug LIKE $1`)).
+					WithArgs("test-league%").
+					WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("test-league").AddRow("test-league-2"))
+
+				mock.ExpectBegin()
+				const sqlInsert = `INSERT INTO "leagues" ("name","slug","owner_id","location_id","created_at","updated_at","deleted_at") VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "id"`
+				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
+					WithArgs(payload.Name, "test-league-3", userObj.ID.String(), payload.LocationId, utils.AnyTime{}, utils.AnyTime{}, nil).
+					WillReturnRows(
+						sqlmock.NewRows([]string{"id"}).
+							AddRow(uuid.New()),
+					)
+				mock.ExpectCommit()
+
+				body, err := json.Marshal(payload)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+
+				router.POST("/", func(c *gin.Context) { controller.CreateLeague(c, generated.PostLeaguesParams{}) })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+				response := &generated.LeagueResponse{}
+				err = json.Unmarshal(rr.Body.Bytes(), response)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+				gomega.Expect(response.League.Slug).To(gomega.Equal("test-league-3"))
+			})
+		})
+
+		ginkgo.Context("with an invalid slug", func() {
+			ginkgo.It("fails with 400 bad request", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+				payload.Slug = utils.PtrString("Test League!")
+
+				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
+				mock.ExpectQuery(regexp.QuoteMeta(sqlQuery)).
+					WithArgs(payload.LocationId).
+					WillReturnRows(
+						sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
+							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, *locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
+					)
+
+				body, err := json.Marshal(payload)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+
+				router.POST("/", func(c *gin.Context) { controller.CreateLeague(c, generated.PostLeaguesParams{}) })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+			})
+		})
+
 		ginkgo.Context("with a location id that does not exist", func() {
 			ginkgo.It("fails with 400 bad request", func() {
 				router.Use(func(ctx *gin.Context) {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
 
-				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnError(gorm.ErrRecordNotFound)
@@ -134,7 +207,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
 
-				router.POST("/", controller.CreateLeague)
+				router.POST("/", func(c *gin.Context) { controller.CreateLeague(c, generated.PostLeaguesParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
@@ -152,7 +225,7 @@ var _ = ginkgo.Describe("Controller", func() {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
 
-				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnError(errors.New("some error"))
@@ -161,7 +234,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
 
-				router.POST("/", controller.CreateLeague)
+				router.POST("/", func(c *gin.Context) { controller.CreateLeague(c, generated.PostLeaguesParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusInternalServerError))
@@ -187,7 +260,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(err).To(gomega.BeNil())
 				req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
 
-				router.POST("/", controller.CreateLeague)
+				router.POST("/", func(c *gin.Context) { controller.CreateLeague(c, generated.PostLeaguesParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
@@ -205,7 +278,7 @@ var _ = ginkgo.Describe("Controller", func() {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
 
-				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnRows(
@@ -214,17 +287,19 @@ var _ = ginkgo.Describe("Controller", func() {
 					)
 
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "leagues" ("name","slug","owner_id","location_id","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "leagues" ("name","slug","owner_id","location_id","created_at","updated_at","deleted_at") VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "id"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Slug, userObj.ID.String(), payload.LocationId, utils.AnyTime{}, utils.AnyTime{}).
-					WillReturnError(fmt.Errorf("ERROR: duplicate key value violates unique constraint \"idx_league_slug\" (SQLSTATE 23505)"))
+					WithArgs(payload.Name, payload.Slug, userObj.ID.String(), payload.LocationId, utils.AnyTime{}, utils.AnyTime{}, nil).
+					WillReturnError(&pgconn.PgError{
+						Code: "23505", ConstraintName: "idx_league_slug", Detail: "Key (slug)=(test) already exists.",
+					})
 				mock.ExpectRollback()
 
 				body, err := json.Marshal(payload)
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
 
-				router.POST("/", controller.CreateLeague)
+				router.POST("/", func(c *gin.Context) { controller.CreateLeague(c, generated.PostLeaguesParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusConflict))
@@ -243,18 +318,18 @@ var _ = ginkgo.Describe("Controller", func() {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
 
-				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const sqlQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
-							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
+							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, *locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
 					)
 
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "leagues" ("name","slug","owner_id","location_id","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "leagues" ("name","slug","owner_id","location_id","created_at","updated_at","deleted_at") VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "id"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Slug, userObj.ID.String(), payload.LocationId, utils.AnyTime{}, utils.AnyTime{}).
+					WithArgs(payload.Name, payload.Slug, userObj.ID.String(), payload.LocationId, utils.AnyTime{}, utils.AnyTime{}, nil).
 					WillReturnError(fmt.Errorf("unknown error"))
 				mock.ExpectRollback()
 
@@ -262,7 +337,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
 
-				router.POST("/", controller.CreateLeague)
+				router.POST("/", func(c *gin.Context) { controller.CreateLeague(c, generated.PostLeaguesParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusInternalServerError))
@@ -293,7 +368,9 @@ var _ = ginkgo.Describe("Controller", func() {
 					UpdatedAt: time.Now(),
 				}
 
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues"`)).
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE "leagues"."deleted_at" IS NULL ORDER BY created_at DESC,id DESC LIMIT 51`)).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id", "created_at", "updated_at"}).
 							AddRow(leagueObj.ID.String(), leagueObj.Name, leagueObj.Slug, leagueObj.Owner.ID.String(), leagueObj.Location.ID.String(), leagueObj.CreatedAt, leagueObj.UpdatedAt),
@@ -304,13 +381,13 @@ var _ = ginkgo.Describe("Controller", func() {
 					WithArgs(locationObj.ID).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
-							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
+							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, *locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
 					)
 
 				req, err := http.NewRequest("GET", "/", nil)
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 
-				router.GET("/", controller.ListLeagues)
+				router.GET("/", func(ctx *gin.Context) { controller.ListLeagues(ctx, generated.GetLeaguesParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
@@ -326,19 +403,73 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(response.Leagues[0].Location.Name).To(gomega.Equal(leagueObj.Location.Name))
 			})
 		})
+		ginkgo.Context("with filters and a limit", func() {
+			ginkgo.It("returns the matching page and the cursor of the next one", func() {
+				ownerID := uuid.New()
+				createdAt := time.Now().Add(-1 * time.Hour)
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues" WHERE LOWER(name) LIKE $1 AND owner_id = $2 AND "leagues"."deleted_at" IS NULL`)).
+					WithArgs(`%tue\_%`, ownerID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE LOWER(name) LIKE $1 AND owner_id = $2 AND "leagues"."deleted_at" IS NULL ORDER BY name ASC,id ASC LIMIT 2`)).
+					WithArgs(`%tue\_%`, ownerID).
+					WillReturnRows(
+						sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id", "created_at", "updated_at"}).
+							AddRow(uuid.New(), "Tue_A", "tue-a", ownerID, locationObj.ID, createdAt, createdAt).
+							AddRow(uuid.New(), "Tue_B", "tue-b", ownerID, locationObj.ID, createdAt, createdAt),
+					)
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE "locations"."id" = $1`)).
+					WithArgs(locationObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(locationObj.ID, locationObj.Name))
+
+				req, err := http.NewRequest("GET", "/?search=TUE_&owner_id="+ownerID.String()+"&sort=name&limit=1", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.GET("/", func(ctx *gin.Context) {
+					params := generated.GetLeaguesParams{}
+					gomega.Expect(ctx.ShouldBindQuery(&params)).To(gomega.Succeed())
+					controller.ListLeagues(ctx, params)
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				response := &generated.LeagueListResponse{}
+				err = json.Unmarshal(rr.Body.Bytes(), response)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+
+				gomega.Expect(response.Total).To(gomega.Equal(3))
+				gomega.Expect(response.Leagues).To(gomega.HaveLen(1))
+				gomega.Expect(response.Leagues[0].Name).To(gomega.Equal("Tue_A"))
+				gomega.Expect(response.NextCursor).ToNot(gomega.BeNil())
+			})
+		})
+		ginkgo.Context("with an invalid owner_id", func() {
+			ginkgo.It("fails", func() {
+				req, err := http.NewRequest("GET", "/", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.GET("/", func(ctx *gin.Context) {
+					controller.ListLeagues(ctx, generated.GetLeaguesParams{OwnerId: utils.PtrString("someone")})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+			})
+		})
 		ginkgo.Context("with unknown sql error", func() {
 			ginkgo.It("fails", func() {
 				router.Use(func(ctx *gin.Context) {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
 
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues"`)).
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues"`)).
 					WillReturnError(fmt.Errorf("unknown error"))
 
 				req, err := http.NewRequest("GET", "/", nil)
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 
-				router.GET("/", controller.ListLeagues)
+				router.GET("/", func(ctx *gin.Context) { controller.ListLeagues(ctx, generated.GetLeaguesParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusInternalServerError))
@@ -377,14 +508,14 @@ var _ = ginkgo.Describe("Controller", func() {
 					WithArgs(locationObj.ID).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
-							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
+							AddRow(locationObj.ID.String(), locationObj.Name, locationObj.Slug, locationObj.Address, *locationObj.PinballMapID, locationObj.CreatedAt, locationObj.UpdatedAt),
 					)
 
 				req, err := http.NewRequest("GET", "/", nil)
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 
 				router.GET("/", func(c *gin.Context) {
-					controller.GetLeagueWithSlug(c, leagueObj.Slug)
+					controller.GetLeagueWithSlug(c, leagueObj.Slug, generated.GetLeaguesSlugParams{})
 				})
 				router.ServeHTTP(rr, req)
 
@@ -398,18 +529,102 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(response.League.Slug).To(gomega.Equal(leagueObj.Slug))
 				gomega.Expect(response.League.Location.Id).To(gomega.Equal(leagueObj.Location.ID.String()))
 				gomega.Expect(response.League.Location.Name).To(gomega.Equal(leagueObj.Location.Name))
+				gomega.Expect(response.League.Owner).To(gomega.BeNil())
+			})
+		})
+		ginkgo.Context("with include=owner", func() {
+			ginkgo.It("embeds the owner instead of the location", func() {
+				leagueID := uuid.New()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE slug = $1`)).
+					WithArgs("test-league").
+					WillReturnRows(
+						sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id"}).
+							AddRow(leagueID, "Test League", "test-league", userObj.ID, locationObj.ID),
+					)
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+					WithArgs(userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).AddRow(userObj.ID, userObj.Name, userObj.Email))
+
+				req, err := http.NewRequest("GET", "/", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.GetLeagueWithSlug(c, "test-league", generated.GetLeaguesSlugParams{Include: utils.PtrString("owner")})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+				response := &generated.LeagueResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.League.Location).To(gomega.BeNil())
+				gomega.Expect(response.League.Owner).To(gomega.Equal(&generated.UserSummary{
+					Id:   userObj.ID.String(),
+					Name: userObj.Name,
+				}))
+				gomega.Expect(rr.Body.String()).ToNot(gomega.ContainSubstring(userObj.Email))
+			})
+		})
+		ginkgo.Context("with a slug the league was renamed from", func() {
+			ginkgo.It("returns the league with a link to its current slug", func() {
+				leagueID := uuid.New()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE slug = $1`)).
+					WithArgs("old-league").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "slug_histories" WHERE kind = $1 AND slug = $2`)).
+					WithArgs("league", "old-league").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "slug", "resource_id"}).
+						AddRow(uuid.New(), "league", "old-league", leagueID))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE id = $1`)).
+					WithArgs(leagueID).
+					WillReturnRows(
+						sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id"}).
+							AddRow(leagueID, "Test League", "test-league", userObj.ID, locationObj.ID),
+					)
+
+				req, err := http.NewRequest("GET", "/", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.GetLeagueWithSlug(c, "old-league", generated.GetLeaguesSlugParams{Include: utils.PtrString("")})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+				gomega.Expect(rr.Header().Get("Link")).To(gomega.Equal(`</api/leagues/test-league>; rel="canonical"`))
+				response := &generated.LeagueResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.League.Slug).To(gomega.Equal("test-league"))
+			})
+		})
+		ginkgo.Context("with an unknown relation to include", func() {
+			ginkgo.It("fails", func() {
+				req, err := http.NewRequest("GET", "/", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.GetLeagueWithSlug(c, "test-league", generated.GetLeaguesSlugParams{Include: utils.PtrString("league")})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
 			})
 		})
 		ginkgo.Context("when location is not found", func() {
 			ginkgo.It("fails", func() {
 				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE slug = $1`)).
 					WillReturnError(gorm.ErrRecordNotFound)
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "slug_histories" WHERE kind = $1 AND slug = $2`)).
+					WithArgs("league", "foo-bar").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "slug", "resource_id"}))
 
 				req, err := http.NewRequest("GET", "/", nil)
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 
 				router.GET("/", func(c *gin.Context) {
-					controller.GetLeagueWithSlug(c, "foo-bar")
+					controller.GetLeagueWithSlug(c, "foo-bar", generated.GetLeaguesSlugParams{})
 				})
 				router.ServeHTTP(rr, req)
 
@@ -432,7 +647,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(err).ToNot(gomega.HaveOccurred())
 
 				router.GET("/", func(c *gin.Context) {
-					controller.GetLeagueWithSlug(c, "foo-bar")
+					controller.GetLeagueWithSlug(c, "foo-bar", generated.GetLeaguesSlugParams{})
 				})
 				router.ServeHTTP(rr, req)
 
@@ -447,4 +662,197 @@ var _ = ginkgo.Describe("Controller", func() {
 			})
 		})
 	})
+
+	ginkgo.When("ListLeagues is asked to include deleted leagues", func() {
+		ginkgo.It("lists them with the time they were deleted", func() {
+			deletedAt := time.Now().Add(-1 * time.Hour)
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery(`^` + regexp.QuoteMeta(`SELECT * FROM "leagues" ORDER BY created_at DESC,id DESC LIMIT 51`)).
+				WillReturnRows(
+					sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id", "deleted_at"}).
+						AddRow(uuid.New(), "Test League", "test-league", userObj.ID, locationObj.ID, deletedAt),
+				)
+
+			req, err := http.NewRequest("GET", "/", nil)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			router.GET("/", func(ctx *gin.Context) {
+				controller.ListLeagues(ctx, generated.GetLeaguesParams{
+					Include:        utils.PtrString(""),
+					IncludeDeleted: utils.PtrBool(true),
+				})
+			})
+			router.ServeHTTP(rr, req)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+			response := &generated.LeagueListResponse{}
+			gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+			gomega.Expect(response.Leagues).To(gomega.HaveLen(1))
+			gomega.Expect(response.Leagues[0].DeletedAt).To(gomega.Equal(utils.PtrString(utils.FormatTime(deletedAt))))
+		})
+
+		ginkgo.It("embeds their relations even if those are deleted too", func() {
+			deletedAt := time.Now().Add(-1 * time.Hour)
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery(`^` + regexp.QuoteMeta(`SELECT * FROM "leagues" ORDER BY created_at DESC,id DESC LIMIT 51`)).
+				WillReturnRows(
+					sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id", "deleted_at"}).
+						AddRow(uuid.New(), "Test League", "test-league", userObj.ID, locationObj.ID, deletedAt),
+				)
+			mock.ExpectQuery(`^` + regexp.QuoteMeta(`SELECT * FROM "locations" WHERE "locations"."id" = $1`) + `$`).
+				WithArgs(locationObj.ID).
+				WillReturnRows(
+					sqlmock.NewRows([]string{"id", "name", "slug", "deleted_at"}).
+						AddRow(locationObj.ID, locationObj.Name, locationObj.Slug, deletedAt),
+				)
+
+			req, err := http.NewRequest("GET", "/", nil)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			router.GET("/", func(ctx *gin.Context) {
+				controller.ListLeagues(ctx, generated.GetLeaguesParams{
+					Include:        utils.PtrString("location"),
+					IncludeDeleted: utils.PtrBool(true),
+				})
+			})
+			router.ServeHTTP(rr, req)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+			response := &generated.LeagueListResponse{}
+			gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+			gomega.Expect(response.Leagues).To(gomega.HaveLen(1))
+			gomega.Expect(response.Leagues[0].Location.Id).To(gomega.Equal(locationObj.ID.String()))
+			gomega.Expect(response.Leagues[0].Location.DeletedAt).To(gomega.Equal(utils.PtrString(utils.FormatTime(deletedAt))))
+		})
+	})
+
+	ginkgo.When("DeleteLeague receives a request", func() {
+		const sqlSelect = `SELECT * FROM "leagues" WHERE slug = $1 AND "leagues"."deleted_at" IS NULL ORDER BY "leagues"."id" LIMIT 1`
+		var leagueID uuid.UUID
+
+		ginkgo.BeforeEach(func() {
+			leagueID = uuid.New()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+				WithArgs("test-league").
+				WillReturnRows(
+					sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id"}).
+						AddRow(leagueID, "Test League", "test-league", userObj.ID, locationObj.ID),
+				)
+		})
+
+		ginkgo.Context("from the owner of the league", func() {
+			ginkgo.It("deletes the league along with its tournaments and revokes its API tokens", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tournaments" SET "deleted_at"=$1 WHERE league_id = $2 AND "tournaments"."deleted_at" IS NULL`)).
+					WithArgs(utils.AnyTime{}, leagueID).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_tokens" SET "revoked_at"=$1 WHERE league_id = $2 AND revoked_at IS NULL`)).
+					WithArgs(utils.AnyTime{}, leagueID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "leagues" SET "deleted_at"=$1 WHERE "leagues"."deleted_at" IS NULL AND "id" = $2`)).
+					WithArgs(utils.AnyTime{}, leagueID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				req, err := http.NewRequest("DELETE", "/", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.DELETE("/", func(ctx *gin.Context) { controller.DeleteLeague(ctx, "test-league") })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNoContent))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+			})
+		})
+
+		ginkgo.Context("from another user", func() {
+			ginkgo.It("fails with 403 forbidden", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, &models.User{ID: uuid.New(), Role: models.RoleOrganizer})
+				})
+
+				req, err := http.NewRequest("DELETE", "/", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.DELETE("/", func(ctx *gin.Context) { controller.DeleteLeague(ctx, "test-league") })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+			})
+		})
+	})
+
+	ginkgo.When("RestoreLeague receives a request", func() {
+		const sqlSelect = `SELECT * FROM "leagues" WHERE slug = $1 AND deleted_at IS NOT NULL ORDER BY "leagues"."id" LIMIT 1`
+		const sqlLocation = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
+		var leagueID uuid.UUID
+		var deletedAt time.Time
+
+		ginkgo.BeforeEach(func() {
+			leagueID = uuid.New()
+			deletedAt = time.Now().Add(-1 * time.Hour)
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+				WithArgs("test-league").
+				WillReturnRows(
+					sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id", "deleted_at"}).
+						AddRow(leagueID, "Test League", "test-league", userObj.ID, locationObj.ID, deletedAt),
+				)
+		})
+
+		ginkgo.Context("with a location that wasn't deleted", func() {
+			ginkgo.It("restores the league and the tournaments deleted with it", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlLocation)).
+					WithArgs(locationObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).
+						AddRow(locationObj.ID, locationObj.Name, locationObj.Slug))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tournaments" SET "deleted_at"=$1 WHERE league_id = $2 AND deleted_at = $3`)).
+					WithArgs(nil, leagueID, deletedAt).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "leagues" SET "deleted_at"=$1 WHERE "id" = $2`)).
+					WithArgs(nil, leagueID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				req, err := http.NewRequest("POST", "/", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.POST("/", func(ctx *gin.Context) { controller.RestoreLeague(ctx, "test-league") })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+				response := &generated.LeagueResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.League.DeletedAt).To(gomega.BeNil())
+				gomega.Expect(response.League.Location.Name).To(gomega.Equal(locationObj.Name))
+			})
+		})
+
+		ginkgo.Context("with a deleted location", func() {
+			ginkgo.It("fails with 409 conflict", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlLocation)).
+					WithArgs(locationObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				req, err := http.NewRequest("POST", "/", nil)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				router.POST("/", func(ctx *gin.Context) { controller.RestoreLeague(ctx, "test-league") })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusConflict))
+				gomega.Expect(mock.ExpectationsWereMet()).ToNot(gomega.HaveOccurred())
+			})
+		})
+	})
 })
@@ -1,27 +1,38 @@
 package location
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 	"net/http"
 	apierrors "pinman/internal/app/api/errors"
+	"pinman/internal/app/api/pagination"
+	"pinman/internal/app/api/slug"
 	"pinman/internal/app/generated"
 	"pinman/internal/clients/pinballmap"
 	"pinman/internal/models"
 	"pinman/internal/utils"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// maxFieldLength is the number of characters the name and address columns allow.
+const maxFieldLength = 255
+
 type Controller struct {
 	DB       *gorm.DB
+	Slugs    *slug.Service
 	pmClient pinballmap.ClientInterface
 }
 
 func NewController(db *gorm.DB) *Controller {
 	return &Controller{
 		DB:       db,
+		Slugs:    slug.NewService(db),
 		pmClient: pinballmap.NewClient(),
 	}
 }
@@ -29,6 +40,7 @@ func NewController(db *gorm.DB) *Controller {
 func NewControllerWithClient(db *gorm.DB, client pinballmap.ClientInterface) *Controller {
 	return &Controller{
 		DB:       db,
+		Slugs:    slug.NewService(db),
 		pmClient: client,
 	}
 }
@@ -41,99 +53,309 @@ func (c *Controller) CreateLocation(ctx *gin.Context) {
 		return
 	}
 
-	pinballMapLocation, err := c.pmClient.GetLocation(payload.PinballMapId)
+	var location models.Location
+	if payload.PinballMapId != nil {
+		if !c.checkNotLinked(ctx, *payload.PinballMapId) {
+			return
+		}
+		pinballMapLocation, ok := c.getPinballMapLocation(ctx, *payload.PinballMapId)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		location = models.Location{
+			Name:         pinballMapLocation.Name,
+			PinballMapID: &pinballMapLocation.ID,
+			Address:      pinballMapLocation.Address(),
+			Machines:     pinballMapLocation.MachineNames,
+			Status:       models.LocationStatusActive,
+			LastSyncedAt: &now,
+		}
+	} else {
+		if payload.Name == nil || *payload.Name == "" || payload.Address == nil || *payload.Address == "" {
+			apierrors.AbortWithError(http.StatusBadRequest, "name and address are required for locations that are not on pinball map", ctx)
+			return
+		}
+		if utf8.RuneCountInString(*payload.Name) > maxFieldLength || utf8.RuneCountInString(*payload.Address) > maxFieldLength {
+			apierrors.AbortWithError(
+				http.StatusBadRequest, fmt.Sprintf("name and address must be at most %d characters", maxFieldLength), ctx,
+				map[string]interface{}{"fields": []string{"name", "address"}},
+			)
+			return
+		}
+
+		location = models.Location{
+			Name:     *payload.Name,
+			Address:  *payload.Address,
+			Machines: []string{},
+			Status:   models.LocationStatusActive,
+		}
+		if payload.Machines != nil {
+			location.Machines = *payload.Machines
+		}
+	}
+
+	err := c.Slugs.Create(slug.Location, location.Name, nil, func(locationSlug string) error {
+		location.Slug = locationSlug
+		return c.DB.Create(&location).Error
+	})
 	if err != nil {
-		log.Error().Err(err).Msgf("failed to get location with id '%d' from pinball map API", payload.PinballMapId)
-		apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), ctx)
+		apierrors.AbortWithDBError(ctx, err, "failed to create location", apierrors.DBErrorDetails{
+			apierrors.ErrUniqueViolation: "location with slug already exists",
+		})
 		return
 	}
 
-	location := models.Location{
-		Name:         pinballMapLocation.Name,
-		Slug:         utils.Slugify(pinballMapLocation.Name, 20),
-		PinballMapID: pinballMapLocation.ID,
-		Address: fmt.Sprintf(
-			"%s, %s, %s, %s",
-			pinballMapLocation.Street, pinballMapLocation.City, pinballMapLocation.State, pinballMapLocation.Country,
-		),
+	ctx.JSON(http.StatusCreated, generated.LocationResponse{
+		Location: NewLocation(&location),
+	})
+}
+
+// LinkLocation links a private location to a Pinball Map location, replacing its details with the ones from Pinball Map.
+func (c *Controller) LinkLocation(ctx *gin.Context, slug string) {
+	payload := &generated.LocationLink{}
+
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
 	}
 
-	result := c.DB.Create(&location)
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "duplicate key") {
-			// TODO: Add some retry logic to generate a different slug if this happens
-			apierrors.AbortWithError(http.StatusConflict, "location with slug already exists", ctx)
-			return
-		} else {
-			log.Error().Err(result.Error).Msg("failed to create location")
-			apierrors.AbortWithError(http.StatusInternalServerError, "failed to create location", ctx)
-			return
-		}
+	var location models.Location
+	if err := c.DB.Where("slug = ?", slug).First(&location).Error; err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get location", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "location not found",
+		})
+		return
 	}
 
-	ctx.JSON(http.StatusCreated, generated.LocationResponse{
-		Location: generated.Location{
-			Id:           location.ID.String(),
-			Name:         location.Name,
-			Slug:         location.Slug,
-			Address:      location.Address,
-			PinballMapId: location.PinballMapID,
-			CreatedAt:    utils.FormatTime(location.CreatedAt),
-			UpdatedAt:    utils.FormatTime(location.UpdatedAt),
-		},
+	if location.PinballMapID != nil {
+		apierrors.AbortWithError(http.StatusConflict, "location is already linked to pinball map", ctx)
+		return
+	}
+
+	if !c.checkNotLinked(ctx, payload.PinballMapId) {
+		return
+	}
+	pinballMapLocation, ok := c.getPinballMapLocation(ctx, payload.PinballMapId)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	location.PinballMapID = &pinballMapLocation.ID
+	location.Name = pinballMapLocation.Name
+	location.Address = pinballMapLocation.Address()
+	location.Machines = pinballMapLocation.MachineNames
+	location.Status = models.LocationStatusActive
+	location.LastSyncedAt = &now
+
+	if err := c.DB.Save(&location).Error; err != nil {
+		log.Error().Err(err).Msg("failed to link location")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to link location", ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, generated.LocationResponse{
+		Location: NewLocation(&location),
 	})
 }
 
-func (c *Controller) ListLocations(ctx *gin.Context) {
+// checkNotLinked aborts the request if another location is already linked to the Pinball Map location.
+func (c *Controller) checkNotLinked(ctx *gin.Context, pinballMapID int) bool {
+	var count int64
+	if err := c.DB.Model(&models.Location{}).Where("pinball_map_id = ?", pinballMapID).Count(&count).Error; err != nil {
+		log.Error().Err(err).Msg("failed to look up linked locations")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to look up linked locations", ctx)
+		return false
+	}
+	if count > 0 {
+		apierrors.AbortWithError(
+			http.StatusConflict, fmt.Sprintf("a location is already linked to pinball map location %d", pinballMapID), ctx,
+			map[string]interface{}{"fields": []string{"pinball_map_id"}},
+		)
+		return false
+	}
+
+	return true
+}
+
+// getPinballMapLocation retrieves a location from Pinball Map, aborting the request if it could not be retrieved.
+func (c *Controller) getPinballMapLocation(ctx *gin.Context, id int) (*pinballmap.Location, bool) {
+	pinballMapLocation, err := c.pmClient.GetLocation(ctx.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, pinballmap.ErrNotFound) {
+			apierrors.AbortWithError(http.StatusBadRequest, fmt.Sprintf("pinball map location with id %d does not exist", id), ctx)
+			return nil, false
+		}
+		log.Error().Err(err).Msgf("failed to get location with id '%d' from pinball map API", id)
+		apierrors.AbortWithError(http.StatusInternalServerError, err.Error(), ctx)
+		return nil, false
+	}
+	// venues without machines may leave out the list, which would be stored as null
+	if pinballMapLocation.MachineNames == nil {
+		pinballMapLocation.MachineNames = []string{}
+	}
+
+	return pinballMapLocation, true
+}
+
+// locationSortFields are the fields locations can be sorted by.
+var locationSortFields = []pagination.Field[models.Location]{
+	{Column: "created_at", Value: func(location *models.Location) interface{} { return location.CreatedAt }},
+	{Column: "name", Value: func(location *models.Location) interface{} { return location.Name }},
+}
+
+// ListLocations lists one page of the locations matching the search, most recently created first unless sorted
+// otherwise. Deleted locations are only listed if the parameters include them.
+func (c *Controller) ListLocations(ctx *gin.Context, params generated.GetLocationsParams) {
+	page, err := pagination.New(pagination.Params{
+		Limit:  params.Limit,
+		Cursor: params.Cursor,
+		Sort:   params.Sort,
+	}, locationSortFields)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		if params.Search != nil && *params.Search != "" {
+			db = db.Where("LOWER(name) LIKE ?", "%"+utils.EscapeLike(strings.ToLower(*params.Search))+"%")
+		}
+		if params.IncludeDeleted != nil && *params.IncludeDeleted {
+			db = db.Unscoped()
+		}
+		return db
+	}
+
+	var total int64
+	if err := c.DB.Model(&models.Location{}).Scopes(filter).Count(&total).Error; err != nil {
+		log.Err(err).Msg("failed to count locations")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list locations", ctx)
+		return
+	}
+
 	var dbLocations []models.Location
-	result := c.DB.Find(&dbLocations)
+	result := c.DB.Scopes(filter, page.Scope).Find(&dbLocations)
 	if result.Error != nil {
 		log.Err(result.Error).Msg("failed to list locations")
 		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list locations", ctx)
 		return
 	}
+	dbLocations, nextCursor, err := page.Trim(dbLocations, func(location *models.Location) uuid.UUID { return location.ID })
+	if err != nil {
+		log.Err(err).Msg("failed to create cursor")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list locations", ctx)
+		return
+	}
 
 	locations := make([]generated.Location, len(dbLocations))
-	for i, location := range dbLocations {
-		locations[i] = generated.Location{
-			Id:           location.ID.String(),
-			Name:         location.Name,
-			Slug:         location.Slug,
-			Address:      location.Address,
-			PinballMapId: location.PinballMapID,
-			CreatedAt:    utils.FormatTime(location.CreatedAt),
-			UpdatedAt:    utils.FormatTime(location.UpdatedAt),
-		}
+	for i := range dbLocations {
+		locations[i] = NewLocation(&dbLocations[i])
 	}
 
 	ctx.JSON(http.StatusOK, generated.LocationListResponse{
-		Locations: locations,
+		Locations:  locations,
+		NextCursor: nextCursor,
+		Total:      int(total),
 	})
 }
 
-func (c *Controller) GetLocationWithSlug(ctx *gin.Context, slug string) {
+// GetLocationWithSlug returns the location with the slug, or the location that was renamed from it with a canonical
+// link to its current slug.
+func (c *Controller) GetLocationWithSlug(ctx *gin.Context, locationSlug string) {
 	var location models.Location
-	result := c.DB.Where("slug = ?", slug).First(&location)
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "not found") {
-			apierrors.AbortWithError(http.StatusNotFound, "location not found", ctx)
-			return
-		} else {
-			log.Error().Err(result.Error).Msg("failed to get location")
-			apierrors.AbortWithError(http.StatusInternalServerError, "failed to get location", ctx)
-			return
-		}
+	renamed, err := c.Slugs.Find(slug.Location, locationSlug, &location)
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get location", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "location not found",
+		})
+		return
+	}
+	if renamed {
+		slug.SetCanonicalLink(ctx, slug.Location, location.Slug)
 	}
 
 	ctx.JSON(http.StatusOK, generated.LocationResponse{
-		Location: generated.Location{
-			Id:           location.ID.String(),
-			Name:         location.Name,
-			Slug:         location.Slug,
-			Address:      location.Address,
-			PinballMapId: location.PinballMapID,
-			CreatedAt:    utils.FormatTime(location.CreatedAt),
-			UpdatedAt:    utils.FormatTime(location.UpdatedAt),
-		},
+		Location: NewLocation(&location),
 	})
 }
+
+// DeleteLocation deletes the location with the slug, which admins can restore until deleted locations are purged.
+// Locations that leagues or tournaments are held at can't be deleted.
+func (c *Controller) DeleteLocation(ctx *gin.Context, locationSlug string) {
+	var location models.Location
+	if err := c.DB.Where("slug = ?", locationSlug).First(&location).Error; err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get location", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "location not found",
+		})
+		return
+	}
+
+	var leagues, tournaments int64
+	err := c.DB.Model(&models.League{}).Where("location_id = ?", location.ID).Count(&leagues).Error
+	if err == nil {
+		err = c.DB.Model(&models.Tournament{}).Where("location_id = ?", location.ID).Count(&tournaments).Error
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to count leagues and tournaments at location")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to delete location", ctx)
+		return
+	}
+	if leagues > 0 || tournaments > 0 {
+		apierrors.AbortWithError(
+			http.StatusConflict,
+			fmt.Sprintf("location is used by %d leagues and %d tournaments, delete them first", leagues, tournaments),
+			ctx,
+		)
+		return
+	}
+
+	if err := c.DB.Delete(&location).Error; err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to delete location", nil)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RestoreLocation restores the deleted location with the slug.
+func (c *Controller) RestoreLocation(ctx *gin.Context, locationSlug string) {
+	var location models.Location
+	err := c.DB.Unscoped().Where("slug = ? AND deleted_at IS NOT NULL", locationSlug).First(&location).Error
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get location", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "deleted location not found",
+		})
+		return
+	}
+
+	if err := c.DB.Unscoped().Model(&location).UpdateColumn("deleted_at", nil).Error; err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to restore location", nil)
+		return
+	}
+	location.DeletedAt = gorm.DeletedAt{}
+
+	ctx.JSON(http.StatusOK, generated.LocationResponse{
+		Location: NewLocation(&location),
+	})
+}
+
+// NewLocation returns the API representation of a location, which other resources embed as well.
+func NewLocation(location *models.Location) generated.Location {
+	machines := []string(location.Machines)
+	return generated.Location{
+		Id:           location.ID.String(),
+		Name:         location.Name,
+		Slug:         location.Slug,
+		Address:      location.Address,
+		PinballMapId: location.PinballMapID,
+		Machines:     &machines,
+		Status:       utils.PtrString(location.Status),
+		LastSyncedAt: utils.FormatTimePtr(location.LastSyncedAt),
+		CreatedAt:    utils.FormatTime(location.CreatedAt),
+		UpdatedAt:    utils.FormatTime(location.UpdatedAt),
+		DeletedAt:    utils.FormatDeletedAt(location.DeletedAt),
+	}
+}
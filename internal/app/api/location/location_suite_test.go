@@ -2,11 +2,14 @@ package location_test
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	testify "github.com/stretchr/testify/mock"
 	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
@@ -17,6 +20,7 @@ import (
 	"pinman/internal/models"
 	"pinman/internal/utils"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -73,6 +77,10 @@ var _ = ginkgo.Describe("Location", func() {
 			City:    "Austin",
 			State:   "TX",
 			Country: "USA",
+			MachineNames: []string{
+				"Godzilla (Premium)",
+				"Medieval Madness",
+			},
 		}
 	})
 
@@ -82,22 +90,30 @@ var _ = ginkgo.Describe("Location", func() {
 				router.Use(func(ctx *gin.Context) {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
-				mockPinballMapClient.On("GetLocation", 1).Return(mockPinballLocationsResponse, nil)
-
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE pinball_map_id = $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(mockPinballLocationsResponse, nil)
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "locations" WHERE slug LIKE $1`)).
+					WithArgs("pinballz-arcade%").
+					WillReturnRows(sqlmock.NewRows([]string{"slug"}))
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","status","last_synced_at","created_at","updated_at","deleted_at","machines") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id","machines"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
 					WithArgs(
 						"Pinballz Arcade",
 						"pinballz-arcade",
 						"123 Main St, Austin, TX, USA",
 						1,
-						utils.AnyTime{}, utils.AnyTime{},
-					).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+						models.LocationStatusActive,
+						utils.AnyTime{}, utils.AnyTime{}, utils.AnyTime{}, nil,
+						`["Godzilla (Premium)","Medieval Madness"]`,
+					).WillReturnRows(sqlmock.NewRows([]string{"id", "machines"}).AddRow(uuid.New(), `["Godzilla (Premium)","Medieval Madness"]`))
 				mock.ExpectCommit()
 
 				body, err := json.Marshal(&generated.LocationCreate{
-					PinballMapId: mockPinballLocationsResponse.ID,
+					PinballMapId: &mockPinballLocationsResponse.ID,
 				})
 				gomega.Expect(err).To(gomega.BeNil())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
@@ -114,6 +130,8 @@ var _ = ginkgo.Describe("Location", func() {
 				gomega.Expect(response.Location).ToNot(gomega.BeNil())
 
 				gomega.Expect(response.Location.Name).To(gomega.Equal(mockPinballLocationsResponse.Name))
+				gomega.Expect(*response.Location.Machines).To(gomega.Equal(mockPinballLocationsResponse.MachineNames))
+				gomega.Expect(*response.Location.Status).To(gomega.Equal(models.LocationStatusActive))
 			})
 		})
 
@@ -137,10 +155,13 @@ var _ = ginkgo.Describe("Location", func() {
 				router.Use(func(ctx *gin.Context) {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
-				mockPinballMapClient.On("GetLocation", 1).Return(nil, fmt.Errorf("some error"))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE pinball_map_id = $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(nil, fmt.Errorf("some error"))
 
 				body, err := json.Marshal(&generated.LocationCreate{
-					PinballMapId: 1,
+					PinballMapId: utils.PtrInt(1),
 				})
 				gomega.Expect(err).To(gomega.BeNil())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
@@ -152,27 +173,52 @@ var _ = ginkgo.Describe("Location", func() {
 			})
 		})
 
-		ginkgo.Context("is called with a location whose slug already exists", func() {
-			ginkgo.It("returns a 409", func() {
+		ginkgo.Context("is called with a location whose slug was taken by a concurrent request", func() {
+			ginkgo.It("retries with the next free slug and returns a 201", func() {
 				router.Use(func(ctx *gin.Context) {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
-				mockPinballMapClient.On("GetLocation", 1).Return(mockPinballLocationsResponse, nil)
-
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE pinball_map_id = $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(mockPinballLocationsResponse, nil)
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "locations" WHERE slug LIKE $1`)).
+					WithArgs("pinballz-arcade%").
+					WillReturnRows(sqlmock.NewRows([]string{"slug"}))
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","status","last_synced_at","created_at","updated_at","deleted_at","machines") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id","machines"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
 					WithArgs(
 						"Pinballz Arcade",
 						"pinballz-arcade",
 						"123 Main St, Austin, TX, USA",
 						1,
-						utils.AnyTime{}, utils.AnyTime{},
-					).WillReturnError(fmt.Errorf("ERROR: duplicate key value violates unique constraint \"idx_location_slug\" (SQLSTATE 23505)"))
+						models.LocationStatusActive,
+						utils.AnyTime{}, utils.AnyTime{}, utils.AnyTime{}, nil,
+						`["Godzilla (Premium)","Medieval Madness"]`,
+					).WillReturnError(&pgconn.PgError{
+					Code: "23505", ConstraintName: "idx_location_slug", Detail: "Key (slug)=(test) already exists.",
+				})
 				mock.ExpectRollback()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "locations" WHERE slug LIKE $1`)).
+					WithArgs("pinballz-arcade%").
+					WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("pinballz-arcade"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
+					WithArgs(
+						"Pinballz Arcade",
+						"pinballz-arcade-2",
+						"123 Main St, Austin, TX, USA",
+						1,
+						models.LocationStatusActive,
+						utils.AnyTime{}, utils.AnyTime{}, utils.AnyTime{}, nil,
+						`["Godzilla (Premium)","Medieval Madness"]`,
+					).WillReturnRows(sqlmock.NewRows([]string{"id", "machines"}).AddRow(uuid.New(), `["Godzilla (Premium)","Medieval Madness"]`))
+				mock.ExpectCommit()
 
 				body, err := json.Marshal(&generated.LocationCreate{
-					PinballMapId: mockPinballLocationsResponse.ID,
+					PinballMapId: &mockPinballLocationsResponse.ID,
 				})
 				gomega.Expect(err).To(gomega.BeNil())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
@@ -180,8 +226,13 @@ var _ = ginkgo.Describe("Location", func() {
 
 				router.POST("/", controller.CreateLocation)
 				router.ServeHTTP(rr, req)
-				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusConflict))
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
 				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+
+				response := &generated.LocationResponse{}
+				err = json.Unmarshal(rr.Body.Bytes(), response)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(response.Location.Slug).To(gomega.Equal("pinballz-arcade-2"))
 			})
 		})
 
@@ -190,22 +241,30 @@ var _ = ginkgo.Describe("Location", func() {
 				router.Use(func(ctx *gin.Context) {
 					ctx.Set(auth.IdentityKey, userObj)
 				})
-				mockPinballMapClient.On("GetLocation", 1).Return(mockPinballLocationsResponse, nil)
-
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE pinball_map_id = $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(mockPinballLocationsResponse, nil)
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "locations" WHERE slug LIKE $1`)).
+					WithArgs("pinballz-arcade%").
+					WillReturnRows(sqlmock.NewRows([]string{"slug"}))
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","status","last_synced_at","created_at","updated_at","deleted_at","machines") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id","machines"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
 					WithArgs(
 						"Pinballz Arcade",
 						"pinballz-arcade",
 						"123 Main St, Austin, TX, USA",
 						1,
-						utils.AnyTime{}, utils.AnyTime{},
+						models.LocationStatusActive,
+						utils.AnyTime{}, utils.AnyTime{}, utils.AnyTime{}, nil,
+						`["Godzilla (Premium)","Medieval Madness"]`,
 					).WillReturnError(fmt.Errorf("some error"))
 				mock.ExpectRollback()
 
 				body, err := json.Marshal(&generated.LocationCreate{
-					PinballMapId: mockPinballLocationsResponse.ID,
+					PinballMapId: &mockPinballLocationsResponse.ID,
 				})
 				gomega.Expect(err).To(gomega.BeNil())
 				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
@@ -217,6 +276,310 @@ var _ = ginkgo.Describe("Location", func() {
 				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
 			})
 		})
+
+		ginkgo.Context("is called with a pinball map id that pinball map does not know about", func() {
+			ginkgo.It("returns a 400", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE pinball_map_id = $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(nil, fmt.Errorf("location 1 %w", pinballmap.ErrNotFound))
+
+				body, err := json.Marshal(&generated.LocationCreate{
+					PinballMapId: utils.PtrInt(1),
+				})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", controller.CreateLocation)
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+			})
+		})
+
+		ginkgo.Context("is called with a name and address instead of a pinball map id", func() {
+			ginkgo.It("creates a private location and returns a 201", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "locations" WHERE slug LIKE $1`)).
+					WithArgs("johns-basement%").
+					WillReturnRows(sqlmock.NewRows([]string{"slug"}))
+				mock.ExpectBegin()
+				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","status","last_synced_at","created_at","updated_at","deleted_at","machines") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id","machines"`
+				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
+					WithArgs(
+						"John's Basement",
+						"johns-basement",
+						"1 Private Rd, Austin, TX, USA",
+						nil,
+						models.LocationStatusActive,
+						nil, utils.AnyTime{}, utils.AnyTime{}, nil,
+						`["Twilight Zone"]`,
+					).WillReturnRows(sqlmock.NewRows([]string{"id", "machines"}).AddRow(uuid.New(), `["Twilight Zone"]`))
+				mock.ExpectCommit()
+
+				body, err := json.Marshal(&generated.LocationCreate{
+					Name:     utils.PtrString("John's Basement"),
+					Address:  utils.PtrString("1 Private Rd, Austin, TX, USA"),
+					Machines: &[]string{"Twilight Zone"},
+				})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", controller.CreateLocation)
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				mockPinballMapClient.AssertNotCalled(ginkgo.GinkgoT(), "GetLocation")
+
+				response := &generated.LocationResponse{}
+				err = json.Unmarshal(rr.Body.Bytes(), response)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(response.Location.Name).To(gomega.Equal("John's Basement"))
+				gomega.Expect(response.Location.PinballMapId).To(gomega.BeNil())
+			})
+		})
+
+		ginkgo.Context("is called for a private location without machines", func() {
+			ginkgo.It("creates the location with an empty machine list", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "locations" WHERE slug LIKE $1`)).
+					WithArgs("johns-basement%").
+					WillReturnRows(sqlmock.NewRows([]string{"slug"}))
+				mock.ExpectBegin()
+				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","status","last_synced_at","created_at","updated_at","deleted_at","machines") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id","machines"`
+				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
+					WithArgs(
+						"John's Basement",
+						"johns-basement",
+						"1 Private Rd, Austin, TX, USA",
+						nil,
+						models.LocationStatusActive,
+						nil, utils.AnyTime{}, utils.AnyTime{}, nil,
+						`[]`,
+					).WillReturnRows(sqlmock.NewRows([]string{"id", "machines"}).AddRow(uuid.New(), `[]`))
+				mock.ExpectCommit()
+
+				body, err := json.Marshal(&generated.LocationCreate{
+					Name:    utils.PtrString("John's Basement"),
+					Address: utils.PtrString("1 Private Rd, Austin, TX, USA"),
+				})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", controller.CreateLocation)
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring(`"machines":[]`))
+			})
+		})
+
+		ginkgo.Context("is called with a pinball map id another location is linked to", func() {
+			ginkgo.It("returns a 409", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE pinball_map_id = $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+				body, err := json.Marshal(&generated.LocationCreate{
+					PinballMapId: utils.PtrInt(1),
+				})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", controller.CreateLocation)
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusConflict))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				mockPinballMapClient.AssertNotCalled(ginkgo.GinkgoT(), "GetLocation")
+			})
+		})
+
+		ginkgo.Context("is called with a pinball map location without machines", func() {
+			ginkgo.It("creates the location with an empty machine list", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+				mockPinballLocationsResponse.MachineNames = nil
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE pinball_map_id = $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(mockPinballLocationsResponse, nil)
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "locations" WHERE slug LIKE $1`)).
+					WithArgs("pinballz-arcade%").
+					WillReturnRows(sqlmock.NewRows([]string{"slug"}))
+				mock.ExpectBegin()
+				const sqlInsert = `INSERT INTO "locations" ("name","slug","address","pinball_map_id","status","last_synced_at","created_at","updated_at","deleted_at","machines") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id","machines"`
+				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
+					WithArgs(
+						"Pinballz Arcade",
+						"pinballz-arcade",
+						"123 Main St, Austin, TX, USA",
+						1,
+						models.LocationStatusActive,
+						utils.AnyTime{}, utils.AnyTime{}, utils.AnyTime{}, nil,
+						`[]`,
+					).WillReturnRows(sqlmock.NewRows([]string{"id", "machines"}).AddRow(uuid.New(), `[]`))
+				mock.ExpectCommit()
+
+				body, err := json.Marshal(&generated.LocationCreate{
+					PinballMapId: utils.PtrInt(1),
+				})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", controller.CreateLocation)
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring(`"machines":[]`))
+			})
+		})
+
+		ginkgo.Context("is called with a name longer than the column allows", func() {
+			ginkgo.It("returns a 400", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+
+				body, err := json.Marshal(&generated.LocationCreate{
+					Name:    utils.PtrString(strings.Repeat("a", 256)),
+					Address: utils.PtrString("1 Private Rd, Austin, TX, USA"),
+				})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", controller.CreateLocation)
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+
+		ginkgo.Context("is called without a pinball map id or an address", func() {
+			ginkgo.It("returns a 400", func() {
+				router.Use(func(ctx *gin.Context) {
+					ctx.Set(auth.IdentityKey, userObj)
+				})
+
+				body, err := json.Marshal(&generated.LocationCreate{
+					Name: utils.PtrString("John's Basement"),
+				})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", controller.CreateLocation)
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+	})
+
+	ginkgo.Describe("LinkLocation", func() {
+		var locationColumns = []string{"id", "name", "slug", "address", "pinball_map_id", "status", "created_at", "updated_at"}
+
+		ginkgo.Context("is called for a private location", func() {
+			ginkgo.It("links the location and returns a 200", func() {
+				locationId := uuid.New()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE slug = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`)).
+					WithArgs("johns-basement").
+					WillReturnRows(sqlmock.NewRows(locationColumns).
+						AddRow(locationId, "John's Basement", "johns-basement", "1 Private Rd", nil, models.LocationStatusActive, time.Now(), time.Now()))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE pinball_map_id = $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(mockPinballLocationsResponse, nil)
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "locations" SET "name"=$1,"slug"=$2,"address"=$3,"pinball_map_id"=$4,"machines"=$5,"status"=$6,"last_synced_at"=$7,"created_at"=$8,"updated_at"=$9,"deleted_at"=$10 WHERE "locations"."deleted_at" IS NULL AND "id" = $11`)).
+					WithArgs(
+						"Pinballz Arcade", "johns-basement", "123 Main St, Austin, TX, USA", 1,
+						`["Godzilla (Premium)","Medieval Madness"]`, models.LocationStatusActive,
+						utils.AnyTime{}, utils.AnyTime{}, utils.AnyTime{}, nil, locationId,
+					).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				body, err := json.Marshal(&generated.LocationLink{PinballMapId: 1})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/johns-basement", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/:slug", func(ctx *gin.Context) {
+					controller.LinkLocation(ctx, ctx.Param("slug"))
+				})
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+
+				response := &generated.LocationResponse{}
+				err = json.Unmarshal(rr.Body.Bytes(), response)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(*response.Location.PinballMapId).To(gomega.Equal(1))
+				gomega.Expect(response.Location.Name).To(gomega.Equal("Pinballz Arcade"))
+			})
+		})
+
+		ginkgo.Context("is called for a location that is already linked", func() {
+			ginkgo.It("returns a 409", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE slug = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`)).
+					WithArgs("pinballz-arcade").
+					WillReturnRows(sqlmock.NewRows(locationColumns).
+						AddRow(uuid.New(), "Pinballz Arcade", "pinballz-arcade", "123 Main St", 1, models.LocationStatusActive, time.Now(), time.Now()))
+
+				body, err := json.Marshal(&generated.LocationLink{PinballMapId: 2})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/pinballz-arcade", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/:slug", func(ctx *gin.Context) {
+					controller.LinkLocation(ctx, ctx.Param("slug"))
+				})
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusConflict))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				mockPinballMapClient.AssertNotCalled(ginkgo.GinkgoT(), "GetLocation")
+			})
+		})
+
+		ginkgo.Context("is called with an unknown location slug", func() {
+			ginkgo.It("returns a 404", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE slug = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`)).
+					WithArgs("unknown").
+					WillReturnError(gorm.ErrRecordNotFound)
+
+				body, err := json.Marshal(&generated.LocationLink{PinballMapId: 1})
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest("POST", "/unknown", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/:slug", func(ctx *gin.Context) {
+					controller.LinkLocation(ctx, ctx.Param("slug"))
+				})
+				router.ServeHTTP(rr, req)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNotFound))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
 	})
 
 	ginkgo.Describe("GetLocation", func() {
@@ -240,11 +603,36 @@ var _ = ginkgo.Describe("Location", func() {
 				gomega.Expect(response.Location.Name).To(gomega.Equal("Pinballz Arcade"))
 			})
 		})
+		ginkgo.Context("is called with a slug the location was renamed from", func() {
+			ginkgo.It("returns the location with a link to its current slug", func() {
+				locationID := uuid.New()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE slug = $1`)).
+					WithArgs("pinballz").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "slug_histories" WHERE kind = $1 AND slug = $2`)).
+					WithArgs("location", "pinballz").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "slug", "resource_id"}).
+						AddRow(uuid.New(), "location", "pinballz", locationID))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE id = $1`)).
+					WithArgs(locationID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
+						AddRow(locationID, "Pinballz Arcade", "pinballz-arcade", "123 Main St, Austin, TX, USA", 1, time.Now(), time.Now()))
+
+				controller.GetLocationWithSlug(ctx, "pinballz")
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				gomega.Expect(rr.Header().Get("Link")).To(gomega.Equal(`</api/locations/pinballz-arcade>; rel="canonical"`))
+			})
+		})
 		ginkgo.Context("is called with an unknown location slug", func() {
 			ginkgo.It("returns a 404", func() {
 				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE slug = $1`)).
 					WithArgs("pinballz-arcade").
 					WillReturnError(gorm.ErrRecordNotFound)
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "slug_histories" WHERE kind = $1 AND slug = $2`)).
+					WithArgs("location", "pinballz-arcade").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "slug", "resource_id"}))
 
 				controller.GetLocationWithSlug(ctx, "pinballz-arcade")
 
@@ -269,11 +657,13 @@ var _ = ginkgo.Describe("Location", func() {
 	ginkgo.Describe("ListLocations", func() {
 		ginkgo.Context("is called", func() {
 			ginkgo.It("returns a 200", func() {
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations"`)).
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE "locations"."deleted_at" IS NULL ORDER BY created_at DESC,id DESC LIMIT 51`)).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
 						AddRow(uuid.New(), "Pinballz Arcade", "pinballz-arcade", "123 Main St, Austin, TX, USA", 1, time.Now(), time.Now()))
 
-				controller.ListLocations(ctx)
+				controller.ListLocations(ctx, generated.GetLocationsParams{})
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
 				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
@@ -284,18 +674,159 @@ var _ = ginkgo.Describe("Location", func() {
 				gomega.Expect(response.Locations).ToNot(gomega.BeNil())
 
 				gomega.Expect(response.Locations[0].Name).To(gomega.Equal("Pinballz Arcade"))
+				gomega.Expect(response.Total).To(gomega.Equal(1))
+				gomega.Expect(response.NextCursor).To(gomega.BeNil())
+			})
+		})
+		ginkgo.Context("with a cursor", func() {
+			ginkgo.It("returns the page after it", func() {
+				createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+				lastID := uuid.New()
+				cursor := base64.RawURLEncoding.EncodeToString([]byte(
+					fmt.Sprintf(`{"s":"-created_at","v":%q,"id":%q}`, createdAt.Format(time.RFC3339Nano), lastID),
+				))
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations" WHERE LOWER(name) LIKE $1 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs("%pinball%").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE LOWER(name) LIKE $1 AND (created_at, id) < ($2, $3) AND "locations"."deleted_at" IS NULL ORDER BY created_at DESC,id DESC LIMIT 51`)).
+					WithArgs("%pinball%", createdAt, lastID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "address", "pinball_map_id", "created_at", "updated_at"}).
+						AddRow(uuid.New(), "Pinballz Lake Creek", "pinballz-lake-creek", "456 Main St, Austin, TX, USA", 2, createdAt, createdAt))
+
+				controller.ListLocations(ctx, generated.GetLocationsParams{
+					Search: utils.PtrString("Pinball"),
+					Cursor: &cursor,
+				})
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+
+				response := &generated.LocationListResponse{}
+				err := json.Unmarshal(rr.Body.Bytes(), response)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(response.Locations).To(gomega.HaveLen(1))
+				gomega.Expect(response.NextCursor).To(gomega.BeNil())
+			})
+		})
+		ginkgo.Context("with a cursor made for another sort", func() {
+			ginkgo.It("returns a 400", func() {
+				cursor := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"s":"name","v":"a","id":%q}`, uuid.New())))
+
+				controller.ListLocations(ctx, generated.GetLocationsParams{Cursor: &cursor})
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
 			})
 		})
 		ginkgo.Context("and the query fails", func() {
 			ginkgo.It("returns a 500", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "locations"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations"`)).
 					WillReturnError(fmt.Errorf("some error"))
 
-				controller.ListLocations(ctx)
+				controller.ListLocations(ctx, generated.GetLocationsParams{})
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusInternalServerError))
 				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
 			})
 		})
 	})
+
+	ginkgo.Describe("DeleteLocation", func() {
+		const sqlSelect = `SELECT * FROM "locations" WHERE slug = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
+		const sqlCountLeagues = `SELECT count(*) FROM "leagues" WHERE location_id = $1 AND "leagues"."deleted_at" IS NULL`
+		const sqlCountTournaments = `SELECT count(*) FROM "tournaments" WHERE location_id = $1 AND "tournaments"."deleted_at" IS NULL`
+		var locationId uuid.UUID
+
+		ginkgo.BeforeEach(func() {
+			locationId = uuid.New()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+				WithArgs("pinballz-arcade").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).
+					AddRow(locationId, "Pinballz Arcade", "pinballz-arcade"))
+		})
+
+		ginkgo.Context("is called for a location nothing is held at", func() {
+			ginkgo.It("deletes the location and returns a 204", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlCountLeagues)).
+					WithArgs(locationId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta(sqlCountTournaments)).
+					WithArgs(locationId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "locations" SET "deleted_at"=$1 WHERE "locations"."id" = $2 AND "locations"."deleted_at" IS NULL`)).
+					WithArgs(utils.AnyTime{}, locationId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				controller.DeleteLocation(ctx, "pinballz-arcade")
+
+				gomega.Expect(ctx.Writer.Status()).To(gomega.Equal(http.StatusNoContent))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+		ginkgo.Context("is called for a location leagues are held at", func() {
+			ginkgo.It("returns a 409", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlCountLeagues)).
+					WithArgs(locationId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectQuery(regexp.QuoteMeta(sqlCountTournaments)).
+					WithArgs(locationId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+				controller.DeleteLocation(ctx, "pinballz-arcade")
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusConflict))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+
+				response := &generated.ErrorResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Detail).To(gomega.Equal("location is used by 2 leagues and 0 tournaments, delete them first"))
+			})
+		})
+	})
+
+	ginkgo.Describe("RestoreLocation", func() {
+		const sqlSelect = `SELECT * FROM "locations" WHERE slug = $1 AND deleted_at IS NOT NULL ORDER BY "locations"."id" LIMIT 1`
+
+		ginkgo.Context("is called for a deleted location", func() {
+			ginkgo.It("restores the location and returns a 200", func() {
+				locationId := uuid.New()
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+					WithArgs("pinballz-arcade").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "deleted_at"}).
+						AddRow(locationId, "Pinballz Arcade", "pinballz-arcade", time.Now()))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "locations" SET "deleted_at"=$1 WHERE "id" = $2`)).
+					WithArgs(nil, locationId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				controller.RestoreLocation(ctx, "pinballz-arcade")
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+
+				response := &generated.LocationResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Location.Id).To(gomega.Equal(locationId.String()))
+				gomega.Expect(response.Location.DeletedAt).To(gomega.BeNil())
+			})
+		})
+		ginkgo.Context("is called for a location that isn't deleted", func() {
+			ginkgo.It("returns a 404", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+					WithArgs("pinballz-arcade").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				controller.RestoreLocation(ctx, "pinballz-arcade")
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNotFound))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+	})
 })
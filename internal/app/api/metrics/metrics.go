@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"pinman/internal/clients/pinballmap"
+)
+
+type Metrics struct {
+	PinballMapCache *pinballmap.CachedClient
+}
+
+func NewMetrics(pinballMapCache *pinballmap.CachedClient) *Metrics {
+	return &Metrics{
+		PinballMapCache: pinballMapCache,
+	}
+}
+
+type Response struct {
+	PinballMapCache *pinballmap.CacheMetrics `json:"pinball_map_cache,omitempty"`
+}
+
+func (m *Metrics) Get(c *gin.Context) {
+	response := Response{}
+	if m.PinballMapCache != nil {
+		cacheMetrics := m.PinballMapCache.Metrics()
+		response.PinballMapCache = &cacheMetrics
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,70 @@
+package metrics_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	testify "github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"pinman/internal/app/api/metrics"
+	"pinman/internal/clients/pinballmap"
+	"testing"
+	"time"
+
+	g "github.com/onsi/ginkgo/v2"
+	m "github.com/onsi/gomega"
+)
+
+func TestMetrics(t *testing.T) {
+	m.RegisterFailHandler(g.Fail)
+	g.RunSpecs(t, "Metrics Suite")
+}
+
+var _ = g.Describe("Metrics", func() {
+	var get = func(controller *metrics.Metrics) (*httptest.ResponseRecorder, metrics.Response) {
+		resp := httptest.NewRecorder()
+		gin.SetMode(gin.TestMode)
+		ctx, router := gin.CreateTestContext(resp)
+
+		router.GET("/", controller.Get)
+
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		router.ServeHTTP(resp, ctx.Request)
+
+		data := metrics.Response{}
+		err := json.Unmarshal(resp.Body.Bytes(), &data)
+		m.Expect(err).To(m.BeNil())
+
+		return resp, data
+	}
+
+	g.When("Get receives a request", func() {
+		g.Context("and the pinball map cache is enabled", func() {
+			g.It("returns the cache metrics", func() {
+				client := pinballmap.NewMockClientInterface(g.GinkgoT())
+				client.On("GetLocation", testify.Anything, 1).Return(&pinballmap.Location{ID: 1}, nil).Once()
+
+				cache := pinballmap.NewCachedClient(client, pinballmap.NewMemoryCacheStore(), time.Hour, time.Hour)
+				_, err := cache.GetLocation(context.Background(), 1)
+				m.Expect(err).To(m.BeNil())
+				_, err = cache.GetLocation(context.Background(), 1)
+				m.Expect(err).To(m.BeNil())
+
+				resp, data := get(metrics.NewMetrics(cache))
+
+				m.Expect(resp.Code).To(m.Equal(http.StatusOK))
+				m.Expect(data.PinballMapCache).To(m.Equal(&pinballmap.CacheMetrics{Hits: 1, Misses: 1}))
+			})
+		})
+
+		g.Context("and the pinball map cache is disabled", func() {
+			g.It("omits the cache metrics", func() {
+				resp, data := get(metrics.NewMetrics(nil))
+
+				m.Expect(resp.Code).To(m.Equal(http.StatusOK))
+				m.Expect(data.PinballMapCache).To(m.BeNil())
+			})
+		})
+	})
+})
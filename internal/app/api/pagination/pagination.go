@@ -0,0 +1,160 @@
+// Package pagination pages through list endpoints with cursors. A cursor holds the sort value and ID of the last item
+// of a page, the next page starts after it, so pages don't shift when items are added or removed in between.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"reflect"
+	"strings"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+	DefaultSort  = "-created_at"
+)
+
+var ErrInvalidCursor = fmt.Errorf("invalid cursor")
+
+// Field is a column the items of a list can be sorted by.
+type Field[T any] struct {
+	Column string
+	Value  func(item *T) interface{}
+}
+
+// Params are the paging query parameters of a list endpoint.
+type Params struct {
+	Limit  *int
+	Cursor *string
+	// Sort names a field, with a leading "-" to sort in descending order
+	Sort *string
+}
+
+// Page selects one page of a list of T.
+type Page[T any] struct {
+	Limit      int
+	field      Field[T]
+	sort       string
+	descending bool
+	// afterValue and afterID are the sort value and ID of the item the page starts after
+	afterValue interface{}
+	afterID    *uuid.UUID
+}
+
+type cursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uuid.UUID       `json:"id"`
+}
+
+// New validates the paging parameters against the fields the list can be sorted by.
+func New[T any](params Params, fields []Field[T]) (*Page[T], error) {
+	page := &Page[T]{Limit: DefaultLimit, sort: DefaultSort}
+	if params.Limit != nil {
+		page.Limit = *params.Limit
+	}
+	if page.Limit < 1 || page.Limit > MaxLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	}
+
+	if params.Sort != nil && *params.Sort != "" {
+		page.sort = *params.Sort
+	}
+	column := strings.TrimPrefix(page.sort, "-")
+	page.descending = column != page.sort
+	found := false
+	for _, field := range fields {
+		if field.Column == column {
+			page.field, found = field, true
+			break
+		}
+	}
+	if !found {
+		names := make([]string, 0, len(fields))
+		for _, field := range fields {
+			names = append(names, field.Column)
+		}
+		return nil, fmt.Errorf("can't sort by %q, sort by one of %s", column, strings.Join(names, ", "))
+	}
+
+	if params.Cursor != nil && *params.Cursor != "" {
+		after, err := decodeCursor(*params.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		// the cursor points into the order it was created for
+		if after.Sort != page.sort {
+			return nil, fmt.Errorf("%w: it was created for sort=%s", ErrInvalidCursor, after.Sort)
+		}
+		if page.afterValue, err = page.decodeValue(after.Value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		page.afterID = &after.ID
+	}
+
+	return page, nil
+}
+
+// Scope orders the query and selects the items of the page, plus one to tell whether there is a next page.
+func (p *Page[T]) Scope(db *gorm.DB) *gorm.DB {
+	direction, comparison := "ASC", ">"
+	if p.descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if p.afterID != nil {
+		db = db.Where(fmt.Sprintf("(%s, id) %s (?, ?)", p.field.Column, comparison), p.afterValue, *p.afterID)
+	}
+
+	// the ID breaks ties, so items with the same sort value are neither skipped nor repeated
+	return db.
+		Order(fmt.Sprintf("%s %s", p.field.Column, direction)).
+		Order(fmt.Sprintf("id %s", direction)).
+		Limit(p.Limit + 1)
+}
+
+// Trim drops the extra item Scope selected and returns the cursor of the next page, or nil on the last page.
+func (p *Page[T]) Trim(items []T, id func(item *T) uuid.UUID) ([]T, *string, error) {
+	if len(items) <= p.Limit {
+		return items, nil, nil
+	}
+	items = items[:p.Limit]
+
+	last := &items[len(items)-1]
+	value, err := json.Marshal(p.field.Value(last))
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := json.Marshal(&cursor{Sort: p.sort, Value: value, ID: id(last)})
+	if err != nil {
+		return nil, nil, err
+	}
+	next := base64.RawURLEncoding.EncodeToString(encoded)
+
+	return items, &next, nil
+}
+
+// decodeValue decodes the sort value of a cursor into the type of the sort field.
+func (p *Page[T]) decodeValue(encoded json.RawMessage) (interface{}, error) {
+	value := reflect.New(reflect.TypeOf(p.field.Value(new(T))))
+	if err := json.Unmarshal(encoded, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+func decodeCursor(encoded string) (*cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	after := &cursor{}
+	if err := json.Unmarshal(decoded, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
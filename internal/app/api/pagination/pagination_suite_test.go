@@ -0,0 +1,101 @@
+package pagination_test
+
+import (
+	"github.com/google/uuid"
+	"pinman/internal/app/api/pagination"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"testing"
+	"time"
+
+	g "github.com/onsi/ginkgo/v2"
+	m "github.com/onsi/gomega"
+)
+
+func TestPagination(t *testing.T) {
+	m.RegisterFailHandler(g.Fail)
+	g.RunSpecs(t, "Pagination Suite")
+}
+
+var fields = []pagination.Field[models.League]{
+	{Column: "created_at", Value: func(league *models.League) interface{} { return league.CreatedAt }},
+	{Column: "name", Value: func(league *models.League) interface{} { return league.Name }},
+}
+
+func leagueID(league *models.League) uuid.UUID {
+	return league.ID
+}
+
+var _ = g.Describe("New", func() {
+	g.It("defaults to the newest items first", func() {
+		page, err := pagination.New(pagination.Params{}, fields)
+		m.Expect(err).To(m.BeNil())
+		m.Expect(page.Limit).To(m.Equal(pagination.DefaultLimit))
+	})
+
+	g.It("rejects limits out of range", func() {
+		_, err := pagination.New(pagination.Params{Limit: utils.PtrInt(0)}, fields)
+		m.Expect(err).ToNot(m.BeNil())
+		_, err = pagination.New(pagination.Params{Limit: utils.PtrInt(pagination.MaxLimit + 1)}, fields)
+		m.Expect(err).ToNot(m.BeNil())
+	})
+
+	g.It("rejects unknown sort fields", func() {
+		_, err := pagination.New(pagination.Params{Sort: utils.PtrString("-slug")}, fields)
+		m.Expect(err).To(m.MatchError(`can't sort by "slug", sort by one of created_at, name`))
+	})
+
+	g.It("rejects malformed cursors", func() {
+		_, err := pagination.New(pagination.Params{Cursor: utils.PtrString("not a cursor")}, fields)
+		m.Expect(err).To(m.MatchError(pagination.ErrInvalidCursor))
+	})
+})
+
+var _ = g.Describe("Trim", func() {
+	var leagues []models.League
+
+	g.BeforeEach(func() {
+		createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		leagues = []models.League{
+			{ID: uuid.New(), Name: "Monday League", CreatedAt: createdAt},
+			{ID: uuid.New(), Name: "Tuesday League", CreatedAt: createdAt.Add(-time.Hour)},
+			{ID: uuid.New(), Name: "Wednesday League", CreatedAt: createdAt.Add(-2 * time.Hour)},
+		}
+	})
+
+	g.It("returns no cursor on the last page", func() {
+		page, err := pagination.New(pagination.Params{Limit: utils.PtrInt(3)}, fields)
+		m.Expect(err).To(m.BeNil())
+
+		items, next, err := page.Trim(leagues, leagueID)
+		m.Expect(err).To(m.BeNil())
+		m.Expect(items).To(m.HaveLen(3))
+		m.Expect(next).To(m.BeNil())
+	})
+
+	g.It("drops the extra item and returns a cursor that continues after the last item", func() {
+		page, err := pagination.New(pagination.Params{Limit: utils.PtrInt(2)}, fields)
+		m.Expect(err).To(m.BeNil())
+
+		items, next, err := page.Trim(leagues, leagueID)
+		m.Expect(err).To(m.BeNil())
+		m.Expect(items).To(m.HaveLen(2))
+		m.Expect(next).ToNot(m.BeNil())
+
+		_, err = pagination.New(pagination.Params{Limit: utils.PtrInt(2), Cursor: next}, fields)
+		m.Expect(err).To(m.BeNil())
+	})
+
+	g.It("returns cursors that only work with the sort they were made for", func() {
+		page, err := pagination.New(pagination.Params{Limit: utils.PtrInt(1), Sort: utils.PtrString("name")}, fields)
+		m.Expect(err).To(m.BeNil())
+
+		_, next, err := page.Trim(leagues, leagueID)
+		m.Expect(err).To(m.BeNil())
+
+		_, err = pagination.New(pagination.Params{Cursor: next}, fields)
+		m.Expect(err).To(m.MatchError(pagination.ErrInvalidCursor))
+		_, err = pagination.New(pagination.Params{Cursor: next, Sort: utils.PtrString("name")}, fields)
+		m.Expect(err).To(m.BeNil())
+	})
+})
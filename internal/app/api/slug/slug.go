@@ -0,0 +1,322 @@
+// Package slug picks the slugs leagues, locations and tournaments are addressed by. Slugs are derived from the name of
+// a record unless the client chooses one, and derived slugs get a numeric suffix when another record took them first.
+// Records are also found by the slugs in their slug history, so links keep working once records can be renamed.
+package slug
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	apierrors "pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of record a slug addresses.
+type Kind string
+
+const (
+	League     Kind = "league"
+	Location   Kind = "location"
+	Tournament Kind = "tournament"
+)
+
+const (
+	// maxAttempts limits how often a record is created again after concurrent requests took the derived slug first
+	maxAttempts = 5
+	// suffixLength is the room left for suffixes when looking up the slugs that are taken, enough for "-999"
+	suffixLength = 4
+)
+
+var (
+	ErrUnknownKind = errors.New("unknown slug type")
+	ErrInvalidSlug = errors.New("invalid slug")
+)
+
+// tables and maxLengths are the table of each kind and the length of its new slugs, collections the path segment the
+// kind is found under in the API and in the app. Existing league slugs may be longer, as they weren't limited before.
+var (
+	tables = map[Kind]string{
+		League:     "leagues",
+		Location:   "locations",
+		Tournament: "tournaments",
+	}
+	collections = map[Kind]string{
+		League:     "leagues",
+		Location:   "locations",
+		Tournament: "tournaments",
+	}
+	maxLengths = map[Kind]int{
+		League:     20,
+		Location:   20,
+		Tournament: 20,
+	}
+)
+
+var (
+	slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	// appRecordPage matches the pages of the app that address a record by its slug, capturing the collection, the
+	// slug and the rest of the path
+	appRecordPage = regexp.MustCompile(`^/app/(leagues|locations|tournaments)/([a-z0-9]+(?:-[a-z0-9]+)*)(/.*)?$`)
+)
+
+// Service looks up which slugs are taken.
+type Service struct {
+	DB *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{DB: db}
+}
+
+// ParseKind returns the kind named by the type parameter of a request.
+func ParseKind(kind string) (Kind, error) {
+	if _, ok := tables[Kind(kind)]; !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	return Kind(kind), nil
+}
+
+// Validate checks a slug chosen by a client: lower case letters and digits separated by single dashes, no longer than
+// the kind allows.
+func Validate(kind Kind, slug string) error {
+	if !slugPattern.MatchString(slug) {
+		return fmt.Errorf("%w: use lower case letters and digits separated by dashes", ErrInvalidSlug)
+	}
+	if len(slug) > maxLengths[kind] {
+		return fmt.Errorf("%w: use at most %d characters", ErrInvalidSlug, maxLengths[kind])
+	}
+	return nil
+}
+
+// Derive returns the slug for a name, before looking at the slugs that are taken.
+func Derive(kind Kind, name string) string {
+	slug := utils.Slugify(name, maxLengths[kind])
+	if slug == "" {
+		// names without a single letter or digit that can be spelled in ASCII still need a slug
+		return string(kind)
+	}
+	return slug
+}
+
+// Available returns whether no record of the kind uses the slug.
+func (s *Service) Available(kind Kind, slug string) (bool, error) {
+	var count int64
+	if err := s.DB.Table(tables[kind]).Where("slug = ?", slug).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// Suggest returns the first slug of base, base-2, base-3 and so on that no record of the kind uses. The base is
+// shortened to make room for the suffix.
+func (s *Service) Suggest(kind Kind, base string) (string, error) {
+	maxLength := maxLengths[kind]
+	prefix := strings.TrimRight(truncate(base, maxLength-suffixLength), "-")
+
+	var slugs []string
+	err := s.DB.Table(tables[kind]).
+		Where("slug LIKE ?", utils.EscapeLike(prefix)+"%").
+		Pluck("slug", &slugs).Error
+	if err != nil {
+		return "", err
+	}
+	taken := make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		taken[slug] = true
+	}
+
+	candidate := truncate(base, maxLength)
+	for n := 2; taken[candidate]; n++ {
+		suffix := "-" + strconv.Itoa(n)
+		candidate = strings.TrimRight(truncate(base, maxLength-len(suffix)), "-") + suffix
+	}
+	return candidate, nil
+}
+
+// Create creates a record with create, passing it the requested slug, or one derived from the name if none was
+// requested. A requested slug is used as is, so a conflict is left to the caller, while a derived slug that a
+// concurrent request took first is replaced with the next free one.
+func (s *Service) Create(kind Kind, name string, requested *string, create func(slug string) error) error {
+	if requested != nil && *requested != "" {
+		if err := Validate(kind, *requested); err != nil {
+			return err
+		}
+		return create(*requested)
+	}
+
+	base := Derive(kind, name)
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		var slug string
+		if slug, err = s.Suggest(kind, base); err != nil {
+			return err
+		}
+		if err = create(slug); !isSlugConflict(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Find finds the record of the kind with the slug into dest, applying the scopes to the query. A slug no record uses
+// finds the record that was renamed from it, which is reported as renamed so the client can be pointed to the
+// current slug. Current slugs take precedence over old ones, so a new record can take the slug another was renamed
+// from.
+func (s *Service) Find(
+	kind Kind, slug string, dest interface{}, scopes ...func(*gorm.DB) *gorm.DB,
+) (renamed bool, err error) {
+	err = s.DB.Scopes(scopes...).Where("slug = ?", slug).First(dest).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	var history models.SlugHistory
+	if err := s.DB.Where("kind = ? AND slug = ?", kind, slug).First(&history).Error; err != nil {
+		return false, err
+	}
+	return true, s.DB.Scopes(scopes...).Where("id = ?", history.ResourceID).First(dest).Error
+}
+
+// Current returns the current slug of the record of the kind the slug addresses, which is the slug itself unless the
+// record was renamed from it. Deleted records that were renamed aren't found.
+func (s *Service) Current(kind Kind, slug string) (string, error) {
+	available, err := s.Available(kind, slug)
+	if err != nil || !available {
+		return slug, err
+	}
+
+	table := tables[kind]
+	var slugs []string
+	err = s.DB.Table(table).
+		Joins("JOIN slug_histories ON slug_histories.resource_id = "+table+".id").
+		Where("slug_histories.kind = ? AND slug_histories.slug = ?", kind, slug).
+		Where(table+".deleted_at IS NULL").
+		Pluck(table+".slug", &slugs).Error
+	if err != nil {
+		return "", err
+	}
+	if len(slugs) == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return slugs[0], nil
+}
+
+// AppRedirect returns where to permanently redirect a request for a page of the app that addresses a record by a slug
+// it was renamed from, like /app/leagues/{slug}, and whether the page has to be redirected at all. Only the pages of
+// leagues, locations and tournaments with a valid slug are looked up, every other page of the app is left alone
+// without a query.
+func (s *Service) AppRedirect(page *url.URL) (string, bool) {
+	match := appRecordPage.FindStringSubmatch(page.Path)
+	if match == nil {
+		return "", false
+	}
+	collection, previous, rest := match[1], match[2], match[3]
+	kind, ok := kindOfCollection(collection)
+	if !ok {
+		return "", false
+	}
+
+	current, err := s.Current(kind, previous)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Err(err).Str("path", page.Path).Msg("failed to look up slug of page")
+		}
+		return "", false
+	}
+	if current == previous {
+		return "", false
+	}
+
+	target := url.URL{Path: "/app/" + collection + "/" + current + rest, RawQuery: page.RawQuery}
+	return target.String(), true
+}
+
+// SetCanonicalLink points a client that requested a record by a slug it was renamed from to the current slug, while
+// the record is still returned.
+func SetCanonicalLink(ctx *gin.Context, kind Kind, current string) {
+	ctx.Header("Link", fmt.Sprintf(`</api/%s/%s>; rel="canonical"`, collections[kind], current))
+}
+
+func kindOfCollection(collection string) (Kind, bool) {
+	for kind, c := range collections {
+		if c == collection {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+func isSlugConflict(err error) bool {
+	var dbErr *apierrors.DatabaseError
+	if !errors.As(apierrors.TranslateDBError(err), &dbErr) || dbErr.Kind != apierrors.ErrUniqueViolation {
+		return false
+	}
+	// without the fields the violation could only be told apart by the constraint name
+	return len(dbErr.Fields) == 0 || (len(dbErr.Fields) == 1 && dbErr.Fields[0] == "slug")
+}
+
+func truncate(s string, length int) string {
+	if len(s) > length {
+		return s[:length]
+	}
+	return s
+}
+
+// Controller lets clients check slugs before they create records with them.
+type Controller struct {
+	Slugs *Service
+}
+
+func NewController(db *gorm.DB) *Controller {
+	return &Controller{
+		Slugs: NewService(db),
+	}
+}
+
+// CheckSlug returns whether a slug is valid and available, and suggests a free one if it's taken.
+func (c *Controller) CheckSlug(ctx *gin.Context, params generated.GetSlugsCheckParams) {
+	kind, err := ParseKind(params.Type)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+	if err := Validate(kind, params.Slug); err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx, map[string]interface{}{
+			"fields": []string{"slug"},
+		})
+		return
+	}
+
+	available, err := c.Slugs.Available(kind, params.Slug)
+	if err != nil {
+		log.Err(err).Msg("failed to check slug")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to check slug", ctx)
+		return
+	}
+
+	response := generated.SlugCheck{
+		Type:      params.Type,
+		Slug:      params.Slug,
+		Available: available,
+	}
+	if !available {
+		suggestion, err := c.Slugs.Suggest(kind, params.Slug)
+		if err != nil {
+			log.Err(err).Msg("failed to suggest slug")
+			apierrors.AbortWithError(http.StatusInternalServerError, "failed to check slug", ctx)
+			return
+		}
+		response.Suggestion = &suggestion
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,249 @@
+package slug_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"net/http"
+	"net/url"
+	"pinman/internal/app/api/slug"
+	"pinman/internal/app/generated"
+	"pinman/internal/utils"
+	"regexp"
+	"testing"
+
+	g "github.com/onsi/ginkgo/v2"
+	m "github.com/onsi/gomega"
+)
+
+func TestSlug(t *testing.T) {
+	m.RegisterFailHandler(g.Fail)
+	g.RunSpecs(t, "Slug Suite")
+}
+
+const sqlTaken = `SELECT "slug" FROM "leagues" WHERE slug LIKE $1`
+
+var _ = g.Describe("Validate", func() {
+	g.It("accepts lower case letters and digits separated by dashes", func() {
+		m.Expect(slug.Validate(slug.League, "monday-league-2")).To(m.Succeed())
+	})
+
+	g.It("rejects other characters, stray dashes and long slugs", func() {
+		for _, s := range []string{"Monday", "monday league", "-monday", "monday--league", "a-very-long-league-slug"} {
+			m.Expect(slug.Validate(slug.League, s)).To(m.MatchError(slug.ErrInvalidSlug), s)
+		}
+	})
+})
+
+var _ = g.Describe("Derive", func() {
+	g.It("falls back to the kind for names without letters or digits", func() {
+		m.Expect(slug.Derive(slug.Tournament, "!!!")).To(m.Equal("tournament"))
+	})
+})
+
+var _ = g.Describe("Service", func() {
+	var service *slug.Service
+	var mock sqlmock.Sqlmock
+
+	g.BeforeEach(func() {
+		db, sqlMock := utils.NewGormMock()
+		service, mock = slug.NewService(db), sqlMock
+	})
+
+	g.Describe("Suggest", func() {
+		g.It("returns the base if it's free", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlTaken)).
+				WithArgs("monday%").
+				WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("monday-league"))
+
+			suggestion, err := service.Suggest(slug.League, "monday")
+			m.Expect(err).To(m.BeNil())
+			m.Expect(suggestion).To(m.Equal("monday"))
+		})
+
+		g.It("shortens the base to make room for the suffix", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlTaken)).
+				WithArgs("tuesday-night-pi%").
+				WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("tuesday-night-pinba"))
+
+			suggestion, err := service.Suggest(slug.League, "tuesday-night-pinba")
+			m.Expect(err).To(m.BeNil())
+			m.Expect(suggestion).To(m.Equal("tuesday-night-pinb-2"))
+		})
+	})
+
+	g.Describe("Create", func() {
+		g.It("uses a requested slug as is", func() {
+			var created []string
+			err := service.Create(slug.League, "Monday League", utils.PtrString("mondays"), func(s string) error {
+				created = append(created, s)
+				return nil
+			})
+			m.Expect(err).To(m.BeNil())
+			m.Expect(created).To(m.Equal([]string{"mondays"}))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("rejects an invalid requested slug", func() {
+			err := service.Create(slug.League, "Monday League", utils.PtrString("Mondays!"), func(string) error {
+				g.Fail("created a record with an invalid slug")
+				return nil
+			})
+			m.Expect(err).To(m.MatchError(slug.ErrInvalidSlug))
+		})
+
+		g.It("retries with the next free slug when a concurrent request took it", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlTaken)).
+				WithArgs("monday-league%").
+				WillReturnRows(sqlmock.NewRows([]string{"slug"}))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlTaken)).
+				WithArgs("monday-league%").
+				WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("monday-league"))
+
+			var created []string
+			err := service.Create(slug.League, "Monday League", nil, func(s string) error {
+				created = append(created, s)
+				if len(created) == 1 {
+					return &pgconn.PgError{Code: "23505", Detail: "Key (slug)=(monday-league) already exists."}
+				}
+				return nil
+			})
+			m.Expect(err).To(m.BeNil())
+			m.Expect(created).To(m.Equal([]string{"monday-league", "monday-league-2"}))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("doesn't retry other errors", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlTaken)).
+				WithArgs("monday-league%").
+				WillReturnRows(sqlmock.NewRows([]string{"slug"}))
+
+			err := service.Create(slug.League, "Monday League", nil, func(string) error {
+				return errors.New("some error")
+			})
+			m.Expect(err).To(m.MatchError("some error"))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+	})
+})
+
+var _ = g.Describe("History", func() {
+	var service *slug.Service
+	var mock sqlmock.Sqlmock
+
+	g.BeforeEach(func() {
+		db, sqlMock := utils.NewGormMock()
+		service, mock = slug.NewService(db), sqlMock
+	})
+
+	g.Describe("AppRedirect", func() {
+		const sqlCurrent = `SELECT "leagues"."slug" FROM "leagues" JOIN slug_histories ON ` +
+			`slug_histories.resource_id = leagues.id WHERE (slug_histories.kind = $1 AND slug_histories.slug = $2) AND ` +
+			`leagues.deleted_at IS NULL`
+
+		g.It("redirects pages of renamed records to their current slug", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues" WHERE slug = $1`)).
+				WithArgs("mondays").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlCurrent)).
+				WithArgs("league", "mondays").
+				WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("monday-league"))
+
+			target, ok := service.AppRedirect(&url.URL{Path: "/app/leagues/mondays/tournaments", RawQuery: "page=2"})
+			m.Expect(ok).To(m.BeTrue())
+			m.Expect(target).To(m.Equal("/app/leagues/monday-league/tournaments?page=2"))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("doesn't redirect pages of current slugs", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues" WHERE slug = $1`)).
+				WithArgs("monday-league").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+			_, ok := service.AppRedirect(&url.URL{Path: "/app/leagues/monday-league"})
+			m.Expect(ok).To(m.BeFalse())
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("doesn't redirect unknown slugs or other pages", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues" WHERE slug = $1`)).
+				WithArgs("unknown").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta(sqlCurrent)).
+				WithArgs("league", "unknown").
+				WillReturnRows(sqlmock.NewRows([]string{"slug"}))
+
+			_, ok := service.AppRedirect(&url.URL{Path: "/app/leagues/unknown"})
+			m.Expect(ok).To(m.BeFalse())
+			_, ok = service.AppRedirect(&url.URL{Path: "/app/leagues"})
+			m.Expect(ok).To(m.BeFalse())
+			_, ok = service.AppRedirect(&url.URL{Path: "/app/login/oidc"})
+			m.Expect(ok).To(m.BeFalse())
+			_, ok = service.AppRedirect(&url.URL{Path: "/app/leagues/Not_A_Slug"})
+			m.Expect(ok).To(m.BeFalse())
+			_, ok = service.AppRedirect(&url.URL{Path: "/app/assets/leagues/mondays"})
+			m.Expect(ok).To(m.BeFalse())
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+	})
+})
+
+var _ = g.Describe("Controller", func() {
+	var controller *slug.Controller
+	var mock sqlmock.Sqlmock
+
+	check := func(params generated.GetSlugsCheckParams) (int, *generated.SlugCheck) {
+		_, rr, router := utils.NewGinTestCtx()
+		router.GET("/", func(c *gin.Context) { controller.CheckSlug(c, params) })
+		req, err := http.NewRequest("GET", "/", nil)
+		m.Expect(err).To(m.BeNil())
+		router.ServeHTTP(rr, req)
+
+		response := &generated.SlugCheck{}
+		if rr.Code == http.StatusOK {
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+		}
+		return rr.Code, response
+	}
+
+	g.BeforeEach(func() {
+		db, sqlMock := utils.NewGormMock()
+		controller, mock = &slug.Controller{Slugs: slug.NewService(db)}, sqlMock
+	})
+
+	g.It("reports a free slug as available", func() {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues" WHERE slug = $1`)).
+			WithArgs("mondays").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		code, response := check(generated.GetSlugsCheckParams{Type: "league", Slug: "mondays"})
+		m.Expect(code).To(m.Equal(http.StatusOK))
+		m.Expect(response.Available).To(m.BeTrue())
+		m.Expect(response.Suggestion).To(m.BeNil())
+		m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+	})
+
+	g.It("suggests another slug for a taken one", func() {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "leagues" WHERE slug = $1`)).
+			WithArgs("mondays").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta(sqlTaken)).
+			WithArgs("mondays%").
+			WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("mondays"))
+
+		code, response := check(generated.GetSlugsCheckParams{Type: "league", Slug: "mondays"})
+		m.Expect(code).To(m.Equal(http.StatusOK))
+		m.Expect(response.Available).To(m.BeFalse())
+		m.Expect(response.Suggestion).To(m.Equal(utils.PtrString("mondays-2")))
+		m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+	})
+
+	g.It("rejects unknown types and invalid slugs", func() {
+		code, _ := check(generated.GetSlugsCheckParams{Type: "user", Slug: "mondays"})
+		m.Expect(code).To(m.Equal(http.StatusBadRequest))
+		code, _ = check(generated.GetSlugsCheckParams{Type: "league", Slug: "Mondays!"})
+		m.Expect(code).To(m.Equal(http.StatusBadRequest))
+	})
+})
@@ -1,31 +1,49 @@
 package tournament
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 	"net/http"
+	"pinman/internal/app/api/auth"
 	apierrors "pinman/internal/app/api/errors"
+	"pinman/internal/app/api/include"
+	"pinman/internal/app/api/league"
+	"pinman/internal/app/api/location"
+	"pinman/internal/app/api/pagination"
+	"pinman/internal/app/api/slug"
 	"pinman/internal/app/generated"
 	"pinman/internal/models"
 	"pinman/internal/utils"
 	"strings"
+	"time"
 )
 
 type Controller struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	Slugs *slug.Service
 }
 
 func NewController(db *gorm.DB) *Controller {
 	return &Controller{
-		DB: db,
+		DB:    db,
+		Slugs: slug.NewService(db),
 	}
 }
 
+// includeRelations are the relations tournaments can embed, and defaultRelations the ones they embed without an
+// include parameter.
+var (
+	includeRelations = []string{include.Location, include.League}
+	defaultRelations = []string{include.Location, include.League}
+)
+
 // CreateTournament creates a new tournament
-func (c *Controller) CreateTournament(ctx *gin.Context) {
+func (c *Controller) CreateTournament(ctx *gin.Context, params generated.PostTournamentsParams) {
 	payload := &generated.TournamentCreate{}
 
 	if err := ctx.ShouldBindJSON(payload); err != nil {
@@ -33,20 +51,53 @@ func (c *Controller) CreateTournament(ctx *gin.Context) {
 		return
 	}
 
+	relations, err := include.Parse(params.Include, includeRelations, defaultRelations...)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
 	if err := validateSettingsPayload(payload); err != nil {
 		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
 		return
 	}
 
+	startsAt, endsAt, err := parseDates(payload)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
 	league := models.League{}
 	if err := c.DB.First(&league, "id = ?", payload.LeagueId).Error; err != nil {
-		apierrors.AbortWithError(http.StatusBadRequest, fmt.Sprintf("invalid league: %s", err.Error()), ctx)
+		if errors.Is(apierrors.TranslateDBError(err), apierrors.ErrNotFound) {
+			apierrors.AbortWithError(
+				http.StatusBadRequest, fmt.Sprintf("league with id %s does not exist", payload.LeagueId), ctx,
+				map[string]interface{}{"fields": []string{"league_id"}},
+			)
+			return
+		}
+		log.Err(err).Msg("failed to get league")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to get league", ctx)
+		return
+	}
+
+	if err := auth.AuthorizeLeague(ctx, league.ID); err != nil {
+		apierrors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
 		return
 	}
 
 	location := models.Location{}
 	if err := c.DB.First(&location, "id = ?", payload.LocationId).Error; err != nil {
-		apierrors.AbortWithError(http.StatusBadRequest, fmt.Sprintf("invalid location: %s", err.Error()), ctx)
+		if errors.Is(apierrors.TranslateDBError(err), apierrors.ErrNotFound) {
+			apierrors.AbortWithError(
+				http.StatusBadRequest, fmt.Sprintf("location with id %s does not exist", payload.LocationId), ctx,
+				map[string]interface{}{"fields": []string{"location_id"}},
+			)
+			return
+		}
+		log.Err(err).Msg("failed to get location")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to get location", ctx)
 		return
 	}
 
@@ -58,54 +109,38 @@ func (c *Controller) CreateTournament(ctx *gin.Context) {
 
 	tournament := &models.Tournament{
 		Name:       payload.Name,
-		Slug:       payload.Slug,
 		Type:       payload.Type,
 		Settings:   settings,
 		LocationID: location.ID,
 		LeagueID:   league.ID,
+		StartsAt:   startsAt,
+		EndsAt:     endsAt,
 	}
 
-	result := c.DB.Create(tournament)
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "duplicate key") {
-			apierrors.AbortWithError(http.StatusBadRequest, "tournament with slug already exists", ctx)
-			return
-		} else {
-			log.Error().Err(result.Error).Msg("failed to create tournament")
-			apierrors.AbortWithError(http.StatusInternalServerError, "failed to create tournament", ctx)
-			return
-		}
+	err = c.Slugs.Create(slug.Tournament, payload.Name, payload.Slug, func(tournamentSlug string) error {
+		tournament.Slug = tournamentSlug
+		return c.DB.Create(tournament).Error
+	})
+	if errors.Is(err, slug.ErrInvalidSlug) {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx, map[string]interface{}{"fields": []string{"slug"}})
+		return
+	}
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to create tournament", apierrors.DBErrorDetails{
+			apierrors.ErrUniqueViolation:     "tournament with slug already exists",
+			apierrors.ErrForeignKeyViolation: "league or location of the tournament does not exist",
+		})
+		return
 	}
 
+	// the relations were loaded to create the tournament, so they don't have to be preloaded
+	tournament.League = league
+	tournament.Location = location
+
+	// Use the original payload settings to avoid having to unmarshal/marshal to the generated type
 	ctx.JSON(http.StatusCreated, generated.TournamentResponse{
-		Tournament: generated.Tournament{
-			Id:   tournament.ID.String(),
-			Name: tournament.Name,
-			Slug: tournament.Slug,
-			Type: tournament.Type,
-			// Use the original payload settings to avoid having to unmarshal/marshal to the generated type
-			Settings: payload.Settings,
-			Location: &generated.Location{
-				Id:           tournament.Location.ID.String(),
-				Slug:         tournament.Location.Slug,
-				Address:      tournament.Location.Address,
-				Name:         tournament.Location.Name,
-				PinballMapId: tournament.Location.PinballMapID,
-				CreatedAt:    utils.FormatTime(tournament.Location.CreatedAt),
-				UpdatedAt:    utils.FormatTime(tournament.Location.UpdatedAt),
-			},
-			League: &generated.League{
-				Id:        tournament.League.ID.String(),
-				Slug:      tournament.League.Slug,
-				Name:      tournament.League.Name,
-				CreatedAt: utils.FormatTime(tournament.League.CreatedAt),
-				UpdatedAt: utils.FormatTime(tournament.League.UpdatedAt),
-			},
-			CreatedAt: utils.FormatTime(tournament.CreatedAt),
-			UpdatedAt: utils.FormatTime(tournament.UpdatedAt),
-		},
+		Tournament: newTournament(tournament, payload.Settings, relations),
 	})
-
 }
 
 func validateSettingsPayload(payload *generated.TournamentCreate) error {
@@ -124,54 +159,313 @@ func validateSettingsPayload(payload *generated.TournamentCreate) error {
 	return nil
 }
 
-// ListTournaments lists all tournaments
-func (c *Controller) ListTournaments(ctx *gin.Context) {
+// parseDates parses when the tournament starts and ends, either of which may be left out. It can't end before it
+// starts.
+func parseDates(payload *generated.TournamentCreate) (*time.Time, *time.Time, error) {
+	var startsAt, endsAt *time.Time
+	if payload.StartsAt != nil {
+		t, err := time.Parse(time.RFC3339, *payload.StartsAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("starts_at must be an RFC 3339 timestamp")
+		}
+		startsAt = &t
+	}
+	if payload.EndsAt != nil {
+		t, err := time.Parse(time.RFC3339, *payload.EndsAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ends_at must be an RFC 3339 timestamp")
+		}
+		endsAt = &t
+	}
+	if startsAt != nil && endsAt != nil && endsAt.Before(*startsAt) {
+		return nil, nil, fmt.Errorf("ends_at must not be before starts_at")
+	}
+
+	return startsAt, endsAt, nil
+}
+
+// tournamentSortFields are the fields tournaments can be sorted by.
+var tournamentSortFields = []pagination.Field[models.Tournament]{
+	{Column: "created_at", Value: func(tournament *models.Tournament) interface{} { return tournament.CreatedAt }},
+	{Column: "name", Value: func(tournament *models.Tournament) interface{} { return tournament.Name }},
+}
+
+// ListTournaments lists one page of the tournaments matching the filters, most recently created first unless sorted
+// otherwise. Deleted tournaments are only listed if the parameters include them.
+func (c *Controller) ListTournaments(ctx *gin.Context, params generated.GetTournamentsParams) {
+	page, err := pagination.New(pagination.Params{
+		Limit:  params.Limit,
+		Cursor: params.Cursor,
+		Sort:   params.Sort,
+	}, tournamentSortFields)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+	relations, err := include.Parse(params.Include, includeRelations, defaultRelations...)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	var leagueID, locationID *uuid.UUID
+	if params.LeagueId != nil && *params.LeagueId != "" {
+		id, err := uuid.Parse(*params.LeagueId)
+		if err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, "league_id must be a UUID", ctx)
+			return
+		}
+		leagueID = &id
+	}
+	if params.LocationId != nil && *params.LocationId != "" {
+		id, err := uuid.Parse(*params.LocationId)
+		if err != nil {
+			apierrors.AbortWithError(http.StatusBadRequest, "location_id must be a UUID", ctx)
+			return
+		}
+		locationID = &id
+	}
+	if params.Type != nil && *params.Type != generated.MultiRoundTournament {
+		apierrors.AbortWithError(http.StatusBadRequest, fmt.Sprintf("unknown tournament type: %s", *params.Type), ctx)
+		return
+	}
+	if params.Status != nil {
+		switch *params.Status {
+		case generated.Upcoming, generated.Ongoing, generated.Finished:
+		default:
+			apierrors.AbortWithError(http.StatusBadRequest, fmt.Sprintf("unknown tournament status: %s", *params.Status), ctx)
+			return
+		}
+	}
+
+	includeDeleted := params.IncludeDeleted != nil && *params.IncludeDeleted
+	now := time.Now()
+	filter := func(db *gorm.DB) *gorm.DB {
+		if params.Search != nil && *params.Search != "" {
+			db = db.Where("LOWER(name) LIKE ?", "%"+utils.EscapeLike(strings.ToLower(*params.Search))+"%")
+		}
+		if leagueID != nil {
+			db = db.Where("league_id = ?", *leagueID)
+		}
+		if locationID != nil {
+			db = db.Where("location_id = ?", *locationID)
+		}
+		if params.Type != nil {
+			db = db.Where("type = ?", *params.Type)
+		}
+		if params.Status != nil {
+			db = db.Scopes(statusScope(*params.Status, now))
+		}
+		if includeDeleted {
+			db = db.Unscoped()
+		}
+		return db
+	}
+	relationsScope := relations.Scope
+	if includeDeleted {
+		relationsScope = relations.UnscopedScope
+	}
+
+	var total int64
+	if err := c.DB.Model(&models.Tournament{}).Scopes(filter).Count(&total).Error; err != nil {
+		log.Error().Err(err).Msg("failed to count tournaments")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list tournaments", ctx)
+		return
+	}
+
 	var tournaments []models.Tournament
-	result := c.DB.Preload("League").Preload("Location").Find(&tournaments)
+	result := c.DB.Scopes(relationsScope, filter, page.Scope).Find(&tournaments)
 	if result.Error != nil {
 		log.Error().Err(result.Error).Msg("failed to list tournaments")
 		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list tournaments", ctx)
 		return
 	}
+	tournaments, nextCursor, err := page.Trim(tournaments, func(tournament *models.Tournament) uuid.UUID {
+		return tournament.ID
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create cursor")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to list tournaments", ctx)
+		return
+	}
 
 	response := generated.TournamentListResponse{
 		Tournaments: []generated.Tournament{},
+		NextCursor:  nextCursor,
+		Total:       int(total),
 	}
 
-	for _, tournament := range tournaments {
-		settings, err := tournament.GetSettings()
+	for i := range tournaments {
+		settings, err := tournaments[i].GetSettings()
 		if err != nil {
 			log.Error().Err(err).Msg("failed to read tournament settings")
 			apierrors.AbortWithError(http.StatusInternalServerError, "failed to read tournament settings", ctx)
 			return
 		}
-		response.Tournaments = append(response.Tournaments, generated.Tournament{
-			Id:       tournament.ID.String(),
-			Name:     tournament.Name,
-			Slug:     tournament.Slug,
-			Type:     tournament.Type,
-			Settings: *settings,
-			Location: &generated.Location{
-				Id:           tournament.Location.ID.String(),
-				Slug:         tournament.Location.Slug,
-				Address:      tournament.Location.Address,
-				Name:         tournament.Location.Name,
-				PinballMapId: tournament.Location.PinballMapID,
-				CreatedAt:    utils.FormatTime(tournament.Location.CreatedAt),
-				UpdatedAt:    utils.FormatTime(tournament.Location.UpdatedAt),
-			},
-			League: &generated.League{
-				Id:        tournament.League.ID.String(),
-				Slug:      tournament.League.Slug,
-				Name:      tournament.League.Name,
-				OwnerId:   tournament.League.OwnerID.String(),
-				CreatedAt: utils.FormatTime(tournament.League.CreatedAt),
-				UpdatedAt: utils.FormatTime(tournament.League.UpdatedAt),
-			},
-			CreatedAt: utils.FormatTime(tournament.CreatedAt),
-			UpdatedAt: utils.FormatTime(tournament.UpdatedAt),
-		})
+		response.Tournaments = append(response.Tournaments, newTournament(&tournaments[i], *settings, relations))
 	}
 
 	ctx.JSON(http.StatusOK, response)
 }
+
+// statusScope only finds the tournaments that have the status at now, which matches models.Tournament.Status.
+func statusScope(status generated.TournamentStatus, now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch status {
+		case generated.Finished:
+			return db.Where("ends_at <= ?", now)
+		case generated.Ongoing:
+			return db.Where("starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", now, now)
+		default:
+			return db.Where("(starts_at IS NULL OR starts_at > ?) AND (ends_at IS NULL OR ends_at > ?)", now, now)
+		}
+	}
+}
+
+// GetTournamentWithSlug returns the tournament with the slug, or the tournament that was renamed from it with a
+// canonical link to its current slug.
+func (c *Controller) GetTournamentWithSlug(
+	ctx *gin.Context, tournamentSlug string, params generated.GetTournamentsSlugParams,
+) {
+	relations, err := include.Parse(params.Include, includeRelations, defaultRelations...)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	var tournament models.Tournament
+	renamed, err := c.Slugs.Find(slug.Tournament, tournamentSlug, &tournament, relations.Scope)
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get tournament", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "tournament not found",
+		})
+		return
+	}
+	if renamed {
+		slug.SetCanonicalLink(ctx, slug.Tournament, tournament.Slug)
+	}
+
+	settings, err := tournament.GetSettings()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read tournament settings")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to read tournament settings", ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, generated.TournamentResponse{
+		Tournament: newTournament(&tournament, *settings, relations),
+	})
+}
+
+// DeleteTournament deletes the tournament with the slug. Only the owner of its league and admins can delete it, and
+// admins can restore it until deleted tournaments are purged.
+func (c *Controller) DeleteTournament(ctx *gin.Context, tournamentSlug string) {
+	currentUser, err := auth.GetUser(ctx)
+	if err != nil {
+		apierrors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
+		return
+	}
+
+	var tournament models.Tournament
+	if err := c.DB.Preload("League").Where("slug = ?", tournamentSlug).First(&tournament).Error; err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get tournament", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "tournament not found",
+		})
+		return
+	}
+
+	if tournament.League.OwnerID != currentUser.ID && !models.RoleIncludes(currentUser.Role, models.RoleAdmin) {
+		apierrors.AbortWithError(http.StatusForbidden, "only the owner of the league can delete its tournaments", ctx)
+		return
+	}
+	if err := auth.AuthorizeLeague(ctx, tournament.LeagueID); err != nil {
+		apierrors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
+		return
+	}
+
+	if err := c.DB.Delete(&tournament).Error; err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to delete tournament", nil)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RestoreTournament restores the deleted tournament with the slug. Its league and location have to be restored first.
+func (c *Controller) RestoreTournament(ctx *gin.Context, tournamentSlug string) {
+	var tournament models.Tournament
+	err := c.DB.Unscoped().Where("slug = ? AND deleted_at IS NOT NULL", tournamentSlug).First(&tournament).Error
+	if err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to get tournament", apierrors.DBErrorDetails{
+			apierrors.ErrNotFound: "deleted tournament not found",
+		})
+		return
+	}
+
+	// the league and location are loaded into their own variables, so restoring the tournament doesn't save them
+	var tournamentLeague models.League
+	var tournamentLocation models.Location
+	err = c.DB.Where("id = ?", tournament.LeagueID).First(&tournamentLeague).Error
+	if err == nil {
+		err = c.DB.Where("id = ?", tournament.LocationID).First(&tournamentLocation).Error
+	}
+	if err != nil {
+		if errors.Is(apierrors.TranslateDBError(err), apierrors.ErrNotFound) {
+			apierrors.AbortWithError(
+				http.StatusConflict, "league or location of the tournament is deleted, restore it first", ctx,
+			)
+			return
+		}
+		log.Error().Err(err).Msg("failed to get league and location of tournament")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to restore tournament", ctx)
+		return
+	}
+
+	if err := c.DB.Unscoped().Model(&tournament).UpdateColumn("deleted_at", nil).Error; err != nil {
+		apierrors.AbortWithDBError(ctx, err, "failed to restore tournament", nil)
+		return
+	}
+	tournament.DeletedAt = gorm.DeletedAt{}
+	tournament.League = tournamentLeague
+	tournament.Location = tournamentLocation
+
+	settings, err := tournament.GetSettings()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read tournament settings")
+		apierrors.AbortWithError(http.StatusInternalServerError, "failed to read tournament settings", ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, generated.TournamentResponse{
+		Tournament: newTournament(&tournament, *settings, defaultRelations),
+	})
+}
+
+// newTournament returns the API representation of a tournament, embedding the included relations, which have to be
+// loaded.
+func newTournament(
+	tournament *models.Tournament, settings generated.TournamentSettings, relations include.Relations,
+) generated.Tournament {
+	response := generated.Tournament{
+		Id:        tournament.ID.String(),
+		Name:      tournament.Name,
+		Slug:      tournament.Slug,
+		Type:      tournament.Type,
+		Settings:  settings,
+		StartsAt:  utils.FormatTimePtr(tournament.StartsAt),
+		EndsAt:    utils.FormatTimePtr(tournament.EndsAt),
+		Status:    tournament.Status(time.Now()),
+		CreatedAt: utils.FormatTime(tournament.CreatedAt),
+		UpdatedAt: utils.FormatTime(tournament.UpdatedAt),
+		DeletedAt: utils.FormatDeletedAt(tournament.DeletedAt),
+	}
+	if relations.Has(include.Location) {
+		tournamentLocation := location.NewLocation(&tournament.Location)
+		response.Location = &tournamentLocation
+	}
+	if relations.Has(include.League) {
+		tournamentLeague := league.NewLeague(&tournament.League, nil)
+		response.League = &tournamentLeague
+	}
+	return response
+}
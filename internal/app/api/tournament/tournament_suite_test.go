@@ -7,6 +7,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
@@ -69,7 +70,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				LeagueId:   uuid.New().String(),
 				LocationId: uuid.New().String(),
 				Name:       "Test Tournament",
-				Slug:       "test-tournament",
+				Slug:       utils.PtrString("test-tournament"),
 				Settings:   *si,
 				Type:       generated.MultiRoundTournament,
 			}
@@ -81,7 +82,7 @@ var _ = ginkgo.Describe("Controller", func() {
 					c.Set("user", userObj)
 				})
 
-				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 ORDER BY "leagues"."id" LIMIT 1`
+				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 AND "leagues"."deleted_at" IS NULL ORDER BY "leagues"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(leaguesQuery)).
 					WithArgs(payload.LeagueId).
 					WillReturnRows(
@@ -89,7 +90,7 @@ var _ = ginkgo.Describe("Controller", func() {
 							AddRow(payload.LeagueId),
 					)
 
-				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(locationsQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnRows(
@@ -100,9 +101,9 @@ var _ = ginkgo.Describe("Controller", func() {
 				insertedSettings, err := payload.Settings.MarshalJSON()
 				gomega.Expect(err).To(gomega.BeNil())
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "tournaments" ("name","slug","type","settings","location_id","league_id") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "tournaments" ("name","slug","type","settings","location_id","league_id","starts_at","ends_at","deleted_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id","created_at","updated_at"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Slug, payload.Type, string(insertedSettings), payload.LocationId, payload.LeagueId).
+					WithArgs(payload.Name, *payload.Slug, payload.Type, string(insertedSettings), payload.LocationId, payload.LeagueId, nil, nil, nil).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id"}).
 							AddRow(uuid.New()),
@@ -114,7 +115,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 				gomega.Expect(err).To(gomega.BeNil())
 
-				router.POST("/", controller.CreateTournament)
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
@@ -122,8 +123,44 @@ var _ = ginkgo.Describe("Controller", func() {
 				err = json.Unmarshal(rr.Body.Bytes(), response)
 				gomega.Expect(err).To(gomega.BeNil())
 				gomega.Expect(response.Tournament.Name).To(gomega.Equal(payload.Name))
-				gomega.Expect(response.Tournament.Slug).To(gomega.Equal(payload.Slug))
+				gomega.Expect(response.Tournament.Slug).To(gomega.Equal(*payload.Slug))
 				gomega.Expect(response.Tournament.Type).To(gomega.Equal(payload.Type))
+				gomega.Expect(response.Tournament.League.Id).To(gomega.Equal(payload.LeagueId))
+				gomega.Expect(response.Tournament.Location.Id).To(gomega.Equal(payload.LocationId))
+			})
+		})
+		ginkgo.Context("with an include parameter", func() {
+			ginkgo.It("only embeds the included relations", func() {
+				router.Use(func(c *gin.Context) {
+					c.Set("user", userObj)
+				})
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(payload.LeagueId))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(payload.LocationId))
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tournaments"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectCommit()
+
+				body, err := json.Marshal(payload)
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest(http.MethodPost, "/?include=location", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", func(c *gin.Context) {
+					params := generated.PostTournamentsParams{}
+					gomega.Expect(c.ShouldBindQuery(&params)).To(gomega.Succeed())
+					controller.CreateTournament(c, params)
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+				response := &generated.TournamentResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Tournament.Location.Id).To(gomega.Equal(payload.LocationId))
+				gomega.Expect(response.Tournament.League).To(gomega.BeNil())
 			})
 		})
 		ginkgo.Context("with a location id that does not exist", func() {
@@ -132,7 +169,7 @@ var _ = ginkgo.Describe("Controller", func() {
 					c.Set("user", userObj)
 				})
 
-				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 ORDER BY "leagues"."id" LIMIT 1`
+				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 AND "leagues"."deleted_at" IS NULL ORDER BY "leagues"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(leaguesQuery)).
 					WithArgs(payload.LeagueId).
 					WillReturnRows(
@@ -140,7 +177,7 @@ var _ = ginkgo.Describe("Controller", func() {
 							AddRow(payload.LeagueId),
 					)
 
-				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(locationsQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnError(gorm.ErrRecordNotFound)
@@ -150,40 +187,65 @@ var _ = ginkgo.Describe("Controller", func() {
 				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 				gomega.Expect(err).To(gomega.BeNil())
 
-				router.POST("/", controller.CreateTournament)
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				response := &generated.ErrorResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(*response.Meta).To(gomega.HaveKeyWithValue("fields", []interface{}{"location_id"}))
 			})
 		})
 		ginkgo.Context("with a league id that does not exist", func() {
-			ginkgo.It("returns a 400", func() {
+			ginkgo.It("returns a 400 naming the field", func() {
 				router.Use(func(c *gin.Context) {
 					c.Set("user", userObj)
 				})
 
-				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 ORDER BY "leagues"."id" LIMIT 1`
+				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 AND "leagues"."deleted_at" IS NULL ORDER BY "leagues"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(leaguesQuery)).
 					WithArgs(payload.LeagueId).
 					WillReturnError(gorm.ErrRecordNotFound)
 
-				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
-				mock.ExpectQuery(regexp.QuoteMeta(locationsQuery)).
-					WithArgs(payload.LocationId).
-					WillReturnRows(
-						sqlmock.NewRows([]string{"id"}).
-							AddRow(payload.LocationId),
-					)
-
 				body, err := json.Marshal(payload)
 				gomega.Expect(err).To(gomega.BeNil())
 				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 				gomega.Expect(err).To(gomega.BeNil())
 
-				router.POST("/", controller.CreateTournament)
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				response := &generated.ErrorResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Detail).To(gomega.Equal(fmt.Sprintf("league with id %s does not exist", payload.LeagueId)))
+				gomega.Expect(*response.Meta).To(gomega.HaveKeyWithValue("fields", []interface{}{"league_id"}))
+			})
+		})
+		ginkgo.Context("when the league can't be looked up", func() {
+			ginkgo.It("returns a 500", func() {
+				router.Use(func(c *gin.Context) {
+					c.Set("user", userObj)
+				})
+
+				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 AND "leagues"."deleted_at" IS NULL ORDER BY "leagues"."id" LIMIT 1`
+				mock.ExpectQuery(regexp.QuoteMeta(leaguesQuery)).
+					WithArgs(payload.LeagueId).
+					WillReturnError(fmt.Errorf("connection refused"))
+
+				body, err := json.Marshal(payload)
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusInternalServerError))
+				response := &generated.ErrorResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Detail).To(gomega.Equal("failed to get league"))
 			})
 		})
 		ginkgo.Context("with a payload that is not valid", func() {
@@ -197,10 +259,50 @@ var _ = ginkgo.Describe("Controller", func() {
 				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 				gomega.Expect(err).To(gomega.BeNil())
 
-				router.POST("/", controller.CreateTournament)
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+			})
+		})
+		ginkgo.Context("with an end before its start", func() {
+			ginkgo.It("returns a 400", func() {
+				router.Use(func(c *gin.Context) {
+					c.Set("user", userObj)
+				})
+				payload.StartsAt = utils.PtrString("2026-05-02T10:00:00Z")
+				payload.EndsAt = utils.PtrString("2026-05-01T10:00:00Z")
+
+				body, err := json.Marshal(payload)
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("ends_at must not be before starts_at"))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+		ginkgo.Context("with a start that is not a timestamp", func() {
+			ginkgo.It("returns a 400", func() {
+				router.Use(func(c *gin.Context) {
+					c.Set("user", userObj)
+				})
+				payload.StartsAt = utils.PtrString("tomorrow")
+
+				body, err := json.Marshal(payload)
+				gomega.Expect(err).To(gomega.BeNil())
+				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("starts_at must be an RFC 3339 timestamp"))
 			})
 		})
 		ginkgo.Context("with a settings payload that is invalid", func() {
@@ -218,7 +320,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 				gomega.Expect(err).To(gomega.BeNil())
 
-				router.POST("/", controller.CreateTournament)
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
@@ -226,12 +328,12 @@ var _ = ginkgo.Describe("Controller", func() {
 			})
 		})
 		ginkgo.Context("with existing slug", func() {
-			ginkgo.It("returns a 400", func() {
+			ginkgo.It("returns a 409", func() {
 				router.Use(func(c *gin.Context) {
 					c.Set("user", userObj)
 				})
 
-				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 ORDER BY "leagues"."id" LIMIT 1`
+				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 AND "leagues"."deleted_at" IS NULL ORDER BY "leagues"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(leaguesQuery)).
 					WithArgs(payload.LeagueId).
 					WillReturnRows(
@@ -239,7 +341,7 @@ var _ = ginkgo.Describe("Controller", func() {
 							AddRow(payload.LeagueId),
 					)
 
-				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(locationsQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnRows(
@@ -251,10 +353,12 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(err).To(gomega.BeNil())
 
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "tournaments" ("name","slug","type","settings","location_id","league_id") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "tournaments" ("name","slug","type","settings","location_id","league_id","starts_at","ends_at","deleted_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id","created_at","updated_at"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Slug, payload.Type, string(insertedSettings), payload.LocationId, payload.LeagueId).
-					WillReturnError(fmt.Errorf("ERROR: duplicate key value violates unique constraint \"idx_tournament_slug\" (SQLSTATE 23505)"))
+					WithArgs(payload.Name, *payload.Slug, payload.Type, string(insertedSettings), payload.LocationId, payload.LeagueId, nil, nil, nil).
+					WillReturnError(&pgconn.PgError{
+						Code: "23505", ConstraintName: "idx_tournament_slug", Detail: "Key (slug)=(test) already exists.",
+					})
 				mock.ExpectRollback()
 
 				body, err := json.Marshal(payload)
@@ -262,10 +366,14 @@ var _ = ginkgo.Describe("Controller", func() {
 				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 				gomega.Expect(err).To(gomega.BeNil())
 
-				router.POST("/", controller.CreateTournament)
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
 				router.ServeHTTP(rr, req)
 
-				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusConflict))
+				response := &generated.ErrorResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Detail).To(gomega.Equal("tournament with slug already exists"))
+				gomega.Expect(*response.Meta).To(gomega.HaveKeyWithValue("fields", []interface{}{"slug"}))
 			})
 		})
 		ginkgo.Context("with a database error", func() {
@@ -274,7 +382,7 @@ var _ = ginkgo.Describe("Controller", func() {
 					c.Set("user", userObj)
 				})
 
-				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 ORDER BY "leagues"."id" LIMIT 1`
+				const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 AND "leagues"."deleted_at" IS NULL ORDER BY "leagues"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(leaguesQuery)).
 					WithArgs(payload.LeagueId).
 					WillReturnRows(
@@ -282,7 +390,7 @@ var _ = ginkgo.Describe("Controller", func() {
 							AddRow(payload.LeagueId),
 					)
 
-				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 ORDER BY "locations"."id" LIMIT 1`
+				const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
 				mock.ExpectQuery(regexp.QuoteMeta(locationsQuery)).
 					WithArgs(payload.LocationId).
 					WillReturnRows(
@@ -294,9 +402,9 @@ var _ = ginkgo.Describe("Controller", func() {
 				gomega.Expect(err).To(gomega.BeNil())
 
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "tournaments" ("name","slug","type","settings","location_id","league_id") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "tournaments" ("name","slug","type","settings","location_id","league_id","starts_at","ends_at","deleted_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id","created_at","updated_at"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Slug, payload.Type, string(insertedSettings), payload.LocationId, payload.LeagueId).
+					WithArgs(payload.Name, *payload.Slug, payload.Type, string(insertedSettings), payload.LocationId, payload.LeagueId, nil, nil, nil).
 					WillReturnError(fmt.Errorf("ERROR: database error"))
 				mock.ExpectRollback()
 
@@ -305,7 +413,7 @@ var _ = ginkgo.Describe("Controller", func() {
 				req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 				gomega.Expect(err).To(gomega.BeNil())
 
-				router.POST("/", controller.CreateTournament)
+				router.POST("/", func(c *gin.Context) { controller.CreateTournament(c, generated.PostTournamentsParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusInternalServerError))
@@ -339,7 +447,10 @@ var _ = ginkgo.Describe("Controller", func() {
 					UpdatedAt:  time.Now(),
 				}
 
-				const query = `SELECT * FROM "tournaments"`
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "tournaments"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+				const query = `SELECT * FROM "tournaments" WHERE "tournaments"."deleted_at" IS NULL ORDER BY created_at DESC,id DESC LIMIT 51`
 				mock.ExpectQuery(regexp.QuoteMeta(query)).
 					WillReturnRows(
 						sqlmock.NewRows([]string{
@@ -371,12 +482,370 @@ var _ = ginkgo.Describe("Controller", func() {
 				req, err := http.NewRequest(http.MethodGet, "/", nil)
 				gomega.Expect(err).To(gomega.BeNil())
 
-				router.GET("/", controller.ListTournaments)
+				router.GET("/", func(c *gin.Context) { controller.ListTournaments(c, generated.GetTournamentsParams{}) })
 				router.ServeHTTP(rr, req)
 
 				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
 				gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring(mockTournament.Name))
 			})
 		})
+		ginkgo.Context("with filters", func() {
+			ginkgo.It("only lists the matching tournaments", func() {
+				leagueID, locationID := uuid.New(), uuid.New()
+				tournamentType := generated.MultiRoundTournament
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "tournaments" WHERE league_id = $1 AND location_id = $2 AND type = $3 AND "tournaments"."deleted_at" IS NULL`)).
+					WithArgs(leagueID, locationID, string(generated.MultiRoundTournament)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tournaments" WHERE league_id = $1 AND location_id = $2 AND type = $3 AND "tournaments"."deleted_at" IS NULL ORDER BY created_at DESC,id DESC LIMIT 51`)).
+					WithArgs(leagueID, locationID, string(generated.MultiRoundTournament)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				req, err := http.NewRequest(http.MethodGet, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.ListTournaments(c, generated.GetTournamentsParams{
+						LeagueId:   utils.PtrString(leagueID.String()),
+						LocationId: utils.PtrString(locationID.String()),
+						Type:       &tournamentType,
+					})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				response := &generated.TournamentListResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Tournaments).To(gomega.BeEmpty())
+				gomega.Expect(response.Total).To(gomega.Equal(0))
+			})
+		})
+		ginkgo.Context("with a status", func() {
+			ginkgo.It("only lists the tournaments with the status", func() {
+				status := generated.Ongoing
+				startsAt, endsAt := time.Now().Add(-1*time.Hour), time.Now().Add(time.Hour)
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "tournaments" WHERE (starts_at <= $1 AND (ends_at IS NULL OR ends_at > $2)) AND "tournaments"."deleted_at" IS NULL`)).
+					WithArgs(utils.AnyTime{}, utils.AnyTime{}).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tournaments" WHERE (starts_at <= $1 AND (ends_at IS NULL OR ends_at > $2)) AND "tournaments"."deleted_at" IS NULL ORDER BY created_at DESC,id DESC LIMIT 51`)).
+					WithArgs(utils.AnyTime{}, utils.AnyTime{}).
+					WillReturnRows(
+						sqlmock.NewRows([]string{"id", "name", "type", "settings", "starts_at", "ends_at"}).
+							AddRow(uuid.New(), "Test Tournament", generated.MultiRoundTournament, `{"rounds":8}`, startsAt, endsAt),
+					)
+
+				req, err := http.NewRequest(http.MethodGet, "/?include=", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.ListTournaments(c, generated.GetTournamentsParams{Status: &status, Include: utils.PtrString("")})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				response := &generated.TournamentListResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Tournaments).To(gomega.HaveLen(1))
+				gomega.Expect(response.Tournaments[0].Status).To(gomega.Equal(generated.Ongoing))
+				gomega.Expect(response.Tournaments[0].StartsAt).To(gomega.Equal(utils.FormatTimePtr(&startsAt)))
+			})
+
+			ginkgo.It("returns a 400 for an unknown status", func() {
+				req, err := http.NewRequest(http.MethodGet, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					status := generated.TournamentStatus("postponed")
+					controller.ListTournaments(c, generated.GetTournamentsParams{Status: &status})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+			})
+		})
+		ginkgo.Context("including deleted tournaments", func() {
+			ginkgo.It("embeds their league and location even if those are deleted too", func() {
+				deletedAt := time.Now().Add(-1 * time.Hour)
+				tournamentID, leagueID, locationID := uuid.New(), uuid.New(), uuid.New()
+
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "tournaments"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(`^` + regexp.QuoteMeta(`SELECT * FROM "tournaments" ORDER BY created_at DESC,id DESC LIMIT 51`)).
+					WillReturnRows(
+						sqlmock.NewRows([]string{"id", "name", "slug", "type", "settings", "location_id", "league_id", "deleted_at"}).
+							AddRow(tournamentID, "Test Tournament", "test-tournament", generated.MultiRoundTournament,
+								`{"rounds":8}`, locationID, leagueID, deletedAt),
+					)
+				mock.ExpectQuery(`^` + regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE "leagues"."id" = $1`) + `$`).
+					WithArgs(leagueID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(leagueID, deletedAt))
+				mock.ExpectQuery(`^` + regexp.QuoteMeta(`SELECT * FROM "locations" WHERE "locations"."id" = $1`) + `$`).
+					WithArgs(locationID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(locationID, deletedAt))
+
+				req, err := http.NewRequest(http.MethodGet, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.ListTournaments(c, generated.GetTournamentsParams{IncludeDeleted: utils.PtrBool(true)})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				response := &generated.TournamentListResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Tournaments).To(gomega.HaveLen(1))
+				gomega.Expect(response.Tournaments[0].League.Id).To(gomega.Equal(leagueID.String()))
+				gomega.Expect(response.Tournaments[0].Location.Id).To(gomega.Equal(locationID.String()))
+			})
+		})
+		ginkgo.Context("with an unknown type", func() {
+			ginkgo.It("returns a 400", func() {
+				req, err := http.NewRequest(http.MethodGet, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					tournamentType := generated.TournamentType("knockout")
+					controller.ListTournaments(c, generated.GetTournamentsParams{Type: &tournamentType})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+			})
+		})
+		ginkgo.Context("with a limit above the maximum", func() {
+			ginkgo.It("returns a 400", func() {
+				req, err := http.NewRequest(http.MethodGet, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.ListTournaments(c, generated.GetTournamentsParams{Limit: utils.PtrInt(101)})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+			})
+		})
+	})
+	ginkgo.Describe("GetTournamentWithSlug", func() {
+		var tournamentID uuid.UUID
+		var settings []byte
+
+		ginkgo.BeforeEach(func() {
+			tournamentID = uuid.New()
+			var err error
+			settings, err = json.Marshal(generated.MultiRoundTournamentSettings{
+				GamesPerRound:       4,
+				Rounds:              8,
+				LowestScoresDropped: 3,
+			})
+			gomega.Expect(err).To(gomega.BeNil())
+		})
+
+		tournamentRows := func() *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"id", "name", "slug", "type", "settings"}).
+				AddRow(tournamentID, "Test Tournament", "test-tournament", generated.MultiRoundTournament, settings)
+		}
+
+		ginkgo.Context("with the slug of a tournament", func() {
+			ginkgo.It("returns a 200", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tournaments" WHERE slug = $1`)).
+					WithArgs("test-tournament").
+					WillReturnRows(tournamentRows())
+
+				req, err := http.NewRequest(http.MethodGet, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.GetTournamentWithSlug(c, "test-tournament", generated.GetTournamentsSlugParams{
+						Include: utils.PtrString(""),
+					})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				gomega.Expect(rr.Header().Get("Link")).To(gomega.BeEmpty())
+				response := &generated.TournamentResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Tournament.Id).To(gomega.Equal(tournamentID.String()))
+			})
+		})
+		ginkgo.Context("with a slug the tournament was renamed from", func() {
+			ginkgo.It("returns the tournament with a link to its current slug", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tournaments" WHERE slug = $1`)).
+					WithArgs("old-tournament").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "slug_histories" WHERE kind = $1 AND slug = $2`)).
+					WithArgs("tournament", "old-tournament").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "slug", "resource_id"}).
+						AddRow(uuid.New(), "tournament", "old-tournament", tournamentID))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tournaments" WHERE id = $1`)).
+					WithArgs(tournamentID).
+					WillReturnRows(tournamentRows())
+
+				req, err := http.NewRequest(http.MethodGet, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.GetTournamentWithSlug(c, "old-tournament", generated.GetTournamentsSlugParams{
+						Include: utils.PtrString(""),
+					})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				gomega.Expect(rr.Header().Get("Link")).To(gomega.Equal(`</api/tournaments/test-tournament>; rel="canonical"`))
+			})
+		})
+		ginkgo.Context("with an unknown slug", func() {
+			ginkgo.It("returns a 404", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tournaments" WHERE slug = $1`)).
+					WithArgs("unknown").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "slug_histories" WHERE kind = $1 AND slug = $2`)).
+					WithArgs("tournament", "unknown").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				req, err := http.NewRequest(http.MethodGet, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.GET("/", func(c *gin.Context) {
+					controller.GetTournamentWithSlug(c, "unknown", generated.GetTournamentsSlugParams{})
+				})
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNotFound))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+	})
+
+	ginkgo.When("DeleteTournament is called", func() {
+		const sqlSelect = `SELECT * FROM "tournaments" WHERE slug = $1 AND "tournaments"."deleted_at" IS NULL ORDER BY "tournaments"."id" LIMIT 1`
+		var tournamentID, leagueID uuid.UUID
+
+		ginkgo.BeforeEach(func() {
+			tournamentID, leagueID = uuid.New(), uuid.New()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+				WithArgs("test-tournament").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "league_id"}).
+					AddRow(tournamentID, "Test Tournament", "test-tournament", leagueID))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE "leagues"."id" = $1 AND "leagues"."deleted_at" IS NULL`)).
+				WithArgs(leagueID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(leagueID, userObj.ID))
+		})
+
+		ginkgo.Context("by the owner of its league", func() {
+			ginkgo.It("returns a 204", func() {
+				router.Use(func(c *gin.Context) {
+					c.Set("user", userObj)
+				})
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tournaments" SET "deleted_at"=$1 WHERE "tournaments"."id" = $2 AND "tournaments"."deleted_at" IS NULL`)).
+					WithArgs(utils.AnyTime{}, tournamentID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				req, err := http.NewRequest(http.MethodDelete, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.DELETE("/", func(c *gin.Context) { controller.DeleteTournament(c, "test-tournament") })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNoContent))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+
+		ginkgo.Context("by another user", func() {
+			ginkgo.It("returns a 403", func() {
+				router.Use(func(c *gin.Context) {
+					c.Set("user", &models.User{ID: uuid.New(), Role: models.RoleUser})
+				})
+
+				req, err := http.NewRequest(http.MethodDelete, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.DELETE("/", func(c *gin.Context) { controller.DeleteTournament(c, "test-tournament") })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+	})
+
+	ginkgo.When("RestoreTournament is called", func() {
+		const sqlSelect = `SELECT * FROM "tournaments" WHERE slug = $1 AND deleted_at IS NOT NULL ORDER BY "tournaments"."id" LIMIT 1`
+		const leaguesQuery = `SELECT * FROM "leagues" WHERE id = $1 AND "leagues"."deleted_at" IS NULL ORDER BY "leagues"."id" LIMIT 1`
+		const locationsQuery = `SELECT * FROM "locations" WHERE id = $1 AND "locations"."deleted_at" IS NULL ORDER BY "locations"."id" LIMIT 1`
+		var tournamentID, leagueID, locationID uuid.UUID
+
+		ginkgo.BeforeEach(func() {
+			tournamentID, leagueID, locationID = uuid.New(), uuid.New(), uuid.New()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+				WithArgs("test-tournament").
+				WillReturnRows(sqlmock.NewRows([]string{
+					"id", "name", "slug", "type", "settings", "location_id", "league_id", "deleted_at",
+				}).AddRow(
+					tournamentID, "Test Tournament", "test-tournament", generated.MultiRoundTournament,
+					`{"games_per_round":4,"lowest_scores_dropped":3,"rounds":8}`, locationID, leagueID, time.Now(),
+				))
+		})
+
+		ginkgo.Context("with a league and location that weren't deleted", func() {
+			ginkgo.It("returns a 200", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(leaguesQuery)).
+					WithArgs(leagueID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(leagueID, "Test League"))
+				mock.ExpectQuery(regexp.QuoteMeta(locationsQuery)).
+					WithArgs(locationID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(locationID, "Test Location"))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tournaments" SET "deleted_at"=$1 WHERE "id" = $2`)).
+					WithArgs(nil, tournamentID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				req, err := http.NewRequest(http.MethodPost, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", func(c *gin.Context) { controller.RestoreTournament(c, "test-tournament") })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+
+				response := &generated.TournamentResponse{}
+				gomega.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(gomega.Succeed())
+				gomega.Expect(response.Tournament.DeletedAt).To(gomega.BeNil())
+				gomega.Expect(response.Tournament.League.Name).To(gomega.Equal("Test League"))
+				gomega.Expect(response.Tournament.Location.Name).To(gomega.Equal("Test Location"))
+			})
+		})
+
+		ginkgo.Context("with a deleted league", func() {
+			ginkgo.It("returns a 409", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(leaguesQuery)).
+					WithArgs(leagueID).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				req, err := http.NewRequest(http.MethodPost, "/", nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				router.POST("/", func(c *gin.Context) { controller.RestoreTournament(c, "test-tournament") })
+				router.ServeHTTP(rr, req)
+
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusConflict))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
 	})
 })
@@ -0,0 +1,364 @@
+package user
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"pinman/internal/app/api/auth"
+	"pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"strings"
+	"time"
+)
+
+const (
+	defaultUserListLimit = 50
+	maxUserListLimit     = 100
+	loginHistoryLimit    = 100
+)
+
+// findUser looks up the user an admin endpoint was called for, and aborts with not found for unknown users.
+func (c *Controller) findUser(ctx *gin.Context, id string) (*models.User, bool) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		errors.AbortWithError(http.StatusNotFound, "user not found", ctx)
+		return nil, false
+	}
+
+	user := &models.User{}
+	if err := c.DB.First(user, "id = ?", userID).Error; err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			errors.AbortWithError(http.StatusNotFound, "user not found", ctx)
+			return nil, false
+		}
+		log.Err(err).Msg("failed to look up user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to look up user", ctx)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// ListUsers lists the users matching the filters, most recently registered first.
+func (c *Controller) ListUsers(ctx *gin.Context, params generated.GetUsersParams) {
+	limit := defaultUserListLimit
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	if limit < 1 || limit > maxUserListLimit {
+		errors.AbortWithError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxUserListLimit), ctx)
+		return
+	}
+	offset := 0
+	if params.Offset != nil {
+		offset = *params.Offset
+	}
+	if offset < 0 {
+		errors.AbortWithError(http.StatusBadRequest, "offset can't be negative", ctx)
+		return
+	}
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		if params.Search != nil && *params.Search != "" {
+			pattern := "%" + utils.EscapeLike(strings.ToLower(*params.Search)) + "%"
+			db = db.Where("LOWER(name) LIKE ? OR email LIKE ?", pattern, pattern)
+		}
+		if params.Role != nil && *params.Role != "" {
+			db = db.Where("role = ?", *params.Role)
+		}
+		return db
+	}
+
+	var total int64
+	if err := c.DB.Model(&models.User{}).Scopes(filter).Count(&total).Error; err != nil {
+		log.Err(err).Msg("failed to count users")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to list users", ctx)
+		return
+	}
+
+	var users []models.User
+	err := c.DB.Scopes(filter).Order("created_at DESC").Limit(limit).Offset(offset).Find(&users).Error
+	if err != nil {
+		log.Err(err).Msg("failed to list users")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to list users", ctx)
+		return
+	}
+
+	response := generated.UserListResponse{
+		Users: make([]generated.User, 0, len(users)),
+		Total: int(total),
+	}
+	for i := range users {
+		response.Users = append(response.Users, *newUser(&users[i]))
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// ChangeRole gives a user another role. Admins can't change their own role, so there is always one left. Users who
+// get a role that requires two-factor authentication but don't use it yet are logged out and lose their API tokens.
+func (c *Controller) ChangeRole(ctx *gin.Context, id string) {
+	admin, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	payload := &generated.UserRoleUpdate{}
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	user, ok := c.findUser(ctx, id)
+	if !ok {
+		return
+	}
+	if user.ID == admin.ID {
+		errors.AbortWithError(http.StatusBadRequest, "you can't change your own role", ctx)
+		return
+	}
+
+	previousRole := user.Role
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("role", string(payload.Role)).Error; err != nil {
+			return err
+		}
+		required, err := auth.TwoFactorRequired(tx, user.Role)
+		if err != nil || !required {
+			return err
+		}
+		return auth.RevokeAccessWithoutTwoFactor(tx, user.Role, user.ID)
+	})
+	if err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to change role")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to change role", ctx)
+		return
+	}
+
+	auth.WriteAuditLog(c.DB, ctx, &models.AuditLog{
+		Action:  models.AuditActionUserRoleChanged,
+		UserID:  &user.ID,
+		ActorID: &admin.ID,
+		Detail:  fmt.Sprintf("role of %s changed from %s to %s by %s", user.Email, previousRole, user.Role, admin.Email),
+	})
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// Disable keeps a user from logging in or using their tokens, and logs them out everywhere.
+func (c *Controller) Disable(ctx *gin.Context, id string) {
+	admin, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	user, ok := c.findUser(ctx, id)
+	if !ok {
+		return
+	}
+	if user.ID == admin.ID {
+		errors.AbortWithError(http.StatusBadRequest, "you can't disable your own account", ctx)
+		return
+	}
+	if user.DisabledAt != nil {
+		ctx.JSON(http.StatusOK, newUserResponse(user))
+		return
+	}
+
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return auth.RevokeSessions(tx, user.ID)
+	})
+	if err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to disable user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to disable user", ctx)
+		return
+	}
+
+	auth.WriteAuditLog(c.DB, ctx, &models.AuditLog{
+		Action:  models.AuditActionUserDisabled,
+		UserID:  &user.ID,
+		ActorID: &admin.ID,
+		Detail:  fmt.Sprintf("%s disabled by %s", user.Email, admin.Email),
+	})
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// Enable lets a disabled user log in again.
+func (c *Controller) Enable(ctx *gin.Context, id string) {
+	admin, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	user, ok := c.findUser(ctx, id)
+	if !ok {
+		return
+	}
+	if user.AnonymizedAt != nil {
+		errors.AbortWithError(http.StatusBadRequest, "deleted accounts can't be enabled", ctx)
+		return
+	}
+	if user.DisabledAt == nil {
+		ctx.JSON(http.StatusOK, newUserResponse(user))
+		return
+	}
+
+	if err := c.DB.Model(user).Update("disabled_at", nil).Error; err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to enable user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to enable user", ctx)
+		return
+	}
+	user.DisabledAt = nil
+
+	auth.WriteAuditLog(c.DB, ctx, &models.AuditLog{
+		Action:  models.AuditActionUserEnabled,
+		UserID:  &user.ID,
+		ActorID: &admin.ID,
+		Detail:  fmt.Sprintf("%s enabled by %s", user.Email, admin.Email),
+	})
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ListLogins returns the most recent logins and failed logins of a user.
+func (c *Controller) ListLogins(ctx *gin.Context, id string) {
+	user, ok := c.findUser(ctx, id)
+	if !ok {
+		return
+	}
+
+	var entries []models.AuditLog
+	err := c.DB.Where("user_id = ? AND action IN ?", user.ID, []string{models.AuditActionLogin, models.AuditActionLoginFailed}).
+		Order("created_at DESC").
+		Limit(loginHistoryLimit).
+		Find(&entries).Error
+	if err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to list logins")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to list logins", ctx)
+		return
+	}
+
+	response := generated.LoginHistoryResponse{
+		Logins: make([]generated.LoginEvent, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		response.Logins = append(response.Logins, generated.LoginEvent{
+			Success:   entry.Action == models.AuditActionLogin,
+			IpAddress: entry.IPAddress,
+			Detail:    entry.Detail,
+			CreatedAt: utils.FormatTime(entry.CreatedAt),
+		})
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Unlock lets a user whose account was locked after too many failed logins log in again right away.
+func (c *Controller) Unlock(ctx *gin.Context, id string) {
+	admin, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	user, ok := c.findUser(ctx, id)
+	if !ok {
+		return
+	}
+
+	if err := auth.UnlockLogin(c.DB, user.Email); err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to unlock user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to unlock user", ctx)
+		return
+	}
+
+	auth.WriteAuditLog(c.DB, ctx, &models.AuditLog{
+		Action:  models.AuditActionAccountUnlocked,
+		UserID:  &user.ID,
+		ActorID: &admin.ID,
+		Detail:  fmt.Sprintf("%s unlocked by %s", user.Email, admin.Email),
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func isRole(role string) bool {
+	for _, r := range models.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRole returns the security settings of a role.
+func (c *Controller) GetRole(ctx *gin.Context, role string) {
+	if !isRole(role) {
+		errors.AbortWithError(http.StatusNotFound, "role not found", ctx)
+		return
+	}
+
+	required, err := auth.TwoFactorRequired(c.DB, role)
+	if err != nil {
+		log.Err(err).Str("role", role).Msg("failed to look up role settings")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to look up role", ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, generated.Role{Name: role, TwoFactorRequired: required})
+}
+
+// UpdateRole changes the security settings of a role. Requiring two-factor authentication logs out the users with
+// the role who don't use it yet and revokes their API tokens.
+func (c *Controller) UpdateRole(ctx *gin.Context, role string) {
+	admin, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	if !isRole(role) {
+		errors.AbortWithError(http.StatusNotFound, "role not found", ctx)
+		return
+	}
+
+	payload := &generated.RoleUpdate{}
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	setting := &models.RoleSetting{Role: role, TwoFactorRequired: *payload.TwoFactorRequired}
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "role"}},
+			DoUpdates: clause.AssignmentColumns([]string{"two_factor_required", "updated_at"}),
+		}).Create(setting).Error
+		if err != nil || !setting.TwoFactorRequired {
+			return err
+		}
+		return auth.RevokeAccessWithoutTwoFactor(tx, role)
+	})
+	if err != nil {
+		log.Err(err).Str("role", role).Msg("failed to update role settings")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to update role", ctx)
+		return
+	}
+
+	auth.WriteAuditLog(c.DB, ctx, &models.AuditLog{
+		Action:  models.AuditActionRoleUpdated,
+		ActorID: &admin.ID,
+		Detail:  fmt.Sprintf("two-factor authentication required for %s set to %t by %s", role, setting.TwoFactorRequired, admin.Email),
+	})
+
+	ctx.JSON(http.StatusOK, generated.Role{Name: role, TwoFactorRequired: setting.TwoFactorRequired})
+}
@@ -0,0 +1,157 @@
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"pinman/internal/app/api/auth"
+	"pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"time"
+)
+
+// length of the token prefix kept to tell tokens apart, "pm_" and the first 5 random characters
+const apiTokenPrefixLength = 8
+
+// ListAPITokens lists the personal API tokens of the current user.
+func (c *Controller) ListAPITokens(ctx *gin.Context) {
+	currentUser, err := auth.GetUser(ctx)
+	if err != nil {
+		errors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
+		return
+	}
+
+	var tokens []models.APIToken
+	result := c.DB.Where("user_id = ? AND revoked_at IS NULL", currentUser.ID).Order("created_at DESC").Find(&tokens)
+	if result.Error != nil {
+		log.Err(result.Error).Msg("failed to list API tokens")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to list API tokens", ctx)
+		return
+	}
+
+	response := generated.ApiTokenListResponse{
+		ApiTokens: make([]generated.ApiToken, 0, len(tokens)),
+	}
+	for i := range tokens {
+		response.ApiTokens = append(response.ApiTokens, newAPITokenResponse(&tokens[i]))
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateAPIToken creates a personal API token for the current user. The token itself is only returned here.
+func (c *Controller) CreateAPIToken(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	payload := &generated.ApiTokenCreate{}
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	plainToken, err := auth.GenerateAPIToken()
+	if err != nil {
+		log.Err(err).Msg("failed to generate API token")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to create API token", ctx)
+		return
+	}
+
+	token := &models.APIToken{
+		UserID:      currentUser.ID,
+		Name:        payload.Name,
+		TokenPrefix: plainToken[:apiTokenPrefixLength],
+		TokenHash:   utils.HashOpaqueToken(plainToken),
+		ReadOnly:    payload.ReadOnly != nil && *payload.ReadOnly,
+	}
+
+	if payload.ExpiresAt != nil {
+		expiresAt, err := time.Parse(time.RFC3339, *payload.ExpiresAt)
+		if err != nil {
+			errors.AbortWithError(http.StatusBadRequest, "expires_at must be an RFC 3339 timestamp", ctx)
+			return
+		}
+		if expiresAt.Before(time.Now()) {
+			errors.AbortWithError(http.StatusBadRequest, "expires_at must be in the future", ctx)
+			return
+		}
+		token.ExpiresAt = &expiresAt
+	}
+
+	if payload.LeagueId != nil {
+		league := &models.League{}
+		result := c.DB.Where("id = ? AND owner_id = ?", *payload.LeagueId, currentUser.ID).Limit(1).Find(league)
+		if result.Error != nil {
+			log.Err(result.Error).Msg("failed to get league")
+			errors.AbortWithError(http.StatusInternalServerError, "failed to create API token", ctx)
+			return
+		}
+		if result.RowsAffected == 0 {
+			errors.AbortWithError(http.StatusBadRequest, "league does not exist or is not owned by you", ctx)
+			return
+		}
+		token.LeagueID = &league.ID
+	}
+
+	if err := c.DB.Create(token).Error; err != nil {
+		log.Err(err).Msg("failed to create API token")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to create API token", ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, generated.ApiTokenCreateResponse{
+		ApiToken: newAPITokenResponse(token),
+		Token:    plainToken,
+	})
+}
+
+// RevokeAPIToken revokes a personal API token of the current user.
+func (c *Controller) RevokeAPIToken(ctx *gin.Context, id string) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	tokenID, err := uuid.Parse(id)
+	if err != nil {
+		errors.AbortWithError(http.StatusNotFound, "API token not found", ctx)
+		return
+	}
+
+	result := c.DB.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, currentUser.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Err(result.Error).Msg("failed to revoke API token")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to revoke API token", ctx)
+		return
+	}
+	if result.RowsAffected == 0 {
+		errors.AbortWithError(http.StatusNotFound, "API token not found", ctx)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func newAPITokenResponse(token *models.APIToken) generated.ApiToken {
+	response := generated.ApiToken{
+		Id:          token.ID.String(),
+		Name:        token.Name,
+		TokenPrefix: token.TokenPrefix,
+		ReadOnly:    token.ReadOnly,
+		LastUsedAt:  utils.FormatTimePtr(token.LastUsedAt),
+		ExpiresAt:   utils.FormatTimePtr(token.ExpiresAt),
+		CreatedAt:   utils.FormatTime(token.CreatedAt),
+	}
+	if token.LeagueID != nil {
+		response.LeagueId = utils.PtrString(token.LeagueID.String())
+	}
+
+	return response
+}
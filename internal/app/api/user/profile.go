@@ -0,0 +1,348 @@
+package user
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"net/http"
+	"pinman/internal/app/api/auth"
+	"pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/mailer"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"strings"
+	"time"
+)
+
+const (
+	deletedUserName = "Deleted user"
+	exportFileName  = "pinman-export.json"
+	// emailChangedDetail is the detail of email change audit logs, email addresses contain no spaces so the
+	// addresses can be read back from it
+	emailChangedDetail = "email address changed from %s to %s"
+)
+
+// UpdateMe changes the name and email address of the current user. A new email address is unverified until the user
+// opens the link sent to it, and links sent to the previous address stop working.
+func (c *Controller) UpdateMe(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	payload := &generated.UserUpdate{}
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	name := currentUser.Name
+	if payload.Name != nil {
+		name = strings.TrimSpace(*payload.Name)
+		if name == "" {
+			errors.AbortWithError(http.StatusBadRequest, "name can't be empty", ctx)
+			return
+		}
+		if name != currentUser.Name {
+			updates["name"] = name
+		}
+	}
+	previousEmail := currentUser.Email
+	email := currentUser.Email
+	if payload.Email != nil {
+		email = strings.ToLower(strings.TrimSpace(*payload.Email))
+		if email != currentUser.Email {
+			updates["email"] = email
+			updates["verified"] = false
+		}
+	}
+
+	if len(updates) == 0 {
+		ctx.JSON(http.StatusOK, newUserResponse(currentUser))
+		return
+	}
+
+	if err := c.DB.Model(currentUser).Updates(updates).Error; err != nil {
+		errors.AbortWithDBError(ctx, err, "failed to update user", errors.DBErrorDetails{
+			errors.ErrUniqueViolation: "user with that email already exists",
+		})
+		return
+	}
+	currentUser.Name = name
+
+	if email != previousEmail {
+		currentUser.Email = email
+		currentUser.Verified = false
+
+		auth.WriteAuditLog(c.DB, ctx, &models.AuditLog{
+			Action: models.AuditActionEmailChanged,
+			UserID: &currentUser.ID,
+			Detail: fmt.Sprintf(emailChangedDetail, previousEmail, email),
+		})
+
+		if err := c.sendVerificationEmail(currentUser); err != nil {
+			log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to send verification email")
+		}
+		if err := c.sendEmailChangedEmail(currentUser, previousEmail); err != nil {
+			log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to send email change notice")
+		}
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(currentUser))
+}
+
+// ExportMe returns everything stored about the current user as a JSON file.
+func (c *Controller) ExportMe(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+	currentSessionID, _ := auth.GetSessionID(ctx)
+
+	export, err := c.exportUser(currentUser, currentSessionID)
+	if err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to export user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to export user", ctx)
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFileName))
+	ctx.JSON(http.StatusOK, export)
+}
+
+func (c *Controller) exportUser(user *models.User, currentSessionID uuid.UUID) (*generated.UserExport, error) {
+	var leagues []models.League
+	if err := c.DB.Preload("Location").Where("owner_id = ?", user.ID).Order("created_at").Find(&leagues).Error; err != nil {
+		return nil, fmt.Errorf("listing leagues: %w", err)
+	}
+	var tournaments []models.Tournament
+	err := c.DB.Preload("Location").
+		Where("league_id IN (?)", c.DB.Model(&models.League{}).Select("id").Where("owner_id = ?", user.ID)).
+		Order("created_at").
+		Find(&tournaments).Error
+	if err != nil {
+		return nil, fmt.Errorf("listing tournaments: %w", err)
+	}
+	var sessions []models.Session
+	if err := c.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	var tokens []models.APIToken
+	if err := c.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("listing API tokens: %w", err)
+	}
+	var identities []models.ExternalIdentity
+	if err := c.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("listing identities: %w", err)
+	}
+	var events []models.AuditLog
+	if err := c.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("listing audit logs: %w", err)
+	}
+
+	export := &generated.UserExport{
+		ExportedAt:  utils.FormatTime(time.Now()),
+		User:        *newUser(user),
+		Leagues:     make([]generated.League, 0, len(leagues)),
+		Tournaments: make([]generated.Tournament, 0, len(tournaments)),
+		Sessions:    make([]generated.Session, 0, len(sessions)),
+		ApiTokens:   make([]generated.ApiToken, 0, len(tokens)),
+		Identities:  make([]generated.ExternalIdentity, 0, len(identities)),
+		Activity:    make([]generated.AccountEvent, 0, len(events)),
+	}
+	leaguesByID := make(map[uuid.UUID]generated.League, len(leagues))
+	for _, league := range leagues {
+		exportedLeague := generated.League{
+			Id:        league.ID.String(),
+			Name:      league.Name,
+			Slug:      league.Slug,
+			OwnerId:   league.OwnerID.String(),
+			CreatedAt: utils.FormatTime(league.CreatedAt),
+			UpdatedAt: utils.FormatTime(league.UpdatedAt),
+		}
+		leaguesByID[league.ID] = exportedLeague
+		exportedLeague.Location = exportLocation(&league.Location)
+		export.Leagues = append(export.Leagues, exportedLeague)
+	}
+	for i := range tournaments {
+		tournament := &tournaments[i]
+		settings, err := tournament.GetSettings()
+		if err != nil {
+			return nil, fmt.Errorf("reading settings of tournament %s: %w", tournament.ID, err)
+		}
+		tournamentLeague := leaguesByID[tournament.LeagueID]
+		export.Tournaments = append(export.Tournaments, generated.Tournament{
+			Id:        tournament.ID.String(),
+			Name:      tournament.Name,
+			Slug:      tournament.Slug,
+			Type:      tournament.Type,
+			Settings:  *settings,
+			League:    &tournamentLeague,
+			Location:  exportLocation(&tournament.Location),
+			StartsAt:  utils.FormatTimePtr(tournament.StartsAt),
+			EndsAt:    utils.FormatTimePtr(tournament.EndsAt),
+			Status:    tournament.Status(time.Now()),
+			CreatedAt: utils.FormatTime(tournament.CreatedAt),
+			UpdatedAt: utils.FormatTime(tournament.UpdatedAt),
+		})
+	}
+	for i := range sessions {
+		export.Sessions = append(export.Sessions, newSessionResponse(&sessions[i], currentSessionID))
+	}
+	for i := range tokens {
+		export.ApiTokens = append(export.ApiTokens, newAPITokenResponse(&tokens[i]))
+	}
+	for _, identity := range identities {
+		export.Identities = append(export.Identities, generated.ExternalIdentity{
+			Issuer:    identity.Issuer,
+			Email:     identity.Email,
+			CreatedAt: utils.FormatTime(identity.CreatedAt),
+		})
+	}
+	for _, event := range events {
+		export.Activity = append(export.Activity, generated.AccountEvent{
+			Action:    event.Action,
+			IpAddress: event.IPAddress,
+			Detail:    event.Detail,
+			CreatedAt: utils.FormatTime(event.CreatedAt),
+		})
+	}
+
+	return export, nil
+}
+
+func exportLocation(location *models.Location) *generated.Location {
+	return &generated.Location{
+		Address:      location.Address,
+		Id:           location.ID.String(),
+		Name:         location.Name,
+		PinballMapId: location.PinballMapID,
+		Slug:         location.Slug,
+		CreatedAt:    utils.FormatTime(location.CreatedAt),
+		UpdatedAt:    utils.FormatTime(location.UpdatedAt),
+	}
+}
+
+// DeleteMe deletes the account of the current user. The user is anonymized instead of removed, so the leagues they
+// own keep their owner and the standings they are part of stay intact. Their credentials, sessions and linked
+// accounts are removed, and they can't log in again.
+func (c *Controller) DeleteMe(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	previousEmail := currentUser.Email
+	anonymousEmail := fmt.Sprintf("deleted-%s@deleted.invalid", currentUser.ID)
+	now := time.Now()
+
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		emails, err := pastEmails(tx, currentUser.ID, previousEmail)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(currentUser).Updates(map[string]interface{}{
+			"name":                deletedUserName,
+			"email":               anonymousEmail,
+			"password":            "",
+			"verified":            false,
+			"password_changed_at": now,
+			"disabled_at":         now,
+			"anonymized_at":       now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// sessions keep the devices and addresses the user logged in from, so they are removed rather than revoked
+		sessionIDs := tx.Model(&models.Session{}).Select("id").Where("user_id = ?", currentUser.ID)
+		if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{
+			&models.Session{}, &models.APIToken{}, &models.ExternalIdentity{}, &models.RecoveryCode{}, &models.TwoFactor{},
+		} {
+			if err := tx.Where("user_id = ?", currentUser.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// the audit logs are kept for the admins, but not the email addresses they mention, also in the logs of
+		// what the user did to others
+		for _, email := range emails {
+			if err := auth.UnlockLogin(tx, email); err != nil {
+				return err
+			}
+			err := tx.Model(&models.AuditLog{}).
+				Where("user_id = ? OR actor_id = ?", currentUser.ID, currentUser.ID).
+				Update("detail", gorm.Expr("REPLACE(detail, ?, ?)", email, anonymousEmail)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to delete user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to delete user", ctx)
+		return
+	}
+
+	auth.WriteAuditLog(c.DB, ctx, &models.AuditLog{
+		Action: models.AuditActionAccountDeleted,
+		UserID: &currentUser.ID,
+		Detail: fmt.Sprintf("%s deleted their account", anonymousEmail),
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// pastEmails returns the current email address of the user followed by every address they changed it from or to,
+// which the audit logs of their email changes still mention.
+func pastEmails(db *gorm.DB, userID uuid.UUID, currentEmail string) ([]string, error) {
+	var details []string
+	err := db.Model(&models.AuditLog{}).
+		Where("user_id = ? AND action = ?", userID, models.AuditActionEmailChanged).
+		Order("created_at").
+		Pluck("detail", &details).Error
+	if err != nil {
+		return nil, err
+	}
+
+	emails := []string{currentEmail}
+	seen := map[string]bool{currentEmail: true}
+	for _, detail := range details {
+		var from, to string
+		if _, err := fmt.Sscanf(detail, emailChangedDetail, &from, &to); err != nil {
+			log.Warn().Err(err).Str("userId", userID.String()).Msg("failed to parse email change audit log")
+			continue
+		}
+		for _, email := range []string{from, to} {
+			if !seen[email] {
+				seen[email] = true
+				emails = append(emails, email)
+			}
+		}
+	}
+
+	return emails, nil
+}
+
+// sendEmailChangedEmail tells the previous email address of the user that it was replaced, so the user notices if
+// someone else took over their account.
+func (c *Controller) sendEmailChangedEmail(user *models.User, previousEmail string) error {
+	return c.Mailer.Send(mailer.Message{
+		To:      previousEmail,
+		Subject: "Your PinMan email address was changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThe email address of your PinMan account was changed to %s. If you did not change it, "+
+				"please contact us right away.\n",
+			user.Name, user.Email,
+		),
+	})
+}
@@ -0,0 +1,106 @@
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"pinman/internal/app/api/auth"
+	"pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"time"
+)
+
+// ListSessions lists the devices the current user is logged in on.
+func (c *Controller) ListSessions(ctx *gin.Context) {
+	currentUser, err := auth.GetUser(ctx)
+	if err != nil {
+		errors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
+		return
+	}
+	currentSessionID, _ := auth.GetSessionID(ctx)
+
+	var sessions []models.Session
+	result := c.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", currentUser.ID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions)
+	if result.Error != nil {
+		log.Err(result.Error).Msg("failed to list sessions")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to list sessions", ctx)
+		return
+	}
+
+	response := generated.SessionListResponse{
+		Sessions: make([]generated.Session, 0, len(sessions)),
+	}
+	for i := range sessions {
+		response.Sessions = append(response.Sessions, newSessionResponse(&sessions[i], currentSessionID))
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RevokeSession logs the current user out of one of their devices.
+func (c *Controller) RevokeSession(ctx *gin.Context, id string) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(id)
+	if err != nil {
+		errors.AbortWithError(http.StatusNotFound, "session not found", ctx)
+		return
+	}
+
+	result := c.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, currentUser.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Err(result.Error).Msg("failed to revoke session")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to revoke session", ctx)
+		return
+	}
+	if result.RowsAffected == 0 {
+		errors.AbortWithError(http.StatusNotFound, "session not found", ctx)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RevokeOtherSessions logs the current user out of every device but the one making the request.
+func (c *Controller) RevokeOtherSessions(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	var keep []uuid.UUID
+	if currentSessionID, err := auth.GetSessionID(ctx); err == nil {
+		keep = append(keep, currentSessionID)
+	}
+
+	if err := auth.RevokeSessions(c.DB, currentUser.ID, keep...); err != nil {
+		log.Err(err).Msg("failed to revoke sessions")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to revoke sessions", ctx)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func newSessionResponse(session *models.Session, currentSessionID uuid.UUID) generated.Session {
+	return generated.Session{
+		Id:         session.ID.String(),
+		UserAgent:  session.UserAgent,
+		IpAddress:  session.IPAddress,
+		CreatedAt:  utils.FormatTime(session.CreatedAt),
+		LastUsedAt: utils.FormatTime(session.LastUsedAt),
+		ExpiresAt:  utils.FormatTime(session.ExpiresAt),
+		Current:    session.ID == currentSessionID,
+	}
+}
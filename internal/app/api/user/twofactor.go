@@ -0,0 +1,220 @@
+package user
+
+import (
+	stderrors "errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"pinman/internal/app/api/auth"
+	"pinman/internal/app/api/errors"
+	"pinman/internal/app/generated"
+	"pinman/internal/models"
+)
+
+// getEnabledTwoFactor returns the authenticator app of the user, and aborts if two-factor authentication is not
+// enabled.
+func (c *Controller) getEnabledTwoFactor(ctx *gin.Context, user *models.User) (*models.TwoFactor, bool) {
+	twoFactor, err := auth.GetTwoFactor(c.DB, user.ID)
+	if err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to look up two-factor authentication")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to look up two-factor authentication", ctx)
+		return nil, false
+	}
+	if twoFactor == nil || twoFactor.EnabledAt == nil {
+		errors.AbortWithError(http.StatusBadRequest, auth.ErrTwoFactorNotEnrolled.Error(), ctx)
+		return nil, false
+	}
+
+	return twoFactor, true
+}
+
+// verifyTwoFactorCode checks the code the user confirmed a change to their two-factor authentication with.
+func (c *Controller) verifyTwoFactorCode(ctx *gin.Context, twoFactor *models.TwoFactor, code string) bool {
+	err := auth.VerifyTwoFactorCode(c.DB, twoFactor, code)
+	if stderrors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return false
+	} else if err != nil {
+		log.Err(err).Str("userId", twoFactor.UserID.String()).Msg("failed to verify two-factor authentication code")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to verify two-factor authentication code", ctx)
+		return false
+	}
+
+	return true
+}
+
+// GetTwoFactorStatus tells the current user whether they use two-factor authentication.
+func (c *Controller) GetTwoFactorStatus(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	twoFactor, err := auth.GetTwoFactor(c.DB, currentUser.ID)
+	if err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to look up two-factor authentication")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to look up two-factor authentication", ctx)
+		return
+	}
+
+	required, err := auth.TwoFactorRequired(c.DB, currentUser.Role)
+	if err != nil {
+		log.Err(err).Str("role", currentUser.Role).Msg("failed to look up role settings")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to look up two-factor authentication", ctx)
+		return
+	}
+
+	var remaining int64
+	if twoFactor != nil && twoFactor.EnabledAt != nil {
+		err := c.DB.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", currentUser.ID).
+			Count(&remaining).Error
+		if err != nil {
+			log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to count recovery codes")
+			errors.AbortWithError(http.StatusInternalServerError, "failed to look up two-factor authentication", ctx)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, generated.TwoFactorStatus{
+		Enabled:                twoFactor != nil && twoFactor.EnabledAt != nil,
+		Required:               required,
+		RecoveryCodesRemaining: int(remaining),
+	})
+}
+
+// StartTwoFactor returns a new secret for the current user's authenticator app. Two-factor authentication is enabled
+// once the user confirms it with a code.
+func (c *Controller) StartTwoFactor(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	twoFactor, err := auth.GetTwoFactor(c.DB, currentUser.ID)
+	if err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to look up two-factor authentication")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to set up two-factor authentication", ctx)
+		return
+	}
+	if twoFactor != nil && twoFactor.EnabledAt != nil {
+		errors.AbortWithError(http.StatusBadRequest, auth.ErrTwoFactorAlreadyEnabled.Error(), ctx)
+		return
+	}
+
+	enrollment, err := auth.StartTwoFactorEnrollment(c.DB, currentUser)
+	if err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to start two-factor enrollment")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to set up two-factor authentication", ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTwoFactor enables two-factor authentication for the current user and returns their recovery codes.
+func (c *Controller) ConfirmTwoFactor(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	payload := &generated.TwoFactorCode{}
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	twoFactor, err := auth.GetTwoFactor(c.DB, currentUser.ID)
+	if err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to look up two-factor authentication")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to enable two-factor authentication", ctx)
+		return
+	}
+	if twoFactor == nil {
+		errors.AbortWithError(http.StatusBadRequest, auth.ErrTwoFactorNotEnrolled.Error(), ctx)
+		return
+	}
+	if twoFactor.EnabledAt != nil {
+		errors.AbortWithError(http.StatusBadRequest, auth.ErrTwoFactorAlreadyEnabled.Error(), ctx)
+		return
+	}
+
+	codes, err := auth.EnableTwoFactor(c.DB, ctx, currentUser, twoFactor, payload.Code)
+	if stderrors.Is(err, auth.ErrInvalidTwoFactorCode) || stderrors.Is(err, auth.ErrTwoFactorAlreadyEnabled) {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	} else if err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to enable two-factor authentication")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to enable two-factor authentication", ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, generated.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor turns off two-factor authentication for the current user, unless their role requires it.
+func (c *Controller) DisableTwoFactor(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	payload := &generated.TwoFactorCode{}
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	required, err := auth.TwoFactorRequired(c.DB, currentUser.Role)
+	if err != nil {
+		log.Err(err).Str("role", currentUser.Role).Msg("failed to look up role settings")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to disable two-factor authentication", ctx)
+		return
+	}
+	if required {
+		errors.AbortWithError(http.StatusForbidden, auth.ErrTwoFactorRequired.Error(), ctx)
+		return
+	}
+
+	twoFactor, ok := c.getEnabledTwoFactor(ctx, currentUser)
+	if !ok || !c.verifyTwoFactorCode(ctx, twoFactor, payload.Code) {
+		return
+	}
+
+	if err := auth.DisableTwoFactor(c.DB, ctx, currentUser); err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to disable two-factor authentication")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to disable two-factor authentication", ctx)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user.
+func (c *Controller) RegenerateRecoveryCodes(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	payload := &generated.TwoFactorCode{}
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	twoFactor, ok := c.getEnabledTwoFactor(ctx, currentUser)
+	if !ok || !c.verifyTwoFactorCode(ctx, twoFactor, payload.Code) {
+		return
+	}
+
+	codes, err := auth.ReplaceRecoveryCodes(c.DB, currentUser.ID)
+	if err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to replace recovery codes")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to replace recovery codes", ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, generated.RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -1,11 +1,17 @@
 package user
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
 	"github.com/rs/zerolog/log"
 	"net/http"
+	"net/url"
 	"pinman/internal/app/api/auth"
 	"pinman/internal/app/api/errors"
 	"pinman/internal/app/generated"
+	"pinman/internal/mailer"
 	"pinman/internal/models"
 	"pinman/internal/utils"
 	"strings"
@@ -15,12 +21,44 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	verifyEmailPurpose               = "verify-email"
+	resetPasswordPurpose             = "reset-password"
+	defaultVerificationExpiresAfter  = 48 * time.Hour
+	defaultPasswordResetExpiresAfter = time.Hour
+)
+
 type Controller struct {
-	DB *gorm.DB
+	DB             *gorm.DB
+	Config         *utils.Config
+	Mailer         mailer.Mailer
+	PasswordPolicy *utils.PasswordPolicy
 }
 
-func NewController(DB *gorm.DB) *Controller {
-	return &Controller{DB}
+func NewController(DB *gorm.DB, config *utils.Config, mailer mailer.Mailer) *Controller {
+	return &Controller{
+		DB:             DB,
+		Config:         config,
+		Mailer:         mailer,
+		PasswordPolicy: utils.NewPasswordPolicy(config),
+	}
+}
+
+// getAccountUser returns the current user for requests API tokens are not allowed to make, like managing their
+// account or other users. API tokens never pass two-factor authentication, so they can't be used to get around it.
+func getAccountUser(ctx *gin.Context) (*models.User, bool) {
+	currentUser, err := auth.GetUser(ctx)
+	if err != nil {
+		errors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
+		return nil, false
+	}
+
+	if auth.GetAPIToken(ctx) != nil {
+		errors.AbortWithError(http.StatusForbidden, auth.ErrAPITokenNotAllowed.Error(), ctx)
+		return nil, false
+	}
+
+	return currentUser, true
 }
 
 func (c *Controller) GetMe(ctx *gin.Context) {
@@ -29,16 +67,7 @@ func (c *Controller) GetMe(ctx *gin.Context) {
 		errors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
 	}
 
-	ctx.JSON(http.StatusOK, generated.UserResponse{
-		User: &generated.User{
-			Id:        currentUser.ID.String(),
-			Name:      currentUser.Name,
-			Email:     currentUser.Email,
-			Role:      currentUser.Role,
-			CreatedAt: utils.FormatTime(currentUser.CreatedAt),
-			UpdatedAt: utils.FormatTime(currentUser.UpdatedAt),
-		},
-	})
+	ctx.JSON(http.StatusOK, newUserResponse(currentUser))
 }
 
 func (c *Controller) SignUpUser(ctx *gin.Context) {
@@ -54,6 +83,10 @@ func (c *Controller) SignUpUser(ctx *gin.Context) {
 		return
 	}
 
+	if !c.checkPasswordPolicy(ctx, payload.Password, payload.Name, payload.Email) {
+		return
+	}
+
 	hashedPassword, err := utils.HashPassword(payload.Password)
 	if err != nil {
 		errors.AbortWithError(http.StatusInternalServerError, err.Error(), ctx)
@@ -65,33 +98,326 @@ func (c *Controller) SignUpUser(ctx *gin.Context) {
 		Name:      payload.Name,
 		Email:     strings.ToLower(payload.Email),
 		Password:  hashedPassword,
-		Role:      "user",
-		Verified:  true,
+		Role:      models.RoleUser,
+		Verified:  false,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
-	result := c.DB.Create(&newUser)
+	if err := c.DB.Create(&newUser).Error; err != nil {
+		errors.AbortWithDBError(ctx, err, "failed to create user", errors.DBErrorDetails{
+			errors.ErrUniqueViolation: "user with that email already exists",
+		})
+		return
+	}
 
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "duplicate key") {
-			errors.AbortWithError(http.StatusConflict, "user with that email already exists", ctx)
+	// the account is usable without a verified email address, the user can ask for a new email if this one is lost
+	if err := c.sendVerificationEmail(&newUser); err != nil {
+		log.Err(err).Str("userId", newUser.ID.String()).Msg("failed to send verification email")
+	}
+
+	ctx.JSON(http.StatusCreated, newUserResponse(&newUser))
+}
+
+// VerifyUser marks the email address of a user as verified, using the token from the link sent to that address.
+func (c *Controller) VerifyUser(ctx *gin.Context) {
+	payload := &generated.UserVerify{}
+
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	subject, err := utils.VerifySignedToken([]byte(c.Config.LinkSigningKey), verifyEmailPurpose, payload.Token)
+	if err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// the token is only valid for the address it was sent to, so changing address invalidates it
+	userID, email, _ := strings.Cut(subject, ":")
+
+	user := &models.User{}
+	if err := c.DB.First(user, "id = ?", userID).Error; err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			errors.AbortWithError(http.StatusBadRequest, utils.ErrInvalidToken.Error(), ctx)
 			return
-		} else {
-			log.Err(result.Error).Msg("failed to create user")
-			errors.AbortWithError(http.StatusInternalServerError, "failed to create user", ctx)
+		}
+		log.Err(err).Msg("failed to get user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to verify user", ctx)
+		return
+	}
+
+	if user.Email != email {
+		errors.AbortWithError(http.StatusBadRequest, utils.ErrInvalidToken.Error(), ctx)
+		return
+	}
+
+	if !user.Verified {
+		if err := c.DB.Model(user).Update("verified", true).Error; err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to verify user")
+			errors.AbortWithError(http.StatusInternalServerError, "failed to verify user", ctx)
 			return
 		}
 	}
 
-	ctx.JSON(http.StatusCreated, generated.UserResponse{
-		User: &generated.User{
-			Id:        newUser.ID.String(),
-			Name:      newUser.Name,
-			Email:     newUser.Email,
-			Role:      newUser.Role,
-			CreatedAt: utils.FormatTime(newUser.CreatedAt),
-			UpdatedAt: utils.FormatTime(newUser.UpdatedAt),
-		},
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ResendVerification sends a new verification email to the authenticated user.
+func (c *Controller) ResendVerification(ctx *gin.Context) {
+	currentUser, err := auth.GetUser(ctx)
+	if err != nil {
+		errors.AbortWithError(http.StatusForbidden, err.Error(), ctx)
+		return
+	}
+
+	if currentUser.Verified {
+		errors.AbortWithError(http.StatusBadRequest, "email address is already verified", ctx)
+		return
+	}
+
+	if err := c.sendVerificationEmail(currentUser); err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to send verification email")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to send verification email", ctx)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ForgotPassword emails a password reset link to the user with the given email address. The response is the same
+// whether the address is registered or not, so it can not be used to find out who has an account.
+func (c *Controller) ForgotPassword(ctx *gin.Context) {
+	payload := &generated.PasswordForgot{}
+
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	user := &models.User{}
+	if err := c.DB.First(user, "email = ?", strings.ToLower(payload.Email)).Error; err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.Status(http.StatusNoContent)
+			return
+		}
+		log.Err(err).Msg("failed to get user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to send password reset email", ctx)
+		return
+	}
+
+	// sending takes a while and may fail, which would tell the address is registered too
+	go func() {
+		if err := c.sendPasswordResetEmail(user); err != nil {
+			log.Err(err).Str("userId", user.ID.String()).Msg("failed to send password reset email")
+		}
+	}()
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ResetPassword sets a new password using the token from a password reset link. The token is tied to the password
+// it was issued for, so it stops working once the password has been changed.
+func (c *Controller) ResetPassword(ctx *gin.Context) {
+	payload := &generated.PasswordReset{}
+
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	if payload.Password != payload.PasswordConfirm {
+		errors.AbortWithError(http.StatusBadRequest, "passwords don't match", ctx)
+		return
+	}
+
+	subject, err := utils.VerifySignedToken([]byte(c.Config.LinkSigningKey), resetPasswordPurpose, payload.Token)
+	if err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	userID, fingerprint, _ := strings.Cut(subject, ":")
+
+	user := &models.User{}
+	if err := c.DB.First(user, "id = ?", userID).Error; err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			errors.AbortWithError(http.StatusBadRequest, utils.ErrInvalidToken.Error(), ctx)
+			return
+		}
+		log.Err(err).Msg("failed to get user")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to reset password", ctx)
+		return
+	}
+
+	if passwordFingerprint(user.Password) != fingerprint {
+		errors.AbortWithError(http.StatusBadRequest, utils.ErrInvalidToken.Error(), ctx)
+		return
+	}
+
+	if !c.checkPasswordPolicy(ctx, payload.Password, user.Name, user.Email) {
+		return
+	}
+
+	if err := c.setPassword(user, payload.Password); err != nil {
+		log.Err(err).Str("userId", user.ID.String()).Msg("failed to reset password")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to reset password", ctx)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ChangePassword sets a new password for the authenticated user, who must confirm their current password.
+func (c *Controller) ChangePassword(ctx *gin.Context) {
+	currentUser, ok := getAccountUser(ctx)
+	if !ok {
+		return
+	}
+
+	payload := &generated.PasswordChange{}
+
+	if err := ctx.ShouldBindJSON(payload); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	if payload.Password != payload.PasswordConfirm {
+		errors.AbortWithError(http.StatusBadRequest, "passwords don't match", ctx)
+		return
+	}
+
+	if err := utils.VerifyPassword(currentUser.Password, payload.CurrentPassword); err != nil {
+		errors.AbortWithError(http.StatusBadRequest, "current password is incorrect", ctx)
+		return
+	}
+
+	if !c.checkPasswordPolicy(ctx, payload.Password, currentUser.Name, currentUser.Email) {
+		return
+	}
+
+	if err := c.setPassword(currentUser, payload.Password); err != nil {
+		log.Err(err).Str("userId", currentUser.ID.String()).Msg("failed to change password")
+		errors.AbortWithError(http.StatusInternalServerError, "failed to change password", ctx)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// checkPasswordPolicy aborts with bad request if the password breaks the password policy, listing the rules it breaks
+// in the meta of the response.
+func (c *Controller) checkPasswordPolicy(ctx *gin.Context, password string, name string, email string) bool {
+	if err := c.PasswordPolicy.Check(password, name, email); err != nil {
+		policyErr := err.(*utils.PasswordPolicyError)
+		errors.AbortWithError(http.StatusBadRequest, policyErr.Error(), ctx, map[string]interface{}{
+			"failed_rules": policyErr.Rules,
+		})
+		return false
+	}
+
+	return true
+}
+
+// setPassword hashes and stores a new password for the user, which revokes every token and session issued to them
+// so far.
+func (c *Controller) setPassword(user *models.User, password string) error {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return c.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"password":            hashedPassword,
+			"password_changed_at": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return auth.RevokeSessions(tx, user.ID)
+	})
+}
+
+func (c *Controller) sendPasswordResetEmail(user *models.User) error {
+	expiresAfter := c.Config.PasswordResetLinkExpiresAfter
+	if expiresAfter <= 0 {
+		expiresAfter = defaultPasswordResetExpiresAfter
+	}
+	expiresAt := time.Now().Add(expiresAfter)
+
+	token := utils.SignToken(
+		[]byte(c.Config.LinkSigningKey),
+		resetPasswordPurpose,
+		fmt.Sprintf("%s:%s", user.ID.String(), passwordFingerprint(user.Password)),
+		expiresAt,
+	)
+
+	return c.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your PinMan password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password of your PinMan account. If it was you, open the link below "+
+				"to choose a new password:\n\n%s\n\nThe link expires on %s. If you did not ask for a new "+
+				"password, you can ignore this email.\n",
+			user.Name, c.link("/app/reset-password", token), expiresAt.Format(time.RFC1123),
+		),
+	})
+}
+
+func (c *Controller) sendVerificationEmail(user *models.User) error {
+	expiresAfter := c.Config.VerificationLinkExpiresAfter
+	if expiresAfter <= 0 {
+		expiresAfter = defaultVerificationExpiresAfter
+	}
+	expiresAt := time.Now().Add(expiresAfter)
+
+	token := utils.SignToken(
+		[]byte(c.Config.LinkSigningKey),
+		verifyEmailPurpose,
+		fmt.Sprintf("%s:%s", user.ID.String(), user.Email),
+		expiresAt,
+	)
+	link := c.link("/app/verify-email", token)
+
+	return c.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your PinMan email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease verify your email address by opening the link below:\n\n%s\n\nThe link expires on %s.\n",
+			user.Name, link, expiresAt.Format(time.RFC1123),
+		),
 	})
 }
+
+// link returns the absolute URL of an app page that receives token as a query parameter.
+func (c *Controller) link(path string, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimSuffix(c.Config.AppURL, "/"), path, url.QueryEscape(token))
+}
+
+// passwordFingerprint identifies a password hash without revealing it.
+func passwordFingerprint(hashedPassword string) string {
+	sum := sha256.Sum256([]byte(hashedPassword))
+	return hex.EncodeToString(sum[:8])
+}
+
+func newUserResponse(user *models.User) generated.UserResponse {
+	return generated.UserResponse{
+		User: newUser(user),
+	}
+}
+
+func newUser(user *models.User) *generated.User {
+	return &generated.User{
+		Id:         user.ID.String(),
+		Name:       user.Name,
+		Email:      user.Email,
+		Role:       user.Role,
+		Verified:   user.Verified,
+		DisabledAt: utils.FormatTimePtr(user.DisabledAt),
+		CreatedAt:  utils.FormatTime(user.CreatedAt),
+		UpdatedAt:  utils.FormatTime(user.UpdatedAt),
+	}
+}
@@ -5,14 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"pinman/internal/app/api/auth"
 	"pinman/internal/app/api/user"
 	"pinman/internal/app/generated"
+	"pinman/internal/mailer"
+	"pinman/internal/mailer/mailertest"
 	"pinman/internal/models"
 	"pinman/internal/utils"
 	"regexp"
@@ -35,12 +40,22 @@ var _ = g.Describe("Controller", func() {
 	var db *gorm.DB
 	var mock sqlmock.Sqlmock
 	var controller *user.Controller
+	var testMailer *mailertest.Mailer
+	var config *utils.Config
 
 	g.BeforeEach(func() {
 		ctx, rr, router = utils.NewGinTestCtx()
 		db, mock = utils.NewGormMock()
+		testMailer = mailertest.NewMailer()
+		config = &utils.Config{
+			AppURL:                       "http://localhost:8080",
+			LinkSigningKey:               "secret",
+			VerificationLinkExpiresAfter: time.Hour,
+			// the specs use simple passwords, only the password policy specs check for common ones
+			PasswordCommonLimit: -1,
+		}
 
-		controller = user.NewController(db)
+		controller = user.NewController(db, config, testMailer)
 	})
 
 	g.When("GetMe receives a request", func() {
@@ -72,6 +87,7 @@ var _ = g.Describe("Controller", func() {
 						Id:        userObj.ID.String(),
 						Name:      userObj.Name,
 						Role:      userObj.Role,
+						Verified:  userObj.Verified,
 						CreatedAt: utils.FormatTime(userObj.CreatedAt),
 						UpdatedAt: utils.FormatTime(userObj.UpdatedAt),
 					},
@@ -91,9 +107,9 @@ var _ = g.Describe("Controller", func() {
 				}
 
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "users" ("name","email","password","role","verified","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "users" ("name","email","password","role","verified","created_at","updated_at","password_changed_at","disabled_at","anonymized_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Email, utils.AnyString{}, "user", true, utils.AnyTime{}, utils.AnyTime{}).
+					WithArgs(payload.Name, payload.Email, utils.AnyString{}, "user", false, utils.AnyTime{}, utils.AnyTime{}, nil, nil, nil).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id"}).
 							AddRow(uuid.New()),
@@ -116,6 +132,11 @@ var _ = g.Describe("Controller", func() {
 
 				m.Expect(response.User.Email).To(m.Equal(payload.Email))
 				m.Expect(response.User.Name).To(m.Equal(payload.Name))
+				m.Expect(response.User.Verified).To(m.BeFalse())
+
+				m.Expect(testMailer.Messages()).To(m.HaveLen(1))
+				m.Expect(testMailer.Messages()[0].To).To(m.Equal(payload.Email))
+				m.Expect(testMailer.Messages()[0].Body).To(m.ContainSubstring("http://localhost:8080/app/verify-email?token="))
 			})
 		})
 		g.Context("with invalid payload", func() {
@@ -166,6 +187,37 @@ var _ = g.Describe("Controller", func() {
 				m.Expect(response.Detail).To(m.Equal("passwords don't match"))
 			})
 		})
+		g.Context("with a password that breaks the password policy", func() {
+			g.It("fails with bad request listing the broken rules", func() {
+				config.PasswordCommonLimit = 100
+				controller = user.NewController(db, config, testMailer)
+				payload := &generated.UserRegister{
+					Email:           "jordan@example.com",
+					Name:            "Jordan Doe",
+					Password:        "jordan",
+					PasswordConfirm: "jordan",
+				}
+
+				body, err := json.Marshal(payload)
+				m.Expect(err).To(m.BeNil())
+				req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Content-Type", "application/json")
+
+				router.POST("/", controller.SignUpUser)
+				router.ServeHTTP(rr, req)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+
+				response := &generated.BadRequest{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Meta).ToNot(m.BeNil())
+				m.Expect((*response.Meta)["failed_rules"]).To(m.ConsistOf(
+					utils.PasswordRuleMinLength, utils.PasswordRulePersonalInfo, utils.PasswordRuleCommon,
+				))
+			})
+		})
 		g.Context("with existing email", func() {
 			g.It("fails with conflict", func() {
 				payload := &generated.UserRegister{
@@ -176,10 +228,13 @@ var _ = g.Describe("Controller", func() {
 				}
 
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "users" ("name","email","password","role","verified","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "users" ("name","email","password","role","verified","created_at","updated_at","password_changed_at","disabled_at","anonymized_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Email, utils.AnyString{}, "user", true, utils.AnyTime{}, utils.AnyTime{}).
-					WillReturnError(fmt.Errorf("ERROR: duplicate key value violates unique constraint \"idx_user_email\" (SQLSTATE 23505)"))
+					WithArgs(payload.Name, payload.Email, utils.AnyString{}, "user", false, utils.AnyTime{}, utils.AnyTime{}, nil, nil, nil).
+					WillReturnError(&pgconn.PgError{
+						Code: "23505", ConstraintName: "idx_user_email", Detail: "Key (email)=(email@example.com) already exists.",
+					})
+				mock.ExpectRollback()
 
 				body, err := json.Marshal(payload)
 				m.Expect(err).To(m.BeNil())
@@ -209,9 +264,9 @@ var _ = g.Describe("Controller", func() {
 				}
 
 				mock.ExpectBegin()
-				const sqlInsert = `INSERT INTO "users" ("name","email","password","role","verified","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "id"`
+				const sqlInsert = `INSERT INTO "users" ("name","email","password","role","verified","created_at","updated_at","password_changed_at","disabled_at","anonymized_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`
 				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
-					WithArgs(payload.Name, payload.Email, utils.AnyString{}, "user", true, utils.AnyTime{}, utils.AnyTime{}).
+					WithArgs(payload.Name, payload.Email, utils.AnyString{}, "user", false, utils.AnyTime{}, utils.AnyTime{}, nil, nil, nil).
 					WillReturnError(fmt.Errorf("something bad happened"))
 				mock.ExpectRollback()
 
@@ -233,4 +288,1207 @@ var _ = g.Describe("Controller", func() {
 			})
 		})
 	})
+
+	g.When("VerifyUser receives a request", func() {
+		userObj := &models.User{
+			ID:        uuid.New(),
+			Name:      "John Doe",
+			Email:     "email@example.com",
+			Role:      "user",
+			Verified:  false,
+			CreatedAt: time.Now().Add(-1 * time.Hour),
+			UpdatedAt: time.Now(),
+		}
+		const sqlSelect = `SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`
+
+		var userRows = func(email string) *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"id", "name", "email", "role", "verified", "created_at", "updated_at"}).
+				AddRow(userObj.ID, userObj.Name, email, userObj.Role, false, userObj.CreatedAt, userObj.UpdatedAt)
+		}
+
+		var verify = func(token string) *generated.ErrorResponse {
+			body, err := json.Marshal(&generated.UserVerify{Token: token})
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+
+			router.POST("/", controller.VerifyUser)
+			router.ServeHTTP(rr, req)
+
+			response := &generated.ErrorResponse{}
+			m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+			return response
+		}
+
+		var signToken = func(email string, expiresAt time.Time) string {
+			return utils.SignToken(
+				[]byte(config.LinkSigningKey), "verify-email", fmt.Sprintf("%s:%s", userObj.ID, email), expiresAt,
+			)
+		}
+
+		g.Context("with a valid token", func() {
+			g.It("verifies the user", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+					WithArgs(userObj.ID.String()).
+					WillReturnRows(userRows(userObj.Email))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "verified"=$1,"updated_at"=$2 WHERE "id" = $3`)).
+					WithArgs(true, utils.AnyTime{}, userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				verify(signToken(userObj.Email, time.Now().Add(time.Hour)))
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				response := &generated.UserResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.User.Verified).To(m.BeTrue())
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.Context("with an expired token", func() {
+			g.It("fails with bad request", func() {
+				response := verify(signToken(userObj.Email, time.Now().Add(-time.Minute)))
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(response.Detail).To(m.Equal(utils.ErrTokenExpired.Error()))
+			})
+		})
+
+		g.Context("with a token sent to a previous email address", func() {
+			g.It("fails with bad request", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+					WithArgs(userObj.ID.String()).
+					WillReturnRows(userRows("new@example.com"))
+
+				response := verify(signToken(userObj.Email, time.Now().Add(time.Hour)))
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(response.Detail).To(m.Equal(utils.ErrInvalidToken.Error()))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.Context("with a token for a user that does not exist", func() {
+			g.It("fails with bad request", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelect)).
+					WithArgs(userObj.ID.String()).
+					WillReturnError(gorm.ErrRecordNotFound)
+
+				response := verify(signToken(userObj.Email, time.Now().Add(time.Hour)))
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(response.Detail).To(m.Equal(utils.ErrInvalidToken.Error()))
+			})
+		})
+	})
+
+	g.When("ResendVerification receives a request", func() {
+		g.Context("from a user that is not verified", func() {
+			g.It("sends a new verification email", func() {
+				ctx.Set(auth.IdentityKey, &models.User{ID: uuid.New(), Email: "email@example.com", Verified: false})
+				controller.ResendVerification(ctx)
+
+				m.Expect(ctx.Writer.Status()).To(m.Equal(http.StatusNoContent))
+				m.Expect(testMailer.Messages()).To(m.HaveLen(1))
+				m.Expect(testMailer.Messages()[0].To).To(m.Equal("email@example.com"))
+			})
+		})
+
+		g.Context("from a user that is already verified", func() {
+			g.It("fails with bad request", func() {
+				ctx.Set(auth.IdentityKey, &models.User{ID: uuid.New(), Email: "email@example.com", Verified: true})
+				controller.ResendVerification(ctx)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(testMailer.Messages()).To(m.BeEmpty())
+			})
+		})
+	})
+
+	g.Describe("password reset", func() {
+		var hashedPassword string
+		var userObj *models.User
+		const sqlSelectByEmail = `SELECT * FROM "users" WHERE email = $1 ORDER BY "users"."id" LIMIT 1`
+		const sqlSelectByID = `SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`
+		const sqlUpdatePassword = `UPDATE "users" SET "password"=$1,"password_changed_at"=$2,"updated_at"=$3 WHERE "id" = $4`
+		const sqlRevokeSessions = `UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE user_id = $3 AND revoked_at IS NULL`
+
+		var userRows = func(password string) *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"id", "name", "email", "password", "role", "verified"}).
+				AddRow(userObj.ID, userObj.Name, userObj.Email, password, userObj.Role, true)
+		}
+
+		var post = func(handler gin.HandlerFunc, payload any) *generated.ErrorResponse {
+			body, err := json.Marshal(payload)
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+
+			router.POST("/", handler)
+			router.ServeHTTP(rr, req)
+
+			response := &generated.ErrorResponse{}
+			if rr.Body.Len() > 0 {
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+			}
+			return response
+		}
+
+		// requestResetToken goes through ForgotPassword and returns the token from the email that was sent
+		var requestResetToken = func() string {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectByEmail)).
+				WithArgs(userObj.Email).
+				WillReturnRows(userRows(hashedPassword))
+
+			post(controller.ForgotPassword, &generated.PasswordForgot{Email: userObj.Email})
+			m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+			m.Eventually(testMailer.Messages).Should(m.HaveLen(1))
+
+			match := regexp.MustCompile(`reset-password\?token=(\S+)`).FindStringSubmatch(testMailer.Messages()[0].Body)
+			m.Expect(match).To(m.HaveLen(2))
+			token, err := url.QueryUnescape(match[1])
+			m.Expect(err).To(m.BeNil())
+
+			rr = httptest.NewRecorder()
+			_, router = gin.CreateTestContext(rr)
+			return token
+		}
+
+		g.BeforeEach(func() {
+			var err error
+			hashedPassword, err = utils.HashPassword("password")
+			m.Expect(err).To(m.BeNil())
+			userObj = &models.User{
+				ID:       uuid.New(),
+				Name:     "John Doe",
+				Email:    "email@example.com",
+				Password: hashedPassword,
+				Role:     "user",
+				Verified: true,
+			}
+		})
+
+		g.When("ForgotPassword receives a request for an unknown email", func() {
+			g.It("succeeds without sending an email", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelectByEmail)).
+					WithArgs("unknown@example.com").
+					WillReturnError(gorm.ErrRecordNotFound)
+
+				post(controller.ForgotPassword, &generated.PasswordForgot{Email: "unknown@example.com"})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+				m.Expect(testMailer.Messages()).To(m.BeEmpty())
+			})
+		})
+
+		g.When("ForgotPassword can't send the email", func() {
+			g.It("succeeds like for an unknown email", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelectByEmail)).
+					WithArgs(userObj.Email).
+					WillReturnRows(userRows(hashedPassword))
+
+				controller.Mailer = failingMailer{}
+				post(controller.ForgotPassword, &generated.PasswordForgot{Email: userObj.Email})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.When("ResetPassword receives a request", func() {
+			g.Context("with a valid token", func() {
+				g.It("changes the password", func() {
+					token := requestResetToken()
+
+					mock.ExpectQuery(regexp.QuoteMeta(sqlSelectByID)).
+						WithArgs(userObj.ID.String()).
+						WillReturnRows(userRows(hashedPassword))
+					mock.ExpectBegin()
+					mock.ExpectExec(regexp.QuoteMeta(sqlUpdatePassword)).
+						WithArgs(utils.AnyString{}, utils.AnyTime{}, utils.AnyTime{}, userObj.ID).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectExec(regexp.QuoteMeta(sqlRevokeSessions)).
+						WithArgs(utils.AnyTime{}, utils.AnyTime{}, userObj.ID).
+						WillReturnResult(sqlmock.NewResult(0, 2))
+					mock.ExpectCommit()
+
+					post(controller.ResetPassword, &generated.PasswordReset{
+						Token:           token,
+						Password:        "new password",
+						PasswordConfirm: "new password",
+					})
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+					m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				})
+			})
+
+			g.Context("with a token that was already used", func() {
+				g.It("fails with bad request", func() {
+					token := requestResetToken()
+
+					newPassword, err := utils.HashPassword("new password")
+					m.Expect(err).To(m.BeNil())
+					mock.ExpectQuery(regexp.QuoteMeta(sqlSelectByID)).
+						WithArgs(userObj.ID.String()).
+						WillReturnRows(userRows(newPassword))
+
+					response := post(controller.ResetPassword, &generated.PasswordReset{
+						Token:           token,
+						Password:        "another password",
+						PasswordConfirm: "another password",
+					})
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+					m.Expect(response.Detail).To(m.Equal(utils.ErrInvalidToken.Error()))
+					m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				})
+			})
+
+			g.Context("with an email verification token", func() {
+				g.It("fails with bad request", func() {
+					token := utils.SignToken(
+						[]byte(config.LinkSigningKey), "verify-email", fmt.Sprintf("%s:%s", userObj.ID, userObj.Email),
+						time.Now().Add(time.Hour),
+					)
+
+					response := post(controller.ResetPassword, &generated.PasswordReset{
+						Token:           token,
+						Password:        "new password",
+						PasswordConfirm: "new password",
+					})
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+					m.Expect(response.Detail).To(m.Equal(utils.ErrInvalidToken.Error()))
+				})
+			})
+
+			g.Context("with passwords that don't match", func() {
+				g.It("fails with bad request", func() {
+					response := post(controller.ResetPassword, &generated.PasswordReset{
+						Token:           "token",
+						Password:        "new password",
+						PasswordConfirm: "other password",
+					})
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+					m.Expect(response.Detail).To(m.Equal("passwords don't match"))
+				})
+			})
+		})
+
+		g.When("ChangePassword receives a request", func() {
+			var changePassword = func(currentPassword string) *generated.ErrorResponse {
+				router.Use(func(c *gin.Context) {
+					c.Set(auth.IdentityKey, userObj)
+				})
+				return post(controller.ChangePassword, &generated.PasswordChange{
+					CurrentPassword: currentPassword,
+					Password:        "new password",
+					PasswordConfirm: "new password",
+				})
+			}
+
+			g.Context("with the correct current password", func() {
+				g.It("changes the password", func() {
+					mock.ExpectBegin()
+					mock.ExpectExec(regexp.QuoteMeta(sqlUpdatePassword)).
+						WithArgs(utils.AnyString{}, utils.AnyTime{}, utils.AnyTime{}, userObj.ID).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectExec(regexp.QuoteMeta(sqlRevokeSessions)).
+						WithArgs(utils.AnyTime{}, utils.AnyTime{}, userObj.ID).
+						WillReturnResult(sqlmock.NewResult(0, 2))
+					mock.ExpectCommit()
+
+					changePassword("password")
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+					m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+					m.Expect(userObj.PasswordChangedAt).ToNot(m.BeNil())
+				})
+			})
+
+			g.Context("with an incorrect current password", func() {
+				g.It("fails with bad request", func() {
+					response := changePassword("wrong password")
+
+					m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+					m.Expect(response.Detail).To(m.Equal("current password is incorrect"))
+					m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				})
+			})
+		})
+	})
+
+	g.Describe("sessions", func() {
+		var userObj *models.User
+		var currentSessionID uuid.UUID
+
+		g.BeforeEach(func() {
+			userObj = &models.User{ID: uuid.New(), Role: "user", Verified: true}
+			currentSessionID = uuid.New()
+			ctx.Set(auth.IdentityKey, userObj)
+			ctx.Set("JWT_PAYLOAD", jwt.MapClaims{auth.SessionIDKey: currentSessionID.String()})
+		})
+
+		g.When("ListSessions receives a request", func() {
+			g.It("lists the active sessions and flags the current one", func() {
+				otherSessionID := uuid.New()
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT * FROM "sessions" WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY last_used_at DESC`,
+				)).WithArgs(userObj.ID, utils.AnyTime{}).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "user_agent", "ip_address"}).
+						AddRow(currentSessionID, userObj.ID, "Firefox", "127.0.0.1").
+						AddRow(otherSessionID, userObj.ID, "curl", "10.0.0.1"))
+
+				controller.ListSessions(ctx)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+
+				response := &generated.SessionListResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Sessions).To(m.HaveLen(2))
+				m.Expect(response.Sessions[0].Id).To(m.Equal(currentSessionID.String()))
+				m.Expect(response.Sessions[0].Current).To(m.BeTrue())
+				m.Expect(response.Sessions[1].UserAgent).To(m.Equal("curl"))
+				m.Expect(response.Sessions[1].Current).To(m.BeFalse())
+			})
+		})
+
+		g.When("RevokeSession receives a request", func() {
+			const sqlRevokeSession = `UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE id = $3 AND user_id = $4 AND revoked_at IS NULL`
+
+			g.It("revokes a session of the user", func() {
+				sessionID := uuid.New()
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlRevokeSession)).
+					WithArgs(utils.AnyTime{}, utils.AnyTime{}, sessionID, userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				controller.RevokeSession(ctx, sessionID.String())
+
+				m.Expect(ctx.Writer.Status()).To(m.Equal(http.StatusNoContent))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+
+			g.It("fails with not found for a session of another user", func() {
+				sessionID := uuid.New()
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlRevokeSession)).
+					WithArgs(utils.AnyTime{}, utils.AnyTime{}, sessionID, userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				controller.RevokeSession(ctx, sessionID.String())
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusNotFound))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.When("RevokeOtherSessions receives a request", func() {
+			g.It("revokes every session but the current one", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE (user_id = $3 AND revoked_at IS NULL) AND id NOT IN ($4)`,
+				)).WithArgs(utils.AnyTime{}, utils.AnyTime{}, userObj.ID, currentSessionID).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+
+				controller.RevokeOtherSessions(ctx)
+
+				m.Expect(ctx.Writer.Status()).To(m.Equal(http.StatusNoContent))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+
+			g.It("fails with forbidden for a request with an API token, which has no session to keep", func() {
+				ctx.Set("JWT_PAYLOAD", nil)
+				ctx.Set(auth.APITokenKey, &models.APIToken{ID: uuid.New(), UserID: userObj.ID})
+
+				controller.RevokeOtherSessions(ctx)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+	})
+
+	g.Describe("API tokens", func() {
+		var userObj *models.User
+
+		var post = func(payload interface{}) {
+			body, err := json.Marshal(payload)
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+			req.Header.Set("Content-Type", "application/json")
+			router.POST("/", controller.CreateAPIToken)
+			router.ServeHTTP(rr, req)
+		}
+
+		g.BeforeEach(func() {
+			userObj = &models.User{ID: uuid.New(), Role: "user", Verified: true}
+			router.Use(func(c *gin.Context) {
+				c.Set(auth.IdentityKey, userObj)
+			})
+		})
+
+		g.When("CreateAPIToken receives a request", func() {
+			const sqlInsert = `INSERT INTO "api_tokens" ("user_id","name","token_prefix","token_hash","read_only","league_id","last_used_at","expires_at","revoked_at","created_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`
+
+			g.It("creates a token and returns it once", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(sqlInsert)).
+					WithArgs(userObj.ID, "import script", utils.AnyString{}, utils.AnyString{}, true, nil, nil, nil, nil, utils.AnyTime{}).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectCommit()
+
+				post(&generated.ApiTokenCreate{Name: "import script", ReadOnly: utils.PtrBool(true)})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusCreated))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+
+				response := &generated.ApiTokenCreateResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Token).To(m.HavePrefix(auth.APITokenPrefix))
+				m.Expect(response.Token).To(m.HavePrefix(response.ApiToken.TokenPrefix))
+				m.Expect(response.ApiToken.ReadOnly).To(m.BeTrue())
+			})
+
+			g.It("fails with bad request for a league the user does not own", func() {
+				leagueID := uuid.New()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE (id = $1 AND owner_id = $2) AND "leagues"."deleted_at" IS NULL LIMIT 1`)).
+					WithArgs(leagueID.String(), userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				post(&generated.ApiTokenCreate{Name: "import script", LeagueId: utils.PtrString(leagueID.String())})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+
+			g.It("fails with bad request for an expiry in the past", func() {
+				post(&generated.ApiTokenCreate{
+					Name:      "import script",
+					ExpiresAt: utils.PtrString(time.Now().Add(-time.Hour).Format(time.RFC3339)),
+				})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+			})
+		})
+
+		g.When("RevokeAPIToken receives a request", func() {
+			g.It("revokes a token of the user", func() {
+				tokenID := uuid.New()
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "api_tokens" SET "revoked_at"=$1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`,
+				)).WithArgs(utils.AnyTime{}, tokenID, userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				ctx.Set(auth.IdentityKey, userObj)
+				controller.RevokeAPIToken(ctx, tokenID.String())
+
+				m.Expect(ctx.Writer.Status()).To(m.Equal(http.StatusNoContent))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+	})
+
+	g.When("Unlock receives a request", func() {
+		var admin *models.User
+
+		g.BeforeEach(func() {
+			admin = &models.User{ID: uuid.New(), Email: "admin@example.com", Role: "admin", Verified: true}
+			ctx.Set(auth.IdentityKey, admin)
+			ctx.Request = httptest.NewRequest("POST", "/", nil)
+		})
+
+		g.It("forgets the failed logins of the user and writes an audit log", func() {
+			userID := uuid.New()
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`)).
+				WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(userID, "player@example.com"))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "failed_logins" WHERE key = $1`)).
+				WithArgs("account:player@example.com").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(
+				`INSERT INTO "audit_logs" ("action","user_id","actor_id","ip_address","detail","created_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`,
+			)).WithArgs(models.AuditActionAccountUnlocked, userID, admin.ID, utils.AnyString{}, utils.AnyString{}, utils.AnyTime{}).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+
+			controller.Unlock(ctx, userID.String())
+
+			m.Expect(ctx.Writer.Status()).To(m.Equal(http.StatusNoContent))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+
+		g.It("fails with not found for an unknown user", func() {
+			userID := uuid.New()
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`)).
+				WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			controller.Unlock(ctx, userID.String())
+
+			m.Expect(ctx.Writer.Status()).To(m.Equal(http.StatusNotFound))
+			m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+		})
+	})
+
+	g.Describe("user management", func() {
+		var admin *models.User
+		var userID uuid.UUID
+
+		const sqlSelectUser = `SELECT * FROM "users" WHERE id = $1 ORDER BY "users"."id" LIMIT 1`
+		const sqlInsertAuditLog = `INSERT INTO "audit_logs" ("action","user_id","actor_id","ip_address","detail","created_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+
+		var expectUser = func(role string, disabledAt interface{}) {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUser)).
+				WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "disabled_at"}).
+					AddRow(userID, "player@example.com", role, disabledAt))
+		}
+
+		var expectAuditLog = func(action string) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlInsertAuditLog)).
+				WithArgs(action, userID, admin.ID, utils.AnyString{}, utils.AnyString{}, utils.AnyTime{}).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+		}
+
+		g.BeforeEach(func() {
+			admin = &models.User{ID: uuid.New(), Email: "admin@example.com", Role: models.RoleAdmin, Verified: true}
+			userID = uuid.New()
+			ctx.Set(auth.IdentityKey, admin)
+			ctx.Request = httptest.NewRequest("POST", "/", nil)
+		})
+
+		g.When("ListUsers receives a request", func() {
+			g.It("searches users by name and email address", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT count(*) FROM "users" WHERE (LOWER(name) LIKE $1 OR email LIKE $2) AND role = $3`,
+				)).WithArgs(`%john\_%`, `%john\_%`, models.RoleOrganizer).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT * FROM "users" WHERE (LOWER(name) LIKE $1 OR email LIKE $2) AND role = $3 ORDER BY created_at DESC LIMIT 10 OFFSET 10`,
+				)).WithArgs(`%john\_%`, `%john\_%`, models.RoleOrganizer).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "role"}).
+						AddRow(userID, "John_Doe", "john_doe@example.com", models.RoleOrganizer))
+
+				controller.ListUsers(ctx, generated.GetUsersParams{
+					Search: utils.PtrString("John_"),
+					Role:   utils.PtrString(models.RoleOrganizer),
+					Limit:  utils.PtrInt(10),
+					Offset: utils.PtrInt(10),
+				})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.UserListResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Total).To(m.Equal(11))
+				m.Expect(response.Users).To(m.HaveLen(1))
+				m.Expect(response.Users[0].Id).To(m.Equal(userID.String()))
+			})
+
+			g.It("fails with bad request for a limit that is too high", func() {
+				controller.ListUsers(ctx, generated.GetUsersParams{Limit: utils.PtrInt(1000)})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+			})
+		})
+
+		g.When("ChangeRole receives a request", func() {
+			var put = func(id string, role generated.UserRoleUpdateRole) {
+				body, err := json.Marshal(&generated.UserRoleUpdate{Role: role})
+				m.Expect(err).To(m.BeNil())
+				ctx.Request = httptest.NewRequest("PUT", "/", bytes.NewReader(body))
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				controller.ChangeRole(ctx, id)
+			}
+
+			var expectRoleChange = func(role string, twoFactorRequired bool) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "role"=$1,"updated_at"=$2 WHERE "id" = $3`)).
+					WithArgs(role, utils.AnyTime{}, userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_settings" WHERE role = $1 LIMIT 1`)).
+					WithArgs(role).
+					WillReturnRows(sqlmock.NewRows([]string{"role", "two_factor_required"}).AddRow(role, twoFactorRequired))
+			}
+
+			g.It("changes the role and writes an audit log", func() {
+				expectUser(models.RoleUser, nil)
+				expectRoleChange(models.RoleOrganizer, false)
+				mock.ExpectCommit()
+				expectAuditLog(models.AuditActionUserRoleChanged)
+
+				put(userID.String(), generated.UserRoleUpdateRoleOrganizer)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.UserResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.User.Role).To(m.Equal(models.RoleOrganizer))
+			})
+
+			g.It("revokes the access of the user if the role requires two-factor authentication they don't use", func() {
+				expectUser(models.RoleUser, nil)
+				expectRoleChange(models.RoleAdmin, true)
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE revoked_at IS NULL AND user_id IN (SELECT "id" FROM "users" WHERE (role = $3 AND id NOT IN (SELECT "user_id" FROM "two_factors" WHERE enabled_at IS NOT NULL)) AND id IN ($4))`,
+				)).WithArgs(utils.AnyTime{}, utils.AnyTime{}, models.RoleAdmin, userID).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "api_tokens" SET "revoked_at"=$1 WHERE revoked_at IS NULL AND user_id IN (SELECT "id" FROM "users" WHERE (role = $2 AND id NOT IN (SELECT "user_id" FROM "two_factors" WHERE enabled_at IS NOT NULL)) AND id IN ($3))`,
+				)).WithArgs(utils.AnyTime{}, models.RoleAdmin, userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectAuditLog(models.AuditActionUserRoleChanged)
+
+				put(userID.String(), generated.UserRoleUpdateRoleAdmin)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+
+			g.It("fails with bad request for an unknown role", func() {
+				put(userID.String(), "superuser")
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+			})
+
+			g.It("fails with forbidden for a request with an API token", func() {
+				ctx.Set(auth.APITokenKey, &models.APIToken{ID: uuid.New(), UserID: admin.ID})
+
+				put(userID.String(), generated.UserRoleUpdateRoleAdmin)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+
+			g.It("fails with bad request for the own role", func() {
+				userID = admin.ID
+				expectUser(models.RoleAdmin, nil)
+
+				put(admin.ID.String(), generated.UserRoleUpdateRoleUser)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.When("Disable receives a request", func() {
+			g.It("disables the account and logs the user out", func() {
+				expectUser(models.RoleUser, nil)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "disabled_at"=$1,"updated_at"=$2 WHERE "id" = $3`)).
+					WithArgs(utils.AnyTime{}, utils.AnyTime{}, userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE user_id = $3 AND revoked_at IS NULL`,
+				)).WithArgs(utils.AnyTime{}, utils.AnyTime{}, userID).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+				expectAuditLog(models.AuditActionUserDisabled)
+
+				controller.Disable(ctx, userID.String())
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.UserResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.User.DisabledAt).ToNot(m.BeNil())
+			})
+
+			g.It("fails with bad request for the own account", func() {
+				userID = admin.ID
+				expectUser(models.RoleAdmin, nil)
+
+				controller.Disable(ctx, admin.ID.String())
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+
+			g.It("fails with forbidden for a request with an API token", func() {
+				ctx.Set(auth.APITokenKey, &models.APIToken{ID: uuid.New(), UserID: admin.ID})
+
+				controller.Disable(ctx, userID.String())
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+				response := &generated.ErrorResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Detail).To(m.Equal(auth.ErrAPITokenNotAllowed.Error()))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.When("Enable receives a request", func() {
+			g.It("enables a disabled account", func() {
+				expectUser(models.RoleUser, time.Now())
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "disabled_at"=$1,"updated_at"=$2 WHERE "id" = $3`)).
+					WithArgs(nil, utils.AnyTime{}, userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectAuditLog(models.AuditActionUserEnabled)
+
+				controller.Enable(ctx, userID.String())
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.UserResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.User.DisabledAt).To(m.BeNil())
+			})
+
+			g.It("fails with bad request for a deleted account", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(sqlSelectUser)).
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "disabled_at", "anonymized_at"}).
+						AddRow(userID, "deleted@deleted.invalid", models.RoleUser, time.Now(), time.Now()))
+
+				controller.Enable(ctx, userID.String())
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.When("ListLogins receives a request", func() {
+			g.It("returns the logins and failed logins of the user", func() {
+				expectUser(models.RoleUser, nil)
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT * FROM "audit_logs" WHERE user_id = $1 AND action IN ($2,$3) ORDER BY created_at DESC LIMIT 100`,
+				)).WithArgs(userID, models.AuditActionLogin, models.AuditActionLoginFailed).
+					WillReturnRows(sqlmock.NewRows([]string{"action", "ip_address", "detail", "created_at"}).
+						AddRow(models.AuditActionLogin, "192.0.2.1", "player@example.com logged in", time.Now()).
+						AddRow(models.AuditActionLoginFailed, "192.0.2.2", "failed login", time.Now()))
+
+				controller.ListLogins(ctx, userID.String())
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.LoginHistoryResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.Logins).To(m.HaveLen(2))
+				m.Expect(response.Logins[0].Success).To(m.BeTrue())
+				m.Expect(response.Logins[1].Success).To(m.BeFalse())
+				m.Expect(response.Logins[1].IpAddress).To(m.Equal("192.0.2.2"))
+			})
+		})
+	})
+
+	g.Describe("two-factor authentication", func() {
+		var userObj *models.User
+
+		const sqlSelectTwoFactor = `SELECT * FROM "two_factors" WHERE user_id = $1 LIMIT 1`
+		const sqlSelectRoleSetting = `SELECT * FROM "role_settings" WHERE role = $1 LIMIT 1`
+
+		var post = func(handler gin.HandlerFunc, payload interface{}) {
+			body, err := json.Marshal(payload)
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+			req.Header.Set("Content-Type", "application/json")
+			router.POST("/", handler)
+			router.ServeHTTP(rr, req)
+		}
+
+		var expectTwoFactor = func(enabledAt interface{}) {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectTwoFactor)).
+				WithArgs(userObj.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "last_used_step", "enabled_at"}).
+					AddRow(userObj.ID, "JBSWY3DPEHPK3PXP", 0, enabledAt))
+		}
+
+		var expectRequired = func(required bool) {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSelectRoleSetting)).
+				WithArgs(userObj.Role).
+				WillReturnRows(sqlmock.NewRows([]string{"role", "two_factor_required"}).AddRow(userObj.Role, required))
+		}
+
+		g.BeforeEach(func() {
+			userObj = &models.User{ID: uuid.New(), Email: "organizer@example.com", Role: models.RoleOrganizer, Verified: true}
+			router.Use(func(c *gin.Context) {
+				c.Set(auth.IdentityKey, userObj)
+			})
+		})
+
+		g.When("GetTwoFactorStatus receives a request", func() {
+			g.It("returns whether two-factor authentication is enabled and the recovery codes left", func() {
+				expectTwoFactor(time.Now())
+				expectRequired(true)
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT count(*) FROM "recovery_codes" WHERE user_id = $1 AND used_at IS NULL`,
+				)).WithArgs(userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+				ctx.Set(auth.IdentityKey, userObj)
+				controller.GetTwoFactorStatus(ctx)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.TwoFactorStatus{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(*response).To(m.Equal(generated.TwoFactorStatus{
+					Enabled:                true,
+					Required:               true,
+					RecoveryCodesRemaining: 7,
+				}))
+			})
+		})
+
+		g.When("StartTwoFactor receives a request", func() {
+			g.It("fails with bad request if two-factor authentication is already enabled", func() {
+				expectTwoFactor(time.Now())
+
+				ctx.Set(auth.IdentityKey, userObj)
+				controller.StartTwoFactor(ctx)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.When("ConfirmTwoFactor receives a request", func() {
+			g.It("fails with bad request for a wrong code", func() {
+				expectTwoFactor(nil)
+
+				post(controller.ConfirmTwoFactor, &generated.TwoFactorCode{Code: "000000x"})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+
+		g.When("DisableTwoFactor receives a request", func() {
+			g.It("fails with forbidden if the role requires two-factor authentication", func() {
+				expectRequired(true)
+
+				post(controller.DisableTwoFactor, &generated.TwoFactorCode{Code: "123456"})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusForbidden))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+
+			g.It("removes the authenticator app with a recovery code", func() {
+				expectRequired(false)
+				expectTwoFactor(time.Now())
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "recovery_codes" SET "used_at"=$1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`,
+				)).WithArgs(utils.AnyTime{}, userObj.ID, utils.HashOpaqueToken("abcdefghij")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "recovery_codes" WHERE user_id = $1`)).
+					WithArgs(userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 9))
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "two_factors" WHERE user_id = $1`)).
+					WithArgs(userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+					WithArgs(models.AuditActionTwoFactorOff, userObj.ID, nil, utils.AnyString{}, utils.AnyString{}, utils.AnyTime{}).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectCommit()
+
+				post(controller.DisableTwoFactor, &generated.TwoFactorCode{Code: "abcde-fghij"})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+			})
+		})
+	})
+
+	g.Describe("profile", func() {
+		var userObj *models.User
+
+		const sqlInsertAuditLog = `INSERT INTO "audit_logs" ("action","user_id","actor_id","ip_address","detail","created_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`
+
+		var send = func(method string, handler gin.HandlerFunc, payload interface{}) {
+			body, err := json.Marshal(payload)
+			m.Expect(err).To(m.BeNil())
+			req, err := http.NewRequest(method, "/users/me", bytes.NewReader(body))
+			m.Expect(err).To(m.BeNil())
+			req.Header.Set("Content-Type", "application/json")
+			router.Handle(method, "/users/me", handler)
+			router.ServeHTTP(rr, req)
+		}
+
+		var expectAuditLog = func(action string) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(sqlInsertAuditLog)).
+				WithArgs(action, userObj.ID, nil, utils.AnyString{}, utils.AnyString{}, utils.AnyTime{}).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+		}
+
+		g.BeforeEach(func() {
+			userObj = &models.User{
+				ID:       uuid.New(),
+				Name:     "John Doe",
+				Email:    "john@example.com",
+				Password: "hashed",
+				Role:     models.RoleUser,
+				Verified: true,
+			}
+			router.Use(func(c *gin.Context) {
+				c.Set(auth.IdentityKey, userObj)
+			})
+		})
+
+		g.When("UpdateMe receives a request", func() {
+			const sqlUpdateEmail = `UPDATE "users" SET "email"=$1,"verified"=$2,"updated_at"=$3 WHERE "id" = $4`
+
+			g.It("changes the name", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "name"=$1,"updated_at"=$2 WHERE "id" = $3`)).
+					WithArgs("Jane Doe", utils.AnyTime{}, userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				send("PATCH", controller.UpdateMe, &generated.UserUpdate{Name: utils.PtrString(" Jane Doe ")})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.UserResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.User.Name).To(m.Equal("Jane Doe"))
+				m.Expect(response.User.Verified).To(m.BeTrue())
+				m.Expect(testMailer.Messages()).To(m.BeEmpty())
+			})
+
+			g.It("requires a new email address to be verified", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlUpdateEmail)).
+					WithArgs("jane@example.com", false, utils.AnyTime{}, userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectAuditLog(models.AuditActionEmailChanged)
+
+				send("PATCH", controller.UpdateMe, &generated.UserUpdate{Email: utils.PtrString("Jane@Example.com")})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.UserResponse{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(response.User.Email).To(m.Equal("jane@example.com"))
+				m.Expect(response.User.Verified).To(m.BeFalse())
+
+				m.Expect(testMailer.Messages()).To(m.HaveLen(2))
+				m.Expect(testMailer.Messages()[0].To).To(m.Equal("jane@example.com"))
+				m.Expect(testMailer.Messages()[0].Body).To(m.ContainSubstring("/app/verify-email?token="))
+				m.Expect(testMailer.Messages()[1].To).To(m.Equal("john@example.com"))
+			})
+
+			g.It("fails with conflict for an email address that is taken", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlUpdateEmail)).
+					WithArgs("jane@example.com", false, utils.AnyTime{}, userObj.ID).
+					WillReturnError(&pgconn.PgError{
+						Code: "23505", ConstraintName: "idx_users_email", Detail: "Key (email)=(email@example.com) already exists.",
+					})
+				mock.ExpectRollback()
+
+				send("PATCH", controller.UpdateMe, &generated.UserUpdate{Email: utils.PtrString("jane@example.com")})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusConflict))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				m.Expect(testMailer.Messages()).To(m.BeEmpty())
+			})
+
+			g.It("fails with bad request for an invalid email address", func() {
+				send("PATCH", controller.UpdateMe, &generated.UserUpdate{Email: utils.PtrString("jane")})
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusBadRequest))
+			})
+		})
+
+		g.When("ExportMe receives a request", func() {
+			g.It("returns everything tied to the user as a file", func() {
+				leagueID, locationID := uuid.New(), uuid.New()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "leagues" WHERE owner_id = $1 AND "leagues"."deleted_at" IS NULL ORDER BY created_at`)).
+					WithArgs(userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "owner_id", "location_id"}).
+						AddRow(leagueID, "Monday League", "monday", userObj.ID, locationID))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE "locations"."id" = $1`)).
+					WithArgs(locationID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).
+						AddRow(locationID, "The Arcade", "the-arcade"))
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT * FROM "tournaments" WHERE league_id IN (SELECT "id" FROM "leagues" WHERE owner_id = $1 AND "leagues"."deleted_at" IS NULL) AND "tournaments"."deleted_at" IS NULL ORDER BY created_at`,
+				)).WithArgs(userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "type", "settings", "league_id", "location_id"}).
+						AddRow(uuid.New(), "Spring Cup", "spring-cup", generated.MultiRoundTournament, `{"rounds":3}`, leagueID, locationID))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE "locations"."id" = $1`)).
+					WithArgs(locationID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).
+						AddRow(locationID, "The Arcade", "the-arcade"))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "sessions" WHERE user_id = $1 ORDER BY created_at`)).
+					WithArgs(userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "user_agent", "ip_address"}).
+						AddRow(uuid.New(), userObj.ID, "Firefox", "127.0.0.1"))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "api_tokens" WHERE user_id = $1 ORDER BY created_at`)).
+					WithArgs(userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "token_prefix"}))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "external_identities" WHERE user_id = $1 ORDER BY created_at`)).
+					WithArgs(userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "issuer", "email"}).
+						AddRow(uuid.New(), userObj.ID, "https://accounts.example.com", userObj.Email))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "audit_logs" WHERE user_id = $1 ORDER BY created_at`)).
+					WithArgs(userObj.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "action", "user_id", "ip_address", "detail"}).
+						AddRow(uuid.New(), models.AuditActionLogin, userObj.ID, "127.0.0.1", "john@example.com logged in"))
+
+				send("GET", controller.ExportMe, nil)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				m.Expect(rr.Header().Get("Content-Disposition")).To(m.Equal(`attachment; filename="pinman-export.json"`))
+
+				export := &generated.UserExport{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), export)).To(m.Succeed())
+				m.Expect(export.User.Email).To(m.Equal(userObj.Email))
+				m.Expect(export.Leagues).To(m.HaveLen(1))
+				m.Expect(export.Leagues[0].Slug).To(m.Equal("monday"))
+				m.Expect(export.Leagues[0].Location.Name).To(m.Equal("The Arcade"))
+				m.Expect(export.Tournaments).To(m.HaveLen(1))
+				m.Expect(export.Tournaments[0].Slug).To(m.Equal("spring-cup"))
+				m.Expect(export.Tournaments[0].League.Slug).To(m.Equal("monday"))
+				m.Expect(export.Tournaments[0].Location.Name).To(m.Equal("The Arcade"))
+				m.Expect(export.Sessions).To(m.HaveLen(1))
+				m.Expect(export.ApiTokens).To(m.BeEmpty())
+				m.Expect(export.Identities).To(m.Equal([]generated.ExternalIdentity{{
+					Issuer:    "https://accounts.example.com",
+					Email:     userObj.Email,
+					CreatedAt: utils.FormatTime(time.Time{}),
+				}}))
+				m.Expect(export.Activity).To(m.HaveLen(1))
+				m.Expect(export.Activity[0].Action).To(m.Equal(models.AuditActionLogin))
+			})
+		})
+
+		g.When("DeleteMe receives a request", func() {
+			g.It("anonymizes the user, removes their credentials and scrubs every email address they had", func() {
+				anonymousEmail := fmt.Sprintf("deleted-%s@deleted.invalid", userObj.ID)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT "detail" FROM "audit_logs" WHERE user_id = $1 AND action = $2 ORDER BY created_at`,
+				)).WithArgs(userObj.ID, models.AuditActionEmailChanged).
+					WillReturnRows(sqlmock.NewRows([]string{"detail"}).
+						AddRow("email address changed from old@example.com to john@example.com"))
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "users" SET "anonymized_at"=$1,"disabled_at"=$2,"email"=$3,"name"=$4,"password"=$5,"password_changed_at"=$6,"verified"=$7,"updated_at"=$8 WHERE "id" = $9`,
+				)).WithArgs(utils.AnyTime{}, utils.AnyTime{}, anonymousEmail, "Deleted user", "", utils.AnyTime{}, false, utils.AnyTime{}, userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(
+					`DELETE FROM "refresh_tokens" WHERE session_id IN (SELECT "id" FROM "sessions" WHERE user_id = $1)`,
+				)).WithArgs(userObj.ID).
+					WillReturnResult(sqlmock.NewResult(0, 4))
+				for _, table := range []string{"sessions", "api_tokens", "external_identities", "recovery_codes", "two_factors"} {
+					mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(`DELETE FROM "%s" WHERE user_id = $1`, table))).
+						WithArgs(userObj.ID).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				for _, email := range []string{"john@example.com", "old@example.com"} {
+					mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "failed_logins" WHERE key = $1`)).
+						WithArgs("account:" + email).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+					mock.ExpectExec(regexp.QuoteMeta(`UPDATE "audit_logs" SET "detail"=REPLACE(detail, $1, $2) WHERE user_id = $3 OR actor_id = $4`)).
+						WithArgs(email, anonymousEmail, userObj.ID, userObj.ID).
+						WillReturnResult(sqlmock.NewResult(0, 5))
+				}
+				mock.ExpectCommit()
+				expectAuditLog(models.AuditActionAccountDeleted)
+
+				send("DELETE", controller.DeleteMe, nil)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusNoContent))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				m.Expect(userObj.Name).To(m.Equal("Deleted user"))
+				m.Expect(userObj.AnonymizedAt).ToNot(m.BeNil())
+			})
+		})
+	})
+
+	g.Describe("roles", func() {
+		var admin *models.User
+
+		g.BeforeEach(func() {
+			admin = &models.User{ID: uuid.New(), Email: "admin@example.com", Role: models.RoleAdmin, Verified: true}
+			router.Use(func(c *gin.Context) {
+				c.Set(auth.IdentityKey, admin)
+			})
+		})
+
+		g.When("GetRole receives a request", func() {
+			g.It("fails with not found for an unknown role", func() {
+				controller.GetRole(ctx, "superuser")
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusNotFound))
+			})
+		})
+
+		g.When("UpdateRole receives a request", func() {
+			g.It("requires two-factor authentication and revokes the access of the users without it", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(
+					`INSERT INTO "role_settings" ("role","two_factor_required","updated_at") VALUES ($1,$2,$3) ON CONFLICT ("role") DO UPDATE SET "two_factor_required"="excluded"."two_factor_required","updated_at"="excluded"."updated_at"`,
+				)).WithArgs(models.RoleOrganizer, true, utils.AnyTime{}).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE revoked_at IS NULL AND user_id IN (SELECT "id" FROM "users" WHERE role = $3 AND id NOT IN (SELECT "user_id" FROM "two_factors" WHERE enabled_at IS NOT NULL))`,
+				)).WithArgs(utils.AnyTime{}, utils.AnyTime{}, models.RoleOrganizer).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(regexp.QuoteMeta(
+					`UPDATE "api_tokens" SET "revoked_at"=$1 WHERE revoked_at IS NULL AND user_id IN (SELECT "id" FROM "users" WHERE role = $2 AND id NOT IN (SELECT "user_id" FROM "two_factors" WHERE enabled_at IS NOT NULL))`,
+				)).WithArgs(utils.AnyTime{}, models.RoleOrganizer).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+					WithArgs(models.AuditActionRoleUpdated, nil, admin.ID, utils.AnyString{}, utils.AnyString{}, utils.AnyTime{}).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectCommit()
+
+				body, err := json.Marshal(&generated.RoleUpdate{TwoFactorRequired: utils.PtrBool(true)})
+				m.Expect(err).To(m.BeNil())
+				req, err := http.NewRequest("PUT", "/roles/organizer", bytes.NewReader(body))
+				m.Expect(err).To(m.BeNil())
+				req.Header.Set("Content-Type", "application/json")
+				router.PUT("/roles/:role", func(c *gin.Context) {
+					controller.UpdateRole(c, c.Param("role"))
+				})
+				router.ServeHTTP(rr, req)
+
+				m.Expect(rr.Code).To(m.Equal(http.StatusOK))
+				m.Expect(mock.ExpectationsWereMet()).To(m.BeNil())
+				response := &generated.Role{}
+				m.Expect(json.Unmarshal(rr.Body.Bytes(), response)).To(m.Succeed())
+				m.Expect(*response).To(m.Equal(generated.Role{Name: models.RoleOrganizer, TwoFactorRequired: true}))
+			})
+		})
+	})
 })
+
+// failingMailer fails to send every message.
+type failingMailer struct{}
+
+func (failingMailer) Send(mailer.Message) error {
+	return fmt.Errorf("connection refused")
+}
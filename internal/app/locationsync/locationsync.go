@@ -0,0 +1,152 @@
+package locationsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"pinman/internal/clients/pinballmap"
+	"pinman/internal/models"
+	"strings"
+	"time"
+)
+
+// Syncer periodically refreshes locations with the latest data from Pinball Map.
+type Syncer struct {
+	DB       *gorm.DB
+	pmClient pinballmap.ClientInterface
+	interval time.Duration
+}
+
+func NewSyncer(db *gorm.DB, interval time.Duration) *Syncer {
+	return &Syncer{
+		DB:       db,
+		pmClient: pinballmap.NewClient(),
+		interval: interval,
+	}
+}
+
+func NewSyncerWithClient(db *gorm.DB, client pinballmap.ClientInterface, interval time.Duration) *Syncer {
+	return &Syncer{
+		DB:       db,
+		pmClient: client,
+		interval: interval,
+	}
+}
+
+// Run syncs all locations immediately, then once every interval until ctx is cancelled.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.SyncAll(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to sync locations with pinball map")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncAll syncs every location that is listed on Pinball Map. Failing to sync a single location is logged and does
+// not stop the others from being synced.
+func (s *Syncer) SyncAll(ctx context.Context) error {
+	var locations []models.Location
+	if err := s.DB.Where("pinball_map_id IS NOT NULL").Find(&locations).Error; err != nil {
+		return fmt.Errorf("listing locations: %w", err)
+	}
+
+	for i := range locations {
+		if err := s.SyncLocation(ctx, &locations[i]); err != nil {
+			log.Error().Err(err).Str("locationId", locations[i].ID.String()).Msg("failed to sync location")
+		}
+	}
+
+	return nil
+}
+
+// SyncLocation updates the location with the data Pinball Map currently has for it and records every field that
+// changed. Locations that Pinball Map no longer knows about are flagged as removed instead of being updated.
+func (s *Syncer) SyncLocation(ctx context.Context, location *models.Location) error {
+	if location.PinballMapID == nil {
+		return fmt.Errorf("location is not linked to pinball map")
+	}
+
+	pinballMapLocation, err := s.pmClient.GetLocation(ctx, *location.PinballMapID)
+	if err != nil && !errors.Is(err, pinballmap.ErrNotFound) {
+		return fmt.Errorf("getting location from pinball map: %w", err)
+	}
+
+	var changes []models.LocationChange
+	recordChange := func(field string, oldValue string, newValue string) {
+		if oldValue == newValue {
+			return
+		}
+		changes = append(changes, models.LocationChange{
+			LocationID: location.ID,
+			Field:      field,
+			OldValue:   oldValue,
+			NewValue:   newValue,
+		})
+	}
+
+	// only the synced columns are written, so edits made while pinball map was being queried are not overwritten
+	columns := []string{"status", "last_synced_at", "updated_at"}
+	if pinballMapLocation == nil {
+		recordChange("status", location.Status, models.LocationStatusRemoved)
+		location.Status = models.LocationStatusRemoved
+	} else {
+		recordChange("status", location.Status, models.LocationStatusActive)
+		recordChange("name", location.Name, pinballMapLocation.Name)
+		recordChange("address", location.Address, pinballMapLocation.Address())
+		recordChange("machines", strings.Join(location.Machines, ", "), strings.Join(pinballMapLocation.MachineNames, ", "))
+
+		location.Status = models.LocationStatusActive
+		location.Name = pinballMapLocation.Name
+		location.Address = pinballMapLocation.Address()
+		location.Machines = pinballMapLocation.MachineNames
+		if location.Machines == nil {
+			location.Machines = []string{}
+		}
+		columns = append(columns, "name", "address", "machines")
+	}
+
+	now := time.Now()
+	location.LastSyncedAt = &now
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(location).Select(columns).Updates(location)
+		if result.Error != nil {
+			return fmt.Errorf("saving location: %w", result.Error)
+		}
+		// the location was deleted while it was being synced, there is nothing left to record changes for
+		if result.RowsAffected == 0 {
+			changes = nil
+			return nil
+		}
+		if len(changes) > 0 {
+			if err := tx.Create(&changes).Error; err != nil {
+				return fmt.Errorf("recording location changes: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		log.Info().
+			Str("locationId", location.ID.String()).
+			Int("changes", len(changes)).
+			Str("status", location.Status).
+			Msg("location updated from pinball map")
+	}
+
+	return nil
+}
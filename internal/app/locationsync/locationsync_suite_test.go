@@ -0,0 +1,194 @@
+package locationsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	testify "github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"pinman/internal/app/locationsync"
+	"pinman/internal/clients/pinballmap"
+	"pinman/internal/models"
+	"pinman/internal/utils"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestLocationSync(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "LocationSync Suite")
+}
+
+var _ = ginkgo.Describe("NewSyncer", func() {
+	ginkgo.It("should return a new syncer", func() {
+		db, _ := utils.NewGormMock()
+		syncer := locationsync.NewSyncer(db, time.Hour)
+		gomega.Expect(syncer).ToNot(gomega.BeNil())
+		gomega.Expect(syncer.DB).ToNot(gomega.BeNil())
+	})
+})
+
+var _ = ginkgo.Describe("Syncer", func() {
+	var db *gorm.DB
+	var mock sqlmock.Sqlmock
+	var mockPinballMapClient *pinballmap.MockClientInterface
+	var syncer *locationsync.Syncer
+	var location *models.Location
+
+	const sqlUpdate = `UPDATE "locations" SET "name"=$1,"address"=$2,"machines"=$3,"status"=$4,"last_synced_at"=$5,"updated_at"=$6 WHERE "locations"."deleted_at" IS NULL AND "id" = $7`
+	const sqlUpdateStatus = `UPDATE "locations" SET "status"=$1,"last_synced_at"=$2,"updated_at"=$3 WHERE "locations"."deleted_at" IS NULL AND "id" = $4`
+	const sqlInsertChanges = `INSERT INTO "location_changes" ("location_id","field","old_value","new_value","created_at") VALUES `
+
+	ginkgo.BeforeEach(func() {
+		db, mock = utils.NewGormMock()
+		mockPinballMapClient = pinballmap.NewMockClientInterface(ginkgo.GinkgoT())
+		syncer = locationsync.NewSyncerWithClient(db, mockPinballMapClient, time.Hour)
+
+		location = &models.Location{
+			ID:           uuid.New(),
+			Name:         "Pinballz Arcade",
+			Slug:         "pinballz-arcade",
+			Address:      "123 Main St, Austin, TX, USA",
+			PinballMapID: utils.PtrInt(1),
+			Machines:     []string{"Medieval Madness"},
+			Status:       models.LocationStatusActive,
+			CreatedAt:    time.Now().Add(-1 * time.Hour),
+			UpdatedAt:    time.Now().Add(-1 * time.Hour),
+		}
+	})
+
+	ginkgo.When("SyncLocation is called", func() {
+		ginkgo.Context("and pinball map has new data for the location", func() {
+			ginkgo.It("updates the location and records the changes", func() {
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(&pinballmap.Location{
+					ID:           1,
+					Name:         "Pinballz Kingdom",
+					Street:       "123 Main St",
+					City:         "Austin",
+					State:        "TX",
+					Country:      "USA",
+					MachineNames: []string{"Godzilla (Premium)", "Medieval Madness"},
+				}, nil)
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlUpdate)).
+					WithArgs(
+						"Pinballz Kingdom", location.Address, `["Godzilla (Premium)","Medieval Madness"]`,
+						models.LocationStatusActive, utils.AnyTime{}, utils.AnyTime{}, location.ID,
+					).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(sqlInsertChanges+`($1,$2,$3,$4,$5),($6,$7,$8,$9,$10) RETURNING "id"`)).
+					WithArgs(
+						location.ID, "name", "Pinballz Arcade", "Pinballz Kingdom", utils.AnyTime{},
+						location.ID, "machines", "Medieval Madness", "Godzilla (Premium), Medieval Madness", utils.AnyTime{},
+					).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()).AddRow(uuid.New()))
+				mock.ExpectCommit()
+
+				err := syncer.SyncLocation(context.Background(), location)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				gomega.Expect(location.Name).To(gomega.Equal("Pinballz Kingdom"))
+				gomega.Expect(location.LastSyncedAt).ToNot(gomega.BeNil())
+			})
+		})
+
+		ginkgo.Context("and pinball map no longer knows about the location", func() {
+			ginkgo.It("flags the location as removed", func() {
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(nil, fmt.Errorf("location 1 %w", pinballmap.ErrNotFound))
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlUpdateStatus)).
+					WithArgs(models.LocationStatusRemoved, utils.AnyTime{}, utils.AnyTime{}, location.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(sqlInsertChanges+`($1,$2,$3,$4,$5) RETURNING "id"`)).
+					WithArgs(location.ID, "status", models.LocationStatusActive, models.LocationStatusRemoved, utils.AnyTime{}).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectCommit()
+
+				err := syncer.SyncLocation(context.Background(), location)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				gomega.Expect(location.Status).To(gomega.Equal(models.LocationStatusRemoved))
+			})
+		})
+
+		ginkgo.Context("and the location is deleted while it is being synced", func() {
+			ginkgo.It("does not record any changes", func() {
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(nil, fmt.Errorf("location 1 %w", pinballmap.ErrNotFound))
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(sqlUpdateStatus)).
+					WithArgs(models.LocationStatusRemoved, utils.AnyTime{}, utils.AnyTime{}, location.ID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				err := syncer.SyncLocation(context.Background(), location)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+
+		ginkgo.Context("with a location that is not linked to pinball map", func() {
+			ginkgo.It("returns an error without calling pinball map", func() {
+				location.PinballMapID = nil
+
+				err := syncer.SyncLocation(context.Background(), location)
+
+				gomega.Expect(err).To(gomega.HaveOccurred())
+				mockPinballMapClient.AssertNotCalled(ginkgo.GinkgoT(), "GetLocation")
+			})
+		})
+
+		ginkgo.Context("and the pinball map client returns an error", func() {
+			ginkgo.It("returns an error without updating the location", func() {
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(nil, fmt.Errorf("some error"))
+
+				err := syncer.SyncLocation(context.Background(), location)
+
+				gomega.Expect(err).To(gomega.HaveOccurred())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+				gomega.Expect(location.LastSyncedAt).To(gomega.BeNil())
+			})
+		})
+	})
+
+	ginkgo.When("SyncAll is called", func() {
+		ginkgo.Context("and the query fails", func() {
+			ginkgo.It("returns an error", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE pinball_map_id IS NOT NULL`)).
+					WillReturnError(fmt.Errorf("some error"))
+
+				err := syncer.SyncAll(context.Background())
+
+				gomega.Expect(err).To(gomega.HaveOccurred())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+
+		ginkgo.Context("and a location fails to sync", func() {
+			ginkgo.It("continues syncing the other locations", func() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "locations" WHERE pinball_map_id IS NOT NULL`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "pinball_map_id", "status"}).
+						AddRow(uuid.New(), "Location One", 1, models.LocationStatusActive).
+						AddRow(uuid.New(), "Location Two", 2, models.LocationStatusActive))
+
+				mockPinballMapClient.On("GetLocation", testify.Anything, 1).Return(nil, fmt.Errorf("some error"))
+				mockPinballMapClient.On("GetLocation", testify.Anything, 2).Return(nil, fmt.Errorf("some other error"))
+
+				err := syncer.SyncAll(context.Background())
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+			})
+		})
+	})
+})
@@ -0,0 +1,124 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"pinman/internal/app/api/slug"
+	"pinman/internal/models"
+	"time"
+)
+
+// Purger periodically deletes the leagues, locations and tournaments that were deleted longer than the retention
+// period ago for good, after which they can't be restored anymore.
+type Purger struct {
+	DB        *gorm.DB
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewPurger(db *gorm.DB, retention time.Duration) *Purger {
+	return &Purger{
+		DB:        db,
+		retention: retention,
+		interval:  time.Hour,
+	}
+}
+
+// Run purges the records whose retention period is over immediately, then once every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Purge(time.Now().Add(-p.retention)); err != nil {
+			log.Error().Err(err).Msg("failed to purge deleted records")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge permanently deletes the tournaments, leagues and locations that were deleted before the time, along with the
+// records that only exist for them. Leagues and locations that other records still refer to are kept until those are
+// purged as well.
+func (p *Purger) Purge(before time.Time) error {
+	var tournaments, leagues, locations int64
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		deletedTournaments := tx.Unscoped().Model(&models.Tournament{}).
+			Select("id").
+			Where("deleted_at < ?", before)
+		if tournaments, err = purge(tx, slug.Tournament, &models.Tournament{}, deletedTournaments); err != nil {
+			return fmt.Errorf("purging tournaments: %w", err)
+		}
+
+		deletedLeagues := tx.Unscoped().Model(&models.League{}).
+			Select("id").
+			Where("deleted_at < ?", before).
+			Where("id NOT IN (?)", tx.Unscoped().Model(&models.Tournament{}).Select("league_id"))
+		// the API tokens restricted to the leagues are kept for the audit trail and the exports of their users, they
+		// were revoked when the leagues were deleted
+		err = tx.Model(&models.APIToken{}).
+			Where("league_id IN (?)", deletedLeagues).
+			Updates(map[string]interface{}{
+				"league_id":  nil,
+				"revoked_at": gorm.Expr("COALESCE(revoked_at, ?)", time.Now()),
+			}).Error
+		if err != nil {
+			return fmt.Errorf("detaching API tokens from leagues: %w", err)
+		}
+		leagues, err = purge(tx, slug.League, &models.League{}, deletedLeagues)
+		if err != nil {
+			return fmt.Errorf("purging leagues: %w", err)
+		}
+
+		deletedLocations := tx.Unscoped().Model(&models.Location{}).
+			Select("id").
+			Where("deleted_at < ?", before).
+			Where("id NOT IN (?)", tx.Unscoped().Model(&models.League{}).Select("location_id")).
+			Where("id NOT IN (?)", tx.Unscoped().Model(&models.Tournament{}).Select("location_id"))
+		locations, err = purge(tx, slug.Location, &models.Location{}, deletedLocations, &models.LocationChange{})
+		if err != nil {
+			return fmt.Errorf("purging locations: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if tournaments+leagues+locations > 0 {
+		log.Info().
+			Int64("tournaments", tournaments).
+			Int64("leagues", leagues).
+			Int64("locations", locations).
+			Msg("purged deleted records")
+	}
+
+	return nil
+}
+
+// purge deletes the records of the model with the ids the query selects, after deleting their slug histories and the
+// dependents, which refer to them by a column named after the kind, like league_id. It returns how many records it
+// deleted.
+func purge(
+	tx *gorm.DB, kind slug.Kind, model interface{}, ids *gorm.DB, dependents ...interface{},
+) (int64, error) {
+	err := tx.Where("kind = ? AND resource_id IN (?)", kind, ids).Delete(&models.SlugHistory{}).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, dependent := range dependents {
+		if err := tx.Where(string(kind)+"_id IN (?)", ids).Delete(dependent).Error; err != nil {
+			return 0, err
+		}
+	}
+	result := tx.Unscoped().Where("id IN (?)", ids).Delete(model)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,98 @@
+package purge_test
+
+import (
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/gorm"
+	"pinman/internal/app/purge"
+	"pinman/internal/utils"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestPurge(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Purge Suite")
+}
+
+var _ = ginkgo.Describe("NewPurger", func() {
+	ginkgo.It("should return a new purger", func() {
+		db, _ := utils.NewGormMock()
+		purger := purge.NewPurger(db, 30*24*time.Hour)
+		gomega.Expect(purger).ToNot(gomega.BeNil())
+		gomega.Expect(purger.DB).ToNot(gomega.BeNil())
+	})
+})
+
+var _ = ginkgo.Describe("Purger", func() {
+	var db *gorm.DB
+	var mock sqlmock.Sqlmock
+	var purger *purge.Purger
+	var before time.Time
+
+	const (
+		sqlDeletedTournaments = `SELECT "id" FROM "tournaments" WHERE deleted_at < $2`
+		sqlDeletedLeagues     = `SELECT "id" FROM "leagues" WHERE deleted_at < $2 AND id NOT IN (SELECT "league_id" FROM "tournaments")`
+		sqlDeletedLocations   = `SELECT "id" FROM "locations" WHERE deleted_at < $2 AND id NOT IN (SELECT "location_id" FROM "leagues") AND id NOT IN (SELECT "location_id" FROM "tournaments")`
+	)
+
+	ginkgo.BeforeEach(func() {
+		db, mock = utils.NewGormMock()
+		purger = purge.NewPurger(db, 30*24*time.Hour)
+		before = time.Now().Add(-30 * 24 * time.Hour)
+	})
+
+	ginkgo.When("Purge is called", func() {
+		ginkgo.It("deletes the records deleted before the time and what only exists for them", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "slug_histories" WHERE kind = $1 AND resource_id IN (`+sqlDeletedTournaments+`)`)).
+				WithArgs("tournament", before).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "tournaments" WHERE id IN (SELECT "id" FROM "tournaments" WHERE deleted_at < $1)`)).
+				WithArgs(before).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_tokens" SET "league_id"=$1,"revoked_at"=COALESCE(revoked_at, $2) WHERE league_id IN (SELECT "id" FROM "leagues" WHERE deleted_at < $3`)).
+				WithArgs(nil, utils.AnyTime{}, before).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "slug_histories" WHERE kind = $1 AND resource_id IN (`+sqlDeletedLeagues+`)`)).
+				WithArgs("league", before).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "leagues" WHERE id IN (SELECT "id" FROM "leagues" WHERE deleted_at < $1`)).
+				WithArgs(before).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "slug_histories" WHERE kind = $1 AND resource_id IN (`+sqlDeletedLocations+`)`)).
+				WithArgs("location", before).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "location_changes" WHERE location_id IN (SELECT "id" FROM "locations" WHERE deleted_at < $1`)).
+				WithArgs(before).
+				WillReturnResult(sqlmock.NewResult(0, 4))
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "locations" WHERE id IN (SELECT "id" FROM "locations" WHERE deleted_at < $1`)).
+				WithArgs(before).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			gomega.Expect(purger.Purge(before)).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+		})
+
+		ginkgo.It("rolls back and fails when a record can't be purged", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "slug_histories"`)).
+				WithArgs("tournament", before).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "tournaments"`)).
+				WithArgs(before).
+				WillReturnError(fmt.Errorf("some error"))
+			mock.ExpectRollback()
+
+			gomega.Expect(purger.Purge(before)).To(gomega.MatchError("purging tournaments: some error"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+		})
+	})
+})
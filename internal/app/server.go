@@ -1,6 +1,9 @@
 package app
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/logger"
@@ -14,7 +17,14 @@ import (
 	"pinman/internal/app/api/errors"
 	"pinman/internal/app/api/health"
 	"pinman/internal/app/api/hello"
+	"pinman/internal/app/api/metrics"
+	"pinman/internal/app/api/slug"
 	"pinman/internal/app/generated"
+	"pinman/internal/app/locationsync"
+	"pinman/internal/app/purge"
+	"pinman/internal/clients/oidc"
+	"pinman/internal/clients/pinballmap"
+	"pinman/internal/mailer"
 	"pinman/internal/utils"
 	"strings"
 )
@@ -54,6 +64,7 @@ func (s *Server) StartServer() error {
 		corsConfig.AllowHeaders,
 		[]string{
 			"Authorization",
+			auth.CSRFTokenHeader,
 		}...,
 	)
 
@@ -77,19 +88,40 @@ func (s *Server) StartServer() error {
 		return fmt.Errorf("could not initialize JWT middleware: %v", err)
 	}
 
+	pmClient, pmCache, err := s.newPinballMapClient()
+	if err != nil {
+		return fmt.Errorf("could not initialize pinball map client: %v", err)
+	}
+
+	if s.Config.LinkSigningKey == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("could not generate link signing key: %v", err)
+		}
+		s.Config.LinkSigningKey = hex.EncodeToString(key)
+		log.Warn().Msg("LINK_SIGNING_KEY is not set, links sent by email will stop working when the server restarts")
+	}
+
+	emailMailer, err := mailer.NewMailer(s.Config)
+	if err != nil {
+		return fmt.Errorf("could not initialize mailer: %v", err)
+	}
+
 	generated.RegisterHandlersWithOptions(
 		router,
-		api.NewServer(s.Db, authMiddleware),
+		api.NewServer(s.Config, s.Db, authMiddleware, pmClient, emailMailer, s.newOIDCClient()),
 		generated.GinServerOptions{
 			BaseURL: "/api",
 			Middlewares: []generated.MiddlewareFunc{
-				auth.GetAuthMiddlewareFunc(authMiddleware),
+				auth.GetAuthMiddlewareFunc(authMiddleware, s.Db),
 			},
 			ErrorHandler: nil,
 		})
 
+	router.GET("/.well-known/jwks.json", auth.GetJWKSHandlerFunc(authMiddleware))
 	router.GET("/api/health", s.Health.Get)
 	router.GET("/api/hello", s.Hello.Get)
+	router.GET("/api/metrics", metrics.NewMetrics(pmCache).Get)
 
 	// SPA ROUTE
 	// Only loaded if SPAPath is defined.
@@ -103,8 +135,14 @@ func (s *Server) StartServer() error {
 		router.Static("/app", s.Config.SPAPath)
 	}
 
+	slugs := slug.NewService(s.Db)
 	router.NoRoute(func(c *gin.Context) {
 		if strings.HasPrefix(c.Request.URL.Path, "/app") && s.Config.SPAPath != "" {
+			// shared links to pages of records that were renamed lead to their current page
+			if target, ok := slugs.AppRedirect(c.Request.URL); ok {
+				c.Redirect(http.StatusMovedPermanently, target)
+				return
+			}
 			c.File(fmt.Sprintf("%s/index.html", s.Config.SPAPath))
 			return
 		}
@@ -112,5 +150,75 @@ func (s *Server) StartServer() error {
 		errors.AbortWithError(404, "page not found", c)
 	})
 
+	if s.Config.PinballMapSyncInterval > 0 {
+		log.Info().Dur("interval", s.Config.PinballMapSyncInterval).Msg("pinball map location sync enabled")
+		syncer := locationsync.NewSyncerWithClient(
+			s.Db,
+			pinballmap.NewClientWithBaseURL(s.Config.PinballMapURL),
+			s.Config.PinballMapSyncInterval,
+		)
+		go syncer.Run(context.Background())
+	}
+
+	if s.Config.DeletedRetention > 0 {
+		log.Info().Dur("retention", s.Config.DeletedRetention).Msg("purging deleted records enabled")
+		go purge.NewPurger(s.Db, s.Config.DeletedRetention).Run(context.Background())
+	}
+
 	return router.Run()
 }
+
+// newOIDCClient returns nil if no OpenID Connect provider is configured, the login endpoints respond with 404 then.
+func (s *Server) newOIDCClient() oidc.ClientInterface {
+	if s.Config.OIDCIssuerURL == "" {
+		return nil
+	}
+
+	redirectURL := s.Config.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(s.Config.AppURL, "/") + "/app/login/oidc"
+	}
+	log.Info().Str("issuer", s.Config.OIDCIssuerURL).Str("redirectUrl", redirectURL).Msg("OpenID Connect login enabled")
+
+	return oidc.NewClient(oidc.Config{
+		IssuerURL:    s.Config.OIDCIssuerURL,
+		ClientID:     s.Config.OIDCClientID,
+		ClientSecret: s.Config.OIDCClientSecret,
+		RedirectURL:  redirectURL,
+	})
+}
+
+// newPinballMapClient returns the client used to serve API requests, wrapped in a cache unless caching is disabled.
+// The cache is also returned so its metrics can be exposed, it is nil when caching is disabled.
+func (s *Server) newPinballMapClient() (pinballmap.ClientInterface, *pinballmap.CachedClient, error) {
+	client := pinballmap.NewClientWithBaseURL(s.Config.PinballMapURL)
+	if s.Config.PinballMapURL != "" && s.Config.PinballMapURL != pinballmap.DefaultBaseURL {
+		log.Info().Str("url", s.Config.PinballMapURL).Msg("using custom pinball map url")
+	}
+	if s.Config.PinballMapCacheTTL <= 0 {
+		return client, nil, nil
+	}
+
+	var store pinballmap.CacheStore
+	switch s.Config.PinballMapCacheStore {
+	case "", "memory":
+		store = pinballmap.NewMemoryCacheStore()
+	case "postgres":
+		dbStore, err := pinballmap.NewDBCacheStore(s.Db)
+		if err != nil {
+			return nil, nil, err
+		}
+		store = dbStore
+	default:
+		return nil, nil, fmt.Errorf("unknown cache store %q", s.Config.PinballMapCacheStore)
+	}
+
+	log.Info().
+		Dur("ttl", s.Config.PinballMapCacheTTL).
+		Dur("staleTtl", s.Config.PinballMapCacheStaleTTL).
+		Str("store", s.Config.PinballMapCacheStore).
+		Msg("pinball map cache enabled")
+
+	cache := pinballmap.NewCachedClient(client, store, s.Config.PinballMapCacheTTL, s.Config.PinballMapCacheStaleTTL)
+	return cache, cache, nil
+}
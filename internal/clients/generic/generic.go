@@ -1,11 +1,19 @@
 package generic
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"reflect"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type HttpDoer interface {
@@ -32,8 +40,45 @@ func FormatRequestUrl(host string, path string, params ...*url.Values) string {
 	return r
 }
 
+// ErrCircuitOpen is returned without performing the request while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Options configures how a Client times out, retries and stops calling an upstream that is down.
+type Options struct {
+	// Timeout bounds every attempt of a request, 0 disables it.
+	Timeout time.Duration
+	// MaxRetries is how many times a request is retried after a transient failure, 0 disables retries.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry, it doubles on every following retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries. A Retry-After header asking to wait longer stops the retries.
+	MaxBackoff time.Duration
+	// BreakerThreshold is how many requests in a row must fail to open the circuit breaker, 0 disables it.
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit breaker stays open before a request is let through to probe the
+	// upstream again.
+	BreakerCooldown time.Duration
+}
+
+// DefaultOptions returns the options used by NewClient.
+func DefaultOptions() Options {
+	return Options{
+		Timeout:          10 * time.Second,
+		MaxRetries:       3,
+		InitialBackoff:   200 * time.Millisecond,
+		MaxBackoff:       5 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
 type Client struct {
 	httpClient HttpDoer
+	options    Options
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
 }
 
 type ClientInterface interface {
@@ -41,17 +86,26 @@ type ClientInterface interface {
 }
 
 func NewClient() *Client {
-	return &Client{
-		httpClient: http.DefaultClient,
-	}
+	return NewClientWithOptions(http.DefaultClient, DefaultOptions())
 }
 
+// NewClientWithHttpClient creates a client that performs every request exactly once, without a timeout.
 func NewClientWithHttpClient(httpClient HttpDoer) *Client {
+	return NewClientWithOptions(httpClient, Options{})
+}
+
+func NewClientWithOptions(httpClient HttpDoer, options Options) *Client {
 	return &Client{
-		httpClient,
+		httpClient: httpClient,
+		options:    options,
 	}
 }
 
+// Do performs the request and decodes the response body into responseObj, or into errorResponseObj when the
+// response status is 400 or above.
+//
+// The request is cancelled along with its context. Requests that fail with a network error or a 5xx response are
+// retried when their method is idempotent, requests answered with 429 are always retried.
 func (c *Client) Do(request *http.Request, responseObj any, errorResponseObj any) (int, error) {
 	// ensure that responseObj is a non-nil pointer
 	if responseObj == nil || reflect.TypeOf(responseObj).Kind() != reflect.Ptr {
@@ -67,23 +121,202 @@ func (c *Client) Do(request *http.Request, responseObj any, errorResponseObj any
 		return -1, fmt.Errorf("request must not be nil")
 	}
 
-	resp, err := c.httpClient.Do(request)
-	if err != nil {
-		return -1, fmt.Errorf("doing request: %w", err)
+	if !c.allowRequest() {
+		return -1, ErrCircuitOpen
 	}
 
-	//goland:noinspection GoUnhandledErrorResult
-	defer resp.Body.Close()
+	code, body, err := c.doWithRetries(request)
+	c.recordResult(request.Context(), code, err)
+	if err != nil {
+		return -1, err
+	}
 
-	if resp.StatusCode >= 400 {
-		if err := json.NewDecoder(resp.Body).Decode(errorResponseObj); err != nil {
+	if code >= 400 {
+		if err := json.Unmarshal(body, errorResponseObj); err != nil {
 			return -1, fmt.Errorf("decoding error response: %w", err)
 		}
 	} else {
-		if err := json.NewDecoder(resp.Body).Decode(responseObj); err != nil {
+		if err := json.Unmarshal(body, responseObj); err != nil {
 			return -1, fmt.Errorf("decoding response: %w", err)
 		}
 	}
 
-	return resp.StatusCode, nil
+	return code, nil
+}
+
+// doWithRetries performs the request until it succeeds, fails permanently or runs out of retries, returning the
+// status code and body of the last response.
+func (c *Client) doWithRetries(request *http.Request) (int, []byte, error) {
+	ctx := request.Context()
+
+	for attempt := 0; ; attempt++ {
+		code, body, retryAfter, err := c.doAttempt(request, attempt)
+
+		retryable := false
+		if err != nil {
+			retryable = ctx.Err() == nil && isIdempotent(request)
+		} else if code == http.StatusTooManyRequests {
+			retryable = true
+		} else if code >= 500 {
+			retryable = isIdempotent(request)
+		}
+
+		if !retryable || attempt >= c.options.MaxRetries || !canReplay(request) {
+			return code, body, err
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > 0 {
+			if retryAfter > c.options.MaxBackoff {
+				return code, body, err
+			}
+			delay = retryAfter
+		}
+
+		log.Debug().
+			Err(err).
+			Int("status", code).
+			Str("url", request.URL.String()).
+			Dur("delay", delay).
+			Int("attempt", attempt+1).
+			Msg("retrying request")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return -1, nil, fmt.Errorf("doing request: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// doAttempt performs a single attempt of the request and reads the whole response body, so the attempt's timeout
+// can be released before the body is decoded.
+func (c *Client) doAttempt(request *http.Request, attempt int) (int, []byte, time.Duration, error) {
+	ctx := request.Context()
+	if c.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.Timeout)
+		defer cancel()
+	}
+
+	attemptRequest := request.Clone(ctx)
+	if attempt > 0 && request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return -1, nil, 0, fmt.Errorf("rewinding request body: %w", err)
+		}
+		attemptRequest.Body = body
+	}
+
+	resp, err := c.httpClient.Do(attemptRequest)
+	if err != nil {
+		return -1, nil, 0, fmt.Errorf("doing request: %w", err)
+	}
+
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return -1, nil, 0, fmt.Errorf("reading response: %w", err)
+	}
+
+	return resp.StatusCode, body, parseRetryAfter(resp.Header.Get("Retry-After")), nil
+}
+
+// backoff returns the delay before the given retry, doubling from InitialBackoff up to MaxBackoff. Up to half of the
+// delay is randomized so clients that failed together do not retry together.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.options.InitialBackoff << attempt
+	if delay <= 0 || (c.options.MaxBackoff > 0 && delay > c.options.MaxBackoff) {
+		delay = c.options.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// allowRequest reports whether the circuit breaker lets a request through. Once the cooldown has passed a single
+// request is let through, the breaker closes again if it succeeds.
+func (c *Client) allowRequest() bool {
+	if c.options.BreakerThreshold <= 0 {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.consecutiveFailures < c.options.BreakerThreshold {
+		return true
+	}
+
+	now := time.Now()
+	if now.Before(c.openUntil) {
+		return false
+	}
+
+	// half-open, keep the breaker open for other requests while this one probes the upstream
+	c.openUntil = now.Add(c.options.BreakerCooldown)
+	return true
+}
+
+// recordResult updates the circuit breaker with the outcome of a request. Network errors and 5xx responses count as
+// failures, requests cancelled by the caller do not count either way.
+func (c *Client) recordResult(ctx context.Context, code int, err error) {
+	if c.options.BreakerThreshold <= 0 || (err != nil && ctx.Err() != nil) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil && code < 500 {
+		c.consecutiveFailures = 0
+		return
+	}
+
+	c.consecutiveFailures++
+	if c.consecutiveFailures == c.options.BreakerThreshold {
+		log.Warn().Int("failures", c.consecutiveFailures).Msg("circuit breaker opened")
+	}
+	if c.consecutiveFailures >= c.options.BreakerThreshold {
+		c.openUntil = time.Now().Add(c.options.BreakerCooldown)
+	}
+}
+
+func isIdempotent(request *http.Request) bool {
+	switch request.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// canReplay reports whether the request can be sent again, which requires its body to be rewindable.
+func canReplay(request *http.Request) bool {
+	return request.Body == nil || request.Body == http.NoBody || request.GetBody != nil
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
 }
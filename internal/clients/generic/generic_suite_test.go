@@ -2,12 +2,18 @@ package generic_test
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/mock"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"pinman/internal/clients/generic"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
@@ -203,4 +209,211 @@ var _ = ginkgo.Describe("Client", func() {
 			})
 		})
 	})
+
+	ginkgo.Describe("Do with options", func() {
+		var mockHttpClient *generic.MockHttpDoer
+		var options generic.Options
+		type Response struct {
+			Foo string `json:"foo"`
+		}
+
+		var response = func(code int, body string, headers ...string) *http.Response {
+			header := http.Header{}
+			for i := 0; i+1 < len(headers); i += 2 {
+				header.Set(headers[i], headers[i+1])
+			}
+			return &http.Response{
+				StatusCode: code,
+				Header:     header,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}
+		}
+
+		ginkgo.BeforeEach(func() {
+			mockHttpClient = generic.NewMockHttpDoer(ginkgo.GinkgoT())
+			options = generic.Options{
+				MaxRetries:     2,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     10 * time.Millisecond,
+			}
+		})
+
+		ginkgo.When("an idempotent request gets a 5xx response", func() {
+			ginkgo.It("retries until it succeeds", func() {
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusBadGateway, `{"foo":"error"}`), nil).Once()
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusOK, `{"foo":"bar"}`), nil).Once()
+
+				client := generic.NewClientWithOptions(mockHttpClient, options)
+				var resp Response
+				var errorResponse Response
+				code, err := client.Do(httptest.NewRequest(http.MethodGet, "/", nil), &resp, &errorResponse)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(resp.Foo).To(gomega.Equal("bar"))
+			})
+
+			ginkgo.It("returns the last response once retries are exhausted", func() {
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusServiceUnavailable, `{"foo":"first"}`), nil).Once()
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusServiceUnavailable, `{"foo":"second"}`), nil).Once()
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusServiceUnavailable, `{"foo":"third"}`), nil).Once()
+
+				client := generic.NewClientWithOptions(mockHttpClient, options)
+				var resp Response
+				var errorResponse Response
+				code, err := client.Do(httptest.NewRequest(http.MethodGet, "/", nil), &resp, &errorResponse)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(code).To(gomega.Equal(http.StatusServiceUnavailable))
+				gomega.Expect(errorResponse.Foo).To(gomega.Equal("third"))
+			})
+		})
+
+		ginkgo.When("a non-idempotent request gets a 5xx response", func() {
+			ginkgo.It("does not retry", func() {
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusInternalServerError, `{"foo":"error"}`), nil).Once()
+
+				client := generic.NewClientWithOptions(mockHttpClient, options)
+				var resp Response
+				var errorResponse Response
+				code, err := client.Do(httptest.NewRequest(http.MethodPost, "/", nil), &resp, &errorResponse)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(code).To(gomega.Equal(http.StatusInternalServerError))
+				mockHttpClient.AssertNumberOfCalls(ginkgo.GinkgoT(), "Do", 1)
+			})
+		})
+
+		ginkgo.When("a request gets a 429 response", func() {
+			ginkgo.It("waits for Retry-After before retrying", func() {
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusTooManyRequests, `{}`, "Retry-After", "1"), nil).Once()
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusOK, `{"foo":"bar"}`), nil).Once()
+
+				options.MaxBackoff = 2 * time.Second
+				client := generic.NewClientWithOptions(mockHttpClient, options)
+				var resp Response
+				var errorResponse Response
+				start := time.Now()
+				code, err := client.Do(httptest.NewRequest(http.MethodPost, "/", nil), &resp, &errorResponse)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(time.Since(start)).To(gomega.BeNumerically(">=", time.Second))
+			})
+
+			ginkgo.It("gives up when Retry-After is longer than the maximum backoff", func() {
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusTooManyRequests, `{"foo":"slow down"}`, "Retry-After", "60"), nil).Once()
+
+				client := generic.NewClientWithOptions(mockHttpClient, options)
+				var resp Response
+				var errorResponse Response
+				code, err := client.Do(httptest.NewRequest(http.MethodGet, "/", nil), &resp, &errorResponse)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(code).To(gomega.Equal(http.StatusTooManyRequests))
+				gomega.Expect(errorResponse.Foo).To(gomega.Equal("slow down"))
+			})
+		})
+
+		ginkgo.When("the request context is cancelled while waiting to retry", func() {
+			ginkgo.It("returns the context error", func() {
+				mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).
+					Return(response(http.StatusServiceUnavailable, `{}`), nil).Once()
+
+				options.InitialBackoff = time.Minute
+				options.MaxBackoff = time.Minute
+				client := generic.NewClientWithOptions(mockHttpClient, options)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+				var resp Response
+				var errorResponse Response
+				_, err := client.Do(request, &resp, &errorResponse)
+
+				gomega.Expect(err).To(gomega.MatchError(context.DeadlineExceeded))
+			})
+		})
+
+		ginkgo.When("an attempt takes longer than the timeout", func() {
+			ginkgo.It("cancels the attempt", func() {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(time.Second):
+					}
+				}))
+				defer server.Close()
+
+				client := generic.NewClientWithOptions(server.Client(), generic.Options{Timeout: 10 * time.Millisecond})
+				request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+				gomega.Expect(err).To(gomega.BeNil())
+
+				var resp Response
+				var errorResponse Response
+				_, err = client.Do(request, &resp, &errorResponse)
+
+				gomega.Expect(err).To(gomega.MatchError(context.DeadlineExceeded))
+			})
+		})
+
+		ginkgo.When("an upstream keeps failing", func() {
+			ginkgo.It("opens the circuit breaker and probes the upstream after the cooldown", func() {
+				var calls atomic.Int32
+				var healthy atomic.Bool
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					calls.Add(1)
+					if !healthy.Load() {
+						w.WriteHeader(http.StatusInternalServerError)
+					}
+					_, _ = fmt.Fprint(w, `{"foo":"bar"}`)
+				}))
+				defer server.Close()
+
+				client := generic.NewClientWithOptions(server.Client(), generic.Options{
+					BreakerThreshold: 2,
+					BreakerCooldown:  50 * time.Millisecond,
+				})
+				do := func() (int, error) {
+					request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+					gomega.Expect(err).To(gomega.BeNil())
+					var resp Response
+					var errorResponse Response
+					return client.Do(request, &resp, &errorResponse)
+				}
+
+				for i := 0; i < 2; i++ {
+					code, err := do()
+					gomega.Expect(err).To(gomega.BeNil())
+					gomega.Expect(code).To(gomega.Equal(http.StatusInternalServerError))
+				}
+
+				_, err := do()
+				gomega.Expect(err).To(gomega.MatchError(generic.ErrCircuitOpen))
+				gomega.Expect(calls.Load()).To(gomega.Equal(int32(2)))
+
+				healthy.Store(true)
+				time.Sleep(60 * time.Millisecond)
+
+				code, err := do()
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(code).To(gomega.Equal(http.StatusOK))
+
+				code, err = do()
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(calls.Load()).To(gomega.Equal(int32(4)))
+			})
+		})
+	})
 })
@@ -0,0 +1,364 @@
+// Package oidc implements the authorization code flow of OpenID Connect against any standards-compliant provider.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"net/http"
+	"net/url"
+	"pinman/internal/clients/generic"
+	"strings"
+	"sync"
+)
+
+// Scopes are requested from the provider, "email" and "profile" provide the claims needed to link accounts.
+const Scopes = "openid email profile"
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrUnknownKey     = errors.New("ID token was signed with an unknown key")
+)
+
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the user back to with the authorization code
+	RedirectURL string
+}
+
+// Claims identify the user that logged in at the provider.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type ClientInterface interface {
+	// Issuer returns the issuer identifier of the provider, which together with the subject identifies a user.
+	Issuer() string
+	// AuthCodeURL returns the URL of the provider's login page.
+	AuthCodeURL(ctx context.Context, state string, nonce string) (string, error)
+	// Authenticate exchanges the authorization code for an ID token and returns its verified claims.
+	Authenticate(ctx context.Context, code string, nonce string) (*Claims, error)
+}
+
+type Client struct {
+	config        Config
+	genericClient generic.ClientInterface
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]interface{}
+}
+
+func NewClient(config Config) *Client {
+	return NewClientWithGenericClient(config, generic.NewClient())
+}
+
+func NewClientWithGenericClient(config Config, genericClient generic.ClientInterface) *Client {
+	return &Client{
+		config:        config,
+		genericClient: genericClient,
+	}
+}
+
+// Discovery is the part of the provider metadata needed for the authorization code flow.
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+func (c *Client) Issuer() string {
+	return strings.TrimSuffix(c.config.IssuerURL, "/")
+}
+
+func (c *Client) AuthCodeURL(ctx context.Context, state string, nonce string) (string, error) {
+	discovery, err := c.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.config.ClientID)
+	params.Set("redirect_uri", c.config.RedirectURL)
+	params.Set("scope", Scopes)
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+func (c *Client) Authenticate(ctx context.Context, code string, nonce string) (*Claims, error) {
+	discovery, err := c.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.config.RedirectURL)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("preparing request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+
+	var response TokenResponse
+	var errorResponse ErrorResponse
+	statusCode, err := c.genericClient.Do(req, &response, &errorResponse)
+	if err != nil {
+		return nil, fmt.Errorf("performing request: %w", err)
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with error: %s %s", errorResponse.Error, errorResponse.ErrorDescription)
+	}
+
+	return c.verifyIDToken(ctx, discovery, response.IDToken, nonce)
+}
+
+func (c *Client) verifyIDToken(ctx context.Context, discovery *Discovery, rawIDToken string, nonce string) (*Claims, error) {
+	claims := &idTokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.getKey(ctx, discovery, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Issuer != discovery.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidIDToken, claims.Issuer)
+	}
+	if !claims.VerifyAudience(c.config.ClientID, true) {
+		return nil, fmt.Errorf("%w: token was issued for another client", ErrInvalidIDToken)
+	}
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: token does not expire", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: subject is missing", ErrInvalidIDToken)
+	}
+
+	return &Claims{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// getDiscovery fetches the provider metadata on first use, so the server starts even if the provider is down.
+func (c *Client) getDiscovery(ctx context.Context) (*Discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", generic.FormatRequestUrl(c.Issuer(), "/.well-known/openid-configuration"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("preparing request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	var discovery Discovery
+	var errorResponse ErrorResponse
+	statusCode, err := c.genericClient.Do(req, &discovery, &errorResponse)
+	if err != nil {
+		return nil, fmt.Errorf("performing request: %w", err)
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery failed with status %d", statusCode)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != c.Issuer() {
+		return nil, fmt.Errorf("discovery returned issuer %s instead of %s", discovery.Issuer, c.Issuer())
+	}
+
+	c.discovery = &discovery
+	return c.discovery, nil
+}
+
+// getKey returns the verification key with the given key id, refetching the key set once when it is unknown as the
+// provider may have rotated its keys.
+func (c *Client) getKey(ctx context.Context, discovery *Discovery, kid string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.findKey(kid); ok {
+		return key, nil
+	}
+
+	keys, err := c.fetchKeys(ctx, discovery)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+
+	if key, ok := c.findKey(kid); ok {
+		return key, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (c *Client) findKey(kid string) (interface{}, bool) {
+	// tokens without a key id can only be verified if the provider has a single key
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+func (c *Client) fetchKeys(ctx context.Context, discovery *Discovery) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", discovery.JwksURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("preparing request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	var keySet JSONWebKeySet
+	var errorResponse ErrorResponse
+	statusCode, err := c.genericClient.Do(req, &keySet, &errorResponse)
+	if err != nil {
+		return nil, fmt.Errorf("performing request: %w", err)
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching keys failed with status %d", statusCode)
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// providers may publish keys of types we don't support, they just can't be used
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// PublicKey decodes an RSA or EC public key.
+func (k *JSONWebKey) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
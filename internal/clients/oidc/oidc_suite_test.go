@@ -0,0 +1,152 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pinman/internal/clients/generic"
+	"pinman/internal/clients/oidc"
+	"pinman/internal/clients/oidc/testidp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestOIDC(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "OIDC Suite")
+}
+
+var _ = ginkgo.Describe("Client", func() {
+	const redirectURL = "http://localhost:8080/app/login/oidc"
+	var server *httptest.Server
+	var provider *testidp.Provider
+	var client *oidc.Client
+
+	// authorize follows the provider's login page like a browser would and returns the authorization code
+	var authorize = func(state string, nonce string) string {
+		authURL, err := client.AuthCodeURL(context.Background(), state, nonce)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := browser.Get(authURL)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusFound))
+
+		location, err := url.Parse(resp.Header.Get("Location"))
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(location.Query().Get("state")).To(gomega.Equal(state))
+		return location.Query().Get("code")
+	}
+
+	ginkgo.BeforeEach(func() {
+		gin.SetMode(gin.TestMode)
+		var err error
+		provider, err = testidp.NewProvider("", "pinman", "secret", testidp.User{
+			Subject:       "1234",
+			Email:         "player@example.com",
+			EmailVerified: true,
+			Name:          "Test Player",
+		})
+		gomega.Expect(err).To(gomega.BeNil())
+
+		server = httptest.NewServer(provider.NewRouter())
+		provider.Issuer = server.URL
+
+		client = oidc.NewClientWithGenericClient(oidc.Config{
+			IssuerURL:    server.URL,
+			ClientID:     "pinman",
+			ClientSecret: "secret",
+			RedirectURL:  redirectURL,
+		}, generic.NewClientWithHttpClient(http.DefaultClient))
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	ginkgo.When("the user logs in at the provider", func() {
+		ginkgo.It("returns the verified claims of the user", func() {
+			code := authorize("a-state", "a-nonce")
+
+			claims, err := client.Authenticate(context.Background(), code, "a-nonce")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(claims).To(gomega.Equal(&oidc.Claims{
+				Subject:       "1234",
+				Email:         "player@example.com",
+				EmailVerified: true,
+				Name:          "Test Player",
+			}))
+		})
+
+		ginkgo.It("fails if the nonce does not match", func() {
+			code := authorize("a-state", "a-nonce")
+
+			_, err := client.Authenticate(context.Background(), code, "another-nonce")
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring(oidc.ErrInvalidIDToken.Error())))
+		})
+
+		ginkgo.It("fails if the code is used twice", func() {
+			code := authorize("a-state", "a-nonce")
+
+			_, err := client.Authenticate(context.Background(), code, "a-nonce")
+			gomega.Expect(err).To(gomega.BeNil())
+			_, err = client.Authenticate(context.Background(), code, "a-nonce")
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.When("the client secret is wrong", func() {
+		ginkgo.It("fails to authenticate", func() {
+			code := authorize("a-state", "a-nonce")
+
+			client = oidc.NewClientWithGenericClient(oidc.Config{
+				IssuerURL:    server.URL,
+				ClientID:     "pinman",
+				ClientSecret: "wrong",
+				RedirectURL:  redirectURL,
+			}, generic.NewClientWithHttpClient(http.DefaultClient))
+
+			_, err := client.Authenticate(context.Background(), code, "a-nonce")
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("invalid_client")))
+		})
+	})
+
+	ginkgo.When("the ID token was signed by another provider", func() {
+		ginkgo.It("fails to verify it", func() {
+			other, err := testidp.NewProvider(server.URL, "pinman", "secret", provider.User)
+			gomega.Expect(err).To(gomega.BeNil())
+			forged, err := other.IDToken(provider.User, "a-nonce")
+			gomega.Expect(err).To(gomega.BeNil())
+
+			// serve the forged token from the real provider's token endpoint
+			router := provider.NewRouter()
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/token" {
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(oidc.TokenResponse{IDToken: forged})
+					return
+				}
+				router.ServeHTTP(w, r)
+			})
+
+			_, err = client.Authenticate(context.Background(), "any-code", "a-nonce")
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring(oidc.ErrInvalidIDToken.Error())))
+		})
+	})
+
+	ginkgo.When("the discovery document names another issuer", func() {
+		ginkgo.It("fails", func() {
+			provider.Issuer = "https://evil.example.com"
+
+			_, err := client.AuthCodeURL(context.Background(), "a-state", "a-nonce")
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,186 @@
+// Package testidp is a minimal OpenID Connect provider for development and tests. It doesn't ask for credentials:
+// its authorization endpoint immediately sends the user back with a code for the configured user, or for the email
+// passed as login_hint.
+package testidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"net/http"
+	"net/url"
+	"pinman/internal/clients/oidc"
+	"pinman/internal/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const keyID = "testidp"
+
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type Provider struct {
+	// Issuer must be the URL the provider is served at
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	User         User
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	redirectURI string
+	nonce       string
+	user        User
+}
+
+// NewProvider creates a provider with a freshly generated signing key.
+func NewProvider(issuer string, clientID string, clientSecret string, user User) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generating signing key: %w", err)
+	}
+
+	return &Provider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		User:         user,
+		key:          key,
+		codes:        map[string]authorization{},
+	}, nil
+}
+
+// NewRouter returns a router serving the discovery, authorization, token and key set endpoints of the provider.
+func (p *Provider) NewRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	router.GET("/.well-known/openid-configuration", func(c *gin.Context) {
+		c.JSON(http.StatusOK, oidc.Discovery{
+			Issuer:                p.Issuer,
+			AuthorizationEndpoint: p.Issuer + "/authorize",
+			TokenEndpoint:         p.Issuer + "/token",
+			JwksURI:               p.Issuer + "/jwks",
+		})
+	})
+
+	router.GET("/jwks", func(c *gin.Context) {
+		c.JSON(http.StatusOK, oidc.JSONWebKeySet{
+			Keys: []oidc.JSONWebKey{{
+				Kty: "RSA",
+				Kid: keyID,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	})
+
+	router.GET("/authorize", func(c *gin.Context) {
+		redirectURI, err := url.Parse(c.Query("redirect_uri"))
+		if err != nil || c.Query("redirect_uri") == "" {
+			c.String(http.StatusBadRequest, "invalid redirect_uri")
+			return
+		}
+		if c.Query("client_id") != p.ClientID || c.Query("response_type") != "code" {
+			c.String(http.StatusBadRequest, "unknown client_id or unsupported response_type")
+			return
+		}
+
+		user := p.User
+		if hint := c.Query("login_hint"); hint != "" {
+			user = User{Subject: hint, Email: hint, EmailVerified: true, Name: hint}
+		}
+
+		code, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		p.mu.Lock()
+		p.codes[code] = authorization{
+			redirectURI: redirectURI.String(),
+			nonce:       c.Query("nonce"),
+			user:        user,
+		}
+		p.mu.Unlock()
+
+		query := redirectURI.Query()
+		query.Set("code", code)
+		query.Set("state", c.Query("state"))
+		redirectURI.RawQuery = query.Encode()
+		c.Redirect(http.StatusFound, redirectURI.String())
+	})
+
+	router.POST("/token", func(c *gin.Context) {
+		clientID, clientSecret, ok := c.Request.BasicAuth()
+		if !ok {
+			clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+		}
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		if clientID != p.ClientID || clientSecret != p.ClientSecret {
+			c.JSON(http.StatusUnauthorized, oidc.ErrorResponse{Error: "invalid_client"})
+			return
+		}
+
+		// codes can only be used once
+		p.mu.Lock()
+		auth, ok := p.codes[c.PostForm("code")]
+		delete(p.codes, c.PostForm("code"))
+		p.mu.Unlock()
+
+		if !ok || c.PostForm("grant_type") != "authorization_code" || c.PostForm("redirect_uri") != auth.redirectURI {
+			c.JSON(http.StatusBadRequest, oidc.ErrorResponse{Error: "invalid_grant"})
+			return
+		}
+
+		idToken, err := p.IDToken(auth.user, auth.nonce)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, oidc.ErrorResponse{Error: "server_error", ErrorDescription: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, oidc.TokenResponse{
+			AccessToken: c.PostForm("code"),
+			TokenType:   "Bearer",
+			IDToken:     idToken,
+		})
+	})
+
+	return router
+}
+
+// IDToken signs an ID token for the user, as returned by the token endpoint.
+func (p *Provider) IDToken(user User, nonce string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.Issuer,
+		"sub":            user.Subject,
+		"aud":            p.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+	})
+	token.Header["kid"] = keyID
+
+	return token.SignedString(p.key)
+}
@@ -0,0 +1,228 @@
+package pinballmap
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCacheMiss is returned by a CacheStore when it has no entry for the requested key.
+var ErrCacheMiss = errors.New("cache miss")
+
+type CacheEntry struct {
+	Value    []byte
+	StoredAt time.Time
+}
+
+// CacheStore persists responses cached by CachedClient.
+type CacheStore interface {
+	Get(key string) (*CacheEntry, error)
+	Set(key string, entry CacheEntry) error
+}
+
+type CacheMetrics struct {
+	Hits      uint64 `json:"hits"`
+	StaleHits uint64 `json:"stale_hits"`
+	Misses    uint64 `json:"misses"`
+	Errors    uint64 `json:"errors"`
+}
+
+// CachedClient decorates a ClientInterface, caching its responses in a CacheStore.
+//
+// Entries younger than ttl are served from the cache. Entries older than ttl but younger than ttl + staleTTL are
+// served from the cache while they are refreshed in the background. Older entries are refreshed before responding,
+// unless the upstream request fails, in which case the expired entry is served rather than failing the lookup.
+type CachedClient struct {
+	client   ClientInterface
+	store    CacheStore
+	ttl      time.Duration
+	staleTTL time.Duration
+
+	revalidating sync.Map
+
+	hits      atomic.Uint64
+	staleHits atomic.Uint64
+	misses    atomic.Uint64
+	errors    atomic.Uint64
+}
+
+func NewCachedClient(client ClientInterface, store CacheStore, ttl time.Duration, staleTTL time.Duration) *CachedClient {
+	return &CachedClient{
+		client:   client,
+		store:    store,
+		ttl:      ttl,
+		staleTTL: staleTTL,
+	}
+}
+
+// Metrics returns a snapshot of the cache's hit and miss counters.
+func (c *CachedClient) Metrics() CacheMetrics {
+	return CacheMetrics{
+		Hits:      c.hits.Load(),
+		StaleHits: c.staleHits.Load(),
+		Misses:    c.misses.Load(),
+		Errors:    c.errors.Load(),
+	}
+}
+
+func (c *CachedClient) GetLocations(ctx context.Context, nameFilter string) ([]Location, error) {
+	var locations []Location
+	err := c.get(ctx, fmt.Sprintf("locations:%s", nameFilter), &locations, func(ctx context.Context) (any, error) {
+		return c.client.GetLocations(ctx, nameFilter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+func (c *CachedClient) GetLocation(ctx context.Context, id int) (*Location, error) {
+	var location *Location
+	err := c.get(ctx, fmt.Sprintf("location:%d", id), &location, func(ctx context.Context) (any, error) {
+		return c.client.GetLocation(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// get populates result with the cached value for key, calling fetch to refresh the cache when needed.
+func (c *CachedClient) get(ctx context.Context, key string, result any, fetch func(ctx context.Context) (any, error)) error {
+	entry, err := c.store.Get(key)
+	if err != nil && !errors.Is(err, ErrCacheMiss) {
+		log.Error().Err(err).Str("key", key).Msg("failed to read pinball map cache")
+	}
+
+	if entry != nil {
+		age := time.Since(entry.StoredAt)
+		if age < c.ttl {
+			c.hits.Add(1)
+			return json.Unmarshal(entry.Value, result)
+		}
+		if age < c.ttl+c.staleTTL {
+			c.staleHits.Add(1)
+			c.revalidate(key, fetch)
+			return json.Unmarshal(entry.Value, result)
+		}
+	}
+
+	c.misses.Add(1)
+	value, err := c.refresh(ctx, key, fetch)
+	if err != nil {
+		if entry != nil && !errors.Is(err, ErrNotFound) {
+			log.Warn().Err(err).Str("key", key).Msg("pinball map request failed, serving expired cache entry")
+			return json.Unmarshal(entry.Value, result)
+		}
+		return err
+	}
+
+	return json.Unmarshal(value, result)
+}
+
+// refresh calls fetch and stores its result under key.
+func (c *CachedClient) refresh(ctx context.Context, key string, fetch func(ctx context.Context) (any, error)) ([]byte, error) {
+	response, err := fetch(ctx)
+	if err != nil {
+		c.errors.Add(1)
+		return nil, err
+	}
+
+	value, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("encoding cache entry: %w", err)
+	}
+
+	if err := c.store.Set(key, CacheEntry{Value: value, StoredAt: time.Now()}); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("failed to write pinball map cache")
+	}
+
+	return value, nil
+}
+
+// revalidate refreshes key in the background, unless a refresh of key is already in progress. The refresh does not use
+// the context of the lookup that triggered it, as that lookup returns without waiting for it.
+func (c *CachedClient) revalidate(key string, fetch func(ctx context.Context) (any, error)) {
+	if _, inProgress := c.revalidating.LoadOrStore(key, struct{}{}); inProgress {
+		return
+	}
+
+	go func() {
+		defer c.revalidating.Delete(key)
+		if _, err := c.refresh(context.Background(), key, fetch); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("failed to revalidate pinball map cache entry")
+		}
+	}()
+}
+
+// DefaultMemoryCacheSize is how many entries a MemoryCacheStore keeps unless another size is given.
+const DefaultMemoryCacheSize = 1000
+
+// MemoryCacheStore is a CacheStore that keeps entries in memory, they are lost when the server restarts. Once it
+// holds size entries, the least recently used entry is evicted to make room for a new one, as the keys include the
+// search terms of users.
+type MemoryCacheStore struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	// recent orders the entries from the most to the least recently used
+	recent *list.List
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry CacheEntry
+}
+
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return NewMemoryCacheStoreWithSize(DefaultMemoryCacheSize)
+}
+
+func NewMemoryCacheStoreWithSize(size int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		size:    size,
+		entries: map[string]*list.Element{},
+		recent:  list.New(),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	s.recent.MoveToFront(element)
+
+	entry := element.Value.(*memoryCacheItem).entry
+	return &entry, nil
+}
+
+func (s *MemoryCacheStore) Set(key string, entry CacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		element.Value.(*memoryCacheItem).entry = entry
+		s.recent.MoveToFront(element)
+		return nil
+	}
+
+	s.entries[key] = s.recent.PushFront(&memoryCacheItem{key: key, entry: entry})
+	for s.recent.Len() > s.size {
+		oldest := s.recent.Back()
+		s.recent.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
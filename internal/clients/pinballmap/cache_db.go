@@ -0,0 +1,65 @@
+package pinballmap
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type cacheRecord struct {
+	Key      string    `gorm:"type:varchar(255);primaryKey"`
+	Value    []byte    `gorm:"type:bytea;not null"`
+	StoredAt time.Time `gorm:"not null"`
+}
+
+func (cacheRecord) TableName() string {
+	return "pinball_map_cache"
+}
+
+// DBCacheStore is a CacheStore that keeps entries in the database, so they survive server restarts and are shared
+// between instances.
+type DBCacheStore struct {
+	DB *gorm.DB
+}
+
+// NewDBCacheStore creates a DBCacheStore, creating its table if it does not exist yet.
+func NewDBCacheStore(db *gorm.DB) (*DBCacheStore, error) {
+	if err := db.AutoMigrate(&cacheRecord{}); err != nil {
+		return nil, fmt.Errorf("migrating cache table: %w", err)
+	}
+
+	return &DBCacheStore{
+		DB: db,
+	}, nil
+}
+
+func (s *DBCacheStore) Get(key string) (*CacheEntry, error) {
+	record := &cacheRecord{}
+	if err := s.DB.First(record, "key = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCacheMiss
+		}
+		return nil, fmt.Errorf("reading cache entry: %w", err)
+	}
+
+	return &CacheEntry{
+		Value:    record.Value,
+		StoredAt: record.StoredAt,
+	}, nil
+}
+
+func (s *DBCacheStore) Set(key string, entry CacheEntry) error {
+	record := &cacheRecord{
+		Key:      key,
+		Value:    entry.Value,
+		StoredAt: entry.StoredAt,
+	}
+
+	if err := s.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(record).Error; err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+
+	return nil
+}
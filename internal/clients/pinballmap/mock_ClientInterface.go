@@ -2,32 +2,36 @@
 
 package pinballmap
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // MockClientInterface is an autogenerated mock type for the ClientInterface type
 type MockClientInterface struct {
 	mock.Mock
 }
 
-// GetLocation provides a mock function with given fields: id
-func (_m *MockClientInterface) GetLocation(id int) (*Location, error) {
-	ret := _m.Called(id)
+// GetLocation provides a mock function with given fields: ctx, id
+func (_m *MockClientInterface) GetLocation(ctx context.Context, id int) (*Location, error) {
+	ret := _m.Called(ctx, id)
 
 	var r0 *Location
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int) (*Location, error)); ok {
-		return rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int) (*Location, error)); ok {
+		return rf(ctx, id)
 	}
-	if rf, ok := ret.Get(0).(func(int) *Location); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int) *Location); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*Location)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -35,25 +39,25 @@ func (_m *MockClientInterface) GetLocation(id int) (*Location, error) {
 	return r0, r1
 }
 
-// GetLocations provides a mock function with given fields: nameFilter
-func (_m *MockClientInterface) GetLocations(nameFilter string) ([]Location, error) {
-	ret := _m.Called(nameFilter)
+// GetLocations provides a mock function with given fields: ctx, nameFilter
+func (_m *MockClientInterface) GetLocations(ctx context.Context, nameFilter string) ([]Location, error) {
+	ret := _m.Called(ctx, nameFilter)
 
 	var r0 []Location
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) ([]Location, error)); ok {
-		return rf(nameFilter)
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]Location, error)); ok {
+		return rf(ctx, nameFilter)
 	}
-	if rf, ok := ret.Get(0).(func(string) []Location); ok {
-		r0 = rf(nameFilter)
+	if rf, ok := ret.Get(0).(func(context.Context, string) []Location); ok {
+		r0 = rf(ctx, nameFilter)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]Location)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(nameFilter)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, nameFilter)
 	} else {
 		r1 = ret.Error(1)
 	}
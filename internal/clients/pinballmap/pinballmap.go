@@ -1,6 +1,8 @@
 package pinballmap
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"net/http"
@@ -8,7 +10,12 @@ import (
 	"pinman/internal/clients/generic"
 )
 
-const apiHost = "https://pinballmap.com"
+// DefaultBaseURL is the public Pinball Map API, used unless another base URL is configured.
+const DefaultBaseURL = "https://pinballmap.com"
+
+// ErrNotFound is returned when Pinball Map does not know about the requested resource,
+// which is how it reports venues that have been deleted or closed.
+var ErrNotFound = errors.New("not found")
 
 type Client struct {
 	apiHost       string
@@ -16,20 +23,30 @@ type Client struct {
 }
 
 type ClientInterface interface {
-	GetLocations(nameFilter string) ([]Location, error)
-	GetLocation(id int) (*Location, error)
+	GetLocations(ctx context.Context, nameFilter string) ([]Location, error)
+	GetLocation(ctx context.Context, id int) (*Location, error)
 }
 
 func NewClient() *Client {
+	return NewClientWithBaseURL(DefaultBaseURL)
+}
+
+// NewClientWithBaseURL creates a client for the Pinball Map API served at baseURL, falling back to DefaultBaseURL
+// when baseURL is empty.
+func NewClientWithBaseURL(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
 	return &Client{
-		apiHost:       apiHost,
+		apiHost:       baseURL,
 		genericClient: generic.NewClient(),
 	}
 }
 
 func NewClientWithGenericClient(genericClient generic.ClientInterface) *Client {
 	return &Client{
-		apiHost:       apiHost,
+		apiHost:       DefaultBaseURL,
 		genericClient: genericClient,
 	}
 }
@@ -42,6 +59,13 @@ type Location struct {
 	State       string `json:"state"`
 	Country     string `json:"country"`
 	NumMachines int    `json:"num_machines"`
+	// MachineNames is only populated by GetLocation, GetLocations does not request location details.
+	MachineNames []string `json:"machine_names"`
+}
+
+// Address formats the location's street address as a single line.
+func (l *Location) Address() string {
+	return fmt.Sprintf("%s, %s, %s, %s", l.Street, l.City, l.State, l.Country)
 }
 
 type LocationsResponse struct {
@@ -54,12 +78,12 @@ type ErrorResponse struct {
 
 // GetLocations retrieves all locations from the Pinball Map API matching the given name filter.
 // https://pinballmap.com/api/v1/docs/1.0/locations/index.html
-func (c *Client) GetLocations(nameFilter string) ([]Location, error) {
+func (c *Client) GetLocations(ctx context.Context, nameFilter string) ([]Location, error) {
 	params := &url.Values{}
 	params.Add("by_location_name", nameFilter)
 	params.Add("no_details", "true")
 
-	req, err := http.NewRequest("GET", generic.FormatRequestUrl(c.apiHost, "/api/v1/locations.json", params), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", generic.FormatRequestUrl(c.apiHost, "/api/v1/locations.json", params), nil)
 	if err != nil {
 		return nil, fmt.Errorf("preparing request: %w", err)
 	}
@@ -81,8 +105,12 @@ func (c *Client) GetLocations(nameFilter string) ([]Location, error) {
 	return response.Locations, nil
 }
 
-func (c *Client) GetLocation(id int) (*Location, error) {
-	req, err := http.NewRequest(
+// GetLocation retrieves a single location, including its machine list, from the Pinball Map API.
+// Returns an error wrapping ErrNotFound if the location no longer exists.
+// https://pinballmap.com/api/v1/docs/1.0/locations/show.html
+func (c *Client) GetLocation(ctx context.Context, id int) (*Location, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"GET",
 		generic.FormatRequestUrl(c.apiHost, fmt.Sprintf("/api/v1/locations/%d.json", id)),
 		nil,
@@ -101,6 +129,10 @@ func (c *Client) GetLocation(id int) (*Location, error) {
 		return nil, fmt.Errorf("performing request: %w", err)
 	}
 
+	if code == http.StatusNotFound {
+		return nil, fmt.Errorf("location %d %w: %s", id, ErrNotFound, errorResponse.Errors)
+	}
+
 	if code != http.StatusOK {
 		return nil, fmt.Errorf("request failed with error: %s", errorResponse.Errors)
 	}
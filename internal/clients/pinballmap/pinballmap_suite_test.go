@@ -1,16 +1,23 @@
 package pinballmap_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
 	"github.com/stretchr/testify/mock"
 	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
 	"net/http"
 	"pinman/internal/clients/generic"
 	"pinman/internal/clients/pinballmap"
+	"pinman/internal/utils"
 	"reflect"
+	"regexp"
 	"testing"
+	"time"
 )
 
 func TestPinballMap(t *testing.T) {
@@ -37,7 +44,7 @@ var _ = ginkgo.Describe("Client", func() {
 		ginkgo.Context("using the live API with 'north star' filter", func() {
 			ginkgo.It("should return a list of locations that contains at least an entry for 'North Star Machines à Piastres'", func() {
 				client := pinballmap.NewClient()
-				locations, err := client.GetLocations("north star")
+				locations, err := client.GetLocations(context.Background(), "north star")
 				gomega.Expect(err).To(gomega.BeNil())
 				gomega.Expect(locations).ToNot(gomega.BeNil())
 				gomega.Expect(len(locations)).To(gomega.BeNumerically(">", 0))
@@ -57,7 +64,7 @@ var _ = ginkgo.Describe("Client", func() {
 				).Return(-1, fmt.Errorf("some error"))
 
 				client := pinballmap.NewClientWithGenericClient(mgClient)
-				locations, err := client.GetLocations("north star")
+				locations, err := client.GetLocations(context.Background(), "north star")
 
 				gomega.Expect(err).To(gomega.HaveOccurred())
 				gomega.Expect(locations).To(gomega.BeNil())
@@ -76,7 +83,7 @@ var _ = ginkgo.Describe("Client", func() {
 				}).Return(500, nil)
 
 				client := pinballmap.NewClientWithGenericClient(mgClient)
-				locations, err := client.GetLocations("north star")
+				locations, err := client.GetLocations(context.Background(), "north star")
 
 				gomega.Expect(err).To(gomega.HaveOccurred())
 				gomega.Expect(err.Error()).To(gomega.ContainSubstring("some error"))
@@ -90,7 +97,7 @@ var _ = ginkgo.Describe("Client", func() {
 		ginkgo.Context("using the live API with location ID 7464", func() {
 			ginkgo.It("should return a location with ID 7464", func() {
 				client := pinballmap.NewClient()
-				location, err := client.GetLocation(7464)
+				location, err := client.GetLocation(context.Background(), 7464)
 				gomega.Expect(err).To(gomega.BeNil())
 				gomega.Expect(location).ToNot(gomega.BeNil())
 				gomega.Expect(location.ID).To(gomega.Equal(7464))
@@ -109,13 +116,32 @@ var _ = ginkgo.Describe("Client", func() {
 				}).Return(-1, nil)
 
 				client := pinballmap.NewClientWithGenericClient(mgClient)
-				location, err := client.GetLocation(1)
+				location, err := client.GetLocation(context.Background(), 1)
 
 				gomega.Expect(err).To(gomega.HaveOccurred())
 				gomega.Expect(err.Error()).To(gomega.ContainSubstring("some error"))
 				gomega.Expect(location).To(gomega.BeNil())
 			})
 		})
+		ginkgo.Context("and the API responds that the location does not exist", func() {
+			ginkgo.It("should return an ErrNotFound error", func() {
+				mgClient.On(
+					"Do",
+					mock.AnythingOfType(reflect.TypeOf(&http.Request{}).String()),
+					&pinballmap.Location{},
+					&pinballmap.ErrorResponse{},
+				).Run(func(args mock.Arguments) {
+					errResponse := args.Get(2).(*pinballmap.ErrorResponse)
+					errResponse.Errors = "Failed to find location"
+				}).Return(http.StatusNotFound, nil)
+
+				client := pinballmap.NewClientWithGenericClient(mgClient)
+				location, err := client.GetLocation(context.Background(), 1)
+
+				gomega.Expect(err).To(gomega.MatchError(pinballmap.ErrNotFound))
+				gomega.Expect(location).To(gomega.BeNil())
+			})
+		})
 		ginkgo.Context("and performing the request returns an error", func() {
 			ginkgo.It("should return an error", func() {
 				mgClient.On(
@@ -126,7 +152,7 @@ var _ = ginkgo.Describe("Client", func() {
 				).Return(-1, fmt.Errorf("some error"))
 
 				client := pinballmap.NewClientWithGenericClient(mgClient)
-				location, err := client.GetLocation(1)
+				location, err := client.GetLocation(context.Background(), 1)
 
 				gomega.Expect(err).To(gomega.HaveOccurred())
 				gomega.Expect(location).To(gomega.BeNil())
@@ -134,3 +160,212 @@ var _ = ginkgo.Describe("Client", func() {
 		})
 	})
 })
+
+var _ = ginkgo.Describe("CachedClient", func() {
+	var mockClient *pinballmap.MockClientInterface
+	var store *pinballmap.MemoryCacheStore
+	var cache *pinballmap.CachedClient
+
+	ginkgo.BeforeEach(func() {
+		mockClient = pinballmap.NewMockClientInterface(ginkgo.GinkgoT())
+		store = pinballmap.NewMemoryCacheStore()
+		cache = pinballmap.NewCachedClient(mockClient, store, time.Hour, time.Hour)
+	})
+
+	var storeLocation = func(key string, location pinballmap.Location, age time.Duration) {
+		value, err := json.Marshal(location)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = store.Set(key, pinballmap.CacheEntry{Value: value, StoredAt: time.Now().Add(-age)})
+		gomega.Expect(err).To(gomega.BeNil())
+	}
+
+	ginkgo.When("GetLocation is called", func() {
+		ginkgo.Context("and the location is not cached", func() {
+			ginkgo.It("fetches the location and caches it", func() {
+				mockClient.On("GetLocation", mock.Anything, 1).Return(&pinballmap.Location{ID: 1, Name: "Pinballz"}, nil).Once()
+
+				location, err := cache.GetLocation(context.Background(), 1)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(location.Name).To(gomega.Equal("Pinballz"))
+
+				location, err = cache.GetLocation(context.Background(), 1)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(location.Name).To(gomega.Equal("Pinballz"))
+
+				gomega.Expect(cache.Metrics()).To(gomega.Equal(pinballmap.CacheMetrics{Hits: 1, Misses: 1}))
+			})
+		})
+
+		ginkgo.Context("and the cached location is stale", func() {
+			ginkgo.It("serves the cached location and refreshes it in the background", func() {
+				storeLocation("location:1", pinballmap.Location{ID: 1, Name: "Old Name"}, 90*time.Minute)
+				mockClient.On("GetLocation", mock.Anything, 1).Return(&pinballmap.Location{ID: 1, Name: "New Name"}, nil).Once()
+
+				location, err := cache.GetLocation(context.Background(), 1)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(location.Name).To(gomega.Equal("Old Name"))
+
+				gomega.Eventually(func() time.Duration {
+					entry, err := store.Get("location:1")
+					gomega.Expect(err).To(gomega.BeNil())
+					return time.Since(entry.StoredAt)
+				}).Should(gomega.BeNumerically("<", time.Minute))
+
+				location, err = cache.GetLocation(context.Background(), 1)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(location.Name).To(gomega.Equal("New Name"))
+				gomega.Expect(cache.Metrics()).To(gomega.Equal(pinballmap.CacheMetrics{Hits: 1, StaleHits: 1}))
+			})
+		})
+
+		ginkgo.Context("and the cached location has expired", func() {
+			ginkgo.It("fetches the location before responding", func() {
+				storeLocation("location:1", pinballmap.Location{ID: 1, Name: "Old Name"}, 3*time.Hour)
+				mockClient.On("GetLocation", mock.Anything, 1).Return(&pinballmap.Location{ID: 1, Name: "New Name"}, nil).Once()
+
+				location, err := cache.GetLocation(context.Background(), 1)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(location.Name).To(gomega.Equal("New Name"))
+				gomega.Expect(cache.Metrics()).To(gomega.Equal(pinballmap.CacheMetrics{Misses: 1}))
+			})
+
+			ginkgo.It("serves the expired location when pinball map fails", func() {
+				storeLocation("location:1", pinballmap.Location{ID: 1, Name: "Old Name"}, 3*time.Hour)
+				mockClient.On("GetLocation", mock.Anything, 1).Return(nil, fmt.Errorf("some error")).Once()
+
+				location, err := cache.GetLocation(context.Background(), 1)
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(location.Name).To(gomega.Equal("Old Name"))
+				gomega.Expect(cache.Metrics()).To(gomega.Equal(pinballmap.CacheMetrics{Misses: 1, Errors: 1}))
+			})
+
+			ginkgo.It("returns ErrNotFound when pinball map no longer has the location", func() {
+				storeLocation("location:1", pinballmap.Location{ID: 1, Name: "Old Name"}, 3*time.Hour)
+				mockClient.On("GetLocation", mock.Anything, 1).Return(nil, fmt.Errorf("location 1 %w", pinballmap.ErrNotFound)).Once()
+
+				location, err := cache.GetLocation(context.Background(), 1)
+				gomega.Expect(err).To(gomega.MatchError(pinballmap.ErrNotFound))
+				gomega.Expect(location).To(gomega.BeNil())
+			})
+		})
+	})
+
+	ginkgo.When("GetLocations is called", func() {
+		ginkgo.It("caches results per name filter", func() {
+			mockClient.On("GetLocations", mock.Anything, "north").Return([]pinballmap.Location{{ID: 1}}, nil).Once()
+			mockClient.On("GetLocations", mock.Anything, "south").Return([]pinballmap.Location{{ID: 2}, {ID: 3}}, nil).Once()
+
+			for i := 0; i < 2; i++ {
+				locations, err := cache.GetLocations(context.Background(), "north")
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(locations).To(gomega.HaveLen(1))
+
+				locations, err = cache.GetLocations(context.Background(), "south")
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(locations).To(gomega.HaveLen(2))
+			}
+
+			gomega.Expect(cache.Metrics()).To(gomega.Equal(pinballmap.CacheMetrics{Hits: 2, Misses: 2}))
+		})
+
+		ginkgo.It("returns the error when nothing is cached and pinball map fails", func() {
+			mockClient.On("GetLocations", mock.Anything, "north").Return(nil, fmt.Errorf("some error")).Once()
+
+			locations, err := cache.GetLocations(context.Background(), "north")
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(locations).To(gomega.BeNil())
+		})
+	})
+})
+
+var _ = ginkgo.Describe("MemoryCacheStore", func() {
+	var store *pinballmap.MemoryCacheStore
+
+	ginkgo.BeforeEach(func() {
+		store = pinballmap.NewMemoryCacheStoreWithSize(2)
+	})
+
+	ginkgo.When("it is full", func() {
+		ginkgo.It("evicts the least recently used entry", func() {
+			gomega.Expect(store.Set("a", pinballmap.CacheEntry{Value: []byte("1")})).To(gomega.Succeed())
+			gomega.Expect(store.Set("b", pinballmap.CacheEntry{Value: []byte("2")})).To(gomega.Succeed())
+			_, err := store.Get("a")
+			gomega.Expect(err).To(gomega.BeNil())
+
+			gomega.Expect(store.Set("c", pinballmap.CacheEntry{Value: []byte("3")})).To(gomega.Succeed())
+
+			_, err = store.Get("b")
+			gomega.Expect(err).To(gomega.MatchError(pinballmap.ErrCacheMiss))
+			entry, err := store.Get("a")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(entry.Value).To(gomega.Equal([]byte("1")))
+			entry, err = store.Get("c")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(entry.Value).To(gomega.Equal([]byte("3")))
+		})
+
+		ginkgo.It("replaces an existing entry without evicting another", func() {
+			gomega.Expect(store.Set("a", pinballmap.CacheEntry{Value: []byte("1")})).To(gomega.Succeed())
+			gomega.Expect(store.Set("b", pinballmap.CacheEntry{Value: []byte("2")})).To(gomega.Succeed())
+
+			gomega.Expect(store.Set("a", pinballmap.CacheEntry{Value: []byte("new")})).To(gomega.Succeed())
+
+			entry, err := store.Get("a")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(entry.Value).To(gomega.Equal([]byte("new")))
+			_, err = store.Get("b")
+			gomega.Expect(err).To(gomega.BeNil())
+		})
+	})
+})
+
+var _ = ginkgo.Describe("DBCacheStore", func() {
+	var db *gorm.DB
+	var mock sqlmock.Sqlmock
+	var store *pinballmap.DBCacheStore
+
+	ginkgo.BeforeEach(func() {
+		db, mock = utils.NewGormMock()
+		store = &pinballmap.DBCacheStore{DB: db}
+	})
+
+	ginkgo.When("Get is called", func() {
+		ginkgo.It("returns the stored entry", func() {
+			storedAt := time.Now()
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "pinball_map_cache" WHERE key = $1`)).
+				WithArgs("location:1").
+				WillReturnRows(sqlmock.NewRows([]string{"key", "value", "stored_at"}).
+					AddRow("location:1", []byte(`{"id":1}`), storedAt))
+
+			entry, err := store.Get("location:1")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(entry.Value).To(gomega.Equal([]byte(`{"id":1}`)))
+			gomega.Expect(entry.StoredAt).To(gomega.BeTemporally("==", storedAt))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+		})
+
+		ginkgo.It("returns ErrCacheMiss when there is no entry", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "pinball_map_cache" WHERE key = $1`)).
+				WithArgs("location:1").
+				WillReturnRows(sqlmock.NewRows([]string{"key", "value", "stored_at"}))
+
+			entry, err := store.Get("location:1")
+			gomega.Expect(err).To(gomega.MatchError(pinballmap.ErrCacheMiss))
+			gomega.Expect(entry).To(gomega.BeNil())
+		})
+	})
+
+	ginkgo.When("Set is called", func() {
+		ginkgo.It("upserts the entry", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "pinball_map_cache" ("key","value","stored_at") VALUES ($1,$2,$3) ON CONFLICT ("key") DO UPDATE SET`)).
+				WithArgs("location:1", []byte(`{"id":1}`), utils.AnyTime{}).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			err := store.Set("location:1", pinballmap.CacheEntry{Value: []byte(`{"id":1}`), StoredAt: time.Now()})
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+		})
+	})
+})
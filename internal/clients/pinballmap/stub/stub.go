@@ -0,0 +1,97 @@
+// Package stub serves a fixture-driven fake of the Pinball Map API, so the app can run and be tested offline.
+package stub
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"pinman/internal/clients/pinballmap"
+	"strconv"
+	"strings"
+)
+
+//go:embed fixtures/default.json
+var defaultFixtures []byte
+
+type Machine struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Year         int    `json:"year"`
+	Manufacturer string `json:"manufacturer"`
+}
+
+// Fixtures is the data served by the stub, in the same shape as the Pinball Map responses.
+type Fixtures struct {
+	Locations []pinballmap.Location `json:"locations"`
+	Machines  []Machine             `json:"machines"`
+}
+
+// LoadFixtures reads fixtures from a JSON file, or returns the bundled fixtures when path is empty.
+func LoadFixtures(path string) (*Fixtures, error) {
+	data := defaultFixtures
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading fixtures: %w", err)
+		}
+	}
+
+	fixtures := &Fixtures{}
+	if err := json.Unmarshal(data, fixtures); err != nil {
+		return nil, fmt.Errorf("decoding fixtures: %w", err)
+	}
+
+	return fixtures, nil
+}
+
+// NewRouter returns a router serving the locations and machines endpoints of the Pinball Map API from fixtures.
+func NewRouter(fixtures *Fixtures) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	router.GET("/api/v1/locations.json", func(c *gin.Context) {
+		nameFilter := strings.ToLower(c.Query("by_location_name"))
+		noDetails := c.Query("no_details") != ""
+
+		locations := make([]pinballmap.Location, 0)
+		for _, location := range fixtures.Locations {
+			if !strings.Contains(strings.ToLower(location.Name), nameFilter) {
+				continue
+			}
+			if noDetails {
+				location.MachineNames = nil
+			}
+			locations = append(locations, location)
+		}
+
+		c.JSON(http.StatusOK, pinballmap.LocationsResponse{Locations: locations})
+	})
+
+	// gin can not match a parameter followed by a suffix, so the id is parsed out of "<id>.json"
+	router.GET("/api/v1/locations/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(strings.TrimSuffix(c.Param("id"), ".json"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, pinballmap.ErrorResponse{Errors: "Failed to find location"})
+			return
+		}
+
+		for _, location := range fixtures.Locations {
+			if location.ID == id {
+				c.JSON(http.StatusOK, location)
+				return
+			}
+		}
+
+		c.JSON(http.StatusNotFound, pinballmap.ErrorResponse{Errors: "Failed to find location"})
+	})
+
+	router.GET("/api/v1/machines.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"machines": fixtures.Machines})
+	})
+
+	return router
+}
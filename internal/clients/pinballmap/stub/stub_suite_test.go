@@ -0,0 +1,115 @@
+package stub_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pinman/internal/clients/pinballmap"
+	"pinman/internal/clients/pinballmap/stub"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestStub(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Stub Suite")
+}
+
+var _ = ginkgo.Describe("LoadFixtures", func() {
+	ginkgo.When("no path is given", func() {
+		ginkgo.It("loads the bundled fixtures", func() {
+			fixtures, err := stub.LoadFixtures("")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(fixtures.Locations).ToNot(gomega.BeEmpty())
+			gomega.Expect(fixtures.Machines).ToNot(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.When("a path is given", func() {
+		ginkgo.It("loads the fixtures from the file", func() {
+			path := filepath.Join(ginkgo.GinkgoT().TempDir(), "fixtures.json")
+			err := os.WriteFile(path, []byte(`{"locations":[{"id":1,"name":"Test"}]}`), 0600)
+			gomega.Expect(err).To(gomega.BeNil())
+
+			fixtures, err := stub.LoadFixtures(path)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(fixtures.Locations).To(gomega.HaveLen(1))
+		})
+
+		ginkgo.It("returns an error if the file does not exist", func() {
+			_, err := stub.LoadFixtures(filepath.Join(ginkgo.GinkgoT().TempDir(), "missing.json"))
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+})
+
+var _ = ginkgo.Describe("Router", func() {
+	var server *httptest.Server
+	var client *pinballmap.Client
+
+	ginkgo.BeforeEach(func() {
+		gin.SetMode(gin.TestMode)
+		fixtures, err := stub.LoadFixtures("")
+		gomega.Expect(err).To(gomega.BeNil())
+
+		server = httptest.NewServer(stub.NewRouter(fixtures))
+		client = pinballmap.NewClientWithBaseURL(server.URL)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	ginkgo.When("locations are searched by name", func() {
+		ginkgo.It("returns the matching locations without details", func() {
+			locations, err := client.GetLocations(context.Background(), "north star")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(locations).To(gomega.HaveLen(1))
+			gomega.Expect(locations[0].ID).To(gomega.Equal(7464))
+			gomega.Expect(locations[0].MachineNames).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.When("a location is requested", func() {
+		ginkgo.It("returns the location with its machines", func() {
+			location, err := client.GetLocation(context.Background(), 7464)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(location.Name).To(gomega.Equal("North Star Machines à Piastres"))
+			gomega.Expect(location.MachineNames).ToNot(gomega.BeEmpty())
+		})
+
+		ginkgo.It("returns ErrNotFound for an unknown location", func() {
+			_, err := client.GetLocation(context.Background(), 1)
+			gomega.Expect(err).To(gomega.MatchError(pinballmap.ErrNotFound))
+		})
+
+		ginkgo.It("returns an error without retrying once the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := client.GetLocation(ctx, 7464)
+			gomega.Expect(err).To(gomega.MatchError(context.Canceled))
+		})
+	})
+
+	ginkgo.When("machines are requested", func() {
+		ginkgo.It("returns every machine", func() {
+			resp, err := http.Get(server.URL + "/api/v1/machines.json")
+			gomega.Expect(err).To(gomega.BeNil())
+			defer resp.Body.Close()
+
+			var body struct {
+				Machines []stub.Machine `json:"machines"`
+			}
+			gomega.Expect(json.NewDecoder(resp.Body).Decode(&body)).To(gomega.Succeed())
+			gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(body.Machines).ToNot(gomega.BeEmpty())
+		})
+	})
+})
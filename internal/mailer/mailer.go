@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"mime"
+	"net/smtp"
+	"pinman/internal/utils"
+	"strings"
+	"time"
+)
+
+const (
+	TransportSMTP = "smtp"
+	TransportLog  = "log"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Format renders the message as a plain text email sent by from.
+func (m Message) Format(from string) []byte {
+	headers := []string{
+		fmt.Sprintf("From: %s", from),
+		fmt.Sprintf("To: %s", m.To),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", m.Subject)),
+		fmt.Sprintf("Date: %s", time.Now().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(m.Body, "\n", "\r\n"))
+}
+
+type Mailer interface {
+	Send(message Message) error
+}
+
+// NewMailer creates the Mailer selected by MAILER_TRANSPORT. There is no default, as logging emails in production
+// would leak the links in them to anyone who can read the logs.
+func NewMailer(config *utils.Config) (Mailer, error) {
+	switch config.MailerTransport {
+	case "":
+		return nil, fmt.Errorf("MAILER_TRANSPORT is required, use %q to send emails or %q to only log them", TransportSMTP, TransportLog)
+	case TransportLog:
+		log.Warn().Msg("emails are logged instead of sent, including the links in them, don't use the log mailer in production")
+		return NewLogMailer(), nil
+	case TransportSMTP:
+		if config.SMTPHost == "" || config.MailFrom == "" {
+			return nil, fmt.Errorf("SMTP_HOST and MAIL_FROM are required to send emails over smtp")
+		}
+		return NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer transport %q", config.MailerTransport)
+	}
+}
+
+// SMTPMailer sends emails through an SMTP server.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%s", host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(message Message) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{message.To}, message.Format(m.from)); err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+
+	return nil
+}
+
+// LogMailer logs emails instead of sending them, for development.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(message Message) error {
+	log.Info().
+		Str("to", message.To).
+		Str("subject", message.Subject).
+		Str("body", message.Body).
+		Msg("email captured by log mailer")
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package mailer_test
+
+import (
+	"pinman/internal/mailer"
+	"pinman/internal/utils"
+	"testing"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestMailer(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Mailer Suite")
+}
+
+var _ = ginkgo.Describe("NewMailer", func() {
+	ginkgo.When("no transport is configured", func() {
+		ginkgo.It("returns an error", func() {
+			_, err := mailer.NewMailer(&utils.Config{})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.When("the log transport is configured", func() {
+		ginkgo.It("returns a log mailer", func() {
+			m, err := mailer.NewMailer(&utils.Config{MailerTransport: mailer.TransportLog})
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(m).To(gomega.BeAssignableToTypeOf(&mailer.LogMailer{}))
+		})
+	})
+
+	ginkgo.When("the smtp transport is configured", func() {
+		ginkgo.It("returns an smtp mailer", func() {
+			m, err := mailer.NewMailer(&utils.Config{
+				MailerTransport: mailer.TransportSMTP,
+				SMTPHost:        "smtp.example.com",
+				MailFrom:        "pinman@example.com",
+			})
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(m).To(gomega.BeAssignableToTypeOf(&mailer.SMTPMailer{}))
+		})
+
+		ginkgo.It("returns an error if the smtp host is missing", func() {
+			_, err := mailer.NewMailer(&utils.Config{MailerTransport: mailer.TransportSMTP})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.When("an unknown transport is configured", func() {
+		ginkgo.It("returns an error", func() {
+			_, err := mailer.NewMailer(&utils.Config{MailerTransport: "pigeon"})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+})
+
+var _ = ginkgo.Describe("LogMailer", func() {
+	ginkgo.It("logs sent messages", func() {
+		m := mailer.NewLogMailer()
+		message := mailer.Message{To: "user@example.com", Subject: "Hello", Body: "World"}
+
+		gomega.Expect(m.Send(message)).To(gomega.Succeed())
+	})
+})
+
+var _ = ginkgo.Describe("Message", func() {
+	ginkgo.It("formats as a plain text email", func() {
+		message := mailer.Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"}
+
+		formatted := string(message.Format("pinman@example.com"))
+
+		gomega.Expect(formatted).To(gomega.ContainSubstring("From: pinman@example.com\r\n"))
+		gomega.Expect(formatted).To(gomega.ContainSubstring("To: user@example.com\r\n"))
+		gomega.Expect(formatted).To(gomega.ContainSubstring("Subject: Hello\r\n"))
+		gomega.Expect(formatted).To(gomega.HaveSuffix("\r\n\r\nline one\r\nline two"))
+	})
+})
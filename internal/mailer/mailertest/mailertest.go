@@ -0,0 +1,33 @@
+// Package mailertest provides a mailer for tests that keeps the messages it is asked to send.
+package mailertest
+
+import (
+	"pinman/internal/mailer"
+	"sync"
+)
+
+// Mailer keeps a copy of every message instead of sending it.
+type Mailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func NewMailer() *Mailer {
+	return &Mailer{}
+}
+
+func (m *Mailer) Send(message mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns every message sent so far.
+func (m *Mailer) Messages() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]mailer.Message{}, m.messages...)
+}
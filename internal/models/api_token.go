@@ -0,0 +1,26 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// APIToken is a long-lived personal access token for scripts and integrations. Only its hash is stored, the
+// prefix is kept so users can tell their tokens apart.
+type APIToken struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	User        User
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name        string    `gorm:"type:varchar(100);not null"`
+	TokenPrefix string    `gorm:"type:varchar(12);not null"`
+	TokenHash   string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	// ReadOnly tokens can only be used for GET requests
+	ReadOnly bool `gorm:"not null"`
+	// League restricts the token to the endpoints of a single league when set
+	League     *League
+	LeagueID   *uuid.UUID `gorm:"type:uuid"`
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
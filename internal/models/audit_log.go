@@ -0,0 +1,36 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	AuditActionAccountLocked   = "account_locked"
+	AuditActionIPLocked        = "ip_locked"
+	AuditActionAccountUnlocked = "account_unlocked"
+	AuditActionTwoFactorOn     = "two_factor_enabled"
+	AuditActionTwoFactorOff    = "two_factor_disabled"
+	AuditActionRoleUpdated     = "role_updated"
+	AuditActionLogin           = "login"
+	AuditActionLoginFailed     = "login_failed"
+	AuditActionUserRoleChanged = "user_role_changed"
+	AuditActionUserDisabled    = "user_disabled"
+	AuditActionUserEnabled     = "user_enabled"
+	AuditActionEmailChanged    = "email_changed"
+	AuditActionAccountDeleted  = "account_deleted"
+)
+
+// AuditLog records security relevant events, like logins being locked after too many failed attempts.
+type AuditLog struct {
+	ID uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	// Action is one of the AuditAction constants
+	Action string `gorm:"type:varchar(50);not null;index"`
+	// UserID is the user the event concerns, if any
+	UserID *uuid.UUID `gorm:"type:uuid;index"`
+	// ActorID is the user that caused the event, if it wasn't the user themselves
+	ActorID   *uuid.UUID `gorm:"type:uuid"`
+	IPAddress string     `gorm:"type:varchar(45)"`
+	Detail    string     `gorm:"type:text"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// ExternalIdentity links a user to their account at an OpenID Connect provider, identified by the issuer and the
+// subject the provider assigned to them.
+type ExternalIdentity struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	User      User
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Issuer    string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_external_identity_subject"`
+	Subject   string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_external_identity_subject"`
+	Email     string    `gorm:"type:varchar(255);not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// FailedLogin counts the failed logins for an email address or an IP address. The count starts over once no login
+// failed for the lockout duration.
+type FailedLogin struct {
+	Key          string    `gorm:"type:varchar(255);primary_key"`
+	Count        int       `gorm:"not null"`
+	LastFailedAt time.Time `gorm:"not null"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"time"
 )
 
@@ -9,7 +10,7 @@ type League struct {
 	ID   uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
 	Name string    `gorm:"type:varchar(255);not null"`
 
-	// TODO: Limit to 20 characters and update request validation accordingly
+	// Slug is limited to 20 characters when it's created, the column is wider as leagues used to have longer slugs
 	Slug       string `gorm:"type:varchar(255);not null;uniqueIndex"`
 	Owner      User
 	OwnerID    uuid.UUID `gorm:"type:uuid;not null"`
@@ -17,4 +18,6 @@ type League struct {
 	LocationID uuid.UUID `gorm:"type:uuid;not null"`
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+	// DeletedAt is set when the league is deleted, which can be undone until deleted leagues are purged
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
@@ -2,15 +2,30 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 	"time"
 )
 
+const (
+	LocationStatusActive = "active"
+	// LocationStatusRemoved flags locations that Pinball Map reports as deleted or closed.
+	LocationStatusRemoved = "removed"
+)
+
+// Location is a venue where leagues and tournaments are played. Locations without a PinballMapID are private
+// venues that are not listed on Pinball Map, and are never synced.
 type Location struct {
-	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
-	Name         string    `gorm:"type:varchar(255);not null"`
-	Slug         string    `gorm:"type:varchar(20);not null;uniqueIndex"`
-	Address      string    `gorm:"type:varchar(255);not null"`
-	PinballMapID int       `gorm:"type:int;not null"`
+	ID           uuid.UUID                   `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	Name         string                      `gorm:"type:varchar(255);not null"`
+	Slug         string                      `gorm:"type:varchar(20);not null;uniqueIndex"`
+	Address      string                      `gorm:"type:varchar(255);not null"`
+	PinballMapID *int                        `gorm:"type:int"`
+	Machines     datatypes.JSONSlice[string] `gorm:"type:jsonb;not null;default:'[]'"`
+	Status       string                      `gorm:"type:varchar(20);not null;default:active"`
+	LastSyncedAt *time.Time
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	// DeletedAt is set when the location is deleted, which can be undone until deleted locations are purged
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
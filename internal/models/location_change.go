@@ -0,0 +1,17 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// LocationChange records a single field of a Location that was updated while syncing with Pinball Map.
+type LocationChange struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	LocationID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Location   Location
+	Field      string `gorm:"type:varchar(100);not null"`
+	OldValue   string `gorm:"type:text"`
+	NewValue   string `gorm:"type:text"`
+	CreatedAt  time.Time
+}
@@ -11,6 +11,17 @@ func Migrate(gormDb *gorm.DB) error {
 		&League{},
 		&Location{},
 		&Tournament{},
+		&LocationChange{},
+		&Session{},
+		&RefreshToken{},
+		&APIToken{},
+		&ExternalIdentity{},
+		&FailedLogin{},
+		&AuditLog{},
+		&TwoFactor{},
+		&RecoveryCode{},
+		&RoleSetting{},
+		&SlugHistory{},
 	)
 	if err != nil {
 		return fmt.Errorf("migrating models: %w", err)
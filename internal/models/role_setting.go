@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+// RoleSetting holds the security settings admins chose for a role. Roles without one use the defaults.
+type RoleSetting struct {
+	Role              string `gorm:"type:varchar(50);primary_key"`
+	TwoFactorRequired bool   `gorm:"not null"`
+	UpdatedAt         time.Time
+}
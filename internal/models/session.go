@@ -0,0 +1,32 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Session is a device a user has logged in on. Revoking it logs the device out, the refresh tokens issued to it
+// stop working and so do the access tokens issued with them.
+type Session struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	User       User
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserAgent  string    `gorm:"type:varchar(512)"`
+	IPAddress  string    `gorm:"type:varchar(45)"`
+	LastUsedAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// RefreshToken is a single-use token that gets a new access token for a session. Only its hash is stored.
+// A refresh token that is used twice was stolen from one of the two users, which revokes the whole session.
+type RefreshToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	Session   Session
+	SessionID uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
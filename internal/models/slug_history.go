@@ -0,0 +1,16 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// SlugHistory records a slug a league, location or tournament was addressed by before it was renamed, so links with
+// the old slug keep resolving to the record. Kind is the kind of record, like "league".
+type SlugHistory struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	Kind       string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_slug_history_kind_slug"`
+	Slug       string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_slug_history_kind_slug"`
+	ResourceID uuid.UUID `gorm:"type:uuid;not null;index"`
+	CreatedAt  time.Time
+}
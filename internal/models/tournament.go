@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 	"pinman/internal/app/generated"
 	"time"
 )
@@ -19,8 +20,25 @@ type Tournament struct {
 	Location   Location
 	LeagueID   uuid.UUID `gorm:"type:uuid;not null"`
 	League     League
-	CreatedAt  time.Time `gorm:"type:timestamp;not null;default:now()"`
-	UpdatedAt  time.Time `gorm:"type:timestamp;not null;default:now()"`
+	// StartsAt and EndsAt are when the tournament is played, its status is derived from them
+	StartsAt  *time.Time `gorm:"type:timestamp"`
+	EndsAt    *time.Time `gorm:"type:timestamp"`
+	CreatedAt time.Time  `gorm:"type:timestamp;not null;default:now()"`
+	UpdatedAt time.Time  `gorm:"type:timestamp;not null;default:now()"`
+	// DeletedAt is set when the tournament is deleted, which can be undone until deleted tournaments are purged
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// Status returns whether the tournament is upcoming, ongoing or finished at now. Tournaments without dates are
+// upcoming.
+func (t *Tournament) Status(now time.Time) generated.TournamentStatus {
+	if t.EndsAt != nil && !now.Before(*t.EndsAt) {
+		return generated.Finished
+	}
+	if t.StartsAt != nil && !now.Before(*t.StartsAt) {
+		return generated.Ongoing
+	}
+	return generated.Upcoming
 }
 
 func (t *Tournament) GetSettings() (*generated.TournamentSettings, error) {
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// TwoFactor is the authenticator app of a user. It only protects logins once it is enabled, which happens when the
+// user confirms it with a code.
+type TwoFactor struct {
+	UserID uuid.UUID `gorm:"type:uuid;primary_key"`
+	User   User
+	Secret string `gorm:"type:varchar(64);not null"`
+	// LastUsedStep is the period of the last accepted code, codes can't be used twice
+	LastUsedStep int64 `gorm:"not null;default:0"`
+	EnabledAt    *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RecoveryCode logs a user in once in place of a code from their authenticator app. Only its hash is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash  string    `gorm:"type:varchar(64);not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
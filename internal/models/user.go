@@ -6,6 +6,31 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser      = "user"
+	RoleOrganizer = "organizer"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role a user can have, from the least to the most privileged.
+var Roles = []string{RoleUser, RoleOrganizer, RoleAdmin}
+
+// RoleIncludes returns whether users with the role have the permissions of the required role. Every role includes
+// the roles listed before it in Roles, so admins can do everything organizers and users can.
+func RoleIncludes(role string, required string) bool {
+	rank, requiredRank := roleRank(role), roleRank(required)
+	return rank >= 0 && requiredRank >= 0 && rank >= requiredRank
+}
+
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
 type UserClaims struct {
 	ID       uuid.UUID
 	Name     string
@@ -23,4 +48,11 @@ type User struct {
 	Verified  bool      `gorm:"not null"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// PasswordChangedAt is when the password was last changed, tokens issued before then are no longer accepted.
+	PasswordChangedAt *time.Time
+	// DisabledAt is when an admin disabled the account, disabled users can't log in or use their tokens.
+	DisabledAt *time.Time
+	// AnonymizedAt is when the user deleted their account. The row is kept without their personal data, so the
+	// leagues they own and the results they took part in stay intact.
+	AnonymizedAt *time.Time
 }
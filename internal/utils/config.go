@@ -19,10 +19,91 @@ type Config struct {
 	SPACacheDisabled bool     `mapstructure:"SPA_CACHE_DISABLED"`
 	ClientOrigins    []string `mapstructure:"CLIENT_ORIGINS"`
 
-	TokenPrivateKey   string        `mapstructure:"TOKEN_PRIVATE_KEY"`
-	TokenPublicKey    string        `mapstructure:"TOKEN_PUBLIC_KEY"`
-	TokenExpiresAfter time.Duration `mapstructure:"TOKEN_EXPIRES_AFTER"`
-	TokenSecretKey    string        `mapstructure:"TOKEN_SECRET_KEY"`
+	// Base64 encoded PEM RSA key access tokens are signed with, a random key is used when empty. The public key is
+	// optional and only checked against it.
+	TokenPrivateKey string `mapstructure:"TOKEN_PRIVATE_KEY"`
+	TokenPublicKey  string `mapstructure:"TOKEN_PUBLIC_KEY"`
+	// Base64 encoded PEM public keys of previous private keys, tokens signed with them are still accepted. Keep a
+	// key here for TOKEN_EXPIRES_AFTER after rotating it out so nobody is logged out.
+	TokenRetiredPublicKeys []string      `mapstructure:"TOKEN_RETIRED_PUBLIC_KEYS"`
+	TokenExpiresAfter      time.Duration `mapstructure:"TOKEN_EXPIRES_AFTER"`
+	// Verifies the HS256 access tokens issued before tokens were signed with TOKEN_PRIVATE_KEY
+	TokenSecretKey string `mapstructure:"TOKEN_SECRET_KEY"`
+	// How long a session stays logged in without being used, each refresh extends it
+	RefreshTokenExpiresAfter time.Duration `mapstructure:"REFRESH_TOKEN_EXPIRES_AFTER"`
+	// How tokens are sent to clients, "header" returns them in the response, "cookie" only sets HttpOnly cookies and
+	// "both" does both
+	TokenTransport string `mapstructure:"TOKEN_TRANSPORT"`
+	// Domain of the token cookies, defaults to the host of the API
+	CookieDomain string `mapstructure:"COOKIE_DOMAIN"`
+	// SameSite mode of the token cookies, either "strict", "lax" or "none"
+	CookieSameSite string `mapstructure:"COOKIE_SAME_SITE"`
+
+	// Failed logins before an account is locked, 0 disables the limit. Until then every failed login doubles the
+	// time before the next attempt is accepted, starting at a second.
+	LoginMaxFailures int `mapstructure:"LOGIN_MAX_FAILURES"`
+	// Failed logins before an IP address is locked, 0 disables the limit
+	LoginMaxFailuresPerIP int `mapstructure:"LOGIN_MAX_FAILURES_PER_IP"`
+	// How long accounts and IP addresses stay locked
+	LoginLockoutDuration time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+
+	// Algorithm new passwords are hashed with, either "argon2id" or "bcrypt". Passwords hashed with another algorithm
+	// or other parameters are hashed again when their users log in.
+	PasswordHashAlgorithm string `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	// Memory in KiB, iterations and threads used by argon2id, RFC 9106 recommendations are used when 0
+	Argon2Memory      uint32 `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations  uint32 `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism uint8  `mapstructure:"ARGON2_PARALLELISM"`
+	// Cost of bcrypt hashes, bcrypt.DefaultCost when 0
+	BcryptCost int `mapstructure:"BCRYPT_COST"`
+
+	// Length passwords must have, 8 and 128 characters when 0
+	PasswordMinLength int `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength int `mapstructure:"PASSWORD_MAX_LENGTH"`
+	// Whether passwords may contain the name or email address of their user
+	PasswordAllowPersonalInfo bool `mapstructure:"PASSWORD_ALLOW_PERSONAL_INFO"`
+	// How many of the most common passwords from the bundled list are rejected, all of them when 0. A negative
+	// value disables the check.
+	PasswordCommonLimit int `mapstructure:"PASSWORD_COMMON_LIMIT"`
+	// Directory of Pwned Passwords ranges, one file per 5 character SHA-1 prefix as downloaded from the range API.
+	// Passwords found in them are rejected, the check is disabled when empty.
+	PasswordBreachedRangesPath string `mapstructure:"PASSWORD_BREACHED_RANGES_PATH"`
+
+	// Public URL of the app, used to build the links sent by email
+	AppURL string `mapstructure:"APP_URL"`
+	// Key used to sign the links sent by email, a random key is used when empty
+	LinkSigningKey                string        `mapstructure:"LINK_SIGNING_KEY"`
+	VerificationLinkExpiresAfter  time.Duration `mapstructure:"VERIFICATION_LINK_EXPIRES_AFTER"`
+	PasswordResetLinkExpiresAfter time.Duration `mapstructure:"PASSWORD_RESET_LINK_EXPIRES_AFTER"`
+
+	// OpenID Connect login is enabled when an issuer is set
+	OIDCIssuerURL    string `mapstructure:"OIDC_ISSUER_URL"`
+	OIDCClientID     string `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string `mapstructure:"OIDC_CLIENT_SECRET"`
+	// Where the provider sends users back to, defaults to the OpenID Connect page of the app
+	OIDCRedirectURL string `mapstructure:"OIDC_REDIRECT_URL"`
+
+	// How emails are sent, either "smtp" or "log" which only logs them during development, there is no default
+	MailerTransport string `mapstructure:"MAILER_TRANSPORT"`
+	MailFrom        string `mapstructure:"MAIL_FROM"`
+	SMTPHost        string `mapstructure:"SMTP_HOST"`
+	SMTPPort        string `mapstructure:"SMTP_PORT"`
+	SMTPUsername    string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword    string `mapstructure:"SMTP_PASSWORD"`
+
+	// Base URL of the Pinball Map API, defaults to https://pinballmap.com
+	PinballMapURL string `mapstructure:"PINBALLMAP_URL"`
+	// How often locations are re-synced with Pinball Map, 0 disables syncing
+	PinballMapSyncInterval time.Duration `mapstructure:"PINBALLMAP_SYNC_INTERVAL"`
+	// How long Pinball Map responses are cached for, 0 disables caching
+	PinballMapCacheTTL time.Duration `mapstructure:"PINBALLMAP_CACHE_TTL"`
+	// How long expired responses are still served for while they are refreshed in the background
+	PinballMapCacheStaleTTL time.Duration `mapstructure:"PINBALLMAP_CACHE_STALE_TTL"`
+	// Where cached responses are stored, either "memory" or "postgres"
+	PinballMapCacheStore string `mapstructure:"PINBALLMAP_CACHE_STORE"`
+
+	// How long deleted leagues, locations and tournaments can be restored before they are purged, 0 keeps them forever
+	DeletedRetention time.Duration `mapstructure:"DELETED_RETENTION"`
 
 	// Added to support deployment to railway
 	RailwayDBUrl     string `mapstructure:"DATABASE_URL"`
@@ -62,6 +143,9 @@ func LoadConfig() (*Config, error) {
 
 	if len(config.RailwayStaticUrl) > 0 {
 		config.ClientOrigins = append(config.ClientOrigins, fmt.Sprintf("https://%s", config.RailwayStaticUrl))
+		if config.AppURL == "" {
+			config.AppURL = fmt.Sprintf("https://%s", config.RailwayStaticUrl)
+		}
 	}
 
 	return config, nil
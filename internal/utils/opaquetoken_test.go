@@ -0,0 +1,29 @@
+package utils_test
+
+import (
+	g "github.com/onsi/ginkgo/v2"
+	m "github.com/onsi/gomega"
+	"pinman/internal/utils"
+)
+
+var _ = g.Describe("opaquetoken.go", func() {
+	g.When("GenerateOpaqueToken is called", func() {
+		g.It("returns a different token every time", func() {
+			first, err := utils.GenerateOpaqueToken()
+			m.Expect(err).To(m.BeNil())
+			second, err := utils.GenerateOpaqueToken()
+			m.Expect(err).To(m.BeNil())
+
+			m.Expect(first).To(m.HaveLen(43))
+			m.Expect(first).ToNot(m.Equal(second))
+		})
+	})
+
+	g.When("HashOpaqueToken is called", func() {
+		g.It("returns the same hash for the same token", func() {
+			m.Expect(utils.HashOpaqueToken("token")).To(m.Equal(utils.HashOpaqueToken("token")))
+			m.Expect(utils.HashOpaqueToken("token")).ToNot(m.Equal(utils.HashOpaqueToken("other")))
+			m.Expect(utils.HashOpaqueToken("token")).To(m.HaveLen(64))
+		})
+	})
+})
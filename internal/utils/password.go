@@ -1,21 +1,275 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
 )
 
-var HashCost = bcrypt.DefaultCost
+const (
+	PasswordAlgorithmArgon2id = "argon2id"
+	PasswordAlgorithmBcrypt   = "bcrypt"
 
+	// defaults of the second recommended option of RFC 9106
+	defaultArgon2Memory      = 64 * 1024
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 4
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+var (
+	// dummyPasswordHash is a hash made with PasswordHashing that VerifyDummyPassword verifies against
+	dummyPasswordHash struct {
+		sync.Mutex
+		hasher PasswordHasher
+		hash   string
+	}
+
+	ErrPasswordMismatch    = fmt.Errorf("password does not match")
+	ErrUnknownPasswordHash = fmt.Errorf("password hash uses an unknown algorithm")
+)
+
+// PasswordHasher hashes passwords with one algorithm. The hashes name the algorithm and its parameters, so passwords
+// hashed with another algorithm or outdated parameters can still be verified, and rehashed once they are.
+type PasswordHasher interface {
+	Algorithm() string
+	Hash(password string) (string, error)
+	// Identifies returns whether the hash was made with the algorithm of the hasher
+	Identifies(hashedPassword string) bool
+	Verify(hashedPassword string, password string) error
+	// Outdated returns whether the hash was made with other parameters than the hasher uses
+	Outdated(hashedPassword string) bool
+}
+
+// PasswordHashing hashes new passwords. It is replaced by the hasher configured with NewPasswordHasher on startup.
+var PasswordHashing PasswordHasher = NewArgon2idHasher(0, 0, 0)
+
+// NewPasswordHasher returns the hasher configured by PASSWORD_HASH_ALGORITHM, argon2id by default.
+func NewPasswordHasher(config *Config) (PasswordHasher, error) {
+	switch config.PasswordHashAlgorithm {
+	case "", PasswordAlgorithmArgon2id:
+		return NewArgon2idHasher(config.Argon2Memory, config.Argon2Iterations, config.Argon2Parallelism), nil
+	case PasswordAlgorithmBcrypt:
+		cost := config.BcryptCost
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return &BcryptHasher{Cost: cost}, nil
+	}
+	return nil, fmt.Errorf("unknown password hash algorithm %q", config.PasswordHashAlgorithm)
+}
+
+// HashPassword hashes the password with PasswordHashing.
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), HashCost)
+	hashedPassword, err := PasswordHashing.Hash(password)
 
 	if err != nil {
 		return "", fmt.Errorf("could not hash password %w", err)
 	}
-	return string(hashedPassword), nil
+	return hashedPassword, nil
 }
 
+// VerifyPassword checks the password against a hash made with any of the supported algorithms.
 func VerifyPassword(hashedPassword string, candidatePassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(candidatePassword))
+	hasher := passwordHasherFor(hashedPassword)
+	if hasher == nil {
+		return ErrUnknownPasswordHash
+	}
+	return hasher.Verify(hashedPassword, candidatePassword)
+}
+
+// VerifyDummyPassword verifies the password against a fixed hash made with PasswordHashing, which takes as long as
+// verifying the password of a user. Logins call it when there is no password to verify, so the time they take doesn't
+// tell which email addresses have an account.
+func VerifyDummyPassword(password string) {
+	dummyPasswordHash.Lock()
+	if dummyPasswordHash.hasher != PasswordHashing {
+		dummyPasswordHash.hasher = PasswordHashing
+		dummyPasswordHash.hash, _ = PasswordHashing.Hash("dummy password")
+	}
+	hashedPassword := dummyPasswordHash.hash
+	dummyPasswordHash.Unlock()
+
+	_ = VerifyPassword(hashedPassword, password)
+}
+
+// PasswordNeedsRehash returns whether the hash was made with another algorithm or other parameters than
+// PasswordHashing uses, so the password should be hashed again the next time it is known.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	if hashedPassword == "" {
+		return false
+	}
+	if !PasswordHashing.Identifies(hashedPassword) {
+		return true
+	}
+	return PasswordHashing.Outdated(hashedPassword)
+}
+
+func passwordHasherFor(hashedPassword string) PasswordHasher {
+	for _, hasher := range []PasswordHasher{PasswordHashing, &Argon2idHasher{}, &BcryptHasher{}} {
+		if hasher.Identifies(hashedPassword) {
+			return hasher
+		}
+	}
+	return nil
+}
+
+// BcryptHasher hashes passwords with bcrypt, which was the only algorithm before argon2id was supported.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (b *BcryptHasher) Algorithm() string {
+	return PasswordAlgorithmBcrypt
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+func (b *BcryptHasher) Identifies(hashedPassword string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hashedPassword, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *BcryptHasher) Verify(hashedPassword string, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (b *BcryptHasher) Outdated(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != b.Cost
+}
+
+// Argon2idHasher hashes passwords with argon2id. The hashes use the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+type Argon2idHasher struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// NewArgon2idHasher returns an argon2id hasher, using the defaults for parameters that are 0.
+func NewArgon2idHasher(memory uint32, iterations uint32, parallelism uint8) *Argon2idHasher {
+	hasher := &Argon2idHasher{Memory: memory, Iterations: iterations, Parallelism: parallelism}
+	if hasher.Memory == 0 {
+		hasher.Memory = defaultArgon2Memory
+	}
+	if hasher.Iterations == 0 {
+		hasher.Iterations = defaultArgon2Iterations
+	}
+	if hasher.Parallelism == 0 {
+		hasher.Parallelism = defaultArgon2Parallelism
+	}
+	return hasher
+}
+
+func (a *Argon2idHasher) Algorithm() string {
+	return PasswordAlgorithmArgon2id
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *Argon2idHasher) Identifies(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$argon2id$")
+}
+
+func (a *Argon2idHasher) Verify(hashedPassword string, password string) error {
+	hash, err := decodeArgon2idHash(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), hash.salt, hash.iterations, hash.memory, hash.parallelism, uint32(len(hash.key)))
+	if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (a *Argon2idHasher) Outdated(hashedPassword string) bool {
+	hash, err := decodeArgon2idHash(hashedPassword)
+	if err != nil {
+		return true
+	}
+	return hash.memory != a.Memory || hash.iterations != a.Iterations || hash.parallelism != a.Parallelism ||
+		len(hash.key) != argon2KeyLength
+}
+
+func decodeArgon2idHash(hashedPassword string) (*argon2idHash, error) {
+	// the leading $ leaves an empty first part
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != PasswordAlgorithmArgon2id {
+		return nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash version: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	hash := &argon2idHash{}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.iterations, &hash.parallelism)
+	if err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash parameters: %w", err)
+	}
+	if hash.iterations == 0 || hash.parallelism == 0 {
+		return nil, fmt.Errorf("invalid argon2id hash parameters")
+	}
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash salt: %w", err)
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash key: %w", err)
+	}
+	if len(hash.key) == 0 {
+		return nil, fmt.Errorf("invalid argon2id hash key")
+	}
+
+	return hash, nil
 }
@@ -5,13 +5,25 @@ import (
 	m "github.com/onsi/gomega"
 	"golang.org/x/crypto/bcrypt"
 	"pinman/internal/utils"
+	"strings"
 )
 
 var _ = g.Describe("password.go", func() {
+	var hasher utils.PasswordHasher
+
+	g.BeforeEach(func() {
+		hasher = utils.PasswordHashing
+		utils.PasswordHashing = utils.NewArgon2idHasher(1024, 1, 1)
+	})
+
+	g.AfterEach(func() {
+		utils.PasswordHashing = hasher
+	})
+
 	g.When("HashPassword is called", func() {
 		g.Context("with invalid HashCost", func() {
 			g.It("should return an error", func() {
-				utils.HashCost = 100
+				utils.PasswordHashing = &utils.BcryptHasher{Cost: 100}
 				str, err := utils.HashPassword("password")
 				m.Expect(err).NotTo(m.BeNil())
 				m.Expect(str).To(m.BeEmpty())
@@ -26,8 +38,82 @@ var _ = g.Describe("password.go", func() {
 				m.Expect(utils.VerifyPassword(str, val)).To(m.BeNil())
 			})
 		})
+
+		g.It("names the algorithm and its parameters in the hash", func() {
+			str, err := utils.HashPassword("password")
+			m.Expect(err).To(m.BeNil())
+			m.Expect(str).To(m.HavePrefix("$argon2id$v=19$m=1024,t=1,p=1$"))
+			m.Expect(strings.Split(str, "$")).To(m.HaveLen(6))
+		})
 	})
-	g.AfterEach(func() {
-		utils.HashCost = bcrypt.DefaultCost
+
+	g.When("VerifyPassword is called", func() {
+		g.It("accepts the bcrypt hashes made before argon2id was supported", func() {
+			str, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+			m.Expect(err).To(m.BeNil())
+			m.Expect(utils.VerifyPassword(string(str), "password")).To(m.Succeed())
+			m.Expect(utils.VerifyPassword(string(str), "wrong")).To(m.MatchError(utils.ErrPasswordMismatch))
+		})
+
+		g.It("rejects a wrong password", func() {
+			str, err := utils.HashPassword("password")
+			m.Expect(err).To(m.BeNil())
+			m.Expect(utils.VerifyPassword(str, "wrong")).To(m.MatchError(utils.ErrPasswordMismatch))
+		})
+
+		g.It("rejects hashes of unknown algorithms", func() {
+			m.Expect(utils.VerifyPassword("", "")).To(m.MatchError(utils.ErrUnknownPasswordHash))
+			m.Expect(utils.VerifyPassword("$md5$abc", "password")).To(m.MatchError(utils.ErrUnknownPasswordHash))
+		})
+
+		g.It("rejects malformed argon2id hashes", func() {
+			m.Expect(utils.VerifyPassword("$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5", "password")).ToNot(m.Succeed())
+			m.Expect(utils.VerifyPassword("$argon2id$v=19$m=1024,t=1,p=1$c2FsdA", "password")).ToNot(m.Succeed())
+		})
+	})
+
+	g.When("PasswordNeedsRehash is called", func() {
+		g.It("returns false for a hash made with the current parameters", func() {
+			str, err := utils.HashPassword("password")
+			m.Expect(err).To(m.BeNil())
+			m.Expect(utils.PasswordNeedsRehash(str)).To(m.BeFalse())
+		})
+
+		g.It("returns true for a hash made with other parameters", func() {
+			str, err := utils.NewArgon2idHasher(2048, 1, 1).Hash("password")
+			m.Expect(err).To(m.BeNil())
+			m.Expect(utils.PasswordNeedsRehash(str)).To(m.BeTrue())
+		})
+
+		g.It("returns true for a hash made with another algorithm", func() {
+			str, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+			m.Expect(err).To(m.BeNil())
+			m.Expect(utils.PasswordNeedsRehash(string(str))).To(m.BeTrue())
+		})
+
+		g.It("returns true for a bcrypt hash with an outdated cost", func() {
+			utils.PasswordHashing = &utils.BcryptHasher{Cost: bcrypt.MinCost + 1}
+			str, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+			m.Expect(err).To(m.BeNil())
+			m.Expect(utils.PasswordNeedsRehash(string(str))).To(m.BeTrue())
+		})
+	})
+
+	g.When("NewPasswordHasher is called", func() {
+		g.It("defaults to argon2id", func() {
+			hasher, err := utils.NewPasswordHasher(&utils.Config{})
+			m.Expect(err).To(m.BeNil())
+			m.Expect(hasher.Algorithm()).To(m.Equal(utils.PasswordAlgorithmArgon2id))
+		})
+
+		g.It("fails for an unknown algorithm", func() {
+			_, err := utils.NewPasswordHasher(&utils.Config{PasswordHashAlgorithm: "md5"})
+			m.Expect(err).ToNot(m.BeNil())
+		})
+
+		g.It("fails for an invalid bcrypt cost", func() {
+			_, err := utils.NewPasswordHasher(&utils.Config{PasswordHashAlgorithm: "bcrypt", BcryptCost: 100})
+			m.Expect(err).ToNot(m.BeNil())
+		})
 	})
 })
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	PasswordRuleMinLength    = "min_length"
+	PasswordRuleMaxLength    = "max_length"
+	PasswordRulePersonalInfo = "personal_info"
+	PasswordRuleCommon       = "common"
+	PasswordRuleBreached     = "breached"
+
+	defaultPasswordMinLength = 8
+	defaultPasswordMaxLength = 128
+	// parts of names and email addresses shorter than this are too likely to be found in any password
+	minPersonalInfoLength = 3
+	// length of the SHA-1 prefixes the breached password ranges are split by
+	breachedRangePrefixLength = 5
+)
+
+// commonPasswords lists the most common passwords, the most common first.
+//
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	MinLength         int
+	MaxLength         int
+	AllowPersonalInfo bool
+	// common holds the passwords that are too common to be used, in lower case
+	common map[string]struct{}
+	// breachedRangesPath is a directory of Pwned Passwords ranges, one file per SHA-1 prefix
+	breachedRangesPath string
+}
+
+// PasswordPolicyError lists the rules a password breaks.
+type PasswordPolicyError struct {
+	Rules []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Rules))
+	for _, rule := range e.Rules {
+		messages = append(messages, passwordRuleMessages[rule])
+	}
+	return "password " + strings.Join(messages, ", ")
+}
+
+var passwordRuleMessages = map[string]string{
+	PasswordRuleMinLength:    "is too short",
+	PasswordRuleMaxLength:    "is too long",
+	PasswordRulePersonalInfo: "must not contain your name or email address",
+	PasswordRuleCommon:       "is too common",
+	PasswordRuleBreached:     "appeared in a data breach",
+}
+
+// NewPasswordPolicy returns the password policy set by the PASSWORD_ settings.
+func NewPasswordPolicy(config *Config) *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength:          config.PasswordMinLength,
+		MaxLength:          config.PasswordMaxLength,
+		AllowPersonalInfo:  config.PasswordAllowPersonalInfo,
+		common:             map[string]struct{}{},
+		breachedRangesPath: config.PasswordBreachedRangesPath,
+	}
+	if policy.MinLength <= 0 {
+		policy.MinLength = defaultPasswordMinLength
+	}
+	if policy.MaxLength <= 0 {
+		policy.MaxLength = defaultPasswordMaxLength
+	}
+
+	if limit := config.PasswordCommonLimit; limit >= 0 {
+		scanner := bufio.NewScanner(strings.NewReader(commonPasswords))
+		for (limit == 0 || len(policy.common) < limit) && scanner.Scan() {
+			if password := strings.TrimSpace(scanner.Text()); password != "" {
+				policy.common[strings.ToLower(password)] = struct{}{}
+			}
+		}
+	}
+
+	if policy.breachedRangesPath != "" {
+		if info, err := os.Stat(policy.breachedRangesPath); err != nil || !info.IsDir() {
+			log.Warn().Str("path", policy.breachedRangesPath).
+				Msg("PASSWORD_BREACHED_RANGES_PATH is not a directory, passwords are not checked against breaches")
+			policy.breachedRangesPath = ""
+		}
+	}
+
+	return policy
+}
+
+// Check returns a PasswordPolicyError listing the rules the password breaks, if any. The personal information is
+// the name and email address of the user, which the password must not contain.
+func (p *PasswordPolicy) Check(password string, personalInfo ...string) error {
+	var rules []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		rules = append(rules, PasswordRuleMinLength)
+	}
+	if length > p.MaxLength {
+		rules = append(rules, PasswordRuleMaxLength)
+	}
+	if !p.AllowPersonalInfo && containsPersonalInfo(password, personalInfo) {
+		rules = append(rules, PasswordRulePersonalInfo)
+	}
+	if _, ok := p.common[strings.ToLower(password)]; ok {
+		rules = append(rules, PasswordRuleCommon)
+	}
+	if p.breachedRangesPath != "" {
+		breached, err := p.breached(password)
+		if err != nil {
+			// the other rules still apply, so a missing range doesn't keep users from choosing a password
+			log.Err(err).Msg("failed to check password against breaches")
+		} else if breached {
+			rules = append(rules, PasswordRuleBreached)
+		}
+	}
+
+	if len(rules) > 0 {
+		return &PasswordPolicyError{Rules: rules}
+	}
+	return nil
+}
+
+// containsPersonalInfo returns whether the password contains the name or email address of the user, or a part of
+// them. Only the local part of an email address counts, its domain is shared with many other users and words like
+// "com" would rule out lots of passwords.
+func containsPersonalInfo(password string, personalInfo []string) bool {
+	password = strings.ToLower(password)
+
+	var parts []string
+	for _, info := range personalInfo {
+		info = strings.ToLower(info)
+		if local, _, ok := strings.Cut(info, "@"); ok {
+			info = local
+		}
+		parts = append(parts, info)
+		parts = append(parts, strings.FieldsFunc(info, func(r rune) bool {
+			return r == ' ' || r == '.' || r == '_' || r == '-' || r == '+'
+		})...)
+	}
+
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= minPersonalInfoLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// breached looks the password up in the Pwned Passwords range of its SHA-1 prefix, which lists the suffixes of the
+// hashes sharing that prefix like the k-anonymity API does, so only one small file has to be read.
+func (p *PasswordPolicy) breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedRangePrefixLength], hash[breachedRangePrefixLength:]
+
+	file, err := os.Open(filepath.Join(p.breachedRangesPath, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(p.breachedRangesPath, prefix))
+	}
+	if err != nil {
+		return false, fmt.Errorf("opening range %s: %w", prefix, err)
+	}
+	defer file.Close()
+
+	// lines are "<suffix>:<count>"
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("reading range %s: %w", prefix, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,130 @@
+package utils_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"pinman/internal/utils"
+	"strings"
+
+	g "github.com/onsi/ginkgo/v2"
+	m "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("passwordpolicy.go", func() {
+	var config *utils.Config
+
+	var rules = func(err error) []string {
+		policyErr, ok := err.(*utils.PasswordPolicyError)
+		m.Expect(ok).To(m.BeTrue())
+		return policyErr.Rules
+	}
+
+	g.BeforeEach(func() {
+		config = &utils.Config{PasswordCommonLimit: 1000}
+	})
+
+	g.When("Check is called", func() {
+		g.It("accepts a password that follows every rule", func() {
+			policy := utils.NewPasswordPolicy(config)
+			m.Expect(policy.Check("correct horse battery staple", "John Doe", "john@example.com")).To(m.Succeed())
+		})
+
+		g.It("rejects passwords that are too short or too long", func() {
+			config.PasswordMinLength = 10
+			config.PasswordMaxLength = 20
+			policy := utils.NewPasswordPolicy(config)
+
+			m.Expect(rules(policy.Check("tr0ub4dor"))).To(m.Equal([]string{utils.PasswordRuleMinLength}))
+			m.Expect(rules(policy.Check(strings.Repeat("x", 21)))).To(m.Equal([]string{utils.PasswordRuleMaxLength}))
+		})
+
+		g.It("counts characters rather than bytes", func() {
+			policy := utils.NewPasswordPolicy(config)
+			m.Expect(policy.Check("ŝŝŝŝŝŝŝ")).ToNot(m.Succeed())
+			m.Expect(policy.Check("ŝŝŝŝŝŝŝŝ")).To(m.Succeed())
+		})
+
+		g.It("rejects passwords containing the name or email address", func() {
+			policy := utils.NewPasswordPolicy(config)
+
+			m.Expect(rules(policy.Check("Johnathan2024!", "Johnathan Doe", "jd@example.com"))).
+				To(m.Equal([]string{utils.PasswordRulePersonalInfo}))
+			m.Expect(rules(policy.Check("my-jdoe42-secret", "Jane", "jdoe42@example.com"))).
+				To(m.Equal([]string{utils.PasswordRulePersonalInfo}))
+		})
+
+		g.It("ignores the domain of the email address", func() {
+			policy := utils.NewPasswordPolicy(config)
+
+			m.Expect(policy.Check("comfortable horse battery", "John Doe", "john@example.com")).To(m.Succeed())
+			m.Expect(policy.Check("example staple battery", "John Doe", "john.doe@example.com")).To(m.Succeed())
+			m.Expect(rules(policy.Check("battery doe staple", "John", "john.doe@example.com"))).
+				To(m.Equal([]string{utils.PasswordRulePersonalInfo}))
+		})
+
+		g.It("allows personal information when configured", func() {
+			config.PasswordAllowPersonalInfo = true
+			policy := utils.NewPasswordPolicy(config)
+			m.Expect(policy.Check("Johnathan2024!", "Johnathan Doe", "jd@example.com")).To(m.Succeed())
+		})
+
+		g.It("rejects the most common passwords", func() {
+			policy := utils.NewPasswordPolicy(config)
+			m.Expect(rules(policy.Check("Password1"))).To(m.Equal([]string{utils.PasswordRuleCommon}))
+			m.Expect(rules(policy.Check("1234"))).To(m.ConsistOf(utils.PasswordRuleMinLength, utils.PasswordRuleCommon))
+		})
+
+		g.It("only rejects the configured number of common passwords", func() {
+			config.PasswordCommonLimit = 2
+			policy := utils.NewPasswordPolicy(config)
+			m.Expect(rules(policy.Check("password"))).To(m.Equal([]string{utils.PasswordRuleCommon}))
+			m.Expect(policy.Check("12345678")).To(m.Succeed())
+
+			config.PasswordCommonLimit = -1
+			policy = utils.NewPasswordPolicy(config)
+			m.Expect(policy.Check("password")).To(m.Succeed())
+		})
+
+		g.It("rejects every bundled common password when no limit is configured", func() {
+			config.PasswordCommonLimit = 0
+			policy := utils.NewPasswordPolicy(config)
+			m.Expect(rules(policy.Check("12345678"))).To(m.Equal([]string{utils.PasswordRuleCommon}))
+		})
+
+		g.Context("with breached password ranges", func() {
+			g.BeforeEach(func() {
+				dir := g.GinkgoT().TempDir()
+				sum := sha1.Sum([]byte("breached password"))
+				hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+				content := "0018A45C4D1DEF81644B54AB7F969B88D65:1\n" + hash[5:] + ":42\n"
+				m.Expect(os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(content), 0o644)).To(m.Succeed())
+				config.PasswordBreachedRangesPath = dir
+			})
+
+			g.It("rejects passwords found in a breach", func() {
+				policy := utils.NewPasswordPolicy(config)
+				m.Expect(rules(policy.Check("breached password"))).To(m.Equal([]string{utils.PasswordRuleBreached}))
+			})
+
+			g.It("accepts passwords whose range is missing", func() {
+				policy := utils.NewPasswordPolicy(config)
+				m.Expect(policy.Check("correct horse battery staple")).To(m.Succeed())
+			})
+		})
+
+		g.It("ignores a breached ranges path that doesn't exist", func() {
+			config.PasswordBreachedRangesPath = filepath.Join(g.GinkgoT().TempDir(), "missing")
+			policy := utils.NewPasswordPolicy(config)
+			m.Expect(policy.Check("correct horse battery staple")).To(m.Succeed())
+		})
+	})
+
+	g.When("the error is formatted", func() {
+		g.It("lists the broken rules", func() {
+			err := &utils.PasswordPolicyError{Rules: []string{utils.PasswordRuleMinLength, utils.PasswordRuleCommon}}
+			m.Expect(err.Error()).To(m.Equal("password is too short, is too common"))
+		})
+	})
+})
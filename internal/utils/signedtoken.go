@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token has expired")
+)
+
+// SignToken returns a URL-safe token carrying subject that can only be verified for the same purpose, and only
+// until expiresAt. The token is not encrypted, subject must not contain secrets.
+func SignToken(key []byte, purpose string, subject string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%s\n%s\n%d", purpose, subject, expiresAt.Unix())),
+	)
+
+	return fmt.Sprintf("%s.%s", payload, signTokenPayload(key, payload))
+}
+
+// VerifySignedToken checks that token was signed with key for purpose and has not expired, and returns its subject.
+func VerifySignedToken(key []byte, purpose string, token string) (string, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signTokenPayload(key, payload))) {
+		return "", ErrInvalidToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	parts := strings.Split(string(decoded), "\n")
+	if len(parts) != 3 || parts[0] != purpose {
+		return "", ErrInvalidToken
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() > expiresAt {
+		return "", ErrTokenExpired
+	}
+
+	return parts[1], nil
+}
+
+func signTokenPayload(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
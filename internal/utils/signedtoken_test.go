@@ -0,0 +1,54 @@
+package utils_test
+
+import (
+	g "github.com/onsi/ginkgo/v2"
+	m "github.com/onsi/gomega"
+	"pinman/internal/utils"
+	"time"
+)
+
+var _ = g.Describe("signedtoken.go", func() {
+	key := []byte("secret")
+
+	g.When("VerifySignedToken is called", func() {
+		g.Context("with a valid token", func() {
+			g.It("returns the subject", func() {
+				token := utils.SignToken(key, "verify-email", "subject", time.Now().Add(time.Hour))
+				subject, err := utils.VerifySignedToken(key, "verify-email", token)
+				m.Expect(err).To(m.BeNil())
+				m.Expect(subject).To(m.Equal("subject"))
+			})
+		})
+
+		g.Context("with an expired token", func() {
+			g.It("returns ErrTokenExpired", func() {
+				token := utils.SignToken(key, "verify-email", "subject", time.Now().Add(-time.Minute))
+				_, err := utils.VerifySignedToken(key, "verify-email", token)
+				m.Expect(err).To(m.MatchError(utils.ErrTokenExpired))
+			})
+		})
+
+		g.Context("with a token signed for another purpose", func() {
+			g.It("returns ErrInvalidToken", func() {
+				token := utils.SignToken(key, "reset-password", "subject", time.Now().Add(time.Hour))
+				_, err := utils.VerifySignedToken(key, "verify-email", token)
+				m.Expect(err).To(m.MatchError(utils.ErrInvalidToken))
+			})
+		})
+
+		g.Context("with a token signed with another key", func() {
+			g.It("returns ErrInvalidToken", func() {
+				token := utils.SignToken([]byte("other"), "verify-email", "subject", time.Now().Add(time.Hour))
+				_, err := utils.VerifySignedToken(key, "verify-email", token)
+				m.Expect(err).To(m.MatchError(utils.ErrInvalidToken))
+			})
+		})
+
+		g.Context("with a malformed token", func() {
+			g.It("returns ErrInvalidToken", func() {
+				_, err := utils.VerifySignedToken(key, "verify-email", "not-a-token")
+				m.Expect(err).To(m.MatchError(utils.ErrInvalidToken))
+			})
+		})
+	})
+})
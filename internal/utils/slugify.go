@@ -1,60 +1,105 @@
 package utils
 
-// Source: https://github.com/metal3d/go-slugify/blob/master/main.go
-// Package slugify provide a function that
-// gives a non accentuated and minus separated string from a
-// accentuated string. The code is based from a Javascript function
-// that you can get here:
-// http://irz.fr/slugme-permalien-javascript-slug/
-
 import (
-	"regexp"
+	"golang.org/x/text/unicode/norm"
 	"strings"
+	"unicode"
 )
 
-// Replacement structure
-type replacement struct {
-	re *regexp.Regexp
-	ch string
+// transliterations spell the letters that don't decompose to ASCII letters and accents. Cyrillic letters like й and ё
+// decompose, but are listed because their marks change how they are spelled.
+var transliterations = map[rune]string{
+	// Latin
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'ħ': "h", 'ı': "i", 'ł': "l", 'ŋ': "ng", 'þ': "th",
+	'ŧ': "t",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'ґ': "g", 'д': "d", 'ђ': "dj", 'е': "e", 'ё': "yo", 'є': "ye", 'ж': "zh",
+	'з': "z", 'ѕ': "dz", 'и': "i", 'і': "i", 'ї': "yi", 'й': "y", 'ј': "j", 'к': "k", 'л': "l", 'љ': "lj", 'м': "m",
+	'н': "n", 'њ': "nj", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'ћ': "c", 'у': "u", 'ў': "u", 'ф': "f",
+	'х': "kh", 'ц': "ts", 'ч': "ch", 'џ': "dz", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l",
+	'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f",
+	'χ': "ch", 'ψ': "ps", 'ω': "o",
+	// Arabic, short vowels are marks and left out like accents
+	'ا': "a", 'أ': "a", 'إ': "i", 'آ': "a", 'ب': "b", 'ت': "t", 'ث': "th", 'ج': "j", 'ح': "h", 'خ': "kh", 'د': "d",
+	'ذ': "dh", 'ر': "r", 'ز': "z", 'س': "s", 'ش': "sh", 'ص': "s", 'ض': "d", 'ط': "t", 'ظ': "z", 'ع': "", 'غ': "gh",
+	'ف': "f", 'ق': "q", 'ك': "k", 'ل': "l", 'م': "m", 'ن': "n", 'ه': "h", 'و': "w", 'ي': "y", 'ى': "a", 'ة': "a",
+	'ء': "", 'ؤ': "w", 'ئ': "y", 'پ': "p", 'چ': "ch", 'ژ': "zh", 'گ': "g", 'ک': "k", 'ی': "y", 'ـ': "",
+	'٠': "0", '١': "1", '٢': "2", '٣': "3", '٤': "4", '٥': "5", '٦': "6", '٧': "7", '٨': "8", '٩': "9",
+	// Hebrew, vowel points are marks and left out like accents
+	'א': "a", 'ב': "b", 'ג': "g", 'ד': "d", 'ה': "h", 'ו': "v", 'ז': "z", 'ח': "kh", 'ט': "t", 'י': "y", 'כ': "k",
+	'ך': "k", 'ל': "l", 'מ': "m", 'ם': "m", 'נ': "n", 'ן': "n", 'ס': "s", 'ע': "", 'פ': "p", 'ף': "f", 'צ': "ts",
+	'ץ': "ts", 'ק': "k", 'ר': "r", 'ש': "sh", 'ת': "t", '׳': "", '״': "",
+	// apostrophes join the parts of a word, so "John's" becomes "johns"
+	'\'': "", '’': "", 'ʼ': "",
 }
 
-// Build regexps and replacements
-var (
-	rExps = []replacement{
-		{re: regexp.MustCompile(`[\xC0-\xC6]`), ch: "A"},
-		{re: regexp.MustCompile(`[\xE0-\xE6]`), ch: "a"},
-		{re: regexp.MustCompile(`[\xC8-\xCB]`), ch: "E"},
-		{re: regexp.MustCompile(`[\xE8-\xEB]`), ch: "e"},
-		{re: regexp.MustCompile(`[\xCC-\xCF]`), ch: "I"},
-		{re: regexp.MustCompile(`[\xEC-\xEF]`), ch: "i"},
-		{re: regexp.MustCompile(`[\xD2-\xD6]`), ch: "O"},
-		{re: regexp.MustCompile(`[\xF2-\xF6]`), ch: "o"},
-		{re: regexp.MustCompile(`[\xD9-\xDC]`), ch: "U"},
-		{re: regexp.MustCompile(`[\xF9-\xFC]`), ch: "u"},
-		{re: regexp.MustCompile(`[\xC7-\xE7]`), ch: "c"},
-		{re: regexp.MustCompile(`\xD1`), ch: "N"},
-		{re: regexp.MustCompile(`\xF1`), ch: "n"},
-	}
-	spacereg       = regexp.MustCompile(`\s+`)
-	noncharreg     = regexp.MustCompile(`[^A-Za-z0-9-]`)
-	minusrepeatreg = regexp.MustCompile(`-{2,}`)
-)
-
-// Slugify function returns slugifies string "s"
+// Slugify returns the words of s in lower case ASCII letters and digits, separated by dashes. Accents are removed and
+// Cyrillic, Greek, Arabic and Hebrew letters are transliterated, while letters of other scripts separate words like
+// punctuation does.
+// With a max length the words that don't fit are left out, only a first word that is too long on its own is cut.
 func Slugify(s string, maxLength ...int) string {
-	if len(maxLength) > 0 && maxLength[0] > 0 && len(s) > maxLength[0] {
-		s = s[:maxLength[0]]
+	limit := 0
+	if len(maxLength) > 0 {
+		limit = maxLength[0]
 	}
 
-	for _, r := range rExps {
-		s = r.re.ReplaceAllString(s, r.ch)
+	var slug strings.Builder
+	for _, word := range slugWords(s) {
+		length := slug.Len() + len(word)
+		if slug.Len() > 0 {
+			length++
+		}
+		if limit > 0 && length > limit {
+			if slug.Len() == 0 {
+				// words are ASCII, so cutting bytes cuts runes
+				slug.WriteString(word[:limit])
+			}
+			break
+		}
+		if slug.Len() > 0 {
+			slug.WriteByte('-')
+		}
+		slug.WriteString(word)
 	}
+	return slug.String()
+}
 
-	s = strings.ToLower(s)
-	s = strings.TrimSpace(s)
-	s = spacereg.ReplaceAllString(s, "-")
-	s = noncharreg.ReplaceAllString(s, "")
-	s = minusrepeatreg.ReplaceAllString(s, "-")
+// slugWords splits s into words of ASCII letters and digits.
+func slugWords(s string) []string {
+	var words []string
+	var word strings.Builder
+	endWord := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
 
-	return s
+	for _, r := range strings.ToLower(s) {
+		if spelling, ok := transliterations[r]; ok {
+			word.WriteString(spelling)
+			continue
+		}
+		// the compatibility decomposition splits accents off their letters, and turns ligatures like ﬁ and digits
+		// like ² into their ASCII counterparts
+		for _, d := range norm.NFKD.String(string(r)) {
+			if spelling, ok := transliterations[d]; ok {
+				word.WriteString(spelling)
+				continue
+			}
+			switch {
+			case d <= unicode.MaxASCII && (unicode.IsLetter(d) || unicode.IsDigit(d)):
+				word.WriteRune(unicode.ToLower(d))
+			case unicode.Is(unicode.Mn, d):
+				// accents
+			default:
+				endWord()
+			}
+		}
+	}
+	endWord()
+	return words
 }
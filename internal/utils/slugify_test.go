@@ -28,4 +28,29 @@ var _ = ginkgo.Describe("Slugify", func() {
 			gomega.Expect(utils.Slugify(value, 17)).To(gomega.Equal(expected))
 		})
 	})
+	ginkgo.Context("when it receives accented and non-Latin names", func() {
+		ginkgo.It("should transliterate them", func() {
+			gomega.Expect(utils.Slugify("Café Flipper")).To(gomega.Equal("cafe-flipper"))
+			gomega.Expect(utils.Slugify("Straße & Søn's Spielhölle")).To(gomega.Equal("strasse-sons-spielholle"))
+			gomega.Expect(utils.Slugify("Пинбол Клуб Ёлка")).To(gomega.Equal("pinbol-klub-yolka"))
+			gomega.Expect(utils.Slugify("Φλίπερ Αθήνα")).To(gomega.Equal("fliper-athina"))
+			gomega.Expect(utils.Slugify("ﬁnal ²")).To(gomega.Equal("final-2"))
+			gomega.Expect(utils.Slugify("نادي الفليبر ٢٤")).To(gomega.Equal("nady-alflybr-24"))
+			gomega.Expect(utils.Slugify("مَقْهَى الكُرَة")).To(gomega.Equal("mqha-alkra"))
+			gomega.Expect(utils.Slugify("פינבול תל אביב")).To(gomega.Equal("pynbvl-tl-abyb"))
+			gomega.Expect(utils.Slugify("שָׁלוֹם")).To(gomega.Equal("shlvm"))
+		})
+	})
+	ginkgo.Context("when it receives letters it can't transliterate", func() {
+		ginkgo.It("should leave them out", func() {
+			gomega.Expect(utils.Slugify("東京 Pinball")).To(gomega.Equal("pinball"))
+			gomega.Expect(utils.Slugify("東京")).To(gomega.Equal(""))
+		})
+	})
+	ginkgo.Context("when a multi-byte name is longer than the max length", func() {
+		ginkgo.It("should cut it on word boundaries after transliterating", func() {
+			gomega.Expect(utils.Slugify("Café Flipper Montréal", 12)).To(gomega.Equal("cafe-flipper"))
+			gomega.Expect(utils.Slugify("Щёлковский", 5)).To(gomega.Equal("shchy"))
+		})
+	})
 })
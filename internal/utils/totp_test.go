@@ -0,0 +1,71 @@
+package utils_test
+
+import (
+	"encoding/base32"
+	g "github.com/onsi/ginkgo/v2"
+	m "github.com/onsi/gomega"
+	"net/url"
+	"pinman/internal/utils"
+	"time"
+)
+
+var _ = g.Describe("totp.go", func() {
+	// the SHA1 secret of the test vectors in RFC 6238 appendix B
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	g.When("TOTPCode is called", func() {
+		g.It("returns the codes of the RFC 6238 test vectors", func() {
+			vectors := map[int64]string{
+				59:         "287082",
+				1111111109: "081804",
+				1111111111: "050471",
+				1234567890: "005924",
+				2000000000: "279037",
+			}
+			for unix, code := range vectors {
+				actual, err := utils.TOTPCode(secret, utils.TOTPStep(time.Unix(unix, 0)))
+				m.Expect(err).To(m.BeNil())
+				m.Expect(actual).To(m.Equal(code))
+			}
+		})
+	})
+
+	g.When("ValidateTOTP is called", func() {
+		now := time.Unix(1111111109, 0)
+
+		g.It("accepts the code of the current period and returns it", func() {
+			step, ok := utils.ValidateTOTP(secret, "081804", now)
+			m.Expect(ok).To(m.BeTrue())
+			m.Expect(step).To(m.Equal(utils.TOTPStep(now)))
+		})
+
+		g.It("accepts the code of the previous period", func() {
+			_, ok := utils.ValidateTOTP(secret, "081804", now.Add(utils.TOTPPeriod))
+			m.Expect(ok).To(m.BeTrue())
+		})
+
+		g.It("rejects older codes and wrong codes", func() {
+			_, ok := utils.ValidateTOTP(secret, "081804", now.Add(2*utils.TOTPPeriod))
+			m.Expect(ok).To(m.BeFalse())
+			_, ok = utils.ValidateTOTP(secret, "123456", now)
+			m.Expect(ok).To(m.BeFalse())
+			_, ok = utils.ValidateTOTP(secret, "", now)
+			m.Expect(ok).To(m.BeFalse())
+		})
+	})
+
+	g.When("TOTPProvisioningURI is called", func() {
+		g.It("returns an otpauth URI with the secret", func() {
+			generated, err := utils.GenerateTOTPSecret()
+			m.Expect(err).To(m.BeNil())
+
+			uri, err := url.Parse(utils.TOTPProvisioningURI("Pinman", "player@example.com", generated))
+			m.Expect(err).To(m.BeNil())
+			m.Expect(uri.Scheme).To(m.Equal("otpauth"))
+			m.Expect(uri.Host).To(m.Equal("totp"))
+			m.Expect(uri.Path).To(m.Equal("/Pinman:player@example.com"))
+			m.Expect(uri.Query().Get("secret")).To(m.Equal(generated))
+			m.Expect(uri.Query().Get("issuer")).To(m.Equal("Pinman"))
+		})
+	})
+})
@@ -1,11 +1,45 @@
 package utils
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
 
 func PtrString(str string) *string {
 	return &str
 }
 
+func PtrInt(i int) *int {
+	return &i
+}
+
+func PtrBool(b bool) *bool {
+	return &b
+}
+
 func FormatTime(t time.Time) string {
 	return t.Format(time.RFC3339Nano)
 }
+
+// FormatTimePtr formats t like FormatTime, returning nil if t is nil.
+func FormatTimePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := FormatTime(*t)
+	return &formatted
+}
+
+// FormatDeletedAt formats when a soft deleted record was deleted, returning nil if it wasn't.
+func FormatDeletedAt(deletedAt gorm.DeletedAt) *string {
+	if !deletedAt.Valid {
+		return nil
+	}
+	return FormatTimePtr(&deletedAt.Time)
+}
+
+// EscapeLike makes the wildcards of LIKE patterns match themselves.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -25,6 +25,16 @@ var _ = g.Describe("utils.go", func() {
 		})
 	})
 
+	g.When("PtrInt is called", func() {
+		g.It("returns a pointer to an int with same value", func() {
+			val := 42
+			ptrVal := utils.PtrInt(val)
+
+			m.Expect(ptrVal).To(m.BeAssignableToTypeOf(&val))
+			m.Expect(ptrVal).To(m.BeEquivalentTo(&val))
+		})
+	})
+
 	g.When("FormatTime is called", func() {
 		g.It("returns the time formatted in RFC3339", func() {
 			val, _ := time.Parse(time.RFC3339Nano, time.Now().Format(time.RFC3339Nano))
@@ -35,4 +45,14 @@ var _ = g.Describe("utils.go", func() {
 			m.Expect(timeResult).To(m.BeEquivalentTo(val))
 		})
 	})
+
+	g.When("FormatTimePtr is called", func() {
+		g.It("returns nil if the time is nil", func() {
+			m.Expect(utils.FormatTimePtr(nil)).To(m.BeNil())
+		})
+		g.It("returns the time formatted in RFC3339", func() {
+			val := time.Now()
+			m.Expect(*utils.FormatTimePtr(&val)).To(m.Equal(utils.FormatTime(val)))
+		})
+	})
 })
@@ -13,6 +13,11 @@ func main() {
 		log.Fatal().Err(err).Msg("could not load environment variables")
 	}
 
+	utils.PasswordHashing, err = utils.NewPasswordHasher(config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid password hashing settings")
+	}
+
 	gormDb, err := utils.ConnectDB(config)
 	if err != nil {
 		log.Fatal().Err(err).Msg("could not connect to DB")
@@ -1,6 +1,6 @@
-import {Api, Token, TOKEN_KEY} from "./api";
+import {Api, CSRF_TOKEN_HEADER, Token, TOKEN_KEY} from "./api";
 import {faker} from "@faker-js/faker";
-import {AuthApi, ErrorResponse, TokenResponse, UsersApi} from "./generated";
+import {AuthApi, ErrorResponse, TokenResponse, TwoFactorChallenge, UsersApi} from "./generated";
 import axios from "axios";
 
 jest.mock('./generated')
@@ -45,11 +45,24 @@ describe('Api.tryTokenRefresh()', () => {
     expect(localStorageSpy).toBeCalledTimes(1)
     expect(result).toBe(false)
   })
+  it('returns true if a token without refresh token has not expired yet', async () => {
+    const localStorageSpy = jest.spyOn(Storage.prototype, 'getItem')
+    const token: Token = {
+      token: faker.random.alphaNumeric(64),
+      expires: new Date(Date.now() + 1000 * 60 * 4)
+    }
+    localStorageSpy.mockReturnValueOnce(JSON.stringify(token))
+
+    const result = await new Api().tryTokenRefresh()
+    expect(localStorageSpy).toBeCalledTimes(1)
+    expect(result).toBe(true)
+  })
   it('returns true if token is refreshed successfully', async () => {
     const localStorageGetSpy = jest.spyOn(Storage.prototype, 'getItem')
     const token: Token = {
       token: faker.random.alphaNumeric(64),
-      expires: new Date(Date.now() + 1000 * 60 * 4)
+      expires: new Date(Date.now() - 1000 * 60 * 4),
+      refreshToken: faker.random.alphaNumeric(43)
     }
     localStorageGetSpy.mockReturnValueOnce(JSON.stringify(token))
 
@@ -58,9 +71,10 @@ describe('Api.tryTokenRefresh()', () => {
     const mockedAuthApi = jest.mocked(AuthApi)
     const refreshResult: TokenResponse = {
       access_token: faker.random.alphaNumeric(64),
-      expire: new Date(Date.now() + 60 * 60 * 1000).toISOString()
+      expire: new Date(Date.now() + 60 * 60 * 1000).toISOString(),
+      refresh_token: faker.random.alphaNumeric(43)
     }
-    mockedAuthApi.prototype.authRefreshGet.mockResolvedValue({
+    mockedAuthApi.prototype.authRefreshPost.mockResolvedValue({
       config: {},
       data: refreshResult,
       headers: {},
@@ -69,11 +83,45 @@ describe('Api.tryTokenRefresh()', () => {
     })
     const refreshedToken: Token = {
       token: refreshResult.access_token,
-      expires: new Date(Date.parse(refreshResult.expire))
+      expires: new Date(Date.parse(refreshResult.expire)),
+      refreshToken: refreshResult.refresh_token
     }
 
     const result = await new Api().tryTokenRefresh()
     expect(localStorageGetSpy).toBeCalledTimes(1)
+    expect(mockedAuthApi.prototype.authRefreshPost).toBeCalledWith({refresh_token: token.refreshToken})
+    expect(localStorageSetSpy).toBeCalledWith(TOKEN_KEY, JSON.stringify(refreshedToken))
+    expect(result).toBe(true)
+  })
+  it('refreshes with the refresh token cookie in cookie mode', async () => {
+    const localStorageGetSpy = jest.spyOn(Storage.prototype, 'getItem')
+    const token: Token = {
+      expires: new Date(Date.now() + 1000 * 60 * 4),
+      csrfToken: faker.random.alphaNumeric(43)
+    }
+    localStorageGetSpy.mockReturnValueOnce(JSON.stringify(token))
+
+    const localStorageSetSpy = jest.spyOn(Storage.prototype, 'setItem')
+
+    const mockedAuthApi = jest.mocked(AuthApi)
+    const refreshResult: TokenResponse = {
+      expire: new Date(Date.now() + 60 * 60 * 1000).toISOString(),
+      csrf_token: faker.random.alphaNumeric(43)
+    }
+    mockedAuthApi.prototype.authRefreshPost.mockResolvedValue({
+      config: {},
+      data: refreshResult,
+      headers: {},
+      status: 200,
+      statusText: "Ok",
+    })
+    const refreshedToken: Token = {
+      expires: new Date(Date.parse(refreshResult.expire)),
+      csrfToken: refreshResult.csrf_token
+    }
+
+    const result = await new Api().tryTokenRefresh()
+    expect(mockedAuthApi.prototype.authRefreshPost).toBeCalledWith({})
     expect(localStorageSetSpy).toBeCalledWith(TOKEN_KEY, JSON.stringify(refreshedToken))
     expect(result).toBe(true)
   })
@@ -81,17 +129,18 @@ describe('Api.tryTokenRefresh()', () => {
     const localStorageGetSpy = jest.spyOn(Storage.prototype, 'getItem')
     const token: Token = {
       token: faker.random.alphaNumeric(64),
-      expires: new Date(Date.now() + 1000 * 60 * 4)
+      expires: new Date(Date.now() + 1000 * 60 * 4),
+      refreshToken: faker.random.alphaNumeric(43)
     }
     localStorageGetSpy.mockReturnValueOnce(JSON.stringify(token))
 
     const mockedAuthApi = jest.mocked(AuthApi)
     const refreshResult: ErrorResponse = {
       status: 401,
-      detail: "token is expired",
+      detail: "invalid or expired refresh token",
       title: "Unauthorized"
     }
-    mockedAuthApi.prototype.authRefreshGet.mockResolvedValue({
+    mockedAuthApi.prototype.authRefreshPost.mockResolvedValue({
       config: {},
       data: refreshResult as any,
       headers: {},
@@ -134,7 +183,31 @@ describe('Api.login', () => {
       token: loginResult.access_token,
       expires: new Date(Date.parse(loginResult.expire))
     })
-    expect(result).toBe(true)
+    expect(result).toBeUndefined()
+  })
+  it('returns the two-factor challenge instead of storing a token', async () => {
+    const mockedAuthApi = jest.mocked(AuthApi)
+    const challenge: TwoFactorChallenge = {
+      challenge_token: faker.random.alphaNumeric(64),
+      enrollment_required: false
+    }
+    mockedAuthApi.prototype.authLoginPost.mockResolvedValue({
+      config: {},
+      data: challenge as any,
+      headers: {},
+      status: 202,
+      statusText: "Accepted",
+    })
+
+    const setJwtSpy = jest.spyOn(Api.prototype, 'setJwtToken')
+
+    const result = await (new Api()).login({
+      username: faker.internet.email(),
+      password: faker.random.alphaNumeric(16)
+    })
+
+    expect(result).toEqual(challenge)
+    expect(setJwtSpy).toBeCalledTimes(0)
   })
   it('fails with invalid credentials',async () => {
     const mockedAuthApi = jest.mocked(AuthApi)
@@ -161,6 +234,65 @@ describe('Api.login', () => {
     expect(setJwtSpy).toBeCalledTimes(0)
   })
 })
+describe('Api.oidcLogin', () => {
+  it('stores the tokens of the login', async () => {
+    const mockedAuthApi = jest.mocked(AuthApi)
+    const loginResult: TokenResponse = {
+      access_token: faker.random.alphaNumeric(64),
+      expire: new Date(Date.now() + 60 * 60 * 1000).toISOString(),
+      refresh_token: faker.random.alphaNumeric(43)
+    }
+    mockedAuthApi.prototype.authOidcCallbackPost.mockResolvedValue({
+      config: {},
+      data: loginResult,
+      headers: {},
+      status: 200,
+      statusText: "Ok",
+    })
+
+    const setJwtSpy = jest.spyOn(Api.prototype, 'setJwtToken')
+
+    const result = await (new Api()).oidcLogin({code: "a-code", state: "a-state"})
+
+    expect(mockedAuthApi.prototype.authOidcCallbackPost).toBeCalledWith({code: "a-code", state: "a-state"})
+    expect(setJwtSpy).toBeCalledWith({
+      token: loginResult.access_token,
+      expires: new Date(Date.parse(loginResult.expire)),
+      refreshToken: loginResult.refresh_token
+    })
+    expect(result).toBeUndefined()
+  })
+})
+describe('Api.verifyTwoFactor', () => {
+  it('stores the tokens and returns the recovery codes', async () => {
+    const mockedAuthApi = jest.mocked(AuthApi)
+    const loginResult: TokenResponse = {
+      access_token: faker.random.alphaNumeric(64),
+      expire: new Date(Date.now() + 60 * 60 * 1000).toISOString(),
+      refresh_token: faker.random.alphaNumeric(43),
+      recovery_codes: ["abcde-fghij"]
+    }
+    mockedAuthApi.prototype.auth2faVerifyPost.mockResolvedValue({
+      config: {},
+      data: loginResult,
+      headers: {},
+      status: 200,
+      statusText: "Ok",
+    })
+
+    const setJwtSpy = jest.spyOn(Api.prototype, 'setJwtToken')
+
+    const result = await (new Api()).verifyTwoFactor({challenge_token: "a-token", code: "123456"})
+
+    expect(mockedAuthApi.prototype.auth2faVerifyPost).toBeCalledWith({challenge_token: "a-token", code: "123456"})
+    expect(setJwtSpy).toBeCalledWith({
+      token: loginResult.access_token,
+      expires: new Date(Date.parse(loginResult.expire)),
+      refreshToken: loginResult.refresh_token
+    })
+    expect(result).toEqual(["abcde-fghij"])
+  })
+})
 describe('Api.clearJwtToken', () => {
   it('should call localStorage.removeItem', () => {
     const removeItemSpy = jest.spyOn(Storage.prototype, 'removeItem')
@@ -244,6 +376,25 @@ describe('Api.accessToken', () => {
 
     new Api().userApi()
   })
+  it('sends the CSRF token instead in cookie mode', () => {
+    const localStorageSpy = jest.spyOn(Storage.prototype, 'getItem')
+    const token: Token = {
+      expires: new Date(Date.now() + 1000 * 60 * 10),
+      csrfToken: faker.random.alphaNumeric(43)
+    }
+    localStorageSpy.mockReturnValueOnce(JSON.stringify(token))
+
+    const mockUsersApi = jest.mocked(UsersApi)
+    mockUsersApi.mockImplementation((c) => {
+      expect(c).toBeDefined()
+      expect(c!.baseOptions.withCredentials).toBe(true)
+      expect(c!.baseOptions.headers[CSRF_TOKEN_HEADER]).toBe(token.csrfToken)
+
+      return {} as UsersApi
+    })
+
+    new Api().userApi()
+  })
   it('returns empty string if it was not available in storage', () => {
     const localStorageSpy = jest.spyOn(Storage.prototype, 'getItem')
     localStorageSpy.mockReturnValueOnce(null)
@@ -1,12 +1,31 @@
-import {AuthApi, Configuration, ErrorResponse, LeaguesApi, LocationsApi, UserLogin, UsersApi, TournamentsApi} from "./generated";
+import {
+  AuthApi,
+  Configuration,
+  ErrorResponse,
+  LeaguesApi,
+  LocationsApi,
+  OidcCallback,
+  UserLogin,
+  UsersApi,
+  TournamentsApi,
+  TokenResponse,
+  TotpEnrollment,
+  TwoFactorChallenge,
+  TwoFactorVerify
+} from "./generated";
 import {AxiosError} from "axios";
 
 export const TOKEN_KEY = 'token';
+export const OIDC_STATE_KEY = 'oidcState';
 export const REFRESH_DEADLINE = 5 * 1000 * 60 // 5 minutes
+export const CSRF_TOKEN_HEADER = 'X-CSRF-Token';
 
+// In cookie mode the server keeps the tokens in HttpOnly cookies, only their expiry and the CSRF token are known here
 export type Token = {
-  token: string
+  token?: string
   expires: Date
+  refreshToken?: string
+  csrfToken?: string
 }
 
 export class Api {
@@ -38,22 +57,22 @@ export class Api {
     const token = this.getJwtToken()
     if (token) {
 
-      // If the token is already expired, return false
-      if (token.expires.getTime() < new Date(Date.now()).getTime())
-        return false
+      const expiresIn = token.expires.getTime() - new Date(Date.now()).getTime()
 
       // If the token won't expire within thw REFRESH_DEADLINE, token is still valid
-      if (token.expires.getTime() - new Date(Date.now()).getTime() > REFRESH_DEADLINE) {
+      if (expiresIn > REFRESH_DEADLINE) {
         return true
       }
 
-      return await this.authApi().authRefreshGet().then(r => {
+      // Without a refresh token the token can't be renewed, it is only valid until it expires
+      if (!token.refreshToken && !token.csrfToken)
+        return expiresIn > 0
+
+      // in cookie mode the server takes the refresh token from its cookie
+      const refresh = token.refreshToken ? {refresh_token: token.refreshToken} : {}
+      return await this.authApi(token).authRefreshPost(refresh).then(r => {
         if (r.status === 200) {
-          this.setJwtToken({
-            token: r.data.access_token,
-            //TODO: UTC Date?
-            expires: new Date(Date.parse(r.data.expire))
-          })
+          this.saveTokenResponse(r.data)
           return true
         } else {
           console.error("refresh failed", r.config.data)
@@ -65,35 +84,89 @@ export class Api {
     return false
   }
 
-  public login(credentials: UserLogin): Promise<boolean> {
-    return this.authApi().authLoginPost(credentials).then<boolean>(r => {
+  // Saves the tokens of a successful login
+  private saveTokenResponse(response: TokenResponse) {
+    this.setJwtToken({
+      token: response.access_token,
+      //TODO: UTC Date?
+      expires: new Date(Date.parse(response.expire)),
+      refreshToken: response.refresh_token,
+      csrfToken: response.csrf_token
+    })
+  }
+
+  // Logs the user in. Users with two-factor authentication get a challenge to answer with verifyTwoFactor,
+  // otherwise the result is undefined.
+  public login(credentials: UserLogin): Promise<TwoFactorChallenge | undefined> {
+    return this.authApi().authLoginPost(credentials).then(r => {
+      if (r.status === 202) {
+        return r.data as TwoFactorChallenge
+      }
       if (r.status === 200) {
-        this.setJwtToken({
-          token: r.data.access_token,
-          //TODO: UTC Date?
-          expires: new Date(Date.parse(r.data.expire))
-        })
-        return true
+        this.saveTokenResponse(r.data as TokenResponse)
+        return undefined
       }
       console.error("Login failed", r.config.data)
       throw new Error((r.config.data as ErrorResponse).detail)
     })
   }
 
-  // Method used by the generated API client to get the access_token.
-  private accessToken(): string {
-    const token = Api.prototype.getJwtToken()
-    if (token) {
-      return token.token
-    }
+  // Sends the user to the login page of the OpenID Connect provider, which redirects back to /login/oidc
+  public startOidcLogin(): Promise<void> {
+    return this.authApi().authOidcAuthorizeGet().then(r => {
+      sessionStorage.setItem(OIDC_STATE_KEY, r.data.state)
+      window.location.assign(r.data.authorization_url)
+    })
+  }
 
-    return ""
-  };
+  // Finishes a login started with startOidcLogin, like login it can result in a two-factor challenge
+  public oidcLogin(callback: OidcCallback): Promise<TwoFactorChallenge | undefined> {
+    return this.authApi().authOidcCallbackPost(callback).then(r => {
+      if (r.status === 202) {
+        return r.data as TwoFactorChallenge
+      }
+      this.saveTokenResponse(r.data as TokenResponse)
+      return undefined
+    })
+  }
+
+  // Returns the secret for the authenticator app of a user who has to set up two-factor authentication to log in
+  public enrollTwoFactor(challenge: TwoFactorChallenge): Promise<TotpEnrollment> {
+    return this.authApi().auth2faEnrollPost({challenge_token: challenge.challenge_token}).then(r => r.data)
+  }
+
+  // Finishes a login with a two-factor authentication code. Returns the recovery codes if the login enabled
+  // two-factor authentication.
+  public verifyTwoFactor(verify: TwoFactorVerify): Promise<string[] | undefined> {
+    return this.authApi().auth2faVerifyPost(verify).then(r => {
+      this.saveTokenResponse(r.data)
+      return r.data.recovery_codes
+    })
+  }
 
-  private configuration(): Configuration {
+  // Forgets the token and revokes its session, so the refresh token can't be used anymore
+  public logout() {
+    const token = this.getJwtToken()
+    if (token?.refreshToken || token?.csrfToken) {
+      const logout = token.refreshToken ? {refresh_token: token.refreshToken} : {}
+      this.authApi(token).authLogoutPost(logout).catch(e => {
+        console.error("logout failed", e)
+      })
+    }
+    this.clearJwtToken()
+  }
+
+  private configuration(token: Token | undefined = this.getJwtToken()): Configuration {
     const openapiConfig = new Configuration();
     openapiConfig.basePath = process.env.REACT_APP_API_HOST
-    openapiConfig.accessToken = this.accessToken;
+    // Used by the generated API client to get the access_token, there is none in cookie mode
+    openapiConfig.accessToken = () => token?.token ?? ""
+    // lets the browser store and send the token cookies when the API is on another origin
+    openapiConfig.baseOptions = {withCredentials: true}
+    if (token?.csrfToken) {
+      // the cookies authenticate the requests, changing ones have to send the CSRF token too
+      openapiConfig.baseOptions.headers = {[CSRF_TOKEN_HEADER]: token.csrfToken}
+    }
     return openapiConfig;
   };
 
@@ -101,8 +174,9 @@ export class Api {
     return new UsersApi(this.configuration());
   };
 
-  public authApi(): AuthApi {
-    return new AuthApi(this.configuration());
+  // The token defaults to the stored one, refreshing and logging out pass the token they read already
+  public authApi(token: Token | undefined = this.getJwtToken()): AuthApi {
+    return new AuthApi(this.configuration(token));
   }
 
   public leaguesApi(): LeaguesApi {
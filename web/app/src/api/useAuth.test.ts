@@ -29,6 +29,7 @@ test('renders when not authenticated and requireAuth false', async () => {
 
   expect(hook!.result.current.user).toBeUndefined()
   expect(mockedNavigate).toBeCalledTimes(0)
+  expect(MockedApi.prototype.logout).toBeCalled()
 })
 
 test('redirects when not authenticated and requireAuth true', async () => {
@@ -26,7 +26,8 @@ export function useAuth(opts: AuthOptions): AuthState {
         setIsAuthenticated(true)
       } else {
         setIsAuthenticated(false)
-        api.clearJwtToken()
+        // logging out also removes the token cookies of an expired session
+        api.logout()
       }
     })
   }, [])
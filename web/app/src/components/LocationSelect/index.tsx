@@ -63,7 +63,7 @@ export function LocationSelect(props: LocationSelectProps) {
             label: location.name,
             value: location.id,
             type: "pinman",
-            pinballMapId: location.pinball_map_id.toString()
+            pinballMapId: location.pinball_map_id?.toString() ?? ""
           })
         ))
     }).catch((e: AxiosError) => {
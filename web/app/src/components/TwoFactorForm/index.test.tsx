@@ -0,0 +1,86 @@
+import {act, render} from "@testing-library/react";
+import React from "react";
+import {Simulate} from "react-dom/test-utils";
+import {Api} from "../../api";
+import {TwoFactorForm} from "./index";
+import {fake} from "../../test";
+
+jest.mock('../../api/api')
+const mockApi = jest.mocked(Api)
+
+beforeEach(() => {
+  mockApi.prototype.enrollTwoFactor.mockReset()
+  mockApi.prototype.verifyTwoFactor.mockReset()
+  mockApi.prototype.parseError.mockReset()
+})
+
+async function typeCode(result: ReturnType<typeof render>) {
+  const codeField = await result.findByPlaceholderText("Authentication code")
+  codeField.setAttribute("value", "123456")
+  await act(() => {
+    Simulate.change(codeField)
+  })
+}
+
+describe('TwoFactorForm', () => {
+  it('finishes the login with a code', async () => {
+    const onLoggedIn = jest.fn()
+    mockApi.prototype.verifyTwoFactor.mockResolvedValue(undefined)
+
+    const result = render(
+      <TwoFactorForm challenge={{challenge_token: "a-token", enrollment_required: false}}
+                     onLoggedIn={onLoggedIn} onError={jest.fn()}/>
+    )
+    await typeCode(result)
+    await act(() => {
+      result.getByTestId("verify").click()
+    })
+
+    expect(mockApi.prototype.verifyTwoFactor).toBeCalledWith({challenge_token: "a-token", code: "123456"})
+    expect(onLoggedIn).toBeCalled()
+    expect(mockApi.prototype.enrollTwoFactor).not.toBeCalled()
+  })
+
+  it('shows the secret and the recovery codes when enrolling', async () => {
+    const onLoggedIn = jest.fn()
+    mockApi.prototype.enrollTwoFactor.mockResolvedValue({secret: "ABCDEFGH", provisioning_uri: "otpauth://totp/x"})
+    mockApi.prototype.verifyTwoFactor.mockResolvedValue(["abcde-fghij", "klmno-pqrst"])
+
+    const result = render(
+      <TwoFactorForm challenge={{challenge_token: "a-token", enrollment_required: true}}
+                     onLoggedIn={onLoggedIn} onError={jest.fn()}/>
+    )
+    await result.findByText("ABCDEFGH")
+    await typeCode(result)
+    await act(() => {
+      result.getByTestId("verify").click()
+    })
+
+    expect(await result.findByTestId("recovery-codes")).toHaveTextContent("abcde-fghij")
+    expect(onLoggedIn).not.toBeCalled()
+
+    await act(() => {
+      result.getByTestId("continue").click()
+    })
+    expect(onLoggedIn).toBeCalled()
+  })
+
+  it('reports a wrong code', async () => {
+    const onError = jest.fn()
+    const error = fake.errorResponse()
+    mockApi.prototype.verifyTwoFactor.mockRejectedValue(new Error())
+    mockApi.prototype.parseError.mockReturnValue(error)
+    jest.spyOn(console, 'error').mockImplementation(jest.fn())
+
+    const result = render(
+      <TwoFactorForm challenge={{challenge_token: "a-token", enrollment_required: false}}
+                     onLoggedIn={jest.fn()} onError={onError}/>
+    )
+    await typeCode(result)
+    await act(() => {
+      result.getByTestId("verify").click()
+    })
+
+    expect(onError).toBeCalledWith({status: 'error', title: "Login failed", detail: error.detail})
+  })
+})
@@ -0,0 +1,99 @@
+import {Button, Code, FormControl, FormHelperText, Input, Stack, Text} from "@chakra-ui/react";
+import {ChangeEvent, FormEvent, useEffect, useState} from "react";
+import {AxiosError} from "axios";
+import {Api, TotpEnrollment, TwoFactorChallenge} from "../../api";
+import {AlertData} from "../Alert";
+
+const api = new Api()
+
+type TwoFactorFormProps = {
+  challenge: TwoFactorChallenge
+  onLoggedIn: () => void
+  onError: (alert?: AlertData) => void
+}
+
+// TwoFactorForm finishes a login that was answered with a two-factor challenge. Users who have to set up two-factor
+// authentication first are shown the secret for their authenticator app, and their recovery codes once it is enabled.
+export function TwoFactorForm(props: TwoFactorFormProps) {
+  const {challenge, onError} = props
+  const [code, setCode] = useState<string>("")
+  const [enrollment, setEnrollment] = useState<TotpEnrollment>()
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>()
+
+  useEffect(() => {
+    if (!challenge.enrollment_required)
+      return
+    api.enrollTwoFactor(challenge).then(setEnrollment).catch((e: AxiosError) => {
+      const err = api.parseError(e)
+      console.error(err)
+      onError({
+        status: 'error',
+        title: "Login failed",
+        detail: err.detail
+      })
+    })
+  }, [challenge, onError])
+
+  function onCodeChange(e: ChangeEvent<HTMLInputElement>) {
+    setCode(e.target.value)
+  }
+
+  function doVerify(event: FormEvent) {
+    onError(undefined)
+    event.preventDefault()
+    api.verifyTwoFactor({challenge_token: challenge.challenge_token, code: code}).then(codes => {
+      if (codes && codes.length > 0)
+        setRecoveryCodes(codes)
+      else
+        props.onLoggedIn()
+    }).catch((e: AxiosError) => {
+      const err = api.parseError(e)
+      console.error(err)
+      onError({
+        status: 'error',
+        title: "Login failed",
+        detail: err.detail
+      })
+    })
+  }
+
+  if (recoveryCodes) {
+    return (
+      <Stack spacing={4}>
+        <Text>
+          Two-factor authentication is enabled. Keep these recovery codes somewhere safe, each of them can be used once
+          if you lose access to your authenticator app.
+        </Text>
+        <Code data-testid="recovery-codes" whiteSpace="pre" p={2}>{recoveryCodes.join("\n")}</Code>
+        <Button borderRadius={0} width="full" onClick={props.onLoggedIn} data-testid="continue">
+          Continue
+        </Button>
+      </Stack>
+    )
+  }
+
+  return (
+    <form onSubmit={doVerify}>
+      <Stack spacing={4}>
+        {challenge.enrollment_required && (
+          <Text>
+            Your account requires two-factor authentication. Add this key to your authenticator app, then enter the
+            code it shows.
+          </Text>
+        )}
+        {enrollment && (
+          <Code data-testid="totp-secret" p={2}>{enrollment.secret}</Code>
+        )}
+        <FormControl>
+          <Input placeholder="Authentication code" autoComplete="one-time-code" onChange={onCodeChange} required/>
+          {!challenge.enrollment_required && (
+            <FormHelperText>Enter the code from your authenticator app or one of your recovery codes</FormHelperText>
+          )}
+        </FormControl>
+        <Button borderRadius={0} type="submit" variant="solid" width="full" data-testid="verify">
+          Verify
+        </Button>
+      </Stack>
+    </form>
+  )
+}
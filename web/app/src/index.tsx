@@ -10,6 +10,10 @@ import AuthTest from "./pages/AuthTest";
 import SignUpPage from "./pages/SignUp";
 import LeagueListPage from "./pages/Leagues";
 import TournamentsListPage from "./pages/Tournaments";
+import OidcCallbackPage from "./pages/OidcCallback";
+import VerifyEmailPage from "./pages/VerifyEmail";
+import ForgotPasswordPage from "./pages/ForgotPassword";
+import ResetPasswordPage from "./pages/ResetPassword";
 
 const root = ReactDOM.createRoot(
   document.getElementById('root') as HTMLElement
@@ -33,7 +37,11 @@ function Router() {
         <Route path="/leagues" element={<LeagueListPage/>}/>
         <Route path={"/leagues/create"} element={<LeagueListPage createFormOpen={true} />}/>
         <Route path={"/login"} element={<Login/>}/>
+        <Route path={"/login/oidc"} element={<OidcCallbackPage/>}/>
         <Route path={"/signup"} element={<SignUpPage/>}/>
+        <Route path={"/verify-email"} element={<VerifyEmailPage/>}/>
+        <Route path={"/forgot-password"} element={<ForgotPasswordPage/>}/>
+        <Route path={"/reset-password"} element={<ResetPasswordPage/>}/>
         <Route path={"/authenticated"} element={<AuthTest/>}/>
       </Routes>
     </BrowserRouter>
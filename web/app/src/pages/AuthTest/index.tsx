@@ -14,7 +14,7 @@ export default function AuthTest() {
       <h1>User is authenticated</h1>
       <pre>{JSON.stringify(user, null, 2)}</pre>
       <Button variant='outline' marginLeft={"2em"} onClick={() => {
-        api.clearJwtToken()
+        api.logout()
         navigate("/login")
       }}>
         Logout
@@ -0,0 +1,65 @@
+import {act, render} from "@testing-library/react";
+import ForgotPasswordPage from "./index";
+import {MemoryRouter} from "react-router-dom";
+import React from "react";
+import {Api} from "../../api";
+import {faker} from "@faker-js/faker";
+import {Simulate} from "react-dom/test-utils";
+import {fake} from "../../test";
+import {AxiosError} from "axios";
+
+jest.mock('../../api/api')
+const mockApi = jest.mocked(Api)
+
+const mockAuthPasswordForgotPost = jest.fn()
+
+beforeEach(() => {
+  mockAuthPasswordForgotPost.mockReset()
+  mockApi.prototype.parseError.mockReset()
+  mockApi.prototype.authApi.mockReturnValue({
+    authPasswordForgotPost: mockAuthPasswordForgotPost
+  } as any)
+})
+
+describe('ForgotPasswordPage', () => {
+  async function submit() {
+    const result = render(
+      <MemoryRouter initialEntries={['/forgot-password']}>
+        <ForgotPasswordPage/>
+      </MemoryRouter>
+    )
+
+    const email = faker.internet.email()
+    const emailField = await result.findByPlaceholderText("email address")
+    emailField.setAttribute("value", email)
+    await act(() => {
+      Simulate.change(emailField)
+    })
+
+    const button = await result.findByTestId("send reset link")
+    await act(() => {
+      button.click()
+    })
+
+    return {result, email}
+  }
+
+  it('sends a reset link', async () => {
+    mockAuthPasswordForgotPost.mockResolvedValue({status: 204})
+
+    const {result, email} = await submit()
+
+    await result.findByText("If an account uses this email address, a link to reset its password was sent to it")
+    expect(mockAuthPasswordForgotPost).toBeCalledWith({email: email})
+  })
+
+  it('shows an error if the request fails', async () => {
+    const error = fake.errorResponse()
+    mockAuthPasswordForgotPost.mockRejectedValue(new AxiosError())
+    mockApi.prototype.parseError.mockReturnValue(error)
+
+    const {result} = await submit()
+
+    await result.findByText(error.detail)
+  })
+})
@@ -0,0 +1,79 @@
+import {
+  Button,
+  FormControl,
+  Input,
+  InputGroup,
+  InputLeftElement,
+  Link,
+  Stack,
+  Text,
+} from "@chakra-ui/react";
+import {AtSignIcon} from "@chakra-ui/icons";
+import {Api} from "../../api"
+import {ChangeEvent, FormEvent, useState} from "react";
+import {Link as ReactLink} from "react-router-dom";
+import {AxiosError} from "axios";
+import AuthLayout from "../../layouts/auth";
+import {AlertData} from "../../components/Alert";
+
+const api = new Api();
+
+export default function ForgotPasswordPage() {
+  const [email, setEmail] = useState("");
+  const [alert, setAlert] = useState<AlertData>()
+
+  function onEmailChange(e: ChangeEvent<HTMLInputElement>) {
+    setEmail(e.target.value)
+  }
+
+  function doForgotPassword(event: FormEvent) {
+    setAlert(undefined)
+    event.preventDefault()
+    api.authApi().authPasswordForgotPost({email: email}).then(() => {
+      setAlert({
+        status: "success",
+        title: "Success",
+        detail: "If an account uses this email address, a link to reset its password was sent to it"
+      })
+    }).catch((e: AxiosError) => {
+      const err = api.parseError(e)
+      console.error(err)
+      setAlert({
+        status: "error",
+        title: err.title,
+        detail: err.detail
+      })
+    })
+  }
+
+  return (
+    <AuthLayout title={"Forgot password"} alert={alert}>
+      <form onSubmit={doForgotPassword}>
+        <Stack spacing={4}>
+          <FormControl>
+            <InputGroup>
+              <InputLeftElement
+                pointerEvents="none"
+                children={<AtSignIcon/>}
+              />
+              <Input type="email" placeholder="email address"
+                     onChange={onEmailChange} required/>
+            </InputGroup>
+          </FormControl>
+          <Button
+            borderRadius={0}
+            type="submit"
+            variant="solid"
+            width="full"
+            data-testid="send reset link"
+          >
+            Send reset link
+          </Button>
+          <Text textAlign={"center"}>
+            <Link as={ReactLink} to={"/login"}>Back to sign in</Link>
+          </Text>
+        </Stack>
+      </form>
+    </AuthLayout>
+  );
+}
@@ -21,6 +21,7 @@ const mockApi = jest.mocked(Api)
 
 beforeEach(() => {
   mockApi.prototype.login.mockReset()
+  mockApi.prototype.startOidcLogin.mockReset()
   mockApi.prototype.parseError.mockReset()
   mockNavigate.mockReset()
   mockUseAuth.mockReset()
@@ -47,6 +48,16 @@ describe('LoginPage', () => {
     await result.findAllByText("Account created, please log in")
   })
 
+  it('shows success message if reset=true', async () => {
+    mockUseAuth.mockReturnValue({user: undefined})
+    const result = render(
+      <MemoryRouter initialEntries={['/login?reset=true']}>
+        <LoginPage/>
+      </MemoryRouter>
+    )
+    await result.findAllByText("Password changed, please log in")
+  })
+
   it('redirects to /authenticated if user is signed-in', async () => {
     const mockUser = fake.user()
     mockUseAuth.mockReturnValue({
@@ -80,7 +91,7 @@ describe('LoginPage', () => {
 
   it('redirects to /navigate if user login was successful', async () => {
     mockUseAuth.mockReturnValue({user: undefined})
-    mockApi.prototype.login.mockResolvedValue(true)
+    mockApi.prototype.login.mockResolvedValue(undefined)
 
     const result = render(
       <MemoryRouter>
@@ -95,6 +106,26 @@ describe('LoginPage', () => {
     expect(mockNavigate).toBeCalledWith("/authenticated")
   })
 
+  it('asks for the two-factor authentication code', async () => {
+    mockUseAuth.mockReturnValue({user: undefined})
+    mockApi.prototype.login.mockResolvedValue({challenge_token: "a-token", enrollment_required: false})
+
+    const result = render(
+      <MemoryRouter>
+        <LoginPage/>
+      </MemoryRouter>
+    )
+
+    await typeLoginInfo(result)
+
+    await act(() => {
+      result.getByTestId("login").click()
+    })
+
+    await result.findByPlaceholderText("Authentication code")
+    expect(mockNavigate).not.toBeCalled()
+  })
+
   it('displays error message if login fails', async () => {
     const mockError = fake.errorResponse()
 
@@ -121,4 +152,21 @@ describe('LoginPage', () => {
     expect(logSpy).toBeCalled()
 
   })
+
+  it('starts the login with the OpenID Connect provider', async () => {
+    mockUseAuth.mockReturnValue({user: undefined})
+    mockApi.prototype.startOidcLogin.mockResolvedValue()
+
+    const result = render(
+      <MemoryRouter>
+        <LoginPage/>
+      </MemoryRouter>
+    )
+
+    await act(() => {
+      result.getByTestId("oidc-login").click()
+    })
+
+    expect(mockApi.prototype.startOidcLogin).toBeCalled()
+  })
 })
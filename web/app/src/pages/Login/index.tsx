@@ -10,12 +10,13 @@ import {
   Text,
 } from "@chakra-ui/react";
 import {AtSignIcon, LockIcon} from "@chakra-ui/icons";
-import {Api, UserLogin, useAuth} from "../../api"
+import {Api, TwoFactorChallenge, UserLogin, useAuth} from "../../api"
 import {ChangeEvent, FormEvent, useEffect, useState} from "react";
 import {useNavigate} from "react-router-dom";
 import {AxiosError} from "axios";
 import AuthLayout from "../../layouts/auth";
 import {AlertData} from "../../components/Alert";
+import {TwoFactorForm} from "../../components/TwoFactorForm";
 import {Link as ReactLink, useSearchParams} from "react-router-dom";
 
 const api = new Api();
@@ -28,6 +29,7 @@ export default function LoginPage() {
 
   const [loginData, setLoginData] = useState<UserLogin>({username: "", password: ""});
   const [alert, setAlert] = useState<AlertData>()
+  const [challenge, setChallenge] = useState<TwoFactorChallenge>()
 
   useEffect(() => {
     if (searchParams.get("registered") === "true")
@@ -36,6 +38,12 @@ export default function LoginPage() {
         title: 'Success',
         detail: 'Account created, please log in'
       })
+    else if (searchParams.get("reset") === "true")
+      setAlert({
+        status: 'success',
+        title: 'Success',
+        detail: 'Password changed, please log in'
+      })
   }, [searchParams])
 
   useEffect(() => {
@@ -61,8 +69,11 @@ export default function LoginPage() {
   function doLogin(event: FormEvent) {
     setAlert(undefined)
     event.preventDefault()
-    api.login(loginData).then(() => {
-      navigate("/authenticated");
+    api.login(loginData).then(challenge => {
+      if (challenge)
+        setChallenge(challenge)
+      else
+        navigate("/authenticated");
     }).catch((e: AxiosError) => {
       const err = api.parseError(e)
       console.error(err)
@@ -74,6 +85,27 @@ export default function LoginPage() {
     })
   }
 
+  function doOidcLogin() {
+    setAlert(undefined)
+    api.startOidcLogin().catch((e: AxiosError) => {
+      const err = api.parseError(e)
+      console.error(err)
+      setAlert({
+        status: 'error',
+        title: "Login failed",
+        detail: err.detail
+      })
+    })
+  }
+
+  if (challenge) {
+    return (
+      <AuthLayout title={"Login"} alert={alert}>
+        <TwoFactorForm challenge={challenge} onLoggedIn={() => navigate("/authenticated")} onError={setAlert}/>
+      </AuthLayout>
+    );
+  }
+
   return (
     <AuthLayout title={"Login"} alert={alert}>
       <form onSubmit={doLogin}>
@@ -102,7 +134,7 @@ export default function LoginPage() {
               />
             </InputGroup>
             <FormHelperText textAlign="right">
-              <Link>forgot password?</Link>
+              <Link as={ReactLink} to={"/forgot-password"}>forgot password?</Link>
             </FormHelperText>
           </FormControl>
           <Button
@@ -114,6 +146,15 @@ export default function LoginPage() {
           >
             Login
           </Button>
+          <Button
+            borderRadius={0}
+            variant="outline"
+            width="full"
+            onClick={doOidcLogin}
+            data-testid="oidc-login"
+          >
+            Sign in with SSO
+          </Button>
           <Text textAlign={"center"}>
             New here? <Link as={ReactLink} to={"/signup"}>Create an account</Link>
           </Text>
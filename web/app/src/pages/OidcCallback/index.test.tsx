@@ -0,0 +1,93 @@
+import {render, waitFor} from "@testing-library/react";
+import OidcCallbackPage from "./index";
+import {MemoryRouter} from "react-router-dom";
+import React from "react";
+import {Api, OIDC_STATE_KEY} from "../../api";
+import {fake} from "../../test";
+import {AxiosError} from "axios";
+
+const mockNavigate = jest.fn()
+jest.mock('react-router-dom', () => ({
+  ...(jest.requireActual('react-router-dom')),
+  useNavigate: () => mockNavigate
+}))
+
+jest.mock('../../api/api')
+const mockApi = jest.mocked(Api)
+
+beforeEach(() => {
+  mockNavigate.mockReset()
+  mockApi.prototype.oidcLogin.mockReset()
+  mockApi.prototype.parseError.mockReset()
+  sessionStorage.clear()
+})
+
+describe('OidcCallbackPage', () => {
+  it('finishes the login started by this browser', async () => {
+    sessionStorage.setItem(OIDC_STATE_KEY, "a-state")
+    mockApi.prototype.oidcLogin.mockResolvedValue(undefined)
+
+    render(
+      <MemoryRouter initialEntries={['/login/oidc?code=a-code&state=a-state']}>
+        <OidcCallbackPage/>
+      </MemoryRouter>
+    )
+
+    await waitFor(() => expect(mockNavigate).toBeCalledWith("/authenticated"))
+    expect(mockApi.prototype.oidcLogin).toBeCalledWith({code: "a-code", state: "a-state"})
+    expect(sessionStorage.getItem(OIDC_STATE_KEY)).toBeNull()
+  })
+
+  it('asks for the two-factor authentication code', async () => {
+    sessionStorage.setItem(OIDC_STATE_KEY, "a-state")
+    mockApi.prototype.oidcLogin.mockResolvedValue({challenge_token: "a-token", enrollment_required: false})
+
+    const result = render(
+      <MemoryRouter initialEntries={['/login/oidc?code=a-code&state=a-state']}>
+        <OidcCallbackPage/>
+      </MemoryRouter>
+    )
+
+    await result.findByPlaceholderText("Authentication code")
+    expect(mockNavigate).not.toBeCalled()
+  })
+
+  it('rejects a state this browser did not start a login with', async () => {
+    sessionStorage.setItem(OIDC_STATE_KEY, "a-state")
+
+    const result = render(
+      <MemoryRouter initialEntries={['/login/oidc?code=a-code&state=another-state']}>
+        <OidcCallbackPage/>
+      </MemoryRouter>
+    )
+
+    await result.findByText("The login could not be verified, please try again")
+    expect(mockApi.prototype.oidcLogin).not.toBeCalled()
+  })
+
+  it('shows the error returned by the provider', async () => {
+    const result = render(
+      <MemoryRouter initialEntries={['/login/oidc?error=access_denied&error_description=consent+denied']}>
+        <OidcCallbackPage/>
+      </MemoryRouter>
+    )
+
+    await result.findByText("consent denied")
+    expect(mockApi.prototype.oidcLogin).not.toBeCalled()
+  })
+
+  it('shows an error if the login fails', async () => {
+    sessionStorage.setItem(OIDC_STATE_KEY, "a-state")
+    const error = fake.errorResponse()
+    mockApi.prototype.oidcLogin.mockRejectedValue(new AxiosError())
+    mockApi.prototype.parseError.mockReturnValue(error)
+
+    const result = render(
+      <MemoryRouter initialEntries={['/login/oidc?code=a-code&state=a-state']}>
+        <OidcCallbackPage/>
+      </MemoryRouter>
+    )
+
+    await result.findByText(error.detail)
+  })
+})
@@ -0,0 +1,77 @@
+import {Link, Spinner, Stack, Text} from "@chakra-ui/react";
+import {Api, OIDC_STATE_KEY, TwoFactorChallenge} from "../../api"
+import {useEffect, useState} from "react";
+import {Link as ReactLink, useNavigate, useSearchParams} from "react-router-dom";
+import {AxiosError} from "axios";
+import AuthLayout from "../../layouts/auth";
+import {AlertData} from "../../components/Alert";
+import {TwoFactorForm} from "../../components/TwoFactorForm";
+
+const api = new Api();
+
+export default function OidcCallbackPage() {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const [alert, setAlert] = useState<AlertData>()
+  const [challenge, setChallenge] = useState<TwoFactorChallenge>()
+
+  useEffect(() => {
+    const state = searchParams.get("state") ?? ""
+    const expectedState = sessionStorage.getItem(OIDC_STATE_KEY)
+    sessionStorage.removeItem(OIDC_STATE_KEY)
+
+    // the provider sends errors like a denied consent as query parameters
+    if (searchParams.get("error")) {
+      setAlert({
+        status: "error",
+        title: "Login failed",
+        detail: searchParams.get("error_description") ?? searchParams.get("error") ?? ""
+      })
+      return
+    }
+
+    // only finish logins this browser started
+    if (!state || state !== expectedState) {
+      setAlert({
+        status: "error",
+        title: "Login failed",
+        detail: "The login could not be verified, please try again"
+      })
+      return
+    }
+
+    api.oidcLogin({code: searchParams.get("code") ?? "", state: state}).then(challenge => {
+      if (challenge)
+        setChallenge(challenge)
+      else
+        navigate("/authenticated")
+    }).catch((e: AxiosError) => {
+      const err = api.parseError(e)
+      console.error(err)
+      setAlert({
+        status: "error",
+        title: "Login failed",
+        detail: err.detail
+      })
+    })
+  }, [searchParams, navigate])
+
+  if (challenge) {
+    return (
+      <AuthLayout title={"Login"} alert={alert}>
+        <TwoFactorForm challenge={challenge} onLoggedIn={() => navigate("/authenticated")} onError={setAlert}/>
+      </AuthLayout>
+    );
+  }
+
+  return (
+    <AuthLayout title={"Login"} alert={alert}>
+      <Stack spacing={4} alignItems={"center"}>
+        {!alert && <Spinner/>}
+        <Text textAlign={"center"}>
+          <Link as={ReactLink} to={"/login"}>Back to sign in</Link>
+        </Text>
+      </Stack>
+    </AuthLayout>
+  );
+}
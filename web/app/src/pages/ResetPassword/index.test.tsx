@@ -0,0 +1,87 @@
+import {act, render, RenderResult} from "@testing-library/react";
+import ResetPasswordPage from "./index";
+import {MemoryRouter} from "react-router-dom";
+import React from "react";
+import {Api} from "../../api";
+import {Simulate} from "react-dom/test-utils";
+import {fake} from "../../test";
+import {AxiosError} from "axios";
+
+const mockNavigate = jest.fn()
+jest.mock('react-router-dom', () => ({
+  ...(jest.requireActual('react-router-dom')),
+  useNavigate: () => mockNavigate
+}))
+
+jest.mock('../../api/api')
+const mockApi = jest.mocked(Api)
+
+const mockAuthPasswordResetPost = jest.fn()
+
+beforeEach(() => {
+  mockNavigate.mockReset()
+  mockAuthPasswordResetPost.mockReset()
+  mockApi.prototype.parseError.mockReset()
+  mockApi.prototype.authApi.mockReturnValue({
+    authPasswordResetPost: mockAuthPasswordResetPost
+  } as any)
+})
+
+describe('ResetPasswordPage', () => {
+  async function submit(password: string, passwordConfirm: string): Promise<RenderResult> {
+    const result = render(
+      <MemoryRouter initialEntries={['/reset-password?token=abc']}>
+        <ResetPasswordPage/>
+      </MemoryRouter>
+    )
+
+    const passwordField = await result.findByPlaceholderText("new password")
+    passwordField.setAttribute("value", password)
+    await act(() => {
+      Simulate.change(passwordField)
+    })
+
+    const confirmField = await result.findByPlaceholderText("confirm new password")
+    confirmField.setAttribute("value", passwordConfirm)
+    await act(() => {
+      Simulate.change(confirmField)
+    })
+
+    const button = await result.findByTestId("reset password")
+    await act(() => {
+      button.click()
+    })
+
+    return result
+  }
+
+  it('resets the password and redirects to login', async () => {
+    mockAuthPasswordResetPost.mockResolvedValue({status: 204})
+
+    await submit("new password", "new password")
+
+    expect(mockAuthPasswordResetPost).toBeCalledWith({
+      token: "abc",
+      password: "new password",
+      passwordConfirm: "new password"
+    })
+    expect(mockNavigate).toBeCalledWith("/login?reset=true")
+  })
+
+  it('shows an error if the passwords do not match', async () => {
+    const result = await submit("new password", "other password")
+
+    await result.findByText("Password confirmation does not match")
+    expect(mockAuthPasswordResetPost).not.toBeCalled()
+  })
+
+  it('shows an error if the token is invalid', async () => {
+    const error = fake.errorResponse()
+    mockAuthPasswordResetPost.mockRejectedValue(new AxiosError())
+    mockApi.prototype.parseError.mockReturnValue(error)
+
+    const result = await submit("new password", "new password")
+
+    await result.findByText(error.detail)
+  })
+})
@@ -0,0 +1,105 @@
+import {
+  Button,
+  FormControl,
+  Input,
+  InputGroup,
+  Stack,
+} from "@chakra-ui/react";
+import {Api, PasswordReset} from "../../api"
+import {ChangeEvent, FormEvent, useState} from "react";
+import {useNavigate, useSearchParams} from "react-router-dom";
+import {AxiosError} from "axios";
+import AuthLayout from "../../layouts/auth";
+import {AlertData} from "../../components/Alert";
+
+const api = new Api();
+
+export default function ResetPasswordPage() {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+
+  const [resetData, setResetData] = useState<PasswordReset>({
+    token: searchParams.get("token") ?? "",
+    password: "",
+    passwordConfirm: "",
+  });
+  const [alert, setAlert] = useState<AlertData>()
+
+  function onPasswordChange(e: ChangeEvent<HTMLInputElement>) {
+    setResetData({
+      ...resetData,
+      password: e.target.value
+    })
+  }
+
+  function onPasswordConfirmChange(e: ChangeEvent<HTMLInputElement>) {
+    setResetData({
+      ...resetData,
+      passwordConfirm: e.target.value
+    })
+  }
+
+  function doResetPassword(event: FormEvent) {
+    setAlert(undefined)
+    event.preventDefault()
+
+    if (resetData.password !== resetData.passwordConfirm) {
+      setAlert({
+        status: "error",
+        title: "Error",
+        detail: "Password confirmation does not match"
+      })
+      return
+    }
+
+    api.authApi().authPasswordResetPost(resetData).then(() => {
+      navigate("/login?reset=true");
+    }).catch((e: AxiosError) => {
+      const err = api.parseError(e)
+      console.error(err)
+      setAlert({
+        status: "error",
+        title: err.title,
+        detail: err.detail
+      })
+    })
+  }
+
+  return (
+    <AuthLayout title={"Reset password"} alert={alert}>
+      <form onSubmit={doResetPassword}>
+        <Stack spacing={4}>
+          <FormControl>
+            <InputGroup>
+              <Input
+                type={"password"}
+                placeholder="new password"
+                onChange={onPasswordChange}
+                required
+              />
+            </InputGroup>
+          </FormControl>
+          <FormControl>
+            <InputGroup>
+              <Input
+                type={"password"}
+                placeholder="confirm new password"
+                onChange={onPasswordConfirmChange}
+                required
+              />
+            </InputGroup>
+          </FormControl>
+          <Button
+            borderRadius={0}
+            type="submit"
+            variant="solid"
+            width="full"
+            data-testid="reset password"
+          >
+            Reset password
+          </Button>
+        </Stack>
+      </form>
+    </AuthLayout>
+  );
+}
@@ -0,0 +1,49 @@
+import {render} from "@testing-library/react";
+import VerifyEmailPage from "./index";
+import {MemoryRouter} from "react-router-dom";
+import React from "react";
+import {Api} from "../../api";
+import {fake} from "../../test";
+import {AxiosError} from "axios";
+
+jest.mock('../../api/api')
+const mockApi = jest.mocked(Api)
+
+const mockUsersVerifyPost = jest.fn()
+
+beforeEach(() => {
+  mockUsersVerifyPost.mockReset()
+  mockApi.prototype.parseError.mockReset()
+  mockApi.prototype.userApi.mockReturnValue({
+    usersVerifyPost: mockUsersVerifyPost
+  } as any)
+})
+
+describe('VerifyEmailPage', () => {
+  it('verifies the token from the link', async () => {
+    mockUsersVerifyPost.mockResolvedValue({status: 200, data: {user: fake.user()}})
+
+    const result = render(
+      <MemoryRouter initialEntries={['/verify-email?token=abc']}>
+        <VerifyEmailPage/>
+      </MemoryRouter>
+    )
+
+    await result.findByText("Your email address has been verified")
+    expect(mockUsersVerifyPost).toBeCalledWith({token: "abc"})
+  })
+
+  it('shows an error if the token is invalid', async () => {
+    const error = fake.errorResponse()
+    mockUsersVerifyPost.mockRejectedValue(new AxiosError())
+    mockApi.prototype.parseError.mockReturnValue(error)
+
+    const result = render(
+      <MemoryRouter initialEntries={['/verify-email?token=abc']}>
+        <VerifyEmailPage/>
+      </MemoryRouter>
+    )
+
+    await result.findByText(error.detail)
+  })
+})
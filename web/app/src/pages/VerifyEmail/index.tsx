@@ -0,0 +1,43 @@
+import {Link, Spinner, Stack, Text} from "@chakra-ui/react";
+import {Api} from "../../api"
+import {useEffect, useState} from "react";
+import {Link as ReactLink, useSearchParams} from "react-router-dom";
+import {AxiosError} from "axios";
+import AuthLayout from "../../layouts/auth";
+import {AlertData} from "../../components/Alert";
+
+const api = new Api();
+
+export default function VerifyEmailPage() {
+  const [searchParams] = useSearchParams();
+  const [alert, setAlert] = useState<AlertData>()
+
+  useEffect(() => {
+    api.userApi().usersVerifyPost({token: searchParams.get("token") ?? ""}).then(() => {
+      setAlert({
+        status: "success",
+        title: "Success",
+        detail: "Your email address has been verified"
+      })
+    }).catch((e: AxiosError) => {
+      const err = api.parseError(e)
+      console.error(err)
+      setAlert({
+        status: "error",
+        title: err.title,
+        detail: err.detail
+      })
+    })
+  }, [searchParams])
+
+  return (
+    <AuthLayout title={"Verify email"} alert={alert}>
+      <Stack spacing={4} alignItems={"center"}>
+        {!alert && <Spinner/>}
+        <Text textAlign={"center"}>
+          <Link as={ReactLink} to={"/login"}>Back to sign in</Link>
+        </Text>
+      </Stack>
+    </AuthLayout>
+  );
+}
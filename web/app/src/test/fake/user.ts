@@ -7,6 +7,7 @@ export function user(): User {
     email: faker.internet.email(),
     id: faker.datatype.uuid(),
     role: "user",
+    verified: true,
     created_at: faker.date.recent(5).toISOString(),
     updated_at: faker.date.recent(1).toISOString()
   }